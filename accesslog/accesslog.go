@@ -0,0 +1,243 @@
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/tracing"
+	"github.com/rancher/netes/types"
+	"gopkg.in/natefinch/lumberjack.v2"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+var (
+	writersLock sync.Mutex
+	// the clusters share the log file, entries are written whole so they don't interleave
+	writers = map[string]*lockedWriter{}
+)
+
+// Entry is a line of the access log
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Cluster     string    `json:"cluster"`
+	User        string    `json:"user,omitempty"`
+	Verb        string    `json:"verb,omitempty"`
+	Resource    string    `json:"resource,omitempty"`
+	Subresource string    `json:"subresource,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Method      string    `json:"method"`
+	URI         string    `json:"uri"`
+	Code        int       `json:"code"`
+	Latency     float64   `json:"latencySeconds"`
+	Bytes       int64     `json:"bytes"`
+	SourceIP    string    `json:"sourceIP,omitempty"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	RequestID   string    `json:"requestID,omitempty"`
+	// Reason is why netes rejected the request before the apiserver of the cluster saw it
+	Reason string `json:"reason,omitempty"`
+}
+
+// Filter writes a JSON line per request of a cluster to the access log, if the cluster has it enabled.  A share
+// of the requests given by the sample ratio is logged, server errors always are.  Whether the cluster is logged
+// and its sample ratio are read per request so a reload of the config file applies to running clusters.  It must
+// run after the request info is resolved.
+func Filter(config *types.GlobalConfig, cluster *client.Cluster, handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	if config.AccessLogPath == "" {
+		return handler
+	}
+	if value := cluster.K8sServerConfig.AccessLogSampleRatio; value != "" {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			logrus.Warnf("Ignoring invalid access log sample ratio %q of cluster %s: %v", value, cluster.Id, err)
+		}
+	}
+	out := writer(config.AccessLogPath)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !Enabled(config, cluster) {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		ratio := sampleRatio(config, cluster)
+
+		start := time.Now()
+		delegate := &responseWriterDelegator{ResponseWriter: rw}
+		handler.ServeHTTP(wrap(delegate), req)
+
+		code := delegate.status()
+		if code < http.StatusInternalServerError && rand.Float64() >= ratio {
+			return
+		}
+
+		entry := &Entry{
+			Time:      start.UTC(),
+			Cluster:   cluster.Id,
+			Method:    req.Method,
+			URI:       req.URL.RequestURI(),
+			Code:      code,
+			Latency:   time.Since(start).Seconds(),
+			Bytes:     delegate.written,
+			UserAgent: req.UserAgent(),
+			RequestID: tracing.FromContext(req.Context()).TraceID(),
+		}
+		if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+			entry.SourceIP = host
+		}
+		if ctx, ok := mapper.Get(req); ok {
+			if requestInfo, ok := apirequest.RequestInfoFrom(ctx); ok {
+				entry.Verb = requestInfo.Verb
+				entry.Resource = requestInfo.Resource
+				entry.Subresource = requestInfo.Subresource
+				entry.Namespace = requestInfo.Namespace
+				entry.Name = requestInfo.Name
+			}
+			if user, ok := apirequest.UserFrom(ctx); ok {
+				entry.User = user.GetName()
+			}
+		}
+
+		write(out, entry)
+	})
+}
+
+// Record writes an entry to the access log whatever the settings of the cluster are, for requests that must
+// leave a record like the ones rejected by netes
+func Record(config *types.GlobalConfig, entry *Entry) {
+	if config.AccessLogPath != "" {
+		write(writer(config.AccessLogPath), entry)
+	}
+}
+
+func write(out io.Writer, entry *Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logrus.Errorf("Failed to encode access log entry of cluster %s: %v", entry.Cluster, err)
+		return
+	}
+	out.Write(append(line, '\n'))
+}
+
+// Enabled is whether requests of the cluster are logged.  The access log of a cluster is enabled or disabled in
+// Rancher with "true" or "false", clusters without either follow the global default.
+func Enabled(config *types.GlobalConfig, cluster *client.Cluster) bool {
+	if config.AccessLogPath == "" {
+		return false
+	}
+	switch cluster.K8sServerConfig.AccessLog {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	config.Reloading.RLock()
+	defer config.Reloading.RUnlock()
+	return config.AccessLogByDefault
+}
+
+func sampleRatio(config *types.GlobalConfig, cluster *client.Cluster) float64 {
+	if value := cluster.K8sServerConfig.AccessLogSampleRatio; value != "" {
+		if ratio, err := strconv.ParseFloat(value, 64); err == nil {
+			return ratio
+		}
+	}
+	config.Reloading.RLock()
+	defer config.Reloading.RUnlock()
+	return config.AccessLogSampleRatio
+}
+
+type lockedWriter struct {
+	sync.Mutex
+	out io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.out.Write(p)
+}
+
+func writer(path string) io.Writer {
+	writersLock.Lock()
+	defer writersLock.Unlock()
+
+	w, ok := writers[path]
+	if !ok {
+		var out io.Writer = os.Stdout
+		if path != "-" {
+			out = &lumberjack.Logger{
+				Filename: path,
+			}
+		}
+		w = &lockedWriter{out: out}
+		writers[path] = w
+	}
+	return w
+}
+
+// wrap keeps the optional interfaces of the response writer, watches need to flush and exec to hijack
+func wrap(delegate *responseWriterDelegator) http.ResponseWriter {
+	_, closeNotifier := delegate.ResponseWriter.(http.CloseNotifier)
+	_, flusher := delegate.ResponseWriter.(http.Flusher)
+	_, hijacker := delegate.ResponseWriter.(http.Hijacker)
+	if closeNotifier && flusher && hijacker {
+		return &fancyResponseWriterDelegator{delegate}
+	}
+	return delegate
+}
+
+// responseWriterDelegator records the status and size of a response, the bytes of hijacked connections aren't
+// counted
+type responseWriterDelegator struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	written     int64
+}
+
+func (r *responseWriterDelegator) WriteHeader(code int) {
+	r.code = code
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseWriterDelegator) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.written += int64(n)
+	return n, err
+}
+
+func (r *responseWriterDelegator) status() int {
+	if !r.wroteHeader {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+type fancyResponseWriterDelegator struct {
+	*responseWriterDelegator
+}
+
+func (f *fancyResponseWriterDelegator) CloseNotify() <-chan bool {
+	return f.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (f *fancyResponseWriterDelegator) Flush() {
+	f.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (f *fancyResponseWriterDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return f.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,428 @@
+package acmecert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/shard"
+	"github.com/rancher/netes/sni"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/types"
+	"golang.org/x/crypto/acme"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	accountKey        = "/netes/acme/account"
+	certificatePrefix = "/netes/acme/certificates/"
+	challengePrefix   = "/netes/acme/challenges/"
+
+	syncInterval = 10 * time.Minute
+	// how long the replicas serve a certificate before reading it again, renewed ones are picked up this late
+	cacheTTL    = time.Minute
+	renewBefore = 30 * 24 * time.Hour
+	// failed orders are retried with backoff, Let's Encrypt limits failed validations per host and hour
+	minBackoff   = time.Hour
+	maxBackoff   = 24 * time.Hour
+	orderTimeout = 5 * time.Minute
+)
+
+// record is a certificate of the hosts of a cluster as stored in the database, under each of the hosts
+type record struct {
+	Hosts    []string  `json:"hosts"`
+	Chain    [][]byte  `json:"chain"`
+	Key      []byte    `json:"key"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+type cached struct {
+	certificate *tls.Certificate
+	loaded      time.Time
+}
+
+type failure struct {
+	backoff time.Duration
+	next    time.Time
+}
+
+// Manager obtains certificates for the hosts of the clusters under the cluster domain from an ACME CA, like
+// Let's Encrypt, and renews them a month before they expire.  Certificates are stored in the database so every
+// netes serves them, the hosts are validated with TLS-ALPN-01 so the CA has to reach netes on port 443 of the
+// hosts, with netes terminating TLS.  A wildcard DNS record of the cluster domain pointing at netes is enough.
+type Manager struct {
+	sync.Mutex
+	config   *types.GlobalConfig
+	rancher  *rancher.Client
+	shards   *shard.Coordinator
+	kv       kv.Client
+	client   *acme.Client
+	cache    map[string]cached
+	failures map[string]*failure
+}
+
+// New returns nil unless a cluster domain and ACME directory are configured
+func New(config *types.GlobalConfig) (*Manager, error) {
+	if config.ClusterDomain == "" || config.ACMEDirectoryURL == "" {
+		return nil, nil
+	}
+
+	kvClient, err := store.Client(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		config:   config,
+		rancher:  config.RancherClient,
+		shards:   config.Shards,
+		kv:       kvClient,
+		cache:    map[string]cached{},
+		failures: map[string]*failure{},
+	}, nil
+}
+
+// Start obtains and renews the certificates of the clusters, with shards only of the clusters this replica holds
+func (m *Manager) Start(ctx context.Context) {
+	go wait.Until(func() {
+		if err := m.sync(ctx); err != nil {
+			logrus.Errorf("Failed to obtain ACME certificates: %v", err)
+		}
+	}, syncInterval, ctx.Done())
+}
+
+// GetCertificate serves the certificates of the cluster hosts and answers the TLS-ALPN-01 challenges of the CA,
+// hosts without a certificate get the default certificate of the listener
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if sni.ClusterLabel(hello.ServerName, m.config.ClusterDomain) == "" {
+		return nil, nil
+	}
+	host := normalize(hello.ServerName)
+
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+		r, err := m.load(context.Background(), challengePrefix+host)
+		if err != nil || r == nil {
+			return nil, errors.Errorf("no ACME challenge for %s", host)
+		}
+		return r.certificate()
+	}
+
+	m.Lock()
+	c, ok := m.cache[host]
+	m.Unlock()
+	if ok && time.Since(c.loaded) < cacheTTL {
+		return c.certificate, nil
+	}
+
+	c = cached{loaded: time.Now()}
+	r, err := m.load(context.Background(), certificatePrefix+host)
+	if err != nil {
+		logrus.Errorf("Failed to load ACME certificate of %s: %v", host, err)
+	} else if r != nil && time.Now().Before(r.NotAfter) {
+		if c.certificate, err = r.certificate(); err != nil {
+			logrus.Errorf("Failed to load ACME certificate of %s: %v", host, err)
+		}
+	}
+
+	m.Lock()
+	m.cache[host] = c
+	m.Unlock()
+	return c.certificate, nil
+}
+
+func (m *Manager) sync(ctx context.Context) error {
+	clusters, err := m.rancher.Clusters()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range clusters {
+		if m.shards != nil && !m.shards.Owns(c.Id) {
+			continue
+		}
+
+		var hosts []string
+		for _, label := range []string{c.Id, c.Name} {
+			host := normalize(label + "." + m.config.ClusterDomain)
+			if label != "" && sni.ClusterLabel(host, m.config.ClusterDomain) == label && !contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+
+		if err := m.ensure(ctx, c.Id, hosts); err != nil {
+			logrus.Errorf("Failed to obtain ACME certificate of cluster %s for %v: %v", c.Id, hosts, err)
+		}
+	}
+	return nil
+}
+
+// ensure obtains a certificate for hosts unless every host has one that isn't due for renewal
+func (m *Manager) ensure(ctx context.Context, clusterID string, hosts []string) error {
+	due := false
+	for _, host := range hosts {
+		r, err := m.load(ctx, certificatePrefix+host)
+		if err != nil {
+			return err
+		}
+		if r == nil || !sameHosts(r.Hosts, hosts) || time.Until(r.NotAfter) < renewBefore {
+			due = true
+		}
+	}
+	if !due {
+		delete(m.failures, clusterID)
+		return nil
+	}
+
+	f := m.failures[clusterID]
+	if f != nil && time.Now().Before(f.next) {
+		return nil
+	}
+
+	logrus.Infof("Obtaining ACME certificate of cluster %s for %v", clusterID, hosts)
+	ctx, cancel := context.WithTimeout(ctx, orderTimeout)
+	defer cancel()
+	r, err := m.obtain(ctx, hosts)
+	if err != nil {
+		if f == nil {
+			f = &failure{backoff: minBackoff}
+			m.failures[clusterID] = f
+		} else if f.backoff *= 2; f.backoff > maxBackoff {
+			f.backoff = maxBackoff
+		}
+		f.next = time.Now().Add(f.backoff)
+		return err
+	}
+	delete(m.failures, clusterID)
+
+	for _, host := range hosts {
+		if err := m.store(ctx, certificatePrefix+host, r); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("Obtained ACME certificate of cluster %s for %v, valid until %s", clusterID, hosts,
+		r.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+func (m *Manager) obtain(ctx context.Context, hosts []string) (*record, error) {
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(hosts...))
+	if err != nil {
+		return nil, err
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, url); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: hosts}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRecord(hosts, chain, key)
+}
+
+// authorize answers the TLS-ALPN-01 challenge of an authorization, the challenge certificate is stored so any
+// netes the CA reaches can serve it
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil || authz.Status == acme.StatusValid {
+		return err
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "tls-alpn-01" {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return errors.Errorf("CA offers no tls-alpn-01 challenge for %s", authz.Identifier.Value)
+	}
+
+	host := authz.Identifier.Value
+	cert, err := client.TLSALPN01ChallengeCert(challenge.Token, host)
+	if err != nil {
+		return err
+	}
+	r, err := newRecord([]string{host}, cert.Certificate, cert.PrivateKey.(crypto.Signer))
+	if err != nil {
+		return err
+	}
+	if err := m.store(ctx, challengePrefix+host, r); err != nil {
+		return err
+	}
+	defer m.kv.Delete(ctx, challengePrefix+host)
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// acmeClient registers the account of netes with the CA the first time, its key is shared by the replicas
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: m.config.ACMEDirectoryURL,
+		UserAgent:    "netes",
+	}
+
+	account := &acme.Account{}
+	if m.config.ACMEEmail != "" {
+		account.Contact = []string{"mailto:" + m.config.ACMEEmail}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, errors.Wrap(err, "Failed to register ACME account")
+	}
+
+	m.client = client
+	return client, nil
+}
+
+func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	current, err := m.kv.Get(ctx, accountKey)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := m.kv.Create(ctx, accountKey, der, 0); err == kv.ErrExists {
+			// another netes created it first
+			return m.accountKey(ctx)
+		} else if err != nil {
+			return nil, err
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(current.Value)
+}
+
+func (m *Manager) load(ctx context.Context, key string) (*record, error) {
+	current, err := m.kv.Get(ctx, key)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	r := &record{}
+	return r, json.Unmarshal(current.Value, r)
+}
+
+func (m *Manager) store(ctx context.Context, key string, r *record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	for {
+		current, err := m.kv.Get(ctx, key)
+		if err == kv.ErrNotExists || (err == nil && current == nil) {
+			_, err = m.kv.Create(ctx, key, value, 0)
+		} else if err == nil {
+			_, err = m.kv.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+		}
+		if err != kv.ErrExists && err != kv.ErrNotExists {
+			return err
+		}
+	}
+}
+
+func newRecord(hosts []string, chain [][]byte, key crypto.Signer) (*record, error) {
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &record{
+		Hosts:    hosts,
+		Chain:    chain,
+		Key:      der,
+		NotAfter: leaf.NotAfter,
+	}, nil
+}
+
+func (r *record) certificate() (*tls.Certificate, error) {
+	key, err := x509.ParsePKCS8PrivateKey(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: r.Chain,
+		PrivateKey:  key,
+	}, nil
+}
+
+func normalize(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func sameHosts(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for _, host := range right {
+		if !contains(left, host) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/health"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+)
+
+type handlerFunc func(rw http.ResponseWriter, req *http.Request, vars map[string]string)
+
+type route struct {
+	method  string
+	parts   []string
+	handler handlerFunc
+}
+
+// Server is the management API of netes, it is served on its own listener separate from the hosted clusters
+type Server struct {
+	config        *types.GlobalConfig
+	serverFactory *server.Factory
+	health        *health.Checker
+	routes        []route
+}
+
+func New(config *types.GlobalConfig, serverFactory *server.Factory, checker *health.Checker) *Server {
+	s := &Server{
+		config:        config,
+		serverFactory: serverFactory,
+		health:        checker,
+	}
+
+	s.handle("GET", "/v1/clusters", s.listClusters)
+	s.handle("POST", "/v1/clusters", s.createCluster)
+	s.handle("GET", "/v1/clusters/{clusterId}", s.getCluster)
+	s.handle("DELETE", "/v1/clusters/{clusterId}", s.deleteCluster)
+	s.handle("GET", "/v1/quotas", s.listQuotas)
+	s.handle("GET", "/v1/quotas/{account}", s.getQuota)
+	s.handle("PUT", "/v1/quotas/{account}", s.setQuota)
+	s.handle("DELETE", "/v1/quotas/{account}", s.deleteQuota)
+	s.handle("GET", "/v1/templates", s.listTemplates)
+	s.handle("GET", "/v1/clusters/{clusterId}/backups", s.listBackups)
+	s.handle("POST", "/v1/clusters/{clusterId}/backups", s.createBackup)
+	s.handle("POST", "/v1/restores", s.restoreBackup)
+	s.handle("POST", "/v1/imports", s.importCluster)
+	s.handle("POST", "/v1/clusters/{clusterId}/namespaces/{namespace}/restore", s.restoreNamespace)
+	s.handle("GET", "/v1/storage", s.listStorage)
+	s.handle("GET", "/v1/gc", s.listGC)
+	s.handle("GET", "/v1/inflight", s.listInflight)
+	s.handle("GET", "/v1/deprecations", s.deprecationReport)
+	s.handle("GET", "/v1/clusters/{clusterId}/inflight", s.listInflight)
+	s.handle("GET", "/v1/clusters/{clusterId}/audit", s.listAudit)
+	s.handle("GET", "/v1/clusters/{clusterId}/audit/policy", s.getAuditPolicy)
+	s.handle("PUT", "/v1/clusters/{clusterId}/audit/policy", s.setAuditPolicy)
+	s.handle("DELETE", "/v1/clusters/{clusterId}/audit/policy", s.deleteAuditPolicy)
+	s.handle("GET", "/v1/clusters/{clusterId}/mutations", s.listMutations)
+	s.handle("GET", "/v1/clusters/{clusterId}/mutations/checksum", s.mutationChecksum)
+	s.handle("GET", "/v1/clusters/{clusterId}/status", s.clusterStatus)
+	s.handle("GET", "/v1/clusters/{clusterId}/deprecations", s.listDeprecations)
+	s.handle("GET", "/v1/clusters/{clusterId}/admission", s.getAdmission)
+	s.handle("PUT", "/v1/clusters/{clusterId}/admission", s.setAdmission)
+	s.handle("DELETE", "/v1/clusters/{clusterId}/admission", s.deleteAdmission)
+	s.handle("GET", "/v1/clusters/{clusterId}/certificates", s.listCertificates)
+	s.handle("POST", "/v1/clusters/{clusterId}/certificates/{name}/rotate", s.rotateCertificate)
+	s.handle("GET", "/v1/clusters/{clusterId}/rotation", s.getRotation)
+	s.handle("POST", "/v1/clusters/{clusterId}/rotation", s.startRotation)
+	s.handle("GET", "/v1/replication", s.replicationStatus)
+	s.handle("POST", "/v1/replication/promote", s.promote)
+	s.handle("POST", "/v1/replication/demote", s.demote)
+	s.handle("GET", "/metrics", s.metrics)
+	s.handle("GET", "/healthz", s.healthz)
+	s.handle("GET", "/readyz", s.readyz)
+	s.handle("GET", "/v1/swagger.json", s.openAPI)
+
+	return s
+}
+
+func (s *Server) handle(method, pattern string, handler handlerFunc) {
+	s.routes = append(s.routes, route{
+		method:  method,
+		parts:   split(pattern),
+		handler: handler,
+	})
+}
+
+func split(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func (r route) match(req *http.Request) (map[string]string, bool) {
+	parts := split(req.URL.Path)
+	if req.Method != r.method || len(parts) != len(r.parts) {
+		return nil, false
+	}
+
+	vars := map[string]string{}
+	for i, part := range r.parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			vars[part[1:len(part)-1]] = parts[i]
+		} else if part != parts[i] {
+			return nil, false
+		}
+	}
+
+	return vars, true
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// probes of load balancers and orchestrators don't carry the token
+	probe := req.URL.Path == "/healthz" || req.URL.Path == "/readyz"
+	if !probe && s.config.AdminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+s.config.AdminToken)) != 1 {
+		response(rw, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	for _, r := range s.routes {
+		if vars, ok := r.match(req); ok {
+			r.handler(rw, req, vars)
+			return
+		}
+	}
+
+	response(rw, http.StatusNotFound, "Not found")
+}
+
+func (s *Server) lookupServer(rw http.ResponseWriter, clusterID string) server.Server {
+	server, ok := s.serverFactory.Server(clusterID)
+	if !ok {
+		response(rw, http.StatusNotFound, fmt.Sprintf("Cluster %s is not running", clusterID))
+		return nil
+	}
+	return server
+}
+
+func writeJSON(rw http.ResponseWriter, code int, obj interface{}) {
+	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(obj)
+}
+
+func response(rw http.ResponseWriter, code int, message string) {
+	writeJSON(rw, code, &client.Error{
+		Status:  int64(code),
+		Message: message,
+	})
+}
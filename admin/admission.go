@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/server/admission"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+func (s *Server) getAdmission(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	c := s.lookupCluster(rw, vars["clusterId"])
+	if c == nil {
+		return
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	config, err := admission.LoadPluginConfig(context.Background(), client, c.Uuid)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, config)
+}
+
+func (s *Server) setAdmission(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	config := &admission.PluginConfig{}
+	if err := json.NewDecoder(req.Body).Decode(config); err != nil {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.Validate(); err != nil {
+		response(rw, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	c := s.lookupCluster(rw, vars["clusterId"])
+	if c == nil {
+		return
+	}
+
+	if !s.applyAdmission(rw, c, func(ctx context.Context, client kv.Client) error {
+		return admission.SavePluginConfig(ctx, client, c.Uuid, config)
+	}) {
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, config)
+}
+
+func (s *Server) deleteAdmission(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	c := s.lookupCluster(rw, vars["clusterId"])
+	if c == nil {
+		return
+	}
+
+	if !s.applyAdmission(rw, c, func(ctx context.Context, client kv.Client) error {
+		return admission.DeletePluginConfig(ctx, client, c.Uuid)
+	}) {
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// applyAdmission changes the admission plugin configuration of a cluster with change and restarts its server, which
+// builds the admission chain with it.  Plugins that reject their configuration fail the restart, the previous
+// configuration is then restored and the server restarted with it.  A cluster that isn't running only builds the
+// chain when it starts.
+func (s *Server) applyAdmission(rw http.ResponseWriter, c *client.Cluster, change func(ctx context.Context, client kv.Client) error) bool {
+	ctx := context.Background()
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	previous, err := admission.LoadPluginConfig(ctx, kvClient, c.Uuid)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	if err := change(ctx, kvClient); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	restartErr := s.serverFactory.Restart(c.Id, "admission configuration changed", s.config.DrainTimeout)
+	if restartErr == nil {
+		return true
+	}
+
+	if err := admission.SavePluginConfig(ctx, kvClient, c.Uuid, previous); err != nil {
+		response(rw, http.StatusInternalServerError, fmt.Sprintf("Failed to restore admission configuration after %v: %v", restartErr, err))
+		return false
+	}
+	if err := s.serverFactory.Restart(c.Id, "admission configuration restored", s.config.DrainTimeout); err != nil {
+		response(rw, http.StatusInternalServerError, fmt.Sprintf("Failed to restart with the restored admission configuration after %v: %v", restartErr, err))
+		return false
+	}
+
+	response(rw, http.StatusUnprocessableEntity, fmt.Sprintf("Admission configuration rejected, it was restored: %v", restartErr))
+	return false
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/audit"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+const defaultAuditLimit = 100
+
+func (s *Server) listAudit(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	q := req.URL.Query()
+
+	since := time.Time{}
+	if q.Get("since") != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, q.Get("since")); err != nil {
+			response(rw, http.StatusBadRequest, fmt.Sprintf("Invalid since: %v", err))
+			return
+		}
+	}
+
+	limit := defaultAuditLimit
+	if q.Get("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(q.Get("limit")); err != nil || limit <= 0 {
+			response(rw, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reader, ok := client.(kv.AuditReader)
+	if !s.config.Audit || !ok {
+		response(rw, http.StatusNotFound, "Audit is not enabled")
+		return
+	}
+
+	prefix := store.ClusterPrefix(server.Cluster()) + "/"
+	if p := strings.Trim(q.Get("prefix"), "/"); p != "" {
+		prefix = path.Join(prefix, p)
+	}
+
+	entries, err := reader.Audit(context.Background(), prefix, since, limit)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": entries,
+	})
+}
+
+func (s *Server) getAuditPolicy(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	content, err := audit.LoadPolicy(context.Background(), client, vars["clusterId"])
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	} else if content == nil {
+		response(rw, http.StatusNotFound, fmt.Sprintf("Cluster %s has no audit policy set", vars["clusterId"]))
+		return
+	}
+
+	rw.Header().Set("content-type", "application/json")
+	rw.Write(content)
+}
+
+// setAuditPolicy stores an audit.k8s.io/v1alpha1 policy in JSON or YAML for a cluster, the running server of the
+// cluster applies it without a restart
+func (s *Server) setAuditPolicy(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := audit.ValidatePolicy(content); err != nil {
+		response(rw, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	saved, err := audit.SavePolicy(context.Background(), client, vars["clusterId"], content)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.Header().Set("content-type", "application/json")
+	rw.Write(saved)
+}
+
+func (s *Server) deleteAuditPolicy(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := audit.DeletePolicy(context.Background(), client, vars["clusterId"]); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
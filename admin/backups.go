@@ -0,0 +1,182 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/backup"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+type backupInfo struct {
+	Name        string    `json:"name"`
+	Cluster     string    `json:"cluster,omitempty"`
+	ClusterName string    `json:"clusterName,omitempty"`
+	Taken       time.Time `json:"taken,omitempty"`
+	Objects     int64     `json:"objects,omitempty"`
+	Bytes       int64     `json:"bytes,omitempty"`
+}
+
+type restoreInput struct {
+	Backup      string `json:"backup"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Account the cluster counts against the quota of, if any
+	Account string `json:"account,omitempty"`
+}
+
+type restoreResult struct {
+	Cluster *cluster `json:"cluster"`
+	Objects int      `json:"objects"`
+}
+
+func (s *Server) backupTarget(rw http.ResponseWriter) backup.Target {
+	if s.config.BackupTarget == "" {
+		response(rw, http.StatusNotFound, "Backups are not configured")
+		return nil
+	}
+	target, err := backup.NewTarget(s.config.BackupTarget)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	return target
+}
+
+func (s *Server) createBackup(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	target := s.backupTarget(rw)
+	if target == nil {
+		return
+	}
+	c := s.lookupCluster(rw, vars["clusterId"])
+	if c == nil {
+		return
+	}
+
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	b, err := backup.Take(context.Background(), kvClient, c)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data, err := backup.Encode(b)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := target.Put(b.Name(), data); err != nil {
+		response(rw, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, &backupInfo{
+		Name:        b.Name(),
+		Cluster:     b.Cluster,
+		ClusterName: b.ClusterName,
+		Taken:       b.Taken,
+		Objects:     int64(len(b.Entries)),
+		Bytes:       b.Bytes(),
+	})
+}
+
+func (s *Server) listBackups(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	target := s.backupTarget(rw)
+	if target == nil {
+		return
+	}
+
+	names, err := target.List(vars["clusterId"] + "/")
+	if err != nil {
+		response(rw, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	data := []*backupInfo{}
+	for _, name := range names {
+		data = append(data, &backupInfo{
+			Name: name,
+		})
+	}
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
+
+// restoreBackup creates a cluster with the configuration of the cluster a backup was taken from and restores the
+// objects of the backup into it before its server starts
+func (s *Server) restoreBackup(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	input := &restoreInput{}
+	if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Backup == "" || input.Name == "" {
+		response(rw, http.StatusUnprocessableEntity, "Backup and name are required")
+		return
+	}
+	if s.config.RancherClient == nil {
+		response(rw, http.StatusServiceUnavailable, "No Rancher configured")
+		return
+	}
+
+	target := s.backupTarget(rw)
+	if target == nil {
+		return
+	}
+	data, err := target.Get(input.Backup)
+	if err != nil {
+		response(rw, http.StatusBadGateway, err.Error())
+		return
+	}
+	b, err := backup.Decode(data)
+	if err != nil {
+		response(rw, http.StatusUnprocessableEntity, "Invalid backup: "+err.Error())
+		return
+	}
+
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !s.checkQuota(rw, input.Account) {
+		return
+	}
+	created, err := s.config.RancherClient.CreateCluster(&client.Cluster{
+		Name:            input.Name,
+		Description:     input.Description,
+		K8sServerConfig: b.K8sServerConfig,
+	})
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !s.setAccount(rw, created.Id, input.Account) {
+		return
+	}
+
+	restored := 0
+	err = s.serverFactory.Offline(created.Id, s.config.DrainTimeout, func() error {
+		var err error
+		restored, err = backup.Restore(context.Background(), kvClient, created, b)
+		return err
+	})
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, &restoreResult{
+		Cluster: s.cluster(created, nil),
+		Objects: restored,
+	})
+}
@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rancher/netes/certs"
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+func (s *Server) listCertificates(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	writeCertificates(rw, server)
+}
+
+// rotateCertificate replaces a certificate of a running cluster and restarts the cluster to serve it
+func (s *Server) rotateCertificate(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = certs.Rotate(context.Background(), client, server.Cluster().Uuid, vars["name"])
+	if err == certs.ErrUnknownName {
+		response(rw, http.StatusBadRequest, err.Error()+" "+vars["name"])
+		return
+	} else if err == certs.ErrRotating {
+		response(rw, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.config.Events.Emit(events.Event{
+		Type:    events.CertificateRotated,
+		Cluster: vars["clusterId"],
+		Message: fmt.Sprintf("Rotated certificate %s of cluster %s", vars["name"], vars["clusterId"]),
+		Details: map[string]string{"name": vars["name"], "reason": "requested"},
+	})
+
+	if err := s.serverFactory.Restart(vars["clusterId"], "certificate rotated", s.config.DrainTimeout); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if server = s.lookupServer(rw, vars["clusterId"]); server != nil {
+		writeCertificates(rw, server)
+	}
+}
+
+type rotationInput struct {
+	// Overlap is how long each phase of the rotation lasts, like 24h
+	Overlap string `json:"overlap,omitempty"`
+}
+
+type rotationStatus struct {
+	*certs.Rotation
+	Next time.Time `json:"next"`
+}
+
+func (s *Server) getRotation(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	rotation := server.Certificates().Rotation()
+	if rotation == nil {
+		response(rw, http.StatusNotFound, fmt.Sprintf("Cluster %s has no credential rotation in progress", vars["clusterId"]))
+		return
+	}
+	writeJSON(rw, http.StatusOK, &rotationStatus{
+		Rotation: rotation,
+		Next:     rotation.Next(),
+	})
+}
+
+// startRotation rotates the CA, serving certificate and service account key of a cluster.  The new CA and key are
+// trusted first, used after the overlap, and the old CA is no longer trusted after another overlap.  The rotation
+// controller moves the rotation along and restarts the cluster on every netes serving it.
+func (s *Server) startRotation(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	input := &rotationInput{}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+			response(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	overlap := certs.DefaultRotationOverlap
+	if input.Overlap != "" {
+		var err error
+		if overlap, err = time.ParseDuration(input.Overlap); err != nil || overlap <= 0 {
+			response(rw, http.StatusUnprocessableEntity, fmt.Sprintf("Invalid overlap %s", input.Overlap))
+			return
+		}
+	}
+
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rotation, err := certs.StartRotation(context.Background(), client, server.Cluster().Uuid, overlap)
+	if err == certs.ErrRotating {
+		response(rw, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.serverFactory.Restart(vars["clusterId"], "credential rotation started", s.config.DrainTimeout); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusAccepted, &rotationStatus{
+		Rotation: rotation,
+		Next:     rotation.Next(),
+	})
+}
+
+func writeCertificates(rw http.ResponseWriter, server server.Server) {
+	infos, err := server.Certificates().Info()
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": infos,
+	})
+}
@@ -0,0 +1,686 @@
+//go:build ignore
+// +build ignore
+
+// gen writes client.go and netes.ts, the Go and TypeScript clients of the management API, from the OpenAPI spec in
+// admin/openapi.go.  Run go generate in admin/client after changing the spec.  Objects with properties must be
+// definitions so their types get a name, operations that don't produce JSON like /metrics are left out.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	specFile = "../openapi.go"
+	specName = "openAPISpec"
+)
+
+var (
+	initialisms = map[string]bool{
+		"api":    true,
+		"gc":     true,
+		"id":     true,
+		"ok":     true,
+		"rbac":   true,
+		"sha256": true,
+		"ttl":    true,
+		"url":    true,
+		"uuid":   true,
+	}
+	httpMethods = []string{"get", "post", "put", "delete"}
+	// imports of client.go by what uses them
+	goImports = []struct {
+		pkg  string
+		uses []string
+	}{
+		{"encoding/json", []string{"json.RawMessage"}},
+		{"fmt", []string{"fmt.Sprintf"}},
+		{"net/url", []string{"url.PathEscape", "url.Values"}},
+		{"strconv", []string{"strconv."}},
+		{"time", []string{"time.Time", "time.RFC3339"}},
+	}
+)
+
+type schema struct {
+	Ref                  string     `json:"$ref"`
+	Type                 string     `json:"type"`
+	Format               string     `json:"format"`
+	Description          string     `json:"description"`
+	Enum                 []string   `json:"enum"`
+	Items                *schema    `json:"items"`
+	AdditionalProperties *schema    `json:"additionalProperties"`
+	Properties           properties `json:"properties"`
+	Required             []string   `json:"required"`
+	Nullable             bool       `json:"x-nullable"`
+}
+
+func (s *schema) required(name string) bool {
+	for _, required := range s.Required {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+type property struct {
+	Name   string
+	Schema *schema
+}
+
+// properties keep the order of the spec, so the fields of the clients are in the same order
+type properties []property
+
+func (p *properties) UnmarshalJSON(data []byte) error {
+	return decodeObject(data, func(key string, value json.RawMessage) error {
+		s := &schema{}
+		if err := json.Unmarshal(value, s); err != nil {
+			return err
+		}
+		*p = append(*p, property{Name: key, Schema: s})
+		return nil
+	})
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	Format      string  `json:"format"`
+	Schema      *schema `json:"schema"`
+}
+
+func (p *parameter) schema() *schema {
+	if p.Schema != nil {
+		return p.Schema
+	}
+	return &schema{Type: p.Type, Format: p.Format}
+}
+
+type response struct {
+	Schema *schema `json:"schema"`
+}
+
+type operation struct {
+	Method      string
+	Path        string
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Produces    []string             `json:"produces"`
+	Parameters  []parameter          `json:"parameters"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+func (o *operation) params(in string) []parameter {
+	var result []parameter
+	for _, p := range o.Parameters {
+		if p.In == in {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// pathParams are in the order of the path
+func (o *operation) pathParams() []parameter {
+	params := o.params("path")
+	sort.SliceStable(params, func(i, j int) bool {
+		return strings.Index(o.Path, "{"+params[i].Name+"}") < strings.Index(o.Path, "{"+params[j].Name+"}")
+	})
+	return params
+}
+
+func (o *operation) body() *parameter {
+	if params := o.params("body"); len(params) > 0 {
+		return &params[0]
+	}
+	return nil
+}
+
+// result is the schema of the first successful response, nil if it has no content
+func (o *operation) result() *schema {
+	var codes []string
+	for code := range o.Responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if o.Responses[code].Schema != nil {
+			return o.Responses[code].Schema
+		}
+	}
+	return nil
+}
+
+func (o *operation) json() bool {
+	if len(o.Produces) == 0 {
+		return true
+	}
+	for _, produces := range o.Produces {
+		if produces == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+type spec struct {
+	Paths       []*operation
+	Definitions properties
+}
+
+func (s *spec) UnmarshalJSON(data []byte) error {
+	return decodeObject(data, func(key string, value json.RawMessage) error {
+		switch key {
+		case "definitions":
+			return json.Unmarshal(value, &s.Definitions)
+		case "paths":
+			return decodeObject(value, func(path string, value json.RawMessage) error {
+				ops := map[string]*operation{}
+				if err := json.Unmarshal(value, &ops); err != nil {
+					return err
+				}
+				for _, method := range httpMethods {
+					if op, ok := ops[method]; ok {
+						op.Method, op.Path = strings.ToUpper(method), path
+						s.Paths = append(s.Paths, op)
+					}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// decodeObject calls fn with every key of a JSON object and its value, in order
+func decodeObject(data []byte, fn func(key string, value json.RawMessage) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return fmt.Errorf("expected an object, got %v", t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		if err := fn(t.(string), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	s, err := readSpec()
+	if err != nil {
+		log.Fatalf("Failed to read the spec: %v", err)
+	}
+
+	goSource, err := format.Source(genGo(s))
+	if err != nil {
+		log.Fatalf("Failed to format client.go: %v", err)
+	}
+	if err := ioutil.WriteFile("client.go", goSource, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("netes.ts", genTS(s), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readSpec() (*spec, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), specFile, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, s := range gen.Specs {
+			value := s.(*ast.ValueSpec)
+			if len(value.Names) != 1 || value.Names[0].Name != specName || len(value.Values) != 1 {
+				continue
+			}
+			lit, ok := value.Values[0].(*ast.BasicLit)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a string literal", specName)
+			}
+			content, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return nil, err
+			}
+			result := &spec{}
+			return result, json.Unmarshal([]byte(content), result)
+		}
+	}
+	return nil, fmt.Errorf("%s not found in %s", specName, specFile)
+}
+
+// words splits a camel case name, an upper case run is one word like GC in listGC
+func words(name string) []string {
+	var result []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		lowerBefore := !unicode.IsUpper(runes[i-1])
+		lowerAfter := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerBefore || (unicode.IsUpper(runes[i-1]) && lowerAfter) {
+			result = append(result, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(result, string(runes[start:]))
+}
+
+// goName exports a name of the spec the way Go names are written, clusterId is ClusterID
+func goName(name string) string {
+	result := ""
+	for _, word := range words(name) {
+		if initialisms[strings.ToLower(word)] {
+			result += strings.ToUpper(word)
+		} else {
+			result += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return result
+}
+
+// goParam is the name of a parameter in Go, clusterId is clusterID
+func goParam(name string) string {
+	exported := goName(name)
+	first := words(name)[0]
+	if initialisms[strings.ToLower(first)] {
+		return strings.ToLower(first) + exported[len(first):]
+	}
+	return strings.ToLower(exported[:1]) + exported[1:]
+}
+
+// tsName is the name of a definition in TypeScript, like in Go but for error which would shadow Error
+func tsName(name string) string {
+	if name == "error" {
+		return "ApiError"
+	}
+	return goName(name)
+}
+
+func refName(ref string) string {
+	return strings.TrimPrefix(ref, "#/definitions/")
+}
+
+func comment(buf *bytes.Buffer, indent, text string) {
+	if text != "" {
+		fmt.Fprintf(buf, "%s// %s\n", indent, text)
+	}
+}
+
+func goType(s *schema, ref func(string) string) string {
+	switch {
+	case s.Ref != "":
+		return ref(goName(refName(s.Ref)))
+	case s.Type == "array":
+		return "[]" + goType(s.Items, func(name string) string { return name })
+	case s.Type == "object":
+		if len(s.Properties) > 0 {
+			log.Fatalf("Objects with properties must be definitions: %+v", s)
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Type != "" {
+			return "map[string]" + goType(s.AdditionalProperties, ref)
+		}
+		return "map[string]interface{}"
+	case s.Type == "string" && s.Format == "date-time":
+		return "time.Time"
+	case s.Type == "string" && s.Format == "byte":
+		return "[]byte"
+	case s.Type == "string":
+		return "string"
+	case s.Type == "integer" && s.Format != "":
+		return s.Format
+	case s.Type == "integer":
+		return "int"
+	case s.Type == "number" && s.Format == "float":
+		return "float32"
+	case s.Type == "number":
+		return "float64"
+	case s.Type == "boolean":
+		return "bool"
+	}
+	log.Fatalf("Unsupported schema %+v", s)
+	return ""
+}
+
+func pointer(name string) string {
+	return "*" + name
+}
+
+// goPath is the expression of the path of an operation with its path parameters escaped
+func goPath(op *operation) string {
+	params := op.pathParams()
+	if len(params) == 0 {
+		return strconv.Quote(op.Path)
+	}
+
+	path := op.Path
+	var args []string
+	for _, p := range params {
+		path = strings.Replace(path, "{"+p.Name+"}", "%s", 1)
+		args = append(args, fmt.Sprintf("url.PathEscape(%s)", goParam(p.Name)))
+	}
+	return fmt.Sprintf("fmt.Sprintf(%s, %s)", strconv.Quote(path), strings.Join(args, ", "))
+}
+
+// goQuery writes the statement adding a query parameter to q when it is set
+func goQuery(buf *bytes.Buffer, p parameter) {
+	field := "opts." + goName(p.Name)
+	switch goType(p.schema(), pointer) {
+	case "string":
+		fmt.Fprintf(buf, "if %s != \"\" {\nq.Set(%q, %s)\n}\n", field, p.Name, field)
+	case "time.Time":
+		fmt.Fprintf(buf, "if !%s.IsZero() {\nq.Set(%q, %s.Format(time.RFC3339))\n}\n", field, p.Name, field)
+	case "int":
+		fmt.Fprintf(buf, "if %s != 0 {\nq.Set(%q, strconv.Itoa(%s))\n}\n", field, p.Name, field)
+	case "int64":
+		fmt.Fprintf(buf, "if %s != 0 {\nq.Set(%q, strconv.FormatInt(%s, 10))\n}\n", field, p.Name, field)
+	case "bool":
+		fmt.Fprintf(buf, "if %s {\nq.Set(%q, \"true\")\n}\n", field, p.Name)
+	default:
+		log.Fatalf("Unsupported query parameter %s of %s", p.Name, p.In)
+	}
+}
+
+func genGo(s *spec) []byte {
+	types := &bytes.Buffer{}
+	for _, def := range s.Definitions {
+		comment(types, "", def.Schema.Description)
+		fmt.Fprintf(types, "type %s struct {\n", goName(def.Name))
+		for _, prop := range def.Schema.Properties {
+			tag := prop.Name
+			if !def.Schema.required(prop.Name) {
+				tag += ",omitempty"
+			}
+			comment(types, "", prop.Schema.Description)
+			fmt.Fprintf(types, "%s %s `json:\"%s\"`\n", goName(prop.Name), goType(prop.Schema, pointer), tag)
+		}
+		fmt.Fprintf(types, "}\n\n")
+	}
+
+	ops := &bytes.Buffer{}
+	for _, op := range s.Paths {
+		if !op.json() {
+			continue
+		}
+		name := goName(op.OperationID)
+
+		query := op.params("query")
+		if len(query) > 0 {
+			fmt.Fprintf(ops, "type %sOpts struct {\n", name)
+			for _, p := range query {
+				comment(ops, "", p.Description)
+				fmt.Fprintf(ops, "%s %s\n", goName(p.Name), goType(p.schema(), pointer))
+			}
+			fmt.Fprintf(ops, "}\n\n")
+		}
+
+		var args []string
+		for _, p := range op.pathParams() {
+			args = append(args, goParam(p.Name)+" string")
+		}
+		input := "nil"
+		if body := op.body(); body != nil {
+			input = "body"
+			bodyType := "json.RawMessage"
+			if body.Schema.Ref != "" {
+				input = goParam(refName(body.Schema.Ref))
+				bodyType = goType(body.Schema, pointer)
+			}
+			args = append(args, input+" "+bodyType)
+		}
+		if len(query) > 0 {
+			args = append(args, fmt.Sprintf("opts *%sOpts", name))
+		}
+
+		result, output, returns := op.result(), "nil", "error"
+		if result != nil {
+			output, returns = "&result", "(json.RawMessage, error)"
+			if result.Ref != "" {
+				output, returns = "result", fmt.Sprintf("(%s, error)", goType(result, pointer))
+			}
+		}
+
+		comment(ops, "", name+": "+op.Summary)
+		fmt.Fprintf(ops, "func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+		path := goPath(op)
+		if len(query) > 0 {
+			fmt.Fprintf(ops, "path := %s\nif opts != nil {\nq := url.Values{}\n", path)
+			for _, p := range query {
+				goQuery(ops, p)
+			}
+			fmt.Fprintf(ops, "if len(q) > 0 {\npath += \"?\" + q.Encode()\n}\n}\n\n")
+			path = "path"
+		}
+		switch {
+		case result == nil:
+			fmt.Fprintf(ops, "return c.do(%q, %s, %s, nil)\n", op.Method, path, input)
+		case result.Ref != "":
+			fmt.Fprintf(ops, "result := &%s{}\n", goName(refName(result.Ref)))
+			fmt.Fprintf(ops, "return result, c.do(%q, %s, %s, %s)\n", op.Method, path, input, output)
+		default:
+			fmt.Fprintf(ops, "var result json.RawMessage\n")
+			fmt.Fprintf(ops, "return result, c.do(%q, %s, %s, %s)\n", op.Method, path, input, output)
+		}
+		fmt.Fprintf(ops, "}\n\n")
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by gen.go from admin/openapi.go. DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	code := types.String() + ops.String()
+	for _, imp := range goImports {
+		for _, use := range imp.uses {
+			if strings.Contains(code, use) {
+				fmt.Fprintf(buf, "%q\n", imp.pkg)
+				break
+			}
+		}
+	}
+	fmt.Fprintf(buf, ")\n\n")
+	buf.WriteString(code)
+	return buf.Bytes()
+}
+
+func tsType(s *schema) string {
+	result := ""
+	switch {
+	case s.Ref != "":
+		result = tsName(refName(s.Ref))
+	case s.Type == "array":
+		result = tsType(s.Items)
+		if strings.Contains(result, " ") {
+			result = "(" + result + ")"
+		}
+		result += "[]"
+	case s.Type == "object" && s.AdditionalProperties != nil && s.AdditionalProperties.Type != "":
+		result = "{ [key: string]: " + tsType(s.AdditionalProperties) + " }"
+	case s.Type == "object":
+		result = "{ [key: string]: any }"
+	case s.Type == "string" && len(s.Enum) > 0:
+		var values []string
+		for _, value := range s.Enum {
+			values = append(values, "'"+value+"'")
+		}
+		result = strings.Join(values, " | ")
+	case s.Type == "string":
+		result = "string"
+	case s.Type == "integer", s.Type == "number":
+		result = "number"
+	case s.Type == "boolean":
+		result = "boolean"
+	default:
+		log.Fatalf("Unsupported schema %+v", s)
+	}
+	if s.Nullable {
+		result += " | null"
+	}
+	return result
+}
+
+func tsField(buf *bytes.Buffer, name string, s *schema, required bool) {
+	optional := "?"
+	if required {
+		optional = ""
+	}
+	comment(buf, "  ", s.Description)
+	fmt.Fprintf(buf, "  %s%s: %s;\n", name, optional, tsType(s))
+}
+
+// tsPath is the template of the path of an operation with its path parameters encoded
+func tsPath(op *operation, query bool) string {
+	path := op.Path
+	for _, p := range op.pathParams() {
+		path = strings.Replace(path, "{"+p.Name+"}", "${encodeURIComponent("+p.Name+")}", 1)
+	}
+	if query {
+		path += "${query(opts)}"
+	}
+	if strings.Contains(path, "${") {
+		return "`" + path + "`"
+	}
+	return "'" + path + "'"
+}
+
+func genTS(s *spec) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by gen.go from admin/openapi.go. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "// Client of the netes management API described in admin/openapi.go\n\n")
+
+	for _, def := range s.Definitions {
+		comment(buf, "", def.Schema.Description)
+		fmt.Fprintf(buf, "export interface %s {\n", tsName(def.Name))
+		for _, prop := range def.Schema.Properties {
+			tsField(buf, prop.Name, prop.Schema, def.Schema.required(prop.Name))
+		}
+		fmt.Fprintf(buf, "}\n\n")
+	}
+
+	methods := &bytes.Buffer{}
+	for _, op := range s.Paths {
+		if !op.json() {
+			continue
+		}
+
+		query := op.params("query")
+		if len(query) > 0 {
+			fmt.Fprintf(buf, "export interface %sOpts {\n", goName(op.OperationID))
+			for _, p := range query {
+				tsField(buf, p.Name, p.schema(), false)
+			}
+			fmt.Fprintf(buf, "}\n\n")
+		}
+
+		var args []string
+		for _, p := range op.pathParams() {
+			args = append(args, p.Name+": string")
+		}
+		input := ""
+		if body := op.body(); body != nil {
+			input = "body"
+			bodyType := "object"
+			if body.Schema.Ref != "" {
+				input = goParam(refName(body.Schema.Ref))
+				bodyType = tsType(body.Schema)
+			}
+			args = append(args, input+": "+bodyType)
+			input = ", " + input
+		}
+		if len(query) > 0 {
+			args = append(args, fmt.Sprintf("opts: %sOpts = {}", goName(op.OperationID)))
+		}
+
+		returns := "void"
+		if result := op.result(); result != nil && result.Ref != "" {
+			returns = tsType(result)
+		} else if result != nil {
+			returns = "object"
+		}
+
+		comment(methods, "  ", op.Summary)
+		fmt.Fprintf(methods, "  %s(%s): Promise<%s> {\n", op.OperationID, strings.Join(args, ", "), returns)
+		fmt.Fprintf(methods, "    return this.request<%s>('%s', %s%s);\n", returns, op.Method, tsPath(op, len(query) > 0), input)
+		fmt.Fprintf(methods, "  }\n\n")
+	}
+
+	fmt.Fprintf(buf, "export class NetesClient {\n  constructor(private url: string, private token?: string) {}\n\n")
+	buf.Write(methods.Bytes())
+	buf.WriteString(tsRuntime)
+	return buf.Bytes()
+}
+
+const tsRuntime = `  private async request<T>(method: string, path: string, body?: any): Promise<T> {
+    const headers: { [key: string]: string } = {};
+    if (body !== undefined) {
+      headers['content-type'] = 'application/json';
+    }
+    if (this.token) {
+      headers['Authorization'] = ` + "`Bearer ${this.token}`" + `;
+    }
+
+    const resp = await fetch(this.url + path, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+
+    if (resp.status >= 300) {
+      let err: ApiError = { status: resp.status };
+      try {
+        err = { ...err, ...(await resp.json()) };
+      } catch (e) {
+      }
+      throw err;
+    }
+
+    if (resp.status === 204) {
+      return undefined as any;
+    }
+    return resp.json();
+  }
+}
+
+function query(opts: object): string {
+  const params: string[] = [];
+  for (const key of Object.keys(opts)) {
+    const value = (opts as any)[key];
+    if (value !== undefined && value !== '') {
+      params.push(` + "`${key}=${encodeURIComponent(String(value))}`" + `);
+    }
+  }
+  return params.length ? ` + "`?${params.join('&')}`" + ` : '';
+}
+`
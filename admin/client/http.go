@@ -0,0 +1,72 @@
+// Package client is a typed client of the netes management API.  client.go and netes.ts, the TypeScript client,
+// are generated from the spec in admin/openapi.go, only the transport is written here.
+package client
+
+//go:generate go run gen.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New(url, token string) *Client {
+	return &Client{
+		URL:        url,
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Status, e.Message)
+}
+
+func (c *Client) do(method, path string, input, output interface{}) error {
+	var body io.Reader
+	if input != nil {
+		content, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return err
+	}
+	if input != nil {
+		req.Header.Set("content-type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{
+			Status: int64(resp.StatusCode),
+		}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+
+	if output == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
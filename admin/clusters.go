@@ -0,0 +1,203 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/status"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/templates"
+	"github.com/rancher/netes/usage"
+	"golang.org/x/net/context"
+)
+
+// cluster is a cluster served by netes as listed by the management API, status is only filled in for a single
+// running cluster
+type cluster struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	State       string `json:"state"`
+	UUID        string `json:"uuid"`
+	// Running is whether the server of the cluster runs on this netes
+	Running bool `json:"running"`
+	// Objects and StorageBytes are only known when storage usage is tracked
+	Objects      int64           `json:"objects"`
+	StorageBytes int64           `json:"storageBytes"`
+	Status       *status.Cluster `json:"status,omitempty"`
+}
+
+type clusterInput struct {
+	Name            string                  `json:"name"`
+	Description     string                  `json:"description,omitempty"`
+	K8sServerConfig *client.K8sServerConfig `json:"k8sServerConfig,omitempty"`
+	// Template gives the defaults of the settings not in K8sServerConfig
+	Template string `json:"template,omitempty"`
+	// Account the cluster counts against the quota of, if any
+	Account string `json:"account,omitempty"`
+}
+
+func (s *Server) listClusters(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.RancherClient == nil {
+		response(rw, http.StatusServiceUnavailable, "No Rancher configured")
+		return
+	}
+
+	clusters, err := s.config.RancherClient.Clusters()
+	if err != nil {
+		response(rw, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	usage := s.usage()
+	data := []*cluster{}
+	for _, c := range clusters {
+		data = append(data, s.cluster(c, usage))
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Name < data[j].Name
+	})
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": data,
+	})
+}
+
+func (s *Server) getCluster(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	c := s.lookupCluster(rw, vars["clusterId"])
+	if c == nil {
+		return
+	}
+
+	result := s.cluster(c, s.usage())
+	if server, ok := s.serverFactory.Server(c.Id); ok {
+		rancherClient, err := s.config.RancherClient.Get()
+		if err != nil {
+			response(rw, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		result.Status = status.Rollup(rancherClient, server)
+	}
+
+	writeJSON(rw, http.StatusOK, result)
+}
+
+func (s *Server) createCluster(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	input := &clusterInput{}
+	if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Name == "" {
+		response(rw, http.StatusUnprocessableEntity, "Name is required")
+		return
+	}
+	if s.config.RancherClient == nil {
+		response(rw, http.StatusServiceUnavailable, "No Rancher configured")
+		return
+	}
+
+	cluster := &client.Cluster{
+		Name:            input.Name,
+		Description:     input.Description,
+		K8sServerConfig: input.K8sServerConfig,
+	}
+	var t *templates.Template
+	if input.Template != "" {
+		var err error
+		if t, err = templates.Get(s.config, input.Template); err != nil {
+			response(rw, http.StatusInternalServerError, err.Error())
+			return
+		} else if t == nil {
+			response(rw, http.StatusUnprocessableEntity, fmt.Sprintf("Template %s not found", input.Template))
+			return
+		}
+		t.Apply(cluster)
+	}
+
+	if !s.checkQuota(rw, input.Account) {
+		return
+	}
+	created, err := s.config.RancherClient.CreateCluster(cluster)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !s.setAccount(rw, created.Id, input.Account) {
+		return
+	}
+
+	if t != nil {
+		kvClient, err := store.Client(s.config)
+		if err == nil {
+			err = t.Configure(context.Background(), kvClient, created.Uuid)
+		}
+		if err != nil {
+			response(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	writeJSON(rw, http.StatusCreated, s.cluster(created, nil))
+}
+
+func (s *Server) deleteCluster(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	c := s.lookupCluster(rw, vars["clusterId"])
+	if c == nil {
+		return
+	}
+
+	if err := s.config.RancherClient.DeleteCluster(c); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) lookupCluster(rw http.ResponseWriter, clusterID string) *client.Cluster {
+	if s.config.RancherClient == nil {
+		response(rw, http.StatusServiceUnavailable, "No Rancher configured")
+		return nil
+	}
+
+	c, err := s.config.RancherClient.Cluster(clusterID)
+	if err != nil {
+		response(rw, http.StatusServiceUnavailable, err.Error())
+		return nil
+	}
+	if c == nil {
+		response(rw, http.StatusNotFound, fmt.Sprintf("Cluster %s not found", clusterID))
+		return nil
+	}
+	return c
+}
+
+func (s *Server) usage() []usage.Resource {
+	if s.config.Usage == nil {
+		return nil
+	}
+	return s.config.Usage.List()
+}
+
+func (s *Server) cluster(c *client.Cluster, usage []usage.Resource) *cluster {
+	_, running := s.serverFactory.Server(c.Id)
+	result := &cluster{
+		ID:          c.Id,
+		Name:        c.Name,
+		Description: c.Description,
+		State:       c.State,
+		UUID:        c.Uuid,
+		Running:     running,
+	}
+	for _, resource := range usage {
+		if resource.Cluster == c.Id {
+			result.Objects += resource.Rows
+			result.StorageBytes += resource.Bytes
+		}
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"golang.org/x/net/context"
+)
+
+var kubernetesVersion = regexp.MustCompile(`^v?\d+\.\d+$`)
+
+func (s *Server) listDeprecations(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.Deprecations == nil {
+		response(rw, http.StatusNotFound, "Deprecated API usage is not tracked")
+		return
+	}
+
+	usages, err := s.config.Deprecations.List(context.Background(), vars["clusterId"])
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": usages,
+	})
+}
+
+// deprecationReport lists the clusters using deprecated APIs, with removedBy like 1.16 only the ones that would
+// break if their embedded Kubernetes was upgraded to that version, so their tenants can be warned first
+func (s *Server) deprecationReport(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.Deprecations == nil {
+		response(rw, http.StatusNotFound, "Deprecated API usage is not tracked")
+		return
+	}
+
+	removedBy := req.URL.Query().Get("removedBy")
+	if removedBy != "" && !kubernetesVersion.MatchString(removedBy) {
+		response(rw, http.StatusBadRequest, fmt.Sprintf("Invalid removedBy %s, expected a version like 1.16", removedBy))
+		return
+	}
+
+	report, err := s.config.Deprecations.Report(context.Background(), removedBy)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": report,
+	})
+}
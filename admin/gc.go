@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/rancher/netes/gc"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+func (s *Server) listGC(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	records, err := gc.List(context.Background(), client)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if records == nil {
+		records = []*gc.Record{}
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": records,
+	})
+}
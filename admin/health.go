@@ -0,0 +1,23 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/rancher/netes/health"
+)
+
+func (s *Server) healthz(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	writeStatus(rw, s.health.Healthz())
+}
+
+func (s *Server) readyz(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	writeStatus(rw, s.health.Readyz())
+}
+
+func writeStatus(rw http.ResponseWriter, status health.Status) {
+	code := http.StatusOK
+	if !status.OK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(rw, code, status)
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/importer"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+type importInput struct {
+	// Kubeconfig of the cluster to import, its current context is used
+	Kubeconfig      string                  `json:"kubeconfig"`
+	Name            string                  `json:"name"`
+	Description     string                  `json:"description,omitempty"`
+	K8sServerConfig *client.K8sServerConfig `json:"k8sServerConfig,omitempty"`
+	// Account the cluster counts against the quota of, if any
+	Account string `json:"account,omitempty"`
+}
+
+type importResult struct {
+	Cluster *cluster `json:"cluster"`
+	*importer.Result
+}
+
+// importCluster creates a cluster and copies the objects of an existing cluster into it before its server starts
+func (s *Server) importCluster(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	input := &importInput{}
+	if err := json.NewDecoder(req.Body).Decode(input); err != nil {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Kubeconfig == "" || input.Name == "" {
+		response(rw, http.StatusUnprocessableEntity, "Kubeconfig and name are required")
+		return
+	}
+	if s.config.RancherClient == nil {
+		response(rw, http.StatusServiceUnavailable, "No Rancher configured")
+		return
+	}
+
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !s.checkQuota(rw, input.Account) {
+		return
+	}
+	created, err := s.config.RancherClient.CreateCluster(&client.Cluster{
+		Name:            input.Name,
+		Description:     input.Description,
+		K8sServerConfig: input.K8sServerConfig,
+	})
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !s.setAccount(rw, created.Id, input.Account) {
+		return
+	}
+
+	var result *importer.Result
+	err = s.serverFactory.Offline(created.Id, s.config.DrainTimeout, func() error {
+		var err error
+		result, err = importer.Import(context.Background(), s.config, kvClient, created, []byte(input.Kubeconfig))
+		return err
+	})
+	if err != nil {
+		response(rw, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, &importResult{
+		Cluster: s.cluster(created, nil),
+		Result:  result,
+	})
+}
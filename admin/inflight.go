@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rancher/netes/metrics"
+)
+
+// listInflight lists the requests the clusters are serving, oldest first, to find stuck watches and long-running
+// requests.  minAge like 5m leaves out the younger ones.
+func (s *Server) listInflight(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	var minAge time.Duration
+	if value := req.URL.Query().Get("minAge"); value != "" {
+		var err error
+		if minAge, err = time.ParseDuration(value); err != nil {
+			response(rw, http.StatusBadRequest, fmt.Sprintf("Invalid minAge: %v", err))
+			return
+		}
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": metrics.ActiveRequests(vars["clusterId"], minAge),
+	})
+}
@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/replication"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+const defaultMutationLimit = 1000
+
+func (s *Server) listMutations(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	reader, prefix, after, ok := s.mutationLog(rw, req, vars)
+	if !ok {
+		return
+	}
+
+	limit := defaultMutationLimit
+	if q := req.URL.Query(); q.Get("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(q.Get("limit")); err != nil || limit <= 0 {
+			response(rw, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	mutations, err := reader.MutationLog(context.Background(), prefix, after, limit)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": mutations,
+	})
+}
+
+// mutationChecksum is compared by standbys that applied the mutation log up to after with their own copy.  The
+// checksum is only current when nothing but events was written after that id while it was computed.
+func (s *Server) mutationChecksum(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	reader, prefix, after, ok := s.mutationLog(rw, req, vars)
+	if !ok {
+		return
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	current, err := quiet(ctx, reader, prefix, after)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	checksum, err := replication.ComputeChecksum(ctx, client, prefix)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if current {
+		if current, err = quiet(ctx, reader, prefix, after); err != nil {
+			response(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	checksum.Current = current
+
+	writeJSON(rw, http.StatusOK, checksum)
+}
+
+func (s *Server) mutationLog(rw http.ResponseWriter, req *http.Request, vars map[string]string) (kv.MutationLogReader, string, int64, bool) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return nil, "", 0, false
+	}
+
+	q := req.URL.Query()
+
+	var after int64
+	if q.Get("after") != "" {
+		var err error
+		if after, err = strconv.ParseInt(q.Get("after"), 10, 64); err != nil || after < 0 {
+			response(rw, http.StatusBadRequest, "Invalid after")
+			return nil, "", 0, false
+		}
+	}
+
+	client, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return nil, "", 0, false
+	}
+
+	reader, ok := client.(kv.MutationLogReader)
+	if !s.config.MutationLog || !ok {
+		response(rw, http.StatusNotFound, "Mutation log is not enabled")
+		return nil, "", 0, false
+	}
+
+	prefix := store.ClusterPrefix(server.Cluster()) + "/"
+	if p := strings.Trim(q.Get("prefix"), "/"); p != "" {
+		prefix = path.Join(prefix, p)
+	}
+
+	return reader, prefix, after, true
+}
+
+// quiet returns true if nothing but events under prefix was written after the id
+func quiet(ctx context.Context, reader kv.MutationLogReader, prefix string, after int64) (bool, error) {
+	for {
+		mutations, err := reader.MutationLog(ctx, prefix, after, defaultMutationLimit)
+		if err != nil {
+			return false, err
+		}
+		for _, m := range mutations {
+			if !replication.IsEvent(m.Key) {
+				return false, nil
+			}
+			after = m.ID
+		}
+		if len(mutations) < defaultMutationLimit {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+func (s *Server) restoreNamespace(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	if err := server.Trash().Restore(context.Background(), vars["namespace"]); err != nil {
+		response(rw, http.StatusConflict, err.Error())
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
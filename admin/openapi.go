@@ -0,0 +1,1007 @@
+package admin
+
+import (
+	"net/http"
+)
+
+// openAPISpec documents every route registered in New, keep them in sync.  admin/client is the Go client
+// and admin/client/netes.ts the TypeScript client for this spec, run go generate in admin/client after changing it.
+const openAPISpec = `{
+  "swagger": "2.0",
+  "info": {
+    "title": "Netes Management API",
+    "version": "v1"
+  },
+  "consumes": ["application/json"],
+  "produces": ["application/json"],
+  "securityDefinitions": {
+    "token": {
+      "type": "apiKey",
+      "name": "Authorization",
+      "in": "header",
+      "description": "Bearer followed by the configured admin token"
+    }
+  },
+  "security": [{"token": []}],
+  "paths": {
+    "/v1/clusters": {
+      "get": {
+        "operationId": "listClusters",
+        "summary": "Clusters served by netes with their object counts and storage size",
+        "responses": {
+          "200": {"description": "Clusters", "schema": {"$ref": "#/definitions/clusterCollection"}},
+          "503": {"description": "Rancher is not reachable", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "post": {
+        "operationId": "createCluster",
+        "summary": "Create a cluster served by netes in Rancher, its server starts once Rancher publishes it",
+        "parameters": [
+          {"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/clusterInput"}}
+        ],
+        "responses": {
+          "201": {"description": "Cluster created", "schema": {"$ref": "#/definitions/cluster"}},
+          "400": {"description": "Invalid cluster", "schema": {"$ref": "#/definitions/error"}},
+          "403": {"description": "The account reached its quota", "schema": {"$ref": "#/definitions/error"}},
+          "422": {"description": "Name is missing or the template doesn't exist", "schema": {"$ref": "#/definitions/error"}},
+          "503": {"description": "Rancher is not reachable", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/quotas": {
+      "get": {
+        "operationId": "listQuotas",
+        "summary": "Quotas of the accounts clusters are created for",
+        "responses": {
+          "200": {"description": "Quotas", "schema": {"$ref": "#/definitions/quotaCollection"}}
+        }
+      }
+    },
+    "/v1/quotas/{account}": {
+      "get": {
+        "operationId": "getQuota",
+        "summary": "Quota of an account and what its clusters use of it",
+        "parameters": [
+          {"name": "account", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Quota", "schema": {"$ref": "#/definitions/quotaStatus"}},
+          "404": {"description": "The account has no quota", "schema": {"$ref": "#/definitions/error"}},
+          "503": {"description": "Rancher is not reachable", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "put": {
+        "operationId": "setQuota",
+        "summary": "Limit the clusters of an account and what they store, new clusters are rejected once it is reached",
+        "parameters": [
+          {"name": "account", "in": "path", "required": true, "type": "string"},
+          {"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/quota"}}
+        ],
+        "responses": {
+          "200": {"description": "Quota", "schema": {"$ref": "#/definitions/quota"}},
+          "400": {"description": "Invalid quota", "schema": {"$ref": "#/definitions/error"}},
+          "422": {"description": "Negative quota", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "delete": {
+        "operationId": "deleteQuota",
+        "summary": "Remove the limits of an account",
+        "parameters": [
+          {"name": "account", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "204": {"description": "Quota removed"}
+        }
+      }
+    },
+    "/v1/templates": {
+      "get": {
+        "operationId": "listTemplates",
+        "summary": "Templates new clusters can be created from",
+        "responses": {
+          "200": {"description": "Templates", "schema": {"$ref": "#/definitions/templateCollection"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}": {
+      "get": {
+        "operationId": "getCluster",
+        "summary": "A cluster served by netes, with its status when it runs on this netes",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Cluster", "schema": {"$ref": "#/definitions/cluster"}},
+          "404": {"description": "Cluster not found", "schema": {"$ref": "#/definitions/error"}},
+          "503": {"description": "Rancher is not reachable", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "delete": {
+        "operationId": "deleteCluster",
+        "summary": "Remove a cluster in Rancher, its server stops once Rancher publishes the removal",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "204": {"description": "Cluster removed"},
+          "404": {"description": "Cluster not found", "schema": {"$ref": "#/definitions/error"}},
+          "503": {"description": "Rancher is not reachable", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/backups": {
+      "get": {
+        "operationId": "listBackups",
+        "summary": "Backups of a cluster in the backup target, oldest first",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Backups", "schema": {"$ref": "#/definitions/backupCollection"}},
+          "404": {"description": "Backups are not configured", "schema": {"$ref": "#/definitions/error"}},
+          "502": {"description": "Backup target failed", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "post": {
+        "operationId": "createBackup",
+        "summary": "Back up the objects of a cluster from one snapshot of the database to the backup target",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "201": {"description": "Backup taken", "schema": {"$ref": "#/definitions/backup"}},
+          "404": {"description": "Cluster not found or backups are not configured", "schema": {"$ref": "#/definitions/error"}},
+          "502": {"description": "Backup target failed", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/restores": {
+      "post": {
+        "operationId": "restoreBackup",
+        "summary": "Create a cluster with the configuration and objects of a backup, service account tokens are issued again",
+        "parameters": [
+          {"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/restoreInput"}}
+        ],
+        "responses": {
+          "201": {"description": "Cluster created and restored", "schema": {"$ref": "#/definitions/restoreResult"}},
+          "403": {"description": "The account reached its quota", "schema": {"$ref": "#/definitions/error"}},
+          "404": {"description": "Backups are not configured", "schema": {"$ref": "#/definitions/error"}},
+          "422": {"description": "Backup or name is missing, or the backup is invalid", "schema": {"$ref": "#/definitions/error"}},
+          "502": {"description": "Backup target failed", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/imports": {
+      "post": {
+        "operationId": "importCluster",
+        "summary": "Create a cluster with the objects of an existing cluster, read through its kubeconfig",
+        "parameters": [
+          {"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/importInput"}}
+        ],
+        "responses": {
+          "201": {"description": "Cluster created and imported", "schema": {"$ref": "#/definitions/importResult"}},
+          "403": {"description": "The account reached its quota", "schema": {"$ref": "#/definitions/error"}},
+          "422": {"description": "Kubeconfig or name is missing", "schema": {"$ref": "#/definitions/error"}},
+          "502": {"description": "The existing cluster could not be read", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/namespaces/{namespace}/restore": {
+      "post": {
+        "operationId": "restoreNamespace",
+        "summary": "Restore a deleted namespace and its content from the trash",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "namespace", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "204": {"description": "Namespace restored"},
+          "404": {"description": "Cluster is not running", "schema": {"$ref": "#/definitions/error"}},
+          "409": {"description": "Namespace could not be restored", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/storage": {
+      "get": {
+        "operationId": "listStorage",
+        "summary": "Rows and bytes stored per cluster and resource",
+        "responses": {
+          "200": {"description": "Storage usage", "schema": {"$ref": "#/definitions/storageCollection"}},
+          "404": {"description": "Storage usage is not tracked", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/gc": {
+      "get": {
+        "operationId": "listGC",
+        "summary": "Clusters netes serves or served, and how far the collection of the storage of removed ones got",
+        "responses": {
+          "200": {"description": "Clusters", "schema": {"$ref": "#/definitions/gcCollection"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/audit": {
+      "get": {
+        "operationId": "listAudit",
+        "summary": "Mutations of the storage of a cluster, oldest first",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "prefix", "in": "query", "type": "string", "description": "Key prefix relative to the cluster, for example pods/default"},
+          {"name": "since", "in": "query", "type": "string", "format": "date-time"},
+          {"name": "limit", "in": "query", "type": "integer", "default": 100}
+        ],
+        "responses": {
+          "200": {"description": "Audit entries", "schema": {"$ref": "#/definitions/auditCollection"}},
+          "400": {"description": "Invalid parameters", "schema": {"$ref": "#/definitions/error"}},
+          "404": {"description": "Cluster is not running or audit is not enabled", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/mutations": {
+      "get": {
+        "operationId": "listMutations",
+        "summary": "Ordered log of the mutations of a cluster with their values, for replication",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "prefix", "in": "query", "type": "string", "description": "Key prefix relative to the cluster, for example pods/default"},
+          {"name": "after", "in": "query", "type": "integer", "format": "int64", "description": "Id of the last mutation already processed"},
+          {"name": "limit", "in": "query", "type": "integer", "default": 1000}
+        ],
+        "responses": {
+          "200": {"description": "Mutations", "schema": {"$ref": "#/definitions/mutationCollection"}},
+          "400": {"description": "Invalid parameters", "schema": {"$ref": "#/definitions/error"}},
+          "404": {"description": "Cluster is not running or the mutation log is not enabled", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/mutations/checksum": {
+      "get": {
+        "operationId": "getMutationChecksum",
+        "summary": "Checksum of the storage of a cluster without events, for standbys to detect divergence",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "prefix", "in": "query", "type": "string", "description": "Key prefix relative to the cluster, for example pods/default"},
+          {"name": "after", "in": "query", "type": "integer", "format": "int64", "description": "Id of the last mutation applied by the standby"}
+        ],
+        "responses": {
+          "200": {"description": "Checksum", "schema": {"$ref": "#/definitions/mutationChecksum"}},
+          "400": {"description": "Invalid parameters", "schema": {"$ref": "#/definitions/error"}},
+          "404": {"description": "Cluster is not running or the mutation log is not enabled", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/audit/policy": {
+      "get": {
+        "operationId": "getAuditPolicy",
+        "summary": "Audit policy of a cluster set through the admin API",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "audit.k8s.io/v1alpha1 Policy", "schema": {"type": "object"}},
+          "404": {"description": "Cluster has no audit policy set", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "put": {
+        "operationId": "setAuditPolicy",
+        "summary": "Set the audit policy of a cluster, it replaces the policy of the cluster in Rancher and the global one and applies to the running server",
+        "consumes": ["application/json", "application/yaml"],
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "body", "in": "body", "required": true, "description": "audit.k8s.io/v1alpha1 Policy", "schema": {"type": "object"}}
+        ],
+        "responses": {
+          "200": {"description": "audit.k8s.io/v1alpha1 Policy", "schema": {"type": "object"}},
+          "422": {"description": "Invalid audit policy", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "delete": {
+        "operationId": "deleteAuditPolicy",
+        "summary": "Go back to the audit policy of a cluster in Rancher or the global one",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "204": {"description": "Audit policy removed"}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/status": {
+      "get": {
+        "operationId": "clusterStatus",
+        "summary": "Rancher and Kubernetes status of a cluster, its hosts, components and failing pods",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Cluster status", "schema": {"$ref": "#/definitions/clusterStatus"}},
+          "404": {"description": "Cluster is not running", "schema": {"$ref": "#/definitions/error"}},
+          "503": {"description": "Rancher is not reachable", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/inflight": {
+      "get": {
+        "operationId": "listInflight",
+        "summary": "Requests the clusters are serving, oldest first",
+        "parameters": [
+          {"name": "minAge", "in": "query", "type": "string", "description": "Only requests older than this, like 5m"}
+        ],
+        "responses": {
+          "200": {"description": "Requests being served", "schema": {"$ref": "#/definitions/activeRequestCollection"}},
+          "400": {"description": "Invalid minAge", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/deprecations": {
+      "get": {
+        "operationId": "deprecationReport",
+        "summary": "Clusters whose clients use deprecated APIs, to warn their tenants before an upgrade of Kubernetes",
+        "parameters": [
+          {"name": "removedBy", "in": "query", "type": "string", "description": "Only the APIs removed in this Kubernetes version or an earlier one, like 1.16"}
+        ],
+        "responses": {
+          "200": {"description": "Deprecated API usage per cluster", "schema": {"$ref": "#/definitions/clusterDeprecationCollection"}},
+          "400": {"description": "Invalid removedBy", "schema": {"$ref": "#/definitions/error"}},
+          "404": {"description": "Deprecated API usage is not tracked", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/inflight": {
+      "get": {
+        "operationId": "listClusterInflight",
+        "summary": "Requests a cluster is serving, oldest first",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "minAge", "in": "query", "type": "string", "description": "Only requests older than this, like 5m"}
+        ],
+        "responses": {
+          "200": {"description": "Requests being served", "schema": {"$ref": "#/definitions/activeRequestCollection"}},
+          "400": {"description": "Invalid minAge", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/deprecations": {
+      "get": {
+        "operationId": "listDeprecations",
+        "summary": "Requests to deprecated APIs of a cluster per resource and client in the last 30 days",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Deprecated API usage, most requested first", "schema": {"$ref": "#/definitions/deprecationCollection"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/admission": {
+      "get": {
+        "operationId": "getAdmissionConfig",
+        "summary": "Admission plugin configuration of a cluster",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Admission plugin configuration, empty if the defaults are used", "schema": {"$ref": "#/definitions/admissionConfig"}}
+        }
+      },
+      "put": {
+        "operationId": "setAdmissionConfig",
+        "summary": "Set the admission plugin configuration of a cluster and restart its server",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/admissionConfig"}}
+        ],
+        "responses": {
+          "200": {"description": "Admission plugin configuration", "schema": {"$ref": "#/definitions/admissionConfig"}},
+          "422": {"description": "Unknown admission plugin or image verifier", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "delete": {
+        "operationId": "deleteAdmissionConfig",
+        "summary": "Go back to the default admission plugins of a cluster and restart its server",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "204": {"description": "Admission plugin configuration removed"}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/certificates": {
+      "get": {
+        "operationId": "listCertificates",
+        "summary": "Certificates and keys a cluster is served with and when they expire",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Certificates", "schema": {"$ref": "#/definitions/certificateCollection"}},
+          "404": {"description": "Cluster is not running", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/certificates/{name}/rotate": {
+      "post": {
+        "operationId": "rotateCertificate",
+        "summary": "Replace a certificate or key of a cluster and what it signed, and restart its server",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "name", "in": "path", "required": true, "type": "string", "enum": ["ca", "serving", "service-account", "front-proxy-ca", "front-proxy-client"]}
+        ],
+        "responses": {
+          "200": {"description": "Certificates after the rotation", "schema": {"$ref": "#/definitions/certificateCollection"}},
+          "400": {"description": "Unknown certificate", "schema": {"$ref": "#/definitions/error"}},
+          "404": {"description": "Cluster is not running", "schema": {"$ref": "#/definitions/error"}},
+          "409": {"description": "Credentials of the cluster are being rotated", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/clusters/{clusterId}/rotation": {
+      "get": {
+        "operationId": "getRotation",
+        "summary": "Rotation of the credentials of a cluster in progress",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"}
+        ],
+        "responses": {
+          "200": {"description": "Rotation", "schema": {"$ref": "#/definitions/rotation"}},
+          "404": {"description": "Cluster is not running or has no rotation in progress", "schema": {"$ref": "#/definitions/error"}}
+        }
+      },
+      "post": {
+        "operationId": "startRotation",
+        "summary": "Rotate the CA, serving certificate and service account key of a cluster: the new ones are trusted, used after the overlap, and the old CA is no longer trusted after another overlap",
+        "parameters": [
+          {"name": "clusterId", "in": "path", "required": true, "type": "string"},
+          {"name": "body", "in": "body", "required": false, "schema": {"$ref": "#/definitions/rotationInput"}}
+        ],
+        "responses": {
+          "202": {"description": "Rotation started", "schema": {"$ref": "#/definitions/rotation"}},
+          "404": {"description": "Cluster is not running", "schema": {"$ref": "#/definitions/error"}},
+          "409": {"description": "Credentials of the cluster are being rotated", "schema": {"$ref": "#/definitions/error"}},
+          "422": {"description": "Invalid overlap", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/replication": {
+      "get": {
+        "operationId": "replicationStatus",
+        "summary": "Role of this netes and how far it lags behind the primary",
+        "responses": {
+          "200": {"description": "Replication status", "schema": {"$ref": "#/definitions/replicationStatus"}},
+          "404": {"description": "Replication is not configured", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/replication/promote": {
+      "post": {
+        "operationId": "promote",
+        "summary": "Stop replicating and accept writes to the replicated clusters",
+        "responses": {
+          "200": {"description": "Replication status", "schema": {"$ref": "#/definitions/replicationStatus"}},
+          "404": {"description": "Replication is not configured", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/v1/replication/demote": {
+      "post": {
+        "operationId": "demote",
+        "summary": "Reject writes to the replicated clusters and resume replicating from the primary",
+        "responses": {
+          "200": {"description": "Replication status", "schema": {"$ref": "#/definitions/replicationStatus"}},
+          "404": {"description": "Replication is not configured", "schema": {"$ref": "#/definitions/error"}}
+        }
+      }
+    },
+    "/metrics": {
+      "get": {
+        "operationId": "metrics",
+        "summary": "Prometheus metrics",
+        "produces": ["text/plain"],
+        "responses": {
+          "200": {"description": "Metrics in the Prometheus text format"}
+        }
+      }
+    },
+    "/healthz": {
+      "get": {
+        "operationId": "healthz",
+        "summary": "Whether the apiserver and storage of every running cluster are healthy, served without the token",
+        "responses": {
+          "200": {"description": "All clusters are healthy", "schema": {"$ref": "#/definitions/healthStatus"}},
+          "503": {"description": "A cluster is not healthy", "schema": {"$ref": "#/definitions/healthStatus"}}
+        }
+      }
+    },
+    "/readyz": {
+      "get": {
+        "operationId": "readyz",
+        "summary": "Whether every running cluster is healthy and connected to its hosts, served without the token",
+        "responses": {
+          "200": {"description": "All clusters are ready", "schema": {"$ref": "#/definitions/healthStatus"}},
+          "503": {"description": "A cluster is not ready or not checked yet", "schema": {"$ref": "#/definitions/healthStatus"}}
+        }
+      }
+    }
+  },
+  "definitions": {
+    "healthStatus": {
+      "type": "object",
+      "required": ["ok", "clusters"],
+      "properties": {
+        "ok": {"type": "boolean"},
+        "clusters": {"type": "array", "items": {"$ref": "#/definitions/clusterHealth"}}
+      }
+    },
+    "clusterHealth": {
+      "type": "object",
+      "required": ["id", "healthy", "ready", "checks", "checked"],
+      "properties": {
+        "id": {"type": "string"},
+        "healthy": {"type": "boolean"},
+        "ready": {"type": "boolean"},
+        "checks": {"type": "array", "items": {"$ref": "#/definitions/healthCheck"}},
+        "checked": {"type": "string", "format": "date-time"}
+      }
+    },
+    "healthCheck": {
+      "type": "object",
+      "required": ["name", "ok"],
+      "properties": {
+        "name": {"type": "string", "enum": ["apiserver", "storage", "tunnel"]},
+        "ok": {"type": "boolean"},
+        "message": {"type": "string"}
+      }
+    },
+    "error": {
+      "type": "object",
+      "properties": {
+        "status": {"type": "integer", "format": "int64"},
+        "code": {"type": "string"},
+        "message": {"type": "string"},
+        "detail": {"type": "string"}
+      }
+    },
+    "cluster": {
+      "type": "object",
+      "required": ["id", "name", "state", "uuid", "running", "objects", "storageBytes"],
+      "properties": {
+        "id": {"type": "string"},
+        "name": {"type": "string"},
+        "description": {"type": "string"},
+        "state": {"type": "string"},
+        "uuid": {"type": "string"},
+        "running": {"type": "boolean", "description": "Whether the server of the cluster runs on this netes"},
+        "objects": {"type": "integer", "format": "int64", "description": "Rows stored, zero when storage usage is not tracked"},
+        "storageBytes": {"type": "integer", "format": "int64"},
+        "status": {"$ref": "#/definitions/clusterStatus"}
+      }
+    },
+    "clusterCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/cluster"}}
+      }
+    },
+    "clusterInput": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "description": {"type": "string"},
+        "k8sServerConfig": {"type": "object", "description": "k8sServerConfig of the cluster like in the Rancher API"},
+        "template": {"type": "string", "description": "Template with the defaults of the settings not in k8sServerConfig"},
+        "account": {"type": "string", "description": "Account the cluster counts against the quota of"}
+      }
+    },
+    "template": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "description": {"type": "string"},
+        "admission": {"$ref": "#/definitions/admissionConfig"},
+        "featureGates": {"type": "array", "items": {"type": "string"}},
+        "auditPolicy": {"type": "string"},
+        "rbac": {"type": "string", "description": "Manifests applied when the cluster first starts"},
+        "storageClasses": {"type": "string", "description": "Manifests applied when the cluster first starts"}
+      }
+    },
+    "templateCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/template"}}
+      }
+    },
+    "storage": {
+      "type": "object",
+      "required": ["cluster", "resource", "prefix", "rows", "bytes"],
+      "properties": {
+        "cluster": {"type": "string"},
+        "resource": {"type": "string"},
+        "prefix": {"type": "string"},
+        "rows": {"type": "integer", "format": "int64"},
+        "bytes": {"type": "integer", "format": "int64"},
+        "updated": {"type": "string", "format": "date-time"}
+      }
+    },
+    "audit": {
+      "type": "object",
+      "required": ["id", "key", "operation", "user", "oldRevision", "newRevision", "time"],
+      "properties": {
+        "id": {"type": "integer", "format": "int64"},
+        "key": {"type": "string"},
+        "operation": {"type": "string", "enum": ["create", "update", "delete"]},
+        "user": {"type": "string"},
+        "oldRevision": {"type": "integer", "format": "int64"},
+        "newRevision": {"type": "integer", "format": "int64"},
+        "time": {"type": "string", "format": "date-time"}
+      }
+    },
+    "auditCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/audit"}}
+      }
+    },
+    "mutation": {
+      "type": "object",
+      "required": ["id", "key", "operation", "revision", "value", "time"],
+      "properties": {
+        "id": {"type": "integer", "format": "int64"},
+        "key": {"type": "string"},
+        "operation": {"type": "string", "enum": ["create", "update", "delete"]},
+        "revision": {"type": "integer", "format": "int64"},
+        "value": {"type": "string", "format": "byte", "x-nullable": true, "description": "Base64 encoded, null for deletes"},
+        "ttl": {"type": "integer", "format": "int64", "description": "Seconds to live the key was created with"},
+        "time": {"type": "string", "format": "date-time"}
+      }
+    },
+    "mutationCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/mutation"}}
+      }
+    },
+    "mutationChecksum": {
+      "type": "object",
+      "required": ["prefix", "count", "sha256", "current"],
+      "properties": {
+        "prefix": {"type": "string"},
+        "count": {"type": "integer", "format": "int64"},
+        "sha256": {"type": "string"},
+        "current": {"type": "boolean", "description": "Nothing but events was written after the given mutation"}
+      }
+    },
+    "clusterStatus": {
+      "type": "object",
+      "required": ["id", "name", "state", "healthy", "hosts", "components", "failingPods"],
+      "properties": {
+        "id": {"type": "string"},
+        "name": {"type": "string"},
+        "state": {"type": "string"},
+        "transitioning": {"type": "string"},
+        "transitioningMessage": {"type": "string"},
+        "healthy": {"type": "boolean"},
+        "hosts": {"type": "array", "items": {"$ref": "#/definitions/hostStatus"}},
+        "components": {"type": "array", "items": {"$ref": "#/definitions/componentStatus"}},
+        "failingPods": {"type": "array", "items": {"$ref": "#/definitions/podStatus"}},
+        "errors": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    "hostStatus": {
+      "type": "object",
+      "required": ["nodeName", "ready", "conditions"],
+      "properties": {
+        "id": {"type": "string"},
+        "name": {"type": "string"},
+        "nodeName": {"type": "string"},
+        "state": {"type": "string"},
+        "agentState": {"type": "string"},
+        "transitioningMessage": {"type": "string"},
+        "ready": {"type": "string", "enum": ["True", "False", "Unknown", ""]},
+        "conditions": {"type": "array", "items": {"$ref": "#/definitions/nodeCondition"}}
+      }
+    },
+    "nodeCondition": {
+      "type": "object",
+      "required": ["type", "status"],
+      "properties": {
+        "type": {"type": "string"},
+        "status": {"type": "string"},
+        "reason": {"type": "string"},
+        "message": {"type": "string"}
+      }
+    },
+    "componentStatus": {
+      "type": "object",
+      "required": ["name", "healthy"],
+      "properties": {
+        "name": {"type": "string"},
+        "healthy": {"type": "boolean"},
+        "message": {"type": "string"}
+      }
+    },
+    "podStatus": {
+      "type": "object",
+      "required": ["namespace", "name", "phase"],
+      "properties": {
+        "namespace": {"type": "string"},
+        "name": {"type": "string"},
+        "nodeName": {"type": "string"},
+        "phase": {"type": "string"},
+        "reason": {"type": "string"},
+        "message": {"type": "string"}
+      }
+    },
+    "activeRequest": {
+      "type": "object",
+      "required": ["cluster", "kind", "verb", "path", "started", "ageSeconds"],
+      "properties": {
+        "cluster": {"type": "string"},
+        "kind": {"type": "string", "enum": ["readonly", "mutating", "long-running"]},
+        "verb": {"type": "string"},
+        "resource": {"type": "string"},
+        "subresource": {"type": "string"},
+        "namespace": {"type": "string"},
+        "name": {"type": "string"},
+        "path": {"type": "string"},
+        "user": {"type": "string"},
+        "userAgent": {"type": "string"},
+        "started": {"type": "string", "format": "date-time"},
+        "ageSeconds": {"type": "number"}
+      }
+    },
+    "activeRequestCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/activeRequest"}}
+      }
+    },
+    "deprecation": {
+      "type": "object",
+      "required": ["group", "version", "resource", "replacement", "user", "userAgent", "verbs", "count", "firstSeen", "lastSeen"],
+      "properties": {
+        "group": {"type": "string"},
+        "version": {"type": "string"},
+        "resource": {"type": "string"},
+        "replacement": {"type": "string", "description": "API version to use instead"},
+        "removedIn": {"type": "string", "description": "Kubernetes version that no longer serves the API, like 1.16"},
+        "user": {"type": "string"},
+        "userAgent": {"type": "string"},
+        "verbs": {"type": "array", "items": {"type": "string"}},
+        "count": {"type": "integer", "format": "int64"},
+        "firstSeen": {"type": "string", "format": "date-time"},
+        "lastSeen": {"type": "string", "format": "date-time"}
+      }
+    },
+    "deprecationCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/deprecation"}}
+      }
+    },
+    "clusterDeprecation": {
+      "type": "object",
+      "required": ["cluster", "usages"],
+      "properties": {
+        "cluster": {"type": "string"},
+        "usages": {"type": "array", "items": {"$ref": "#/definitions/deprecation"}}
+      }
+    },
+    "clusterDeprecationCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/clusterDeprecation"}}
+      }
+    },
+    "admissionConfig": {
+      "type": "object",
+      "properties": {
+        "enabled": {"type": "array", "items": {"type": "string"}, "description": "Admission plugins replacing the defaults"},
+        "disabled": {"type": "array", "items": {"type": "string"}, "description": "Admission plugins removed from the defaults"},
+        "config": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Configuration file content by plugin name"},
+        "imageVerifier": {"type": "string", "description": "Registered image verifier checking the images of pods, like webhook, instead of the global one"},
+        "imageVerifierConfig": {"type": "string", "description": "Configuration of the image verifier, the URL for webhook"}
+      }
+    },
+    "certificate": {
+      "type": "object",
+      "required": ["name", "created", "expiring"],
+      "properties": {
+        "name": {"type": "string"},
+        "subject": {"type": "string", "description": "Common name, empty for the service account key"},
+        "notBefore": {"type": "string", "format": "date-time"},
+        "notAfter": {"type": "string", "format": "date-time"},
+        "created": {"type": "string", "format": "date-time"},
+        "expiring": {"type": "boolean", "description": "Rotated on the next check, CAs a year and certificates 30 days before they expire"}
+      }
+    },
+    "certificateCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/certificate"}}
+      }
+    },
+    "rotationInput": {
+      "type": "object",
+      "properties": {
+        "overlap": {"type": "string", "description": "How long each phase lasts, 24h by default"}
+      }
+    },
+    "rotation": {
+      "type": "object",
+      "required": ["phase", "started", "phaseStarted", "overlapSeconds", "next"],
+      "properties": {
+        "phase": {"type": "string", "enum": ["trusting", "switched"]},
+        "started": {"type": "string", "format": "date-time"},
+        "phaseStarted": {"type": "string", "format": "date-time"},
+        "overlapSeconds": {"type": "integer", "format": "int64"},
+        "next": {"type": "string", "format": "date-time", "description": "When the rotation moves on to its next phase or completes"}
+      }
+    },
+    "replicationTarget": {
+      "type": "object",
+      "required": ["cluster", "lastId", "diverged"],
+      "properties": {
+        "cluster": {"type": "string"},
+        "prefix": {"type": "string"},
+        "lastId": {"type": "integer", "format": "int64"},
+        "lastMutation": {"type": "string", "format": "date-time"},
+        "lastSync": {"type": "string", "format": "date-time"},
+        "lastVerified": {"type": "string", "format": "date-time"},
+        "diverged": {"type": "boolean"},
+        "error": {"type": "string"}
+      }
+    },
+    "replicationStatus": {
+      "type": "object",
+      "required": ["role", "source", "targets", "lagSeconds"],
+      "properties": {
+        "role": {"type": "string", "enum": ["primary", "standby"]},
+        "source": {"type": "string"},
+        "targets": {"type": "array", "items": {"$ref": "#/definitions/replicationTarget"}},
+        "lagSeconds": {"type": "number"}
+      }
+    },
+    "backup": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "cluster": {"type": "string"},
+        "clusterName": {"type": "string"},
+        "taken": {"type": "string", "format": "date-time"},
+        "objects": {"type": "integer", "format": "int64"},
+        "bytes": {"type": "integer", "format": "int64"}
+      }
+    },
+    "backupCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/backup"}}
+      }
+    },
+    "restoreInput": {
+      "type": "object",
+      "required": ["backup", "name"],
+      "properties": {
+        "backup": {"type": "string", "description": "Name of the backup"},
+        "name": {"type": "string", "description": "Name of the cluster to create"},
+        "description": {"type": "string"},
+        "account": {"type": "string", "description": "Account the cluster counts against the quota of"}
+      }
+    },
+    "restoreResult": {
+      "type": "object",
+      "required": ["cluster", "objects"],
+      "properties": {
+        "cluster": {"$ref": "#/definitions/cluster"},
+        "objects": {"type": "integer"}
+      }
+    },
+    "importInput": {
+      "type": "object",
+      "required": ["kubeconfig", "name"],
+      "properties": {
+        "kubeconfig": {"type": "string", "description": "Kubeconfig of the cluster to import, its current context is used"},
+        "name": {"type": "string", "description": "Name of the cluster to create"},
+        "description": {"type": "string"},
+        "k8sServerConfig": {"type": "object", "description": "Settings of the cluster, like the serviceNetCidr of the existing cluster"},
+        "account": {"type": "string", "description": "Account the cluster counts against the quota of"}
+      }
+    },
+    "importResult": {
+      "type": "object",
+      "required": ["cluster", "objects"],
+      "properties": {
+        "cluster": {"$ref": "#/definitions/cluster"},
+        "objects": {"type": "integer"},
+        "skipped": {"type": "array", "items": {"type": "string"}, "description": "What was left out and why"}
+      }
+    },
+    "gc": {
+      "type": "object",
+      "required": ["cluster", "uuid", "name", "state", "keys", "deleted"],
+      "properties": {
+        "cluster": {"type": "string"},
+        "uuid": {"type": "string"},
+        "name": {"type": "string"},
+        "etcd": {"type": "boolean", "description": "Objects are in the etcd of the cluster and not collected"},
+        "state": {"type": "string", "enum": ["hosted", "removed", "collecting", "collected"]},
+        "removed": {"type": "string", "format": "date-time"},
+        "keys": {"type": "integer", "format": "int64"},
+        "deleted": {"type": "integer", "format": "int64"},
+        "finished": {"type": "string", "format": "date-time"},
+        "error": {"type": "string"}
+      }
+    },
+    "gcCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/gc"}}
+      }
+    },
+    "storageCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/storage"}}
+      }
+    },
+    "quota": {
+      "type": "object",
+      "description": "Zero or missing limits are unlimited, objects and storageBytes are only enforced when storage usage is tracked",
+      "required": ["account"],
+      "properties": {
+        "account": {"type": "string"},
+        "clusters": {"type": "integer", "format": "int64"},
+        "objects": {"type": "integer", "format": "int64"},
+        "storageBytes": {"type": "integer", "format": "int64"}
+      }
+    },
+    "quotaStatus": {
+      "type": "object",
+      "required": ["account", "used"],
+      "properties": {
+        "account": {"type": "string"},
+        "clusters": {"type": "integer", "format": "int64"},
+        "objects": {"type": "integer", "format": "int64"},
+        "storageBytes": {"type": "integer", "format": "int64"},
+        "used": {"$ref": "#/definitions/quotaUsage"}
+      }
+    },
+    "quotaUsage": {
+      "type": "object",
+      "required": ["clusters", "objects", "storageBytes"],
+      "properties": {
+        "clusters": {"type": "integer", "format": "int64"},
+        "objects": {"type": "integer", "format": "int64"},
+        "storageBytes": {"type": "integer", "format": "int64"}
+      }
+    },
+    "quotaCollection": {
+      "type": "object",
+      "required": ["data"],
+      "properties": {
+        "data": {"type": "array", "items": {"$ref": "#/definitions/quota"}}
+      }
+    }
+  }
+}
+`
+
+func (s *Server) openAPI(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	rw.Header().Set("content-type", "application/json")
+	rw.Write([]byte(openAPISpec))
+}
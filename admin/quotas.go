@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/netes/quota"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+)
+
+// accountQuota is the quota of an account with what its clusters use of it
+type accountQuota struct {
+	*quota.Quota
+	Used quota.Usage `json:"used"`
+}
+
+func (s *Server) listQuotas(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	quotas, err := quota.List(context.Background(), kvClient)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if quotas == nil {
+		quotas = []*quota.Quota{}
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": quotas,
+	})
+}
+
+func (s *Server) getQuota(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.RancherClient == nil {
+		response(rw, http.StatusServiceUnavailable, "No Rancher configured")
+		return
+	}
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	q, err := quota.Get(ctx, kvClient, vars["account"])
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	} else if q == nil {
+		response(rw, http.StatusNotFound, fmt.Sprintf("Account %s has no quota", vars["account"]))
+		return
+	}
+
+	used, err := quota.Used(ctx, s.config, kvClient, q.Account)
+	if err != nil {
+		response(rw, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, &accountQuota{
+		Quota: q,
+		Used:  used,
+	})
+}
+
+func (s *Server) setQuota(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	q := &quota.Quota{}
+	if err := json.NewDecoder(req.Body).Decode(q); err != nil {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.Clusters < 0 || q.Objects < 0 || q.StorageBytes < 0 {
+		response(rw, http.StatusUnprocessableEntity, "Quotas can't be negative")
+		return
+	}
+	q.Account = vars["account"]
+
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := quota.Set(context.Background(), kvClient, q); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, q)
+}
+
+func (s *Server) deleteQuota(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := quota.Delete(context.Background(), kvClient, vars["account"]); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// checkQuota responds with why the account can't create another cluster, accounts without a quota always can
+func (s *Server) checkQuota(rw http.ResponseWriter, account string) bool {
+	if account == "" {
+		return true
+	}
+
+	kvClient, err := store.Client(s.config)
+	if err == nil {
+		err = quota.Check(context.Background(), s.config, kvClient, account)
+	}
+	if exceeded, ok := err.(*quota.ExceededError); ok {
+		response(rw, http.StatusForbidden, exceeded.Error())
+		return false
+	} else if err != nil {
+		response(rw, http.StatusServiceUnavailable, err.Error())
+		return false
+	}
+	return true
+}
+
+// setAccount counts a created cluster against the quota of its account
+func (s *Server) setAccount(rw http.ResponseWriter, clusterID, account string) bool {
+	if account == "" {
+		return true
+	}
+
+	kvClient, err := store.Client(s.config)
+	if err == nil {
+		err = quota.SetAccount(context.Background(), kvClient, clusterID, account)
+	}
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
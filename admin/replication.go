@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/replication"
+	"golang.org/x/net/context"
+)
+
+func (s *Server) replicationStatus(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.Replication == nil {
+		response(rw, http.StatusNotFound, "Replication is not configured")
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, s.config.Replication.Status())
+}
+
+func (s *Server) promote(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.Replication == nil {
+		response(rw, http.StatusNotFound, "Replication is not configured")
+		return
+	}
+
+	previous := s.config.Replication.Status().Role
+	if err := s.config.Replication.Promote(context.Background()); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if previous != replication.RolePrimary {
+		s.config.Events.Emit(events.Event{
+			Type:    events.StorageFailover,
+			Message: "Promoted to the primary of the replicated clusters, writes to them are allowed",
+			Details: map[string]string{"source": s.config.ReplicationSource},
+		})
+	}
+
+	writeJSON(rw, http.StatusOK, s.config.Replication.Status())
+}
+
+func (s *Server) demote(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.Replication == nil {
+		response(rw, http.StatusNotFound, "Replication is not configured")
+		return
+	}
+
+	if err := s.config.Replication.Demote(context.Background()); err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, s.config.Replication.Status())
+}
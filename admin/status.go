@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/status"
+)
+
+func (s *Server) clusterStatus(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	server := s.lookupServer(rw, vars["clusterId"])
+	if server == nil {
+		return
+	}
+
+	var rancherClient *client.RancherClient
+	if s.config.RancherClient != nil {
+		var err error
+		if rancherClient, err = s.config.RancherClient.Get(); err != nil {
+			response(rw, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	}
+
+	writeJSON(rw, http.StatusOK, status.Rollup(rancherClient, server))
+}
@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (s *Server) listStorage(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	if s.config.Usage == nil {
+		response(rw, http.StatusNotFound, "Storage usage is not tracked")
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": s.config.Usage.List(),
+	})
+}
+
+func (s *Server) metrics(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	prometheus.Handler().ServeHTTP(rw, req)
+}
@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/rancher/netes/templates"
+)
+
+func (s *Server) listTemplates(rw http.ResponseWriter, req *http.Request, vars map[string]string) {
+	list, err := templates.List(s.config)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if list == nil {
+		list = []*templates.Template{}
+	}
+
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"data": list,
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rancher/netes/tunnel"
+)
+
+// runAgent runs "netes agent" on a node, next to the Rancher agent whose credentials it uses, so netes can reach
+// the kubelet of the node through a tunnel the agent opens
+func runAgent(args []string) {
+	var url, node, addresses string
+	hostname, _ := os.Hostname()
+
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	flags.StringVar(&url, "url", "", "tunnel of the cluster, like wss://netes.example.com/k8s/clusters/1c1/tunnel")
+	flags.StringVar(&node, "node", hostname, "name of the node")
+	flags.StringVar(&addresses, "addresses", "", "comma separated addresses of the node the kubelet is dialed at")
+	flags.Parse(args)
+
+	if url == "" {
+		fmt.Fprintln(os.Stdout, "Missing -url")
+		os.Exit(1)
+	}
+
+	credentials := os.Getenv("CATTLE_ACCESS_KEY") + ":" + os.Getenv("CATTLE_SECRET_KEY")
+	agent := &tunnel.Agent{
+		URL:  url,
+		Node: node,
+		Header: http.Header{
+			"Authorization": []string{"Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))},
+		},
+	}
+	if addresses != "" {
+		agent.Addresses = strings.Split(addresses, ",")
+	}
+
+	agent.Run(context.Background())
+}
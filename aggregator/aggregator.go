@@ -0,0 +1,538 @@
+package aggregator
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/netes/certs"
+	"github.com/rancher/netes/clients"
+	"golang.org/x/net/context"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/clientset"
+	"k8s.io/kubernetes/pkg/master"
+)
+
+const (
+	syncInterval       = 10 * time.Second
+	apiServiceGroup    = "apiregistration.k8s.io"
+	apiServicesPath    = "/apis/apiregistration.k8s.io/v1beta1/apiservices"
+	remoteUserHeader   = "X-Remote-User"
+	remoteGroupHeader  = "X-Remote-Group"
+	remoteExtraPrefix  = "X-Remote-Extra-"
+	crdGroupPriority   = 1000
+	defaultServicePort = "443"
+	proxyFlushInterval = -1
+)
+
+// forwardedHeaders are the request headers passed on to the backends of APIServices.  Anything else, like the
+// credentials and cookies of clients or user headers they made up, stays with netes.
+var forwardedHeaders = map[string]bool{
+	"Accept":                    true,
+	"Accept-Encoding":           true,
+	"Connection":                true,
+	"Content-Encoding":          true,
+	"Content-Type":              true,
+	"If-Match":                  true,
+	"If-None-Match":             true,
+	"Sec-Websocket-Extensions":  true,
+	"Sec-Websocket-Key":         true,
+	"Sec-Websocket-Protocol":    true,
+	"Sec-Websocket-Version":     true,
+	"Upgrade":                   true,
+	"User-Agent":                true,
+	"X-Stream-Protocol-Version": true,
+}
+
+// apiService is the part of apiregistration.k8s.io/v1beta1 APIService netes uses
+type apiService struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              apiServiceSpec `json:"spec"`
+}
+
+type apiServiceSpec struct {
+	Service               *serviceReference `json:"service,omitempty"`
+	Group                 string            `json:"group,omitempty"`
+	Version               string            `json:"version,omitempty"`
+	InsecureSkipTLSVerify bool              `json:"insecureSkipTLSVerify,omitempty"`
+	CABundle              []byte            `json:"caBundle,omitempty"`
+	GroupPriorityMinimum  int32             `json:"groupPriorityMinimum"`
+	VersionPriority       int32             `json:"versionPriority"`
+}
+
+type serviceReference struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type apiServiceList struct {
+	Items []apiService `json:"items"`
+}
+
+type backend struct {
+	spec    apiServiceSpec
+	address string
+	proxy   *httputil.ReverseProxy
+}
+
+// Aggregator proxies the group versions registered by APIServices of a cluster to the service implementing
+// them, like kube-aggregator.  APIServices are stored as custom resources of the cluster.  Requests are
+// authenticated by netes and forwarded with the user in the X-Remote headers and a client certificate of
+// the front proxy CA, which the apiserver publishes in the extension-apiserver-authentication config map.
+// Discovery of /apis also lists the groups of CRDs and APIServices.  APIService status is not maintained.
+type Aggregator struct {
+	sync.Mutex
+	caPEM      []byte
+	clientCert *tls.Certificate
+	client     clientset.Interface
+	crdClient  apiextensionsclient.Interface
+	dialer     func(network, addr string) (net.Conn, error)
+	crdCreated bool
+	backends   map[string]*backend
+	crdGroups  map[string][]string
+	generation uint64
+}
+
+// New proxies with clientCert, signed by the front proxy CA in caPEM.  Both are rotated by the certs
+// package, which restarts the cluster to pick up the new ones.
+func New(caPEM []byte, clientCert *tls.Certificate, clientsetset *clients.ClientSetSet,
+	dialer func(network, addr string) (net.Conn, error)) (*Aggregator, error) {
+	crdClient, err := apiextensionsclient.NewForConfig(&clientsetset.LoopbackClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Aggregator{
+		caPEM:      caPEM,
+		clientCert: clientCert,
+		client:     clientsetset.ExternalClient,
+		crdClient:  crdClient,
+		dialer:     dialer,
+		backends:   map[string]*backend{},
+		crdGroups:  map[string][]string{},
+	}, nil
+}
+
+// RegistrationHook publishes the front proxy CA and headers to aggregated API servers
+func (a *Aggregator) RegistrationHook() master.ClientCARegistrationHook {
+	return master.ClientCARegistrationHook{
+		RequestHeaderUsernameHeaders:     []string{remoteUserHeader},
+		RequestHeaderGroupHeaders:        []string{remoteGroupHeader},
+		RequestHeaderExtraHeaderPrefixes: []string{remoteExtraPrefix},
+		RequestHeaderCA:                  a.caPEM,
+		RequestHeaderAllowedNames:        []string{certs.FrontProxyClientName},
+	}
+}
+
+func (a *Aggregator) Start(ctx context.Context) {
+	go wait.Until(a.sync, syncInterval, ctx.Done())
+}
+
+func (a *Aggregator) sync() {
+	if !a.crdCreated {
+		if err := a.ensureCRD(); err != nil {
+			logrus.Errorf("Failed to create APIService CRD: %v", err)
+			return
+		}
+		a.crdCreated = true
+	}
+
+	crds, err := a.crdClient.ApiextensionsV1beta1().CustomResourceDefinitions().List(metav1.ListOptions{})
+	if err != nil {
+		logrus.Errorf("Failed to list CRDs: %v", err)
+		return
+	}
+
+	crdGroups := map[string][]string{}
+	for _, crd := range crds.Items {
+		if !contains(crdGroups[crd.Spec.Group], crd.Spec.Version) {
+			crdGroups[crd.Spec.Group] = append(crdGroups[crd.Spec.Group], crd.Spec.Version)
+		}
+	}
+
+	apiServices, err := a.listAPIServices()
+	if err != nil {
+		logrus.Errorf("Failed to list APIServices: %v", err)
+		return
+	}
+
+	backends := map[string]*backend{}
+	for _, apiService := range apiServices {
+		spec := apiService.Spec
+		if spec.Service == nil || isLocal(spec.Group) {
+			continue
+		}
+
+		b, err := a.backend(spec)
+		if err != nil {
+			logrus.Errorf("Failed to proxy APIService %s: %v", apiService.Name, err)
+			continue
+		}
+		backends[spec.Group+"/"+spec.Version] = b
+	}
+
+	a.Lock()
+	if !reflect.DeepEqual(a.crdGroups, crdGroups) || !sameSpecs(a.backends, backends) {
+		a.generation++
+	}
+	a.crdGroups = crdGroups
+	a.backends = backends
+	a.Unlock()
+}
+
+// Generation changes whenever the groups of CRDs or APIServices change, and with them the discovery of the cluster
+func (a *Aggregator) Generation() uint64 {
+	a.Lock()
+	defer a.Unlock()
+	return a.generation
+}
+
+func sameSpecs(a, b map[string]*backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, backend := range a {
+		other, ok := b[key]
+		if !ok || !reflect.DeepEqual(backend.spec, other.spec) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Aggregator) getClientCert(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	a.Lock()
+	defer a.Unlock()
+	return a.clientCert, nil
+}
+
+func (a *Aggregator) ensureCRD() error {
+	_, err := a.crdClient.ApiextensionsV1beta1().CustomResourceDefinitions().Create(&v1beta1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "apiservices." + apiServiceGroup,
+		},
+		Spec: v1beta1.CustomResourceDefinitionSpec{
+			Group:   apiServiceGroup,
+			Version: "v1beta1",
+			Scope:   v1beta1.ClusterScoped,
+			Names: v1beta1.CustomResourceDefinitionNames{
+				Plural:   "apiservices",
+				Singular: "apiservice",
+				Kind:     "APIService",
+				ListKind: "APIServiceList",
+			},
+		},
+	})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func (a *Aggregator) listAPIServices() ([]apiService, error) {
+	content, err := a.client.Discovery().RESTClient().Get().AbsPath(apiServicesPath).DoRaw()
+	if apierrors.IsNotFound(err) {
+		// the CRD is not established yet
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	list := apiServiceList{}
+	if err := json.Unmarshal(content, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// isLocal is true for the groups served by the apiserver itself, APIServices can't take them over
+func isLocal(group string) bool {
+	return group == apiServiceGroup || group == v1beta1.GroupName || api.Registry.IsRegistered(group)
+}
+
+// backend returns the proxy to the service of spec, reusing the existing one if nothing changed
+func (a *Aggregator) backend(spec apiServiceSpec) (*backend, error) {
+	service, err := a.client.CoreV1().Services(spec.Service.Namespace).Get(spec.Service.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	address := net.JoinHostPort(service.Spec.ClusterIP, defaultServicePort)
+
+	a.Lock()
+	existing, ok := a.backends[spec.Group+"/"+spec.Version]
+	a.Unlock()
+	if ok && existing.address == address && reflect.DeepEqual(existing.spec, spec) {
+		return existing, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:           spec.Service.Name + "." + spec.Service.Namespace + ".svc",
+		InsecureSkipVerify:   spec.InsecureSkipTLSVerify,
+		GetClientCertificate: a.getClientCert,
+	}
+	if len(spec.CABundle) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(spec.CABundle)
+	}
+
+	return &backend{
+		spec:    spec,
+		address: address,
+		proxy: &httputil.ReverseProxy{
+			Director: func(req *http.Request) {
+				req.URL.Scheme = "https"
+				req.URL.Host = address
+				req.Host = tlsConfig.ServerName
+			},
+			Transport: &http.Transport{
+				Dial:            a.dialer,
+				TLSClientConfig: tlsConfig,
+			},
+			FlushInterval: proxyFlushInterval,
+		},
+	}, nil
+}
+
+// Filter serves aggregated APIs and discovery in front of handler, it must run after authentication
+func (a *Aggregator) Filter(handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		if parts[0] == "apis" {
+			switch {
+			case len(parts) == 1 && req.Method == http.MethodGet:
+				a.serveGroupList(rw, req, handler)
+				return
+			case len(parts) == 2 && req.Method == http.MethodGet:
+				if group, ok := a.group(parts[1]); ok {
+					writeJSON(rw, group)
+					return
+				}
+			case len(parts) > 2:
+				a.Lock()
+				b, ok := a.backends[parts[1]+"/"+parts[2]]
+				a.Unlock()
+				if ok {
+					a.proxy(rw, req, b, mapper)
+					return
+				}
+			}
+		}
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+func (a *Aggregator) proxy(rw http.ResponseWriter, req *http.Request, b *backend, mapper apirequest.RequestContextMapper) {
+	ctx, ok := mapper.Get(req)
+	if !ok {
+		http.Error(rw, "missing request context", http.StatusInternalServerError)
+		return
+	}
+	user, ok := apirequest.UserFrom(ctx)
+	if !ok {
+		http.Error(rw, "missing user", http.StatusInternalServerError)
+		return
+	}
+
+	proxyReq := *req
+	proxyReq.Header = http.Header{}
+	for k, v := range req.Header {
+		if forwardedHeaders[http.CanonicalHeaderKey(k)] {
+			proxyReq.Header[k] = v
+		}
+	}
+	proxyReq.Header.Set(remoteUserHeader, user.GetName())
+	for _, group := range user.GetGroups() {
+		proxyReq.Header.Add(remoteGroupHeader, group)
+	}
+	for key, values := range user.GetExtra() {
+		for _, value := range values {
+			proxyReq.Header.Add(remoteExtraPrefix+key, value)
+		}
+	}
+
+	b.proxy.ServeHTTP(rw, &proxyReq)
+}
+
+// groups returns the groups of CRDs and APIServices, the apiserver only lists its own groups
+func (a *Aggregator) groups() []metav1.APIGroup {
+	a.Lock()
+	defer a.Unlock()
+
+	type groupVersions struct {
+		priority int32
+		versions []*backend
+	}
+
+	var result []metav1.APIGroup
+	byGroup := map[string]*groupVersions{}
+	for _, b := range a.backends {
+		g, ok := byGroup[b.spec.Group]
+		if !ok {
+			g = &groupVersions{}
+			byGroup[b.spec.Group] = g
+		}
+		if b.spec.GroupPriorityMinimum > g.priority {
+			g.priority = b.spec.GroupPriorityMinimum
+		}
+		g.versions = append(g.versions, b)
+	}
+
+	priorities := map[string]int32{}
+	for name, g := range byGroup {
+		sort.Slice(g.versions, func(i, j int) bool {
+			if g.versions[i].spec.VersionPriority != g.versions[j].spec.VersionPriority {
+				return g.versions[i].spec.VersionPriority > g.versions[j].spec.VersionPriority
+			}
+			return g.versions[i].spec.Version < g.versions[j].spec.Version
+		})
+		var versions []string
+		for _, b := range g.versions {
+			versions = append(versions, b.spec.Version)
+		}
+		result = append(result, apiGroup(name, versions))
+		priorities[name] = g.priority
+	}
+
+	for name, versions := range a.crdGroups {
+		if _, ok := byGroup[name]; !ok {
+			result = append(result, apiGroup(name, versions))
+			priorities[name] = crdGroupPriority
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if priorities[result[i].Name] != priorities[result[j].Name] {
+			return priorities[result[i].Name] > priorities[result[j].Name]
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// group returns the discovery of a group served only by APIServices
+func (a *Aggregator) group(name string) (metav1.APIGroup, bool) {
+	a.Lock()
+	_, isCRDGroup := a.crdGroups[name]
+	a.Unlock()
+	if isCRDGroup {
+		// served by the apiextensions server
+		return metav1.APIGroup{}, false
+	}
+
+	for _, group := range a.groups() {
+		if group.Name == name {
+			return group, true
+		}
+	}
+	return metav1.APIGroup{}, false
+}
+
+func apiGroup(name string, versions []string) metav1.APIGroup {
+	group := metav1.APIGroup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIGroup",
+			APIVersion: "v1",
+		},
+		Name: name,
+	}
+	for _, version := range versions {
+		group.Versions = append(group.Versions, metav1.GroupVersionForDiscovery{
+			GroupVersion: name + "/" + version,
+			Version:      version,
+		})
+	}
+	if len(group.Versions) > 0 {
+		group.PreferredVersion = group.Versions[0]
+	}
+	return group
+}
+
+func (a *Aggregator) serveGroupList(rw http.ResponseWriter, req *http.Request, handler http.Handler) {
+	localReq := *req
+	localReq.Header = http.Header{}
+	for k, v := range req.Header {
+		localReq.Header[k] = v
+	}
+	localReq.Header.Set("Accept", "application/json")
+
+	local := &bufferedResponse{
+		header: http.Header{},
+		code:   http.StatusOK,
+	}
+	handler.ServeHTTP(local, &localReq)
+
+	groupList := metav1.APIGroupList{}
+	if local.code != http.StatusOK || json.Unmarshal(local.body.Bytes(), &groupList) != nil {
+		local.writeTo(rw)
+		return
+	}
+
+	served := map[string]bool{}
+	for _, group := range groupList.Groups {
+		served[group.Name] = true
+	}
+	for _, group := range a.groups() {
+		if !served[group.Name] {
+			groupList.Groups = append(groupList.Groups, group)
+		}
+	}
+
+	writeJSON(rw, groupList)
+}
+
+func writeJSON(rw http.ResponseWriter, obj interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(obj)
+}
+
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	b.code = code
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) writeTo(rw http.ResponseWriter) {
+	for k, v := range b.header {
+		rw.Header()[k] = v
+	}
+	rw.WriteHeader(b.code)
+	rw.Write(b.body.Bytes())
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
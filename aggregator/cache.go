@@ -0,0 +1,155 @@
+package aggregator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const maxCachedResponses = 64
+
+// openAPIPaths are the OpenAPI documents of the apiserver, discovery paths are matched by cacheable
+var openAPIPaths = map[string]bool{
+	"/swagger.json":           true,
+	"/swagger-2.0.0.pb-v1":    true,
+	"/swagger-2.0.0.pb-v1.gz": true,
+	"/openapi/v2":             true,
+	"/openapi/v3":             true,
+}
+
+type cachedResponse struct {
+	generation uint64
+	header     http.Header
+	body       []byte
+	etag       string
+}
+
+// Cache serves repeated discovery and OpenAPI requests of a cluster from memory.  Responses are kept until
+// the generation of the aggregator changes, that is until the CRDs or APIServices of the cluster change.
+type Cache struct {
+	sync.Mutex
+	aggregator *Aggregator
+	responses  map[string]*cachedResponse
+}
+
+// NewCache caches the discovery served through the Filter of a
+func (a *Aggregator) NewCache() *Cache {
+	return &Cache{
+		aggregator: a,
+		responses:  map[string]*cachedResponse{},
+	}
+}
+
+// Filter caches the discovery and OpenAPI responses of handler, it must run after authorization
+func (c *Cache) Filter(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || !c.cacheable(req.URL.Path) {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		key := req.URL.Path + "|" + req.Header.Get("Accept") + "|" + req.Header.Get("Accept-Encoding")
+		generation := c.aggregator.Generation()
+
+		c.Lock()
+		cached, ok := c.responses[key]
+		c.Unlock()
+		if !ok || cached.generation != generation {
+			local := &bufferedResponse{
+				header: http.Header{},
+				code:   http.StatusOK,
+			}
+			handler.ServeHTTP(local, req)
+			if local.code != http.StatusOK {
+				local.writeTo(rw)
+				return
+			}
+			cached = newCachedResponse(generation, local)
+			c.store(key, cached)
+		}
+
+		cached.writeTo(rw, req)
+	})
+}
+
+// cacheable is true for the OpenAPI documents and the discovery not proxied to APIServices
+func (c *Cache) cacheable(path string) bool {
+	if openAPIPaths[path] {
+		return true
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "api":
+		return len(parts) <= 2
+	case parts[0] == "apis" && len(parts) <= 2:
+		return true
+	case parts[0] == "apis" && len(parts) == 3:
+		c.aggregator.Lock()
+		_, proxied := c.aggregator.backends[parts[1]+"/"+parts[2]]
+		c.aggregator.Unlock()
+		return !proxied
+	}
+	return false
+}
+
+func (c *Cache) store(key string, response *cachedResponse) {
+	c.Lock()
+	defer c.Unlock()
+
+	for k, existing := range c.responses {
+		if existing.generation != response.generation {
+			delete(c.responses, k)
+		}
+	}
+	// the key includes headers of the client, don't let odd ones grow the cache without bound
+	if _, ok := c.responses[key]; ok || len(c.responses) < maxCachedResponses {
+		c.responses[key] = response
+	}
+}
+
+func newCachedResponse(generation uint64, local *bufferedResponse) *cachedResponse {
+	body := local.body.Bytes()
+	etag := local.header.Get("Etag")
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+
+	header := http.Header{}
+	for k, v := range local.header {
+		header[k] = v
+	}
+	header.Set("Etag", etag)
+
+	return &cachedResponse{
+		generation: generation,
+		header:     header,
+		body:       body,
+		etag:       etag,
+	}
+}
+
+func (r *cachedResponse) writeTo(rw http.ResponseWriter, req *http.Request) {
+	for k, v := range r.header {
+		rw.Header()[k] = v
+	}
+	if matchesETag(req.Header.Get("If-None-Match"), r.etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(r.body)
+}
+
+func matchesETag(ifNoneMatch, etag string) bool {
+	for _, value := range strings.Split(ifNoneMatch, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == etag || value == "*" {
+			return true
+		}
+	}
+	return false
+}
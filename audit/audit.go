@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1alpha1 "k8s.io/apiserver/pkg/apis/audit/v1alpha1"
+	"k8s.io/apiserver/pkg/apis/audit/validation"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+)
+
+const (
+	ClusterLabel = "netes.rancher.io/cluster-id"
+	AccountLabel = "netes.rancher.io/account-id"
+)
+
+var (
+	writersLock sync.Mutex
+	// the clusters share the log file
+	writers = map[string]io.Writer{}
+)
+
+func init() {
+	// the audit filter only runs for clusters with an audit log or webhook, others keep the upstream default of no
+	// audit
+	if err := utilfeature.DefaultFeatureGate.Set("AdvancedAuditing=true"); err != nil {
+		panic(err)
+	}
+}
+
+// New returns the audit backend and policy of a cluster, both nil if the cluster has no audit log or webhook.  The
+// policy set through the admin API replaces the policy set for the cluster in Rancher, which replaces the global
+// one, and is applied while the cluster runs.  The webhook kubeconfig set for the cluster in Rancher replaces the
+// global one, events are labeled with the cluster and the Rancher account of the user.
+func New(config *types.GlobalConfig, cluster *client.Cluster) (audit.Backend, policy.Checker, error) {
+	policyContent := []byte(cluster.K8sServerConfig.AuditPolicy)
+	if len(policyContent) == 0 && config.AuditPolicyFile != "" {
+		var err error
+		if policyContent, err = ioutil.ReadFile(config.AuditPolicyFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var fallback policy.Checker
+	if len(policyContent) > 0 {
+		auditPolicy, err := parsePolicy(policyContent)
+		if err != nil {
+			return nil, nil, err
+		}
+		fallback = policy.NewChecker(auditPolicy)
+	}
+
+	var backends []audit.Backend
+	if config.AuditLogPath != "" {
+		backends = append(backends, &logBackend{
+			out: writer(config.AuditLogPath),
+		})
+	}
+
+	webhookConfig := []byte(cluster.K8sServerConfig.AuditWebhookConfig)
+	if len(webhookConfig) == 0 && config.AuditWebhookConfigFile != "" {
+		var err error
+		if webhookConfig, err = ioutil.ReadFile(config.AuditWebhookConfigFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(webhookConfig) > 0 {
+		backend, err := newWebhook(config, cluster, webhookConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		backends = append(backends, backend)
+	}
+
+	if len(backends) == 0 {
+		if fallback != nil {
+			logrus.Warnf("Cluster %s has an audit policy but no audit log or webhook is configured", cluster.Id)
+		}
+		return nil, nil, nil
+	}
+
+	kvClient, err := store.Client(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamic := &dynamicPolicy{
+		kvClient:  kvClient,
+		clusterID: cluster.Id,
+		fallback:  fallback,
+	}
+	if err := dynamic.refresh(context.Background()); err != nil {
+		return nil, nil, err
+	}
+
+	return &labeledBackend{
+		Backend:   audit.Union(backends...),
+		clusterID: cluster.Id,
+		policy:    dynamic,
+	}, dynamic, nil
+}
+
+func parsePolicy(content []byte) (*auditinternal.Policy, error) {
+	versioned := &auditv1alpha1.Policy{}
+	decoder := audit.Codecs.UniversalDecoder(auditv1alpha1.SchemeGroupVersion)
+	if err := runtime.DecodeInto(decoder, content, versioned); err != nil {
+		return nil, fmt.Errorf("failed decoding audit policy: %v", err)
+	}
+
+	auditPolicy := &auditinternal.Policy{}
+	if err := audit.Scheme.Convert(versioned, auditPolicy, nil); err != nil {
+		return nil, fmt.Errorf("failed converting audit policy: %v", err)
+	}
+	if err := validation.ValidatePolicy(auditPolicy); err != nil {
+		return nil, err.ToAggregate()
+	}
+	return auditPolicy, nil
+}
+
+func writer(path string) io.Writer {
+	if path == "-" {
+		return os.Stdout
+	}
+
+	writersLock.Lock()
+	defer writersLock.Unlock()
+
+	w, ok := writers[path]
+	if !ok {
+		w = &lumberjack.Logger{
+			Filename: path,
+		}
+		writers[path] = w
+	}
+	return w
+}
+
+// logBackend writes an audit.k8s.io/v1alpha1 event in JSON per line, unlike the upstream log format the lines
+// include the labels of the events
+type logBackend struct {
+	out io.Writer
+}
+
+func (l *logBackend) ProcessEvents(events ...*auditinternal.Event) {
+	encoder := audit.Codecs.LegacyCodec(auditv1alpha1.SchemeGroupVersion)
+	for _, ev := range events {
+		content, err := runtime.Encode(encoder, ev)
+		if err != nil {
+			audit.HandlePluginError("log", err, ev)
+			continue
+		}
+
+		if _, err := l.out.Write(append(content, '\n')); err != nil {
+			audit.HandlePluginError("log", err, ev)
+		}
+	}
+}
+
+func (l *logBackend) Run(stopCh <-chan struct{}) error {
+	return nil
+}
+
+// labeledBackend labels events with the cluster and the Rancher account of the user, the events of the
+// apiserver are shared with other backends so they are copied
+type labeledBackend struct {
+	audit.Backend
+	clusterID string
+	policy    *dynamicPolicy
+}
+
+func (l *labeledBackend) Run(stopCh <-chan struct{}) error {
+	go l.policy.run(stopCh)
+	return l.Backend.Run(stopCh)
+}
+
+func (l *labeledBackend) ProcessEvents(events ...*auditinternal.Event) {
+	labeled := make([]*auditinternal.Event, 0, len(events))
+	for _, ev := range events {
+		labeledEvent := *ev
+		labeledEvent.Labels = map[string]string{}
+		for k, v := range ev.Labels {
+			labeledEvent.Labels[k] = v
+		}
+		labeledEvent.Labels[ClusterLabel] = l.clusterID
+		if ev.User.UID != "" {
+			labeledEvent.Labels[AccountLabel] = ev.User.UID
+		}
+		labeled = append(labeled, &labeledEvent)
+	}
+	l.Backend.ProcessEvents(labeled...)
+}
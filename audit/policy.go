@@ -0,0 +1,184 @@
+package audit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1alpha1 "k8s.io/apiserver/pkg/apis/audit/v1alpha1"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	policyPrefix = "/netes/audit/policies/"
+	// other netes serving a cluster pick up changes of its policy within policyRefresh
+	policyRefresh = 30 * time.Second
+)
+
+var (
+	policiesLock sync.Mutex
+	// the policies of the audited clusters running in this process
+	policies = map[string]*dynamicPolicy{}
+)
+
+// LoadPolicy returns the audit.k8s.io/v1alpha1 policy of a cluster set through the admin API in JSON, nil if none
+// is set
+func LoadPolicy(ctx context.Context, kvClient kv.Client, clusterID string) ([]byte, error) {
+	current, err := kvClient.Get(ctx, policyPrefix+clusterID)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return current.Value, nil
+}
+
+// SavePolicy validates and stores the audit policy of a cluster, in JSON or YAML, and applies it to the running
+// server of the cluster.  The policy replaces the one of the cluster in Rancher and the global one.
+func SavePolicy(ctx context.Context, kvClient kv.Client, clusterID string, content []byte) ([]byte, error) {
+	versioned, err := decodePolicy(content)
+	if err != nil {
+		return nil, err
+	}
+	value, err := runtime.Encode(audit.Codecs.LegacyCodec(auditv1alpha1.SchemeGroupVersion), versioned)
+	if err != nil {
+		return nil, err
+	}
+
+	key := policyPrefix + clusterID
+	current, err := kvClient.Get(ctx, key)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		_, err = kvClient.Create(ctx, key, value, 0)
+	} else if err == nil {
+		_, err = kvClient.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, apply(ctx, clusterID)
+}
+
+// DeletePolicy removes the audit policy of a cluster set through the admin API, the running server of the cluster
+// goes back to the policy it was started with
+func DeletePolicy(ctx context.Context, kvClient kv.Client, clusterID string) error {
+	if _, err := kvClient.Delete(ctx, policyPrefix+clusterID); err != nil && err != kv.ErrNotExists {
+		return err
+	}
+	return apply(ctx, clusterID)
+}
+
+func apply(ctx context.Context, clusterID string) error {
+	policiesLock.Lock()
+	p, ok := policies[clusterID]
+	policiesLock.Unlock()
+	if !ok {
+		return nil
+	}
+	return p.refresh(ctx)
+}
+
+// ValidatePolicy checks an audit policy in JSON or YAML
+func ValidatePolicy(content []byte) error {
+	_, err := parsePolicy(content)
+	return err
+}
+
+func decodePolicy(content []byte) (*auditv1alpha1.Policy, error) {
+	if _, err := parsePolicy(content); err != nil {
+		return nil, err
+	}
+	versioned := &auditv1alpha1.Policy{}
+	decoder := audit.Codecs.UniversalDecoder(auditv1alpha1.SchemeGroupVersion)
+	return versioned, runtime.DecodeInto(decoder, content, versioned)
+}
+
+type checkerHolder struct {
+	policy.Checker
+}
+
+// dynamicPolicy checks requests against the policy of a cluster set through the admin API, or the policy the
+// server started with when none is set.  A nil policy audits nothing.
+type dynamicPolicy struct {
+	kvClient  kv.Client
+	clusterID string
+	fallback  policy.Checker
+
+	lock     sync.Mutex
+	loaded   bool
+	revision int64
+	checker  atomic.Value
+}
+
+func (d *dynamicPolicy) Level(attrs authorizer.Attributes) auditinternal.Level {
+	holder, _ := d.checker.Load().(checkerHolder)
+	if holder.Checker == nil {
+		return auditinternal.LevelNone
+	}
+	return holder.Level(attrs)
+}
+
+func (d *dynamicPolicy) refresh(ctx context.Context) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	current, err := d.kvClient.Get(ctx, policyPrefix+d.clusterID)
+	if err == kv.ErrNotExists {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+
+	var revision int64
+	if current != nil {
+		revision = current.Revision
+	}
+	if d.loaded && revision == d.revision {
+		return nil
+	}
+
+	checker := d.fallback
+	if current != nil {
+		auditPolicy, err := parsePolicy(current.Value)
+		if err != nil {
+			return err
+		}
+		checker = policy.NewChecker(auditPolicy)
+	}
+
+	if d.loaded {
+		logrus.Infof("Applying the changed audit policy of cluster %s", d.clusterID)
+	}
+	d.checker.Store(checkerHolder{checker})
+	d.loaded = true
+	d.revision = revision
+	return nil
+}
+
+// run picks up the changes of the policy made on other netes until stopCh is closed
+func (d *dynamicPolicy) run(stopCh <-chan struct{}) {
+	policiesLock.Lock()
+	policies[d.clusterID] = d
+	policiesLock.Unlock()
+
+	defer func() {
+		policiesLock.Lock()
+		if policies[d.clusterID] == d {
+			delete(policies, d.clusterID)
+		}
+		policiesLock.Unlock()
+	}()
+
+	wait.Until(func() {
+		if err := d.refresh(context.Background()); err != nil {
+			logrus.Errorf("Failed to refresh the audit policy of cluster %s: %v", d.clusterID, err)
+		}
+	}, policyRefresh, stopCh)
+}
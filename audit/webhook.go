@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/proxy"
+	"github.com/rancher/netes/types"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1alpha1 "k8s.io/apiserver/pkg/apis/audit/v1alpha1"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/util/webhook"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	webhookPluginName = "webhook"
+
+	// like the batch mode of the upstream webhook backend
+	webhookBufferSize   = 1000
+	webhookBatchSize    = 100
+	webhookBatchWait    = time.Minute
+	webhookRetryBackoff = 500 * time.Millisecond
+)
+
+// webhookBackend sends the events of a cluster to its webhook in batches like the upstream batch webhook, which
+// can't be given a transport.  The webhook is called through the outbound transport of the cluster.
+type webhookBackend struct {
+	restClient *rest.RESTClient
+	// the events are encoded as they are processed, upstream reuses them afterwards
+	buffer chan json.RawMessage
+}
+
+func newWebhook(config *types.GlobalConfig, cluster *client.Cluster, kubeconfig []byte) (audit.Backend, error) {
+	restClient, err := proxy.OutboundWebhook(config, cluster, kubeconfig,
+		audit.Codecs.LegacyCodec(auditv1alpha1.SchemeGroupVersion))
+	if err != nil {
+		return nil, err
+	}
+	return &webhookBackend{
+		restClient: restClient,
+		buffer:     make(chan json.RawMessage, webhookBufferSize),
+	}, nil
+}
+
+func (w *webhookBackend) ProcessEvents(events ...*auditinternal.Event) {
+	for i, e := range events {
+		versioned := &auditv1alpha1.Event{}
+		if err := audit.Scheme.Convert(e, versioned, nil); err != nil {
+			audit.HandlePluginError(webhookPluginName, err, e)
+			continue
+		}
+		data, err := json.Marshal(versioned)
+		if err != nil {
+			audit.HandlePluginError(webhookPluginName, err, e)
+			continue
+		}
+
+		select {
+		case w.buffer <- data:
+		default:
+			audit.HandlePluginError(webhookPluginName, fmt.Errorf("audit webhook queue blocked"), events[i:]...)
+			return
+		}
+	}
+}
+
+// Run sends batches until stopCh is closed, a batch is sent once it is full or has waited webhookBatchWait
+func (w *webhookBackend) Run(stopCh <-chan struct{}) error {
+	go func() {
+		for {
+			batch, stopped := w.collect(stopCh)
+			if len(batch) > 0 {
+				// the next batch is collected while this one is sent
+				go w.send(batch)
+			}
+			if stopped {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (w *webhookBackend) collect(stopCh <-chan struct{}) ([]json.RawMessage, bool) {
+	timer := time.NewTimer(webhookBatchWait)
+	defer timer.Stop()
+
+	var batch []json.RawMessage
+	for len(batch) < webhookBatchSize {
+		select {
+		case e := <-w.buffer:
+			batch = append(batch, e)
+		case <-timer.C:
+			return batch, false
+		case <-stopCh:
+			return batch, true
+		}
+	}
+	return batch, false
+}
+
+func (w *webhookBackend) send(batch []json.RawMessage) {
+	body, err := json.Marshal(map[string]interface{}{
+		"kind":       "EventList",
+		"apiVersion": auditv1alpha1.SchemeGroupVersion.String(),
+		"items":      batch,
+	})
+	if err == nil {
+		err = webhook.WithExponentialBackoff(webhookRetryBackoff, func() error {
+			return w.restClient.Post().SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+		})
+	}
+	if err != nil {
+		logrus.Errorf("Failed to send %d audit events to the webhook: %v", len(batch), err)
+	}
+}
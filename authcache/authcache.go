@@ -0,0 +1,118 @@
+package authcache
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+const cacheSize = 4096
+
+var (
+	requestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_auth_cache_requests_total",
+		Help: "Lookups of cached authentication and authorization results, per cache and hit or miss",
+	}, []string{"cache", "result"})
+	invalidationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_auth_cache_invalidations_total",
+		Help: "Cached authentication and authorization results dropped because of a change in Rancher, per resource type",
+	}, []string{"resource"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsCounter)
+	prometheus.MustRegister(invalidationsCounter)
+}
+
+// Invalidator drops the cached authentication and authorization results of clusters when Rancher reports a change
+// that may make them wrong, like a deleted API key or a changed project member.  Every invalidation starts a new
+// generation, results of older generations are never returned again.
+type Invalidator struct {
+	sync.RWMutex
+	all      uint64
+	clusters map[string]uint64
+}
+
+func NewInvalidator() *Invalidator {
+	return &Invalidator{
+		clusters: map[string]uint64{},
+	}
+}
+
+// Invalidate drops the results of a cluster, of all clusters if clusterID is empty
+func (i *Invalidator) Invalidate(resource, clusterID string) {
+	if i == nil {
+		return
+	}
+
+	i.Lock()
+	if clusterID == "" {
+		i.all++
+	} else {
+		i.clusters[clusterID]++
+	}
+	i.Unlock()
+	invalidationsCounter.WithLabelValues(resource).Inc()
+}
+
+// Forget drops the generation of a removed cluster
+func (i *Invalidator) Forget(clusterID string) {
+	if i == nil {
+		return
+	}
+	i.Lock()
+	delete(i.clusters, clusterID)
+	i.Unlock()
+}
+
+// Generation changes whenever the results of the cluster are invalidated
+func (i *Invalidator) Generation(clusterID string) string {
+	if i == nil {
+		return ""
+	}
+	i.RLock()
+	defer i.RUnlock()
+	return strconv.FormatUint(i.all, 10) + "." + strconv.FormatUint(i.clusters[clusterID], 10)
+}
+
+// Cache holds authentication or authorization results of a cluster for a TTL or until they are invalidated
+type Cache struct {
+	name        string
+	clusterID   string
+	invalidator *Invalidator
+	lru         *cache.LRUExpireCache
+}
+
+// New returns the cache name of a cluster, invalidator may be nil
+func New(name, clusterID string, invalidator *Invalidator) *Cache {
+	return &Cache{
+		name:        name,
+		clusterID:   clusterID,
+		invalidator: invalidator,
+		lru:         cache.NewLRUExpireCache(cacheSize),
+	}
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+	value, ok := c.lru.Get(c.key(key))
+	if ok {
+		requestsCounter.WithLabelValues(c.name, "hit").Inc()
+	} else {
+		requestsCounter.WithLabelValues(c.name, "miss").Inc()
+	}
+	return value, ok
+}
+
+func (c *Cache) Add(key string, value interface{}, ttl time.Duration) {
+	if ttl > 0 {
+		c.lru.Add(c.key(key), value, ttl)
+	}
+}
+
+// key puts the generation into the key, results of older generations expire or are evicted unseen
+func (c *Cache) key(key string) string {
+	return c.invalidator.Generation(c.clusterID) + "/" + key
+}
@@ -1,22 +1,94 @@
 package authentication
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/authcache"
 	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/types"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/pkg/authentication/group"
+	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
+	"k8s.io/apiserver/pkg/authentication/request/union"
 	"k8s.io/apiserver/pkg/authentication/user"
 )
 
+// Authenticator validates the Rancher credentials of a request, an API key pair, a bearer token or the UI token
+// cookie, by looking up the cluster with them.  The Rancher identity that can see the cluster becomes the
+// Kubernetes user.  Results are cached by credential so Rancher is not asked on every request, failures for a
+// shorter time so a new key works quickly.  Changes of keys and project members in Rancher drop the cache.  While
+// Rancher is unreachable successful results are used for up to offlineTTL.
 type Authenticator struct {
 	clusterLookup *cluster.Lookup
+	cache         *authcache.Cache
+	offline       *authcache.Cache
+	ttl           time.Duration
+	negativeTTL   time.Duration
+	offlineTTL    time.Duration
 }
 
-func New(clusterLookup *cluster.Lookup) authenticator.Request {
-	return group.NewAuthenticatedGroupAdder(&Authenticator{
-		clusterLookup: clusterLookup,
+const (
+	// Loopback authenticates the apiserver calling itself
+	Loopback = "loopback"
+	// ServiceAccount authenticates the tokens of the service accounts of the cluster
+	ServiceAccount = "service-account"
+	// Localhost authenticates requests without credentials from the host netes runs on, see InsecureLocalhost
+	Localhost = "insecure-localhost"
+)
+
+type cached struct {
+	info user.Info
+}
+
+// New authenticates requests to a cluster, loopbackToken is the bearer token the apiserver uses to call itself.
+// Service account tokens are checked first since they are verified without asking anyone, then the authentication
+// chain of the cluster.  Requests without credentials are served from localhost or as anonymous if the cluster
+// allows it.
+func New(config *types.GlobalConfig, c *client.Cluster, clusterLookup *cluster.Lookup, loopbackToken string, serviceAccounts ...authenticator.Token) (authenticator.Request, error) {
+	var authenticators []authenticator.Request
+	if loopbackToken != "" {
+		authenticators = append(authenticators, authenticatedBy(Loopback, loopback(loopbackToken)))
+	}
+	for _, a := range serviceAccounts {
+		authenticators = append(authenticators, authenticatedBy(ServiceAccount, bearertoken.New(a)))
+	}
+	chain, err := Chain(&ChainOptions{
+		Config:        config,
+		Cluster:       c,
+		ClusterLookup: clusterLookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	authenticators = append(authenticators, chain...)
+	if InsecureLocalhost(config, c) {
+		authenticators = append(authenticators, authenticatedBy(Localhost, insecureLocalhost()))
+	}
+
+	result := group.NewAuthenticatedGroupAdder(union.New(authenticators...))
+	if AnonymousAuth(config, c) {
+		// anonymous users are not system:authenticated
+		result = union.New(result, anonymous())
+	}
+	return result, nil
+}
+
+// loopback authenticates the apiserver calling itself
+func loopback(token string) authenticator.Request {
+	return authenticator.RequestFunc(func(req *http.Request) (user.Info, bool, error) {
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			return nil, false, nil
+		}
+		return &user.DefaultInfo{
+			Name:   user.APIServerUser,
+			Groups: []string{user.SystemPrivilegedGroup},
+		}, true, nil
 	})
 }
 
@@ -26,15 +98,66 @@ func (a *Authenticator) AuthenticateRequest(req *http.Request) (user.Info, bool,
 		return nil, false, nil
 	}
 
+	credential := credential(req)
+	if credential == "" {
+		return nil, false, nil
+	}
+
+	key := cacheKey(c.Id, credential)
+	if value, ok := a.cache.Get(key); ok {
+		info := value.(cached).info
+		return info, info != nil, nil
+	}
+
+	rancherCluster, err := a.clusterLookup.LookupByID(c.Id, req)
+	if rancher.Unreachable(err) {
+		if value, ok := a.offline.Get(key); ok {
+			return value.(cached).info, true, nil
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if rancherCluster == nil {
+		a.cache.Add(key, cached{}, a.negativeTTL)
+		return nil, false, nil
+	}
+
+	info := userInfo(rancherCluster.Identity)
+	a.cache.Add(key, cached{info: info}, a.ttl)
+	a.offline.Add(key, cached{info: info}, a.offlineTTL)
+	return info, true, nil
+}
+
+func credential(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	if cookie, err := req.Cookie("token"); err == nil && cookie.Value != "" {
+		return "cookie " + cookie.Value
+	}
+	return ""
+}
+
+// cacheKey hashes the credential so the cache doesn't hold secrets
+func cacheKey(clusterID, credential string) string {
+	hash := sha256.Sum256([]byte(credential))
+	return clusterID + ":" + hex.EncodeToString(hash[:])
+}
+
+func userInfo(identity client.ClusterIdentity) user.Info {
 	attrs := map[string][]string{}
-	for k, v := range c.Identity.Attributes {
+	for k, v := range identity.Attributes {
 		attrs[k] = []string{fmt.Sprint(v)}
 	}
 
+	// the groups of the identity are what Rancher project members of a group are identified by, what users may do is
+	// up to the authorizer and the RBAC bindings synced from their project roles
 	return &user.DefaultInfo{
-		Name:   c.Identity.Username,
-		UID:    c.Identity.UserId,
-		Groups: []string{"system:masters"},
+		Name:   identity.Username,
+		UID:    identity.UserId,
+		Groups: identity.Groups,
 		Extra:  attrs,
-	}, true, nil
+	}
 }
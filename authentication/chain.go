@@ -0,0 +1,248 @@
+package authentication
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/authcache"
+	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/proxy"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
+	"k8s.io/apiserver/pkg/authentication/request/headerrequest"
+	x509request "k8s.io/apiserver/pkg/authentication/request/x509"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/plugin/pkg/authenticator/token/webhook"
+	"k8s.io/client-go/kubernetes/scheme"
+	authenticationv1beta1 "k8s.io/client-go/pkg/apis/authentication/v1beta1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/cert"
+)
+
+const (
+	// Rancher authenticates the Rancher credentials of requests, the default chain
+	Rancher = "rancher"
+	// ClientCert authenticates client certificates signed by the client CA of the cluster, the common name is the
+	// user and the organizations are the groups
+	ClientCert = "client-cert"
+	// OIDC authenticates the ID tokens of the OpenID Connect issuer of the cluster
+	OIDC = "oidc"
+	// Webhook authenticates bearer tokens with the TokenReview webhook of the kubeconfig of the cluster
+	Webhook = "webhook"
+	// AuthProxy authenticates the X-Remote-User and X-Remote-Group headers of an authenticating proxy, the
+	// proxy proves itself with a client certificate signed by the request header CA of the cluster
+	AuthProxy = "auth-proxy"
+
+	// AuthenticatorExtra is the extra of users the name of the authenticator that authenticated them is kept in,
+	// only users authenticated by Rancher are authorized by their Rancher project roles
+	AuthenticatorExtra = "netes.rancher.io/authenticator"
+)
+
+// ChainOptions are what the authenticators of the chain of a cluster are created with
+type ChainOptions struct {
+	Config        *types.GlobalConfig
+	Cluster       *client.Cluster
+	ClusterLookup *cluster.Lookup
+}
+
+// Factory creates an authenticator of the chain of a cluster
+type Factory func(opts *ChainOptions) (authenticator.Request, error)
+
+var (
+	factoriesLock sync.Mutex
+	factories     = map[string]Factory{
+		Rancher:    newRancher,
+		ClientCert: newClientCert,
+		OIDC:       newOIDC,
+		Webhook:    newWebhook,
+		AuthProxy:  newAuthProxy,
+	}
+)
+
+// RegisterAuthenticator makes an authenticator available to the chains of clusters by name
+func RegisterAuthenticator(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[name] = factory
+}
+
+func getFactory(name string) (Factory, bool) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	f, ok := factories[name]
+	return f, ok
+}
+
+// Chain returns the authenticators of a cluster in the order of its chain set in Rancher, or the global one
+func Chain(opts *ChainOptions) ([]authenticator.Request, error) {
+	names := types.FirstNotLenZero(opts.Cluster.K8sServerConfig.AuthenticationChain, opts.Config.AuthenticationChain)
+	if len(names) == 0 {
+		names = []string{Rancher}
+	}
+
+	var result []authenticator.Request
+	for _, name := range names {
+		factory, ok := getFactory(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown authenticator %s in the authentication chain of cluster %s", name, opts.Cluster.Id)
+		}
+		a, err := factory(opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid authenticator %s of cluster %s: %v", name, opts.Cluster.Id, err)
+		}
+		result = append(result, authenticatedBy(name, a))
+	}
+	return result, nil
+}
+
+func newRancher(opts *ChainOptions) (authenticator.Request, error) {
+	return &Authenticator{
+		clusterLookup: opts.ClusterLookup,
+		cache:         authcache.New("authentication", opts.Cluster.Id, opts.Config.AuthCache),
+		offline:       authcache.New("authentication-offline", opts.Cluster.Id, opts.Config.AuthCache),
+		ttl:           opts.Config.AuthCacheTTL,
+		negativeTTL:   opts.Config.AuthNegativeCacheTTL,
+		offlineTTL:    opts.Config.AuthOfflineTTL,
+	}, nil
+}
+
+func newClientCert(opts *ChainOptions) (authenticator.Request, error) {
+	verifyOptions, err := verifyOptions(opts.Cluster.K8sServerConfig.ClientCa)
+	if err != nil {
+		return nil, err
+	}
+	return x509request.New(verifyOptions, x509request.CommonNameUserConversion), nil
+}
+
+func newOIDC(opts *ChainOptions) (authenticator.Request, error) {
+	c := opts.Cluster.K8sServerConfig
+	if c.OidcIssuerUrl == "" || c.OidcClientId == "" {
+		return nil, fmt.Errorf("an OIDC issuer URL and client ID are required")
+	}
+
+	usernameClaim := c.OidcUsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "sub"
+	}
+
+	var tlsConfig *tls.Config
+	if c.OidcCa != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(c.OidcCa)) {
+			return nil, fmt.Errorf("no certificates found in the OIDC CA")
+		}
+		tlsConfig = &tls.Config{RootCAs: roots}
+	}
+	transport, err := proxy.OutboundTLSTransport(opts.Config, opts.Cluster, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := newOIDCAuthenticator(c.OidcIssuerUrl, c.OidcClientId, usernameClaim, c.OidcGroupsClaim, transport)
+	if err != nil {
+		return nil, err
+	}
+	return bearertoken.New(a), nil
+}
+
+// newWebhook returns a TokenReview webhook authenticator, called through the outbound transport of the cluster
+func newWebhook(opts *ChainOptions) (authenticator.Request, error) {
+	kubeconfig := opts.Cluster.K8sServerConfig.AuthenticationWebhookConfig
+	if kubeconfig == "" {
+		return nil, fmt.Errorf("a webhook kubeconfig is required")
+	}
+
+	restClient, err := proxy.OutboundWebhook(opts.Config, opts.Cluster, []byte(kubeconfig),
+		scheme.Codecs.LegacyCodec(authenticationv1beta1.SchemeGroupVersion))
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := webhook.NewFromInterface(&tokenReviewClient{restClient}, opts.Config.AuthCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	return bearertoken.New(a), nil
+}
+
+// tokenReviewClient posts TokenReviews to the exact URL of the webhook kubeconfig, like upstream
+type tokenReviewClient struct {
+	restClient *rest.RESTClient
+}
+
+func (t *tokenReviewClient) Create(tokenReview *authenticationv1beta1.TokenReview) (*authenticationv1beta1.TokenReview, error) {
+	result := &authenticationv1beta1.TokenReview{}
+	err := t.restClient.Post().Body(tokenReview).Do().Into(result)
+	return result, err
+}
+
+func newAuthProxy(opts *ChainOptions) (authenticator.Request, error) {
+	verifyOptions, err := verifyOptions(opts.Cluster.K8sServerConfig.RequestHeaderClientCa)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := headerrequest.New([]string{"X-Remote-User"}, []string{"X-Remote-Group"}, []string{"X-Remote-Extra-"})
+	if err != nil {
+		return nil, err
+	}
+	return x509request.NewVerifier(verifyOptions, headers,
+		sets.NewString(opts.Cluster.K8sServerConfig.RequestHeaderAllowedNames...)), nil
+}
+
+func verifyOptions(caPEM string) (x509.VerifyOptions, error) {
+	opts := x509request.DefaultVerifyOptions()
+	if strings.TrimSpace(caPEM) == "" {
+		return opts, fmt.Errorf("a client CA is required")
+	}
+	certs, err := cert.ParseCertsPEM([]byte(caPEM))
+	if err != nil {
+		return opts, err
+	}
+	opts.Roots = x509.NewCertPool()
+	for _, c := range certs {
+		opts.Roots.AddCert(c)
+	}
+	return opts, nil
+}
+
+// authenticatedBy sets the AuthenticatorExtra of the users authenticated by a, replacing whatever a webhook or
+// authenticating proxy put there so the authorizer can rely on it
+func authenticatedBy(name string, a authenticator.Request) authenticator.Request {
+	return authenticator.RequestFunc(func(req *http.Request) (user.Info, bool, error) {
+		u, ok, err := a.AuthenticateRequest(req)
+		if !ok || err != nil || u == nil {
+			return u, ok, err
+		}
+
+		extra := map[string][]string{}
+		for k, v := range u.GetExtra() {
+			extra[k] = v
+		}
+		extra[AuthenticatorExtra] = []string{name}
+		return &user.DefaultInfo{
+			Name:   u.GetName(),
+			UID:    u.GetUID(),
+			Groups: u.GetGroups(),
+			Extra:  extra,
+		}, true, nil
+	})
+}
+
+// AuthenticatedBy returns the name of the authenticator that authenticated u, one of the chain or Loopback,
+// ServiceAccount or Localhost, empty for anonymous users
+func AuthenticatedBy(u user.Info) string {
+	if u == nil {
+		return ""
+	}
+	if names := u.GetExtra()[AuthenticatorExtra]; len(names) == 1 {
+		return names[0]
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/coreos/go-oidc/jose"
+	"github.com/coreos/go-oidc/oidc"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// oidcAuthenticator validates OpenID Connect ID tokens like the upstream one, which can't be given a transport.
+// The discovery document and keys of the issuer are fetched through the outbound transport of the cluster.
+type oidcAuthenticator struct {
+	issuerURL     string
+	clientID      string
+	usernameClaim string
+	groupsClaim   string
+	httpClient    *http.Client
+
+	lock sync.Mutex
+	// the *oidc.Client, set once the issuer could be discovered
+	client atomic.Value
+}
+
+func newOIDCAuthenticator(issuerURL, clientID, usernameClaim, groupsClaim string, transport http.RoundTripper) (*oidcAuthenticator, error) {
+	u, err := url.Parse(issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("the OIDC issuer URL %q is not https", issuerURL)
+	}
+
+	a := &oidcAuthenticator{
+		issuerURL:     issuerURL,
+		clientID:      clientID,
+		usernameClaim: usernameClaim,
+		groupsClaim:   groupsClaim,
+		httpClient:    &http.Client{Transport: transport},
+	}
+
+	// the issuer may not be up yet, like when it runs in the cluster, the first token retries
+	go func() {
+		if _, err := a.oidcClient(); err != nil {
+			logrus.Warnf("Failed to discover OIDC issuer %s: %v", issuerURL, err)
+		}
+	}()
+	return a, nil
+}
+
+func (a *oidcAuthenticator) oidcClient() (*oidc.Client, error) {
+	if c, ok := a.client.Load().(*oidc.Client); ok {
+		return c, nil
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if c, ok := a.client.Load().(*oidc.Client); ok {
+		return c, nil
+	}
+
+	providerConfig, err := oidc.FetchProviderConfig(a.httpClient, a.issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch provider config: %v", err)
+	}
+	c, err := oidc.NewClient(oidc.ClientConfig{
+		HTTPClient:     a.httpClient,
+		Credentials:    oidc.ClientCredentials{ID: a.clientID},
+		ProviderConfig: providerConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create client: %v", err)
+	}
+
+	// keeps the keys of the issuer current
+	c.SyncProviderConfig(a.issuerURL)
+	a.client.Store(c)
+	return c, nil
+}
+
+// AuthenticateToken verifies an ID token and takes the user from its claims, the same way upstream does
+func (a *oidcAuthenticator) AuthenticateToken(value string) (user.Info, bool, error) {
+	jwt, err := jose.ParseJWT(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c, err := a.oidcClient()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := c.VerifyJWT(jwt); err != nil {
+		return nil, false, err
+	}
+
+	claims, err := jwt.Claims()
+	if err != nil {
+		return nil, false, err
+	}
+
+	claim, ok, err := claims.StringClaim(a.usernameClaim)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, fmt.Errorf("cannot find %q in JWT claims", a.usernameClaim)
+	}
+
+	// like upstream only verified emails are user names as is, other claims are prefixed with the issuer
+	username := fmt.Sprintf("%s#%s", a.issuerURL, claim)
+	if a.usernameClaim == "email" {
+		verified, ok := claims["email_verified"]
+		if !ok {
+			return nil, false, errors.New("'email_verified' claim not present")
+		}
+		if emailVerified, ok := verified.(bool); !ok {
+			return nil, false, fmt.Errorf("malformed claim 'email_verified', expected boolean got %T", verified)
+		} else if !emailVerified {
+			return nil, false, errors.New("email not verified")
+		}
+		username = claim
+	}
+
+	info := &user.DefaultInfo{Name: username}
+	if a.groupsClaim != "" {
+		groups, found, err := claims.StringsClaim(a.groupsClaim)
+		if err != nil {
+			// a single group may be a string
+			group, _, err := claims.StringClaim(a.groupsClaim)
+			if err != nil {
+				return nil, false, fmt.Errorf("custom group claim contains invalid type: %T", claims[a.groupsClaim])
+			}
+			info.Groups = []string{group}
+		} else if found {
+			info.Groups = groups
+		}
+	}
+	return info, true, nil
+}
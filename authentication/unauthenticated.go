@@ -0,0 +1,68 @@
+package authentication
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/types"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// unsecuredUser is who requests to the insecure localhost port are, like the insecure port of upstream
+const unsecuredUser = "system:unsecured"
+
+// AnonymousAuth is whether requests without credentials to a cluster are served as system:anonymous.  It is
+// enabled or disabled in Rancher with "true" or "false", clusters without either follow the global default.
+func AnonymousAuth(config *types.GlobalConfig, cluster *client.Cluster) bool {
+	return enabled(cluster.K8sServerConfig.AnonymousAuth, config.AnonymousAuth)
+}
+
+// InsecureLocalhost is whether requests without credentials from the host netes runs on are served as an admin of
+// the cluster, like the insecure port of upstream.  It is set like AnonymousAuth.
+func InsecureLocalhost(config *types.GlobalConfig, cluster *client.Cluster) bool {
+	return enabled(cluster.K8sServerConfig.InsecureLocalhost, config.InsecureLocalhost)
+}
+
+func enabled(value string, def bool) bool {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return def
+}
+
+// insecureLocalhost authenticates requests without credentials from a loopback address, the address of the
+// connection is used so X-Forwarded-For can't fake it
+func insecureLocalhost() authenticator.Request {
+	return authenticator.RequestFunc(func(req *http.Request) (user.Info, bool, error) {
+		if credential(req) != "" {
+			return nil, false, nil
+		}
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			return nil, false, nil
+		}
+		return &user.DefaultInfo{
+			Name:   unsecuredUser,
+			Groups: []string{user.SystemPrivilegedGroup},
+		}, true, nil
+	})
+}
+
+// anonymous authenticates requests without credentials, unlike the upstream one it leaves requests with bad
+// credentials alone so they fail instead of becoming anonymous
+func anonymous() authenticator.Request {
+	return authenticator.RequestFunc(func(req *http.Request) (user.Info, bool, error) {
+		if credential(req) != "" {
+			return nil, false, nil
+		}
+		return &user.DefaultInfo{
+			Name:   user.Anonymous,
+			Groups: []string{user.AllUnauthenticated},
+		}, true, nil
+	})
+}
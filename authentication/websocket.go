@@ -0,0 +1,58 @@
+package authentication
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+const (
+	protocolHeader = "Sec-WebSocket-Protocol"
+	// browsers can't set headers on websockets, clients like the UI pass the token as a subprotocol instead
+	bearerProtocolPrefix = "base64url.bearer.authorization.k8s.io."
+)
+
+// WebSocketFilter moves the bearer token of a websocket upgrade, like exec or attach from a browser, from its
+// subprotocols to the Authorization header before the request is authenticated.  The token protocol is removed
+// so it is neither negotiated nor passed on to the kubelet.
+func WebSocketFilter(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !httpstream.IsUpgradeRequest(req) || !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		var token string
+		var protocols []string
+		for _, header := range req.Header[protocolHeader] {
+			for _, protocol := range strings.Split(header, ",") {
+				protocol = strings.TrimSpace(protocol)
+				if strings.HasPrefix(protocol, bearerProtocolPrefix) {
+					data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(protocol, bearerProtocolPrefix))
+					if err == nil {
+						token = string(data)
+					}
+					continue
+				}
+				if protocol != "" {
+					protocols = append(protocols, protocol)
+				}
+			}
+		}
+		if token == "" {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		req.Header.Del(protocolHeader)
+		if len(protocols) > 0 {
+			req.Header.Set(protocolHeader, strings.Join(protocols, ","))
+		}
+		if req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(rw, req)
+	})
+}
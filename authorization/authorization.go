@@ -1,16 +1,26 @@
 package authorization
 
 import (
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/clients"
+	"github.com/rancher/netes/types"
 	authz "k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/union"
+	kubeauthorizer "k8s.io/kubernetes/pkg/kubeapiserver/authorizer"
+	"k8s.io/kubernetes/pkg/kubeapiserver/authorizer/modes"
 )
 
-type authorizer struct {
-}
-
-func New() (authz.Authorizer, error) {
-	return &authorizer{}, nil
-}
-
-func (a *authorizer) Authorize(attr authz.Attributes) (authorized bool, reason string, err error) {
-	return true, "", nil
+// New authorizes the users authenticated by Rancher as owners of the cluster, or by their project roles when
+// RancherAuthorization is set, and everybody else, including the users of the other authenticators of the chain, by
+// the RBAC objects of the cluster.  Anonymous users only get the always allowed paths unless RBAC allows them more.
+func New(config *types.GlobalConfig, cluster *client.Cluster, clientsetset *clients.ClientSetSet) (authz.Authorizer, error) {
+	rbacAuthorizer, err := kubeauthorizer.AuthorizationConfig{
+		AuthorizationModes: []string{modes.ModeRBAC},
+		InformerFactory:    clientsetset.InternalSharedInformers,
+	}.New()
+	if err != nil {
+		return nil, err
+	}
+	return newPathAuthorizer(alwaysAllowPaths(config, cluster), union.New(newRancherAuthorizer(config, cluster.Id,
+		clientsetset.SharedInformers.Core().V1().Namespaces().Lister()), rbacAuthorizer)), nil
 }
@@ -0,0 +1,69 @@
+package authorization
+
+import (
+	"strings"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	authz "k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// pathAuthorizer lets anyone GET the always allowed paths, like /healthz and /version, and keeps anonymous users
+// from everything else.  Paths ending in * allow everything below them.
+type pathAuthorizer struct {
+	paths    []string
+	prefixes []string
+	next     authz.Authorizer
+}
+
+// AlwaysAllowed is whether anyone can GET the path of a cluster
+func AlwaysAllowed(config *types.GlobalConfig, cluster *client.Cluster, path string) bool {
+	return newPathAuthorizer(alwaysAllowPaths(config, cluster), nil).allowed(path)
+}
+
+func alwaysAllowPaths(config *types.GlobalConfig, cluster *client.Cluster) []string {
+	if cluster.K8sServerConfig == nil {
+		return config.AlwaysAllowPaths
+	}
+	return types.FirstNotLenZero(cluster.K8sServerConfig.AlwaysAllowPaths, config.AlwaysAllowPaths)
+}
+
+func newPathAuthorizer(paths []string, next authz.Authorizer) *pathAuthorizer {
+	a := &pathAuthorizer{
+		next: next,
+	}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if strings.HasSuffix(path, "*") {
+			a.prefixes = append(a.prefixes, strings.TrimSuffix(path, "*"))
+		} else if path != "" {
+			a.paths = append(a.paths, path)
+		}
+	}
+	return a
+}
+
+func (a *pathAuthorizer) Authorize(attr authz.Attributes) (bool, string, error) {
+	if !attr.IsResourceRequest() && attr.GetVerb() == "get" && a.allowed(attr.GetPath()) {
+		return true, "", nil
+	}
+	if u := attr.GetUser(); u != nil && u.GetName() == user.Anonymous {
+		return false, "anonymous users can only get the always allowed paths of the cluster", nil
+	}
+	return a.next.Authorize(attr)
+}
+
+func (a *pathAuthorizer) allowed(path string) bool {
+	for _, p := range a.paths {
+		if p == path {
+			return true
+		}
+	}
+	for _, p := range a.prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package authorization
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/authcache"
+	"github.com/rancher/netes/authentication"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+	authz "k8s.io/apiserver/pkg/authorization/authorizer"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// the label rbac.ProjectLabel puts namespaces in a project with
+	projectLabel = "io.rancher.project.id"
+
+	membersTTL = 30 * time.Second
+)
+
+var (
+	readVerbs = map[string]bool{
+		"get":   true,
+		"list":  true,
+		"watch": true,
+	}
+
+	// what the project roles allow in the namespaces of the project, like the admin, edit and view ClusterRoles
+	// rbac.Controller binds them to
+	projectRoles = map[string]func(authz.Attributes) bool{
+		"owner": func(authz.Attributes) bool {
+			return true
+		},
+		"member": func(attr authz.Attributes) bool {
+			return attr.GetAPIGroup() != "rbac.authorization.k8s.io" &&
+				(readVerbs[attr.GetVerb()] || attr.GetResource() != "resourcequotas")
+		},
+		"readonly":   view,
+		"restricted": view,
+	}
+)
+
+func view(attr authz.Attributes) bool {
+	return readVerbs[attr.GetVerb()] && attr.GetResource() != "secrets"
+}
+
+// rancherAuthorizer authorizes the users Rancher authenticated by their roles in the projects of the cluster.
+// Project members get their role in the namespaces of their projects and can read namespaces and nodes, users
+// who see the cluster without being a member of any of its projects own it.  Without project roles every user
+// authenticated by Rancher owns the cluster.  Users of the other authenticators are left to RBAC, the apiserver
+// calling itself, the insecure localhost user and service accounts are not restricted.  Decisions are cached by
+// user and request attributes, the decisions and project members are read again after changes of projects and
+// their members in Rancher.
+type rancherAuthorizer struct {
+	sync.Mutex
+	clusterID   string
+	byProject   bool
+	rancher     *rancher.Client
+	namespaces  corev1listers.NamespaceLister
+	invalidator *authcache.Invalidator
+	decisions   *authcache.Cache
+	ttl         time.Duration
+	negativeTTL time.Duration
+	members     map[string]map[string]string
+	generation  string
+	refreshed   time.Time
+}
+
+type decision struct {
+	allowed bool
+	reason  string
+}
+
+func newRancherAuthorizer(config *types.GlobalConfig, clusterID string, namespaces corev1listers.NamespaceLister) *rancherAuthorizer {
+	return &rancherAuthorizer{
+		clusterID:   clusterID,
+		byProject:   config.RancherAuthorization && config.RancherClient != nil,
+		rancher:     config.RancherClient,
+		namespaces:  namespaces,
+		invalidator: config.AuthCache,
+		decisions:   authcache.New("authorization", clusterID, config.AuthCache),
+		ttl:         config.AuthCacheTTL,
+		negativeTTL: config.AuthNegativeCacheTTL,
+	}
+}
+
+func (a *rancherAuthorizer) Authorize(attr authz.Attributes) (bool, string, error) {
+	u := attr.GetUser()
+	if u == nil {
+		return false, "no user", nil
+	}
+	switch authentication.AuthenticatedBy(u) {
+	case authentication.Loopback, authentication.Localhost, authentication.ServiceAccount:
+		return true, "", nil
+	case authentication.Rancher:
+	default:
+		return false, "", nil
+	}
+	if !a.byProject {
+		return true, "", nil
+	}
+
+	key := cacheKey(attr)
+	if value, ok := a.decisions.Get(key); ok {
+		d := value.(decision)
+		return d.allowed, d.reason, nil
+	}
+
+	allowed, reason, err := a.authorize(attr)
+	if err != nil {
+		return false, "", err
+	}
+
+	ttl := a.ttl
+	if !allowed {
+		ttl = a.negativeTTL
+	}
+	a.decisions.Add(key, decision{allowed: allowed, reason: reason}, ttl)
+	return allowed, reason, nil
+}
+
+func (a *rancherAuthorizer) authorize(attr authz.Attributes) (bool, string, error) {
+	members, err := a.projectMembers()
+	if err != nil {
+		return false, "", err
+	}
+
+	roles := map[string]string{}
+	for _, subject := range subjects(attr.GetUser()) {
+		for project, role := range members[subject] {
+			roles[project] = role
+		}
+	}
+	if len(roles) == 0 {
+		return true, "", nil
+	}
+
+	if !attr.IsResourceRequest() {
+		return true, "", nil
+	}
+
+	if attr.GetNamespace() == "" {
+		if readVerbs[attr.GetVerb()] && (attr.GetResource() == "namespaces" || attr.GetResource() == "nodes") {
+			return true, "", nil
+		}
+		return false, "cluster resources are only available to the owner of the cluster", nil
+	}
+
+	ns, err := a.namespaces.Get(attr.GetNamespace())
+	if errors.IsNotFound(err) {
+		return false, fmt.Sprintf("namespace %s is not in a project", attr.GetNamespace()), nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	project := ns.Labels[projectLabel]
+	role, ok := roles[project]
+	if project == "" || !ok {
+		return false, fmt.Sprintf("not a member of the project of namespace %s", ns.Name), nil
+	}
+	if !projectRoles[role](attr) {
+		return false, fmt.Sprintf("project role %s doesn't allow %s of %s", role, attr.GetVerb(), attr.GetResource()), nil
+	}
+	return true, "", nil
+}
+
+// projectMembers returns the active roles by member and project of the projects of the cluster, the last ones
+// that could be read while Rancher isn't reachable
+func (a *rancherAuthorizer) projectMembers() (map[string]map[string]string, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	generation := a.invalidator.Generation(a.clusterID)
+	if a.members != nil && a.generation == generation && time.Since(a.refreshed) < membersTTL {
+		return a.members, nil
+	}
+
+	members, err := a.listProjectMembers()
+	if err != nil {
+		if a.members != nil {
+			return a.members, nil
+		}
+		return nil, err
+	}
+
+	a.members = members
+	a.generation = generation
+	a.refreshed = time.Now()
+	return members, nil
+}
+
+// listProjectMembers reads all the pages of projects and members, any page that can't be read fails the whole list
+// so a member isn't mistaken for the owner of the cluster
+func (a *rancherAuthorizer) listProjectMembers() (map[string]map[string]string, error) {
+	rancherClient, err := a.rancher.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	projects, err := rancherClient.Project.ListAll(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"clusterId": a.clusterID,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]map[string]string{}
+	for _, project := range projects {
+		members, err := rancherClient.ProjectMember.ListAll(&client.ListOpts{
+			Filters: map[string]interface{}{
+				"projectId": project.Id,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if _, ok := projectRoles[member.Role]; !ok || member.State != "active" {
+				continue
+			}
+			if result[member.ExternalId] == nil {
+				result[member.ExternalId] = map[string]string{}
+			}
+			result[member.ExternalId][project.Id] = member.Role
+		}
+	}
+	return result, nil
+}
+
+// subjects are the ids project members can be identified by, the user and the groups of its Rancher identity
+func subjects(u user.Info) []string {
+	return append([]string{u.GetUID(), u.GetName()}, u.GetGroups()...)
+}
+
+func cacheKey(attr authz.Attributes) string {
+	u := attr.GetUser()
+	return strings.Join([]string{
+		u.GetName(),
+		strings.Join(u.GetGroups(), ","),
+		attr.GetVerb(),
+		attr.GetNamespace(),
+		attr.GetAPIGroup(),
+		attr.GetResource(),
+		attr.GetSubresource(),
+		attr.GetPath(),
+	}, "\x00")
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/store"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// objects of the hosts and the apiserver the backup was taken from, the cluster restored gets its own
+var skipped = []string{
+	"/minions/",
+	"/masterleases/",
+	"/.trash/",
+}
+
+// Backup is every object of a cluster read from one snapshot of the database, with keys relative to the prefix of
+// the cluster
+type Backup struct {
+	Cluster         string                  `json:"cluster"`
+	ClusterName     string                  `json:"clusterName"`
+	K8sServerConfig *client.K8sServerConfig `json:"k8sServerConfig,omitempty"`
+	Taken           time.Time               `json:"taken"`
+	Entries         []Entry                 `json:"entries"`
+}
+
+type Entry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Name is where the backup is stored in a target, by cluster and time so names sort by when they were taken
+func (b *Backup) Name() string {
+	return fmt.Sprintf("%s/%s.json.gz", b.Cluster, b.Taken.UTC().Format("20060102T150405Z"))
+}
+
+func (b *Backup) Bytes() int64 {
+	size := int64(0)
+	for _, entry := range b.Entries {
+		size += int64(len(entry.Value))
+	}
+	return size
+}
+
+// Take reads the objects of a cluster, from one snapshot of the database when the storage supports it so the
+// backup is consistent while the cluster is in use
+func Take(ctx context.Context, kvClient kv.Client, cluster *client.Cluster) (*Backup, error) {
+	if store.Etcd(cluster) {
+		return nil, fmt.Errorf("Cluster %s is stored in its own etcd, back it up there", cluster.Id)
+	}
+
+	prefix := store.ClusterPrefix(cluster)
+	var values []*kv.KeyValue
+	if lister, ok := kvClient.(kv.SnapshotLister); ok {
+		snapshot, err := lister.ListSnapshot(ctx, prefix+"/")
+		if err != nil {
+			return nil, err
+		}
+		values = snapshot[0]
+	} else {
+		var err error
+		if values, err = kvClient.List(ctx, prefix+"/"); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &Backup{
+		Cluster:         cluster.Id,
+		ClusterName:     cluster.Name,
+		K8sServerConfig: cluster.K8sServerConfig,
+		Taken:           time.Now(),
+	}
+	for _, value := range values {
+		key := strings.TrimPrefix(value.Key, prefix)
+		if !skip(key) {
+			b.Entries = append(b.Entries, Entry{
+				Key:   key,
+				Value: value.Value,
+			})
+		}
+	}
+	return b, nil
+}
+
+func skip(key string) bool {
+	for _, prefix := range skipped {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore replaces the objects of a cluster with the ones of a backup, the server of the cluster must be stopped.
+// Service account tokens are left out, they were signed by the keys of the cluster the backup was taken from and
+// are issued again.  It returns how many objects were restored.
+func Restore(ctx context.Context, kvClient kv.Client, cluster *client.Cluster, b *Backup) (int, error) {
+	if store.Etcd(cluster) {
+		return 0, fmt.Errorf("Cluster %s is stored in its own etcd, restore it there", cluster.Id)
+	}
+
+	prefix := store.ClusterPrefix(cluster)
+	existing, err := kvClient.List(ctx, prefix+"/")
+	if err != nil {
+		return 0, err
+	}
+	for _, value := range existing {
+		if err := kvClient.DeleteVersion(ctx, value.Key, value.Revision); err != nil && err != kv.ErrNotExists {
+			return 0, err
+		}
+	}
+
+	restored := 0
+	for _, entry := range b.Entries {
+		if serviceAccountToken(entry) {
+			continue
+		}
+		if _, err := kvClient.Create(ctx, prefix+entry.Key, entry.Value, 0); err != nil {
+			return restored, fmt.Errorf("Failed to restore %s: %v", entry.Key, err)
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+func serviceAccountToken(entry Entry) bool {
+	if !strings.HasPrefix(entry.Key, "/secrets/") {
+		return false
+	}
+	obj, err := runtime.Decode(api.Codecs.UniversalDecoder(), entry.Value)
+	if err != nil {
+		return false
+	}
+	secret, ok := obj.(*api.Secret)
+	return ok && secret.Type == api.SecretTypeServiceAccountToken
+}
+
+func Encode(b *Backup) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func Decode(data []byte) (*Backup, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backup{}
+	return b, json.Unmarshal(content, b)
+}
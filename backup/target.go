@@ -0,0 +1,207 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// Target is where backups are stored, by name
+type Target interface {
+	Put(name string, data []byte) error
+	Get(name string) ([]byte, error)
+	// List returns the names of the backups starting with prefix
+	List(prefix string) ([]string, error)
+}
+
+// NewTarget returns the target of a URL like file:///var/lib/netes/backups or s3://bucket/prefix.  S3 targets
+// take the region and endpoint as query parameters, like s3://backups/netes?region=eu-west-1 or
+// s3://backups?endpoint=https://minio.example.com, and the credentials from the AWS environment variables or
+// shared credentials file.
+func NewTarget(target string) (Target, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return fileTarget(u.Path), nil
+	case "s3":
+		return newS3Target(u), nil
+	}
+	return nil, fmt.Errorf("Unsupported backup target %s, use file:// or s3://", target)
+}
+
+func validName(name string) error {
+	if name == "" || strings.Contains(name, "..") || strings.HasPrefix(name, "/") {
+		return fmt.Errorf("Invalid backup name %q", name)
+	}
+	return nil
+}
+
+type fileTarget string
+
+func (f fileTarget) Put(name string, data []byte) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	file := filepath.Join(string(f), name)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+func (f fileTarget) Get(name string) ([]byte, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(string(f), name))
+}
+
+func (f fileTarget) List(prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(string(f), func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(string(f), file)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if name = filepath.ToSlash(name); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// s3Target stores backups as objects of a bucket, addressed by path so S3 compatible stores work too
+type s3Target struct {
+	endpoint string
+	bucket   string
+	prefix   string
+	region   string
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+func newS3Target(u *url.URL) *s3Target {
+	region := u.Query().Get("region")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := u.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	return &s3Target{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		region:   region,
+		signer: v4.NewSigner(credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvProvider{},
+			&credentials.SharedCredentialsProvider{},
+		})),
+		client: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+func (s *s3Target) key(name string) string {
+	return strings.TrimPrefix(path.Join(s.prefix, name), "/")
+}
+
+func (s *s3Target) Put(name string, data []byte) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	_, err := s.do("PUT", "/"+s.key(name), nil, data)
+	return err
+}
+
+func (s *s3Target) Get(name string) ([]byte, error) {
+	if err := validName(name); err != nil {
+		return nil, err
+	}
+	return s.do("GET", "/"+s.key(name), nil, nil)
+}
+
+func (s *s3Target) List(prefix string) ([]string, error) {
+	var names []string
+	query := url.Values{
+		"list-type": []string{"2"},
+		"prefix":    []string{s.key(prefix)},
+	}
+	for {
+		content, err := s.do("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result := struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}{}
+		if err := xml.Unmarshal(content, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(strings.TrimPrefix(object.Key, s.prefix), "/"))
+		}
+		if !result.IsTruncated {
+			return names, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *s3Target) do(method, key string, query url.Values, data []byte) ([]byte, error) {
+	u := s.endpoint + "/" + s.bucket + key
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.signer.Sign(req, bytes.NewReader(data), "s3", s.region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, u, resp.Status, content)
+	}
+	return content, nil
+}
@@ -0,0 +1,205 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/clients"
+	"github.com/rancher/netes/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	retryInterval = 30 * time.Second
+	// records the hash of the applied manifests so they are only applied again once they change
+	stateConfigMap = "netes-bootstrap"
+	stateNamespace = "kube-system"
+	hashKey        = "hash"
+)
+
+// Manifests returns the bootstrap manifests of a cluster, the ones set in Rancher replace the files of the global
+// manifest directory
+func Manifests(config *types.GlobalConfig, cluster *client.Cluster) (string, error) {
+	if cluster.K8sServerConfig.BootstrapManifests != "" || config.BootstrapManifestsDir == "" {
+		return cluster.K8sServerConfig.BootstrapManifests, nil
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(config.BootstrapManifestsDir, pattern))
+		if err != nil {
+			return "", err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var manifests []string
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		manifests = append(manifests, string(content))
+	}
+	return strings.Join(manifests, "\n---\n"), nil
+}
+
+// Run seeds a cluster with the system namespaces and bootstrap RBAC, then applies the manifests once the cluster
+// serves their APIs.  Objects are created or replaced, objects removed from the manifests are left alone.
+func Run(ctx context.Context, clusterID string, clientsetset *clients.ClientSetSet, manifests string) {
+	seeded := false
+	ctx, cancel := context.WithCancel(ctx)
+	wait.Until(func() {
+		if !seeded {
+			if err := defaults(ctx, clusterID, clientsetset); err != nil {
+				logrus.Errorf("Failed to create default objects of cluster %s: %v", clusterID, err)
+				return
+			}
+			seeded = true
+		}
+		if manifests != "" {
+			if err := apply(clientsetset, manifests); err != nil {
+				logrus.Errorf("Failed to apply bootstrap manifests of cluster %s: %v", clusterID, err)
+				return
+			}
+		}
+		cancel()
+	}, retryInterval, ctx.Done())
+}
+
+func apply(clientsetset *clients.ClientSetSet, manifests string) error {
+	k8sClient := clientsetset.Client
+	sum := sha256.Sum256([]byte(manifests))
+	hash := hex.EncodeToString(sum[:])
+
+	state, err := k8sClient.CoreV1().ConfigMaps(stateNamespace).Get(stateConfigMap, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		state = nil
+	} else if err != nil {
+		return err
+	} else if state.Data[hashKey] == hash {
+		return nil
+	}
+
+	objects, err := parse(manifests)
+	if err != nil {
+		return err
+	}
+
+	groups, err := discovery.GetAPIGroupResources(k8sClient.Discovery())
+	if err != nil {
+		return err
+	}
+	mapper := discovery.NewRESTMapper(groups, meta.InterfacesForUnstructured)
+	pool := dynamic.NewClientPool(&clientsetset.LoopbackClientConfig, mapper, dynamic.LegacyAPIPathResolverFunc)
+
+	for _, obj := range objects {
+		if err := applyObject(mapper, pool, obj); err != nil {
+			return err
+		}
+	}
+
+	if state == nil {
+		_, err = k8sClient.CoreV1().ConfigMaps(stateNamespace).Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: stateConfigMap,
+			},
+			Data: map[string]string{
+				hashKey: hash,
+			},
+		})
+		return err
+	}
+
+	if state.Data == nil {
+		state.Data = map[string]string{}
+	}
+	state.Data[hashKey] = hash
+	_, err = k8sClient.CoreV1().ConfigMaps(stateNamespace).Update(state)
+	return err
+}
+
+func applyObject(mapper meta.RESTMapper, pool dynamic.ClientPool, obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := pool.ClientForGroupVersionKind(gvk)
+	if err != nil {
+		return err
+	}
+
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	if namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(metav1.NamespaceDefault)
+	}
+	resource := dynamicClient.Resource(&metav1.APIResource{
+		Name:       mapping.Resource,
+		Namespaced: namespaced,
+	}, obj.GetNamespace())
+
+	existing, err := resource.Get(obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		logrus.Infof("Creating bootstrap %s %s", gvk.Kind, name(obj))
+		_, err = resource.Create(obj)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	_, err = resource.Update(obj)
+	return err
+}
+
+// parse splits manifests into their objects, namespaces first so the objects in them can be created
+func parse(manifests string) ([]*unstructured.Unstructured, error) {
+	var namespaces, objects []*unstructured.Unstructured
+
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifests), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "Namespace" {
+			namespaces = append(namespaces, obj)
+		} else {
+			objects = append(objects, obj)
+		}
+	}
+
+	return append(namespaces, objects...), nil
+}
+
+func name(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
@@ -0,0 +1,57 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/netes/clients"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/pkg/api/v1"
+	rbacrest "k8s.io/kubernetes/pkg/registry/rbac/rest"
+)
+
+const rbacGroup = "rbac.authorization.k8s.io"
+
+// systemNamespaces are the namespaces every cluster starts with
+var systemNamespaces = []string{metav1.NamespaceDefault, metav1.NamespaceSystem, metav1.NamespacePublic}
+
+// defaults seeds a cluster with what every Kubernetes cluster has, the system namespaces and the bootstrap RBAC
+// roles and bindings.  Upstream reconciles the roles in a post start hook that exits the process if the storage
+// isn't reachable for 30 seconds, netes disables it and retries here so one cluster can't take down the others.
+func defaults(ctx context.Context, clusterID string, clientsetset *clients.ClientSetSet) error {
+	k8sClient := clientsetset.Client
+	for _, name := range systemNamespaces {
+		_, err := k8sClient.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			logrus.Infof("Creating namespace %s of cluster %s", name, clusterID)
+			_, err = k8sClient.CoreV1().Namespaces().Create(&v1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name,
+				},
+			})
+			if apierrors.IsAlreadyExists(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// clusters can disable the RBAC API through their resource config
+	groups, err := k8sClient.Discovery().ServerGroups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups.Groups {
+		if group.Name == rbacGroup {
+			return rbacrest.PostStartHook(genericapiserver.PostStartHookContext{
+				LoopbackClientConfig: &clientsetset.LoopbackClientConfig,
+				StopCh:               ctx.Done(),
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package budget
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	clusterLabel  = "netes_cluster"
+	checkInterval = 30 * time.Second
+	// checks a cluster can be over its goroutine budget, shedding load, before its apiserver is restarted
+	restartAfter = 3
+)
+
+var (
+	nonMutatingRequestVerbs = sets.NewString("get", "list", "watch")
+
+	goroutinesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_cluster_goroutines",
+		Help: "Goroutines of the hosted apiserver of a cluster, its controllers and the requests it serves",
+	}, []string{"cluster"})
+	watchesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_cluster_watches",
+		Help: "Open watches of the hosted apiserver of a cluster",
+	}, []string{"cluster"})
+	shedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_cluster_budget_rejected_requests_total",
+		Help: "Requests rejected because the cluster was over its budget, per cluster and budget",
+	}, []string{"cluster", "budget"})
+)
+
+func init() {
+	prometheus.MustRegister(goroutinesGauge)
+	prometheus.MustRegister(watchesGauge)
+	prometheus.MustRegister(shedCounter)
+}
+
+// Label runs f with the goroutines it starts labeled with the cluster, so they count against its budget.  Servers
+// are started with it, the goroutines of their controllers and informers inherit the label.
+func Label(clusterID string, f func()) {
+	pprof.Do(context.Background(), pprof.Labels(clusterLabel, clusterID), func(context.Context) {
+		f()
+	})
+}
+
+// Tracker keeps the hosted apiservers sharing the process within their budgets.  Open watches are counted by
+// cluster and new ones rejected over the budget.  Goroutines are counted by their cluster label, a cluster over
+// its budget sheds load by rejecting new watches and writes, and gets its apiserver restarted if that doesn't
+// help.
+type Tracker struct {
+	sync.Mutex
+	watches       map[string]int64
+	maxGoroutines map[string]int64
+	over          map[string]int
+}
+
+func New() *Tracker {
+	return &Tracker{
+		watches:       map[string]int64{},
+		maxGoroutines: map[string]int64{},
+		over:          map[string]int{},
+	}
+}
+
+// Start checks the goroutines of the clusters until ctx is done, restart is called for clusters that stay over
+// their budget
+func (t *Tracker) Start(ctx context.Context, restart func(clusterID string)) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(checkInterval):
+				t.check(restart)
+			}
+		}
+	}()
+}
+
+func (t *Tracker) check(restart func(clusterID string)) {
+	counts, err := goroutines()
+	if err != nil {
+		logrus.Errorf("Failed to count goroutines of clusters: %v", err)
+		return
+	}
+
+	var restarts []string
+	t.Lock()
+	for clusterID, max := range t.maxGoroutines {
+		count := counts[clusterID]
+		goroutinesGauge.WithLabelValues(clusterID).Set(float64(count))
+
+		if max <= 0 || count <= max {
+			delete(t.over, clusterID)
+			continue
+		}
+
+		t.over[clusterID]++
+		logrus.Warnf("Cluster %s has %d goroutines, over its budget of %d", clusterID, count, max)
+		if t.over[clusterID] > restartAfter {
+			delete(t.over, clusterID)
+			restarts = append(restarts, clusterID)
+		}
+	}
+	t.Unlock()
+
+	for _, clusterID := range restarts {
+		logrus.Warnf("Cluster %s stayed over its goroutine budget, restarting its apiserver", clusterID)
+		restart(clusterID)
+	}
+}
+
+func (t *Tracker) shedding(clusterID string) bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.over[clusterID] > 0
+}
+
+func (t *Tracker) openWatch(clusterID string, max int64) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if max > 0 && t.watches[clusterID] >= max {
+		return false
+	}
+	t.watches[clusterID]++
+	watchesGauge.WithLabelValues(clusterID).Set(float64(t.watches[clusterID]))
+	return true
+}
+
+func (t *Tracker) closeWatch(clusterID string) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.watches[clusterID]--
+	watchesGauge.WithLabelValues(clusterID).Set(float64(t.watches[clusterID]))
+}
+
+// Filter enforces the budgets of a cluster, it must run after the request info is resolved.  The requests are
+// labeled with the cluster so the goroutines serving them are counted too.
+func (t *Tracker) Filter(clusterID string, maxWatches, maxGoroutines int64, handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	t.Lock()
+	t.maxGoroutines[clusterID] = maxGoroutines
+	t.Unlock()
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		requestInfo, ok := apirequest.RequestInfoFrom(ctx)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		watch := requestInfo.IsResourceRequest && requestInfo.Verb == "watch"
+		if (watch || !nonMutatingRequestVerbs.Has(requestInfo.Verb)) && t.shedding(clusterID) {
+			shedCounter.WithLabelValues(clusterID, "goroutines").Inc()
+			tooManyRequests(rw, "the cluster is over its goroutine budget")
+			return
+		}
+
+		if watch {
+			if !t.openWatch(clusterID, maxWatches) {
+				shedCounter.WithLabelValues(clusterID, "watches").Inc()
+				tooManyRequests(rw, fmt.Sprintf("the cluster has reached its budget of %d watches", maxWatches))
+				return
+			}
+			defer t.closeWatch(clusterID)
+		}
+
+		pprof.Do(req.Context(), pprof.Labels(clusterLabel, clusterID), func(context.Context) {
+			handler.ServeHTTP(rw, req)
+		})
+	})
+}
+
+func tooManyRequests(rw http.ResponseWriter, message string) {
+	rw.Header().Set("Retry-After", "10")
+	http.Error(rw, "Too many requests, "+message, http.StatusTooManyRequests)
+}
+
+// goroutines counts the goroutines of the process by their cluster label
+func goroutines() (map[string]int64, error) {
+	buf := &bytes.Buffer{}
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 1); err != nil {
+		return nil, err
+	}
+
+	result := map[string]int64{}
+	count := int64(0)
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# labels: ") {
+			labels := map[string]string{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &labels); err == nil && labels[clusterLabel] != "" {
+				result[labels[clusterLabel]] += count
+			}
+			continue
+		}
+		if i := strings.Index(line, " @ "); i > 0 {
+			count, _ = strconv.ParseInt(line[:i], 10, 64)
+		}
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,510 @@
+package certs
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/util/cert"
+)
+
+const (
+	CA               = "ca"
+	Serving          = "serving"
+	ServiceAccount   = "service-account"
+	FrontProxyCA     = "front-proxy-ca"
+	FrontProxyClient = "front-proxy-client"
+
+	// FrontProxyClientName is the common name aggregated API servers allow to set the X-Remote headers
+	FrontProxyClientName = "front-proxy-client"
+
+	keyPrefix = "/netes/certs/"
+	// where the front proxy CA was stored before all certificates were, it is moved over
+	legacyFrontProxyCAPrefix = "/netes/front-proxy-ca/"
+
+	// certificates are valid for a year and CAs for ten, both are renewed with this much validity left
+	renewBefore   = 30 * 24 * time.Hour
+	renewCABefore = 365 * 24 * time.Hour
+)
+
+var (
+	Names = []string{CA, Serving, ServiceAccount, FrontProxyCA, FrontProxyClient}
+
+	ErrUnknownName = errors.New("Unknown certificate")
+)
+
+type keyPair struct {
+	Cert    []byte    `json:"cert,omitempty"`
+	Key     []byte    `json:"key"`
+	Created time.Time `json:"created"`
+}
+
+type record struct {
+	Pairs map[string]*keyPair `json:"pairs"`
+	// PreviousServiceAccountKeys still verify the tokens they signed, tokens are not reissued on rotation
+	PreviousServiceAccountKeys [][]byte `json:"previousServiceAccountKeys,omitempty"`
+
+	Rotation *Rotation `json:"rotation,omitempty"`
+	// NextCA and NextServiceAccount are trusted while a rotation is trusting and replace the current ones once
+	// it switched, then PreviousCAs are trusted until it completes
+	NextCA             *keyPair `json:"nextCA,omitempty"`
+	NextServiceAccount *keyPair `json:"nextServiceAccount,omitempty"`
+	PreviousCAs        [][]byte `json:"previousCAs,omitempty"`
+}
+
+// Info describes a certificate or key, keys have no validity
+type Info struct {
+	Name      string    `json:"name"`
+	Subject   string    `json:"subject,omitempty"`
+	NotBefore time.Time `json:"notBefore,omitempty"`
+	NotAfter  time.Time `json:"notAfter,omitempty"`
+	Created   time.Time `json:"created"`
+	Expiring  bool      `json:"expiring"`
+}
+
+// Bundle has the certificates and keys of a cluster.  They are stored in the database so every netes serving
+// the cluster uses the same, Revision changes whenever one of them is rotated.
+type Bundle struct {
+	Revision int64
+	record   record
+	created  bool
+}
+
+// Load returns the bundle of a cluster, generating what is missing.  The serving certificate is issued again
+// if hosts or ips changed.
+func Load(ctx context.Context, client kv.Client, clusterUUID string, hosts []string, ips []net.IP) (*Bundle, error) {
+	return update(ctx, client, clusterUUID, func(r *record) (bool, error) {
+		return r.ensure(ctx, client, clusterUUID, hosts, ips)
+	})
+}
+
+// Rotate removes a certificate or key of a cluster and what it signed, the next Load generates them again.
+// A rotated service account key keeps verifying the tokens it signed.  The CA and the service account key can't be
+// rotated while a rotation of the credentials is in progress.
+func Rotate(ctx context.Context, client kv.Client, clusterUUID, name string) error {
+	if !contains(Names, name) {
+		return ErrUnknownName
+	}
+
+	_, err := update(ctx, client, clusterUUID, func(r *record) (bool, error) {
+		if r.Rotation != nil && (name == CA || name == ServiceAccount) {
+			return false, ErrRotating
+		}
+		switch name {
+		case CA:
+			delete(r.Pairs, Serving)
+		case FrontProxyCA:
+			delete(r.Pairs, FrontProxyClient)
+		case ServiceAccount:
+			if current, ok := r.Pairs[ServiceAccount]; ok {
+				r.PreviousServiceAccountKeys = append(r.PreviousServiceAccountKeys, current.Key)
+			}
+		}
+		delete(r.Pairs, name)
+		return true, nil
+	})
+	return err
+}
+
+func update(ctx context.Context, client kv.Client, clusterUUID string, mutate func(*record) (bool, error)) (*Bundle, error) {
+	key := keyPrefix + clusterUUID
+	for {
+		current, err := client.Get(ctx, key)
+		if err != nil && err != kv.ErrNotExists {
+			return nil, err
+		}
+
+		r := record{}
+		if current != nil {
+			if err := json.Unmarshal(current.Value, &r); err != nil {
+				return nil, errors.Wrap(err, "Failed to read certificates")
+			}
+		}
+		if r.Pairs == nil {
+			r.Pairs = map[string]*keyPair{}
+		}
+
+		changed, err := mutate(&r)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil && !changed {
+			return &Bundle{
+				Revision: current.Revision,
+				record:   r,
+			}, nil
+		}
+
+		value, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		created := current == nil
+		if created {
+			current, err = client.Create(ctx, key, value, 0)
+		} else {
+			current, err = client.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+		}
+		if err == kv.ErrExists || err == kv.ErrNotExists {
+			// another netes changed them first
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Failed to store certificates")
+		}
+
+		return &Bundle{
+			Revision: current.Revision,
+			record:   r,
+			created:  created,
+		}, nil
+	}
+}
+
+// ensure generates what is missing or no longer matches its CA or hosts
+func (r *record) ensure(ctx context.Context, client kv.Client, clusterUUID string, hosts []string, ips []net.IP) (bool, error) {
+	// only a new cluster takes over the front proxy CA stored before, not one rotating it
+	fresh := len(r.Pairs) == 0
+	changed := false
+
+	if _, ok := r.Pairs[CA]; !ok {
+		pair, err := newCA("kubernetes-ca")
+		if err != nil {
+			return false, err
+		}
+		r.Pairs[CA] = pair
+		changed = true
+	}
+
+	if _, ok := r.Pairs[FrontProxyCA]; !ok {
+		var (
+			pair *keyPair
+			err  error
+		)
+		if fresh {
+			if pair, err = legacyFrontProxyCA(ctx, client, clusterUUID); err != nil {
+				return false, err
+			}
+		}
+		if pair == nil {
+			if pair, err = newCA("front-proxy-ca"); err != nil {
+				return false, err
+			}
+		}
+		r.Pairs[FrontProxyCA] = pair
+		changed = true
+	}
+
+	if _, ok := r.Pairs[ServiceAccount]; !ok {
+		key, err := cert.NewPrivateKey()
+		if err != nil {
+			return false, err
+		}
+		r.Pairs[ServiceAccount] = &keyPair{
+			Key:     cert.EncodePrivateKeyPEM(key),
+			Created: time.Now().UTC(),
+		}
+		changed = true
+	}
+
+	serving := cert.Config{
+		CommonName: "kube-apiserver",
+		AltNames: cert.AltNames{
+			DNSNames: hosts,
+			IPs:      ips,
+		},
+		Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	ok, err := r.issuedFor(Serving, CA, serving)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		if r.Pairs[Serving], err = r.issue(CA, serving); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	frontProxyClient := cert.Config{
+		CommonName: FrontProxyClientName,
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ok, err = r.issuedFor(FrontProxyClient, FrontProxyCA, frontProxyClient); err != nil {
+		return false, err
+	}
+	if !ok {
+		if r.Pairs[FrontProxyClient], err = r.issue(FrontProxyCA, frontProxyClient); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// issuedFor checks that the certificate name exists, is signed by the current caName and has the names of config
+func (r *record) issuedFor(name, caName string, config cert.Config) (bool, error) {
+	pair, ok := r.Pairs[name]
+	if !ok {
+		return false, nil
+	}
+	c, err := parseCert(pair.Cert)
+	if err != nil {
+		return false, err
+	}
+	ca, err := parseCert(r.Pairs[caName].Cert)
+	if err != nil {
+		return false, err
+	}
+
+	return c.CheckSignatureFrom(ca) == nil &&
+		reflect.DeepEqual(sorted(c.DNSNames), sorted(config.AltNames.DNSNames)) &&
+		reflect.DeepEqual(sortedIPs(c.IPAddresses), sortedIPs(config.AltNames.IPs)), nil
+}
+
+func (r *record) issue(caName string, config cert.Config) (*keyPair, error) {
+	ca, caKey, err := r.Pairs[caName].parse()
+	if err != nil {
+		return nil, err
+	}
+	key, err := cert.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	c, err := cert.NewSignedCert(config, key, ca, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return &keyPair{
+		Cert:    cert.EncodeCertPEM(c),
+		Key:     cert.EncodePrivateKeyPEM(key),
+		Created: time.Now().UTC(),
+	}, nil
+}
+
+func newCA(commonName string) (*keyPair, error) {
+	key, err := cert.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	ca, err := cert.NewSelfSignedCACert(cert.Config{
+		CommonName: commonName,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return &keyPair{
+		Cert:    cert.EncodeCertPEM(ca),
+		Key:     cert.EncodePrivateKeyPEM(key),
+		Created: time.Now().UTC(),
+	}, nil
+}
+
+// Delete removes the certificates and keys of a cluster, the tokens its service account keys signed no longer
+// verify
+func Delete(ctx context.Context, client kv.Client, clusterUUID string) error {
+	for _, key := range []string{keyPrefix + clusterUUID, legacyFrontProxyCAPrefix + clusterUUID} {
+		if _, err := client.Delete(ctx, key); err != nil && err != kv.ErrNotExists {
+			return err
+		}
+	}
+	return nil
+}
+
+func legacyFrontProxyCA(ctx context.Context, client kv.Client, clusterUUID string) (*keyPair, error) {
+	current, err := client.Get(ctx, legacyFrontProxyCAPrefix+clusterUUID)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pair := &keyPair{}
+	if err := json.Unmarshal(current.Value, pair); err != nil {
+		return nil, errors.Wrap(err, "Failed to read front proxy CA")
+	}
+	c, err := parseCert(pair.Cert)
+	if err != nil {
+		return nil, err
+	}
+	pair.Created = c.NotBefore
+	return pair, nil
+}
+
+func (p *keyPair) parse() (*x509.Certificate, *rsa.PrivateKey, error) {
+	c, err := parseCert(p.Cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := parseKey(p.Key)
+	return c, key, err
+}
+
+func parseCert(data []byte) (*x509.Certificate, error) {
+	certs, err := cert.ParseCertsPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+func parseKey(data []byte) (*rsa.PrivateKey, error) {
+	key, err := cert.ParsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// Created is whether the bundle was generated by this Load, which happens once for a new cluster
+func (b *Bundle) Created() bool {
+	return b.created
+}
+
+// CAPEM is the CA of the cluster, the serving certificate is signed by it and pods get it with their token
+func (b *Bundle) CAPEM() []byte {
+	return b.record.Pairs[CA].Cert
+}
+
+// ServingCertificate is the certificate of the cluster hosts, with the CA in its chain
+func (b *Bundle) ServingCertificate() (*tls.Certificate, error) {
+	pair := b.record.Pairs[Serving]
+	certificate, err := tls.X509KeyPair(append(append([]byte{}, pair.Cert...), b.CAPEM()...), pair.Key)
+	return &certificate, err
+}
+
+func (b *Bundle) FrontProxyCAPEM() []byte {
+	return b.record.Pairs[FrontProxyCA].Cert
+}
+
+func (b *Bundle) FrontProxyClientCertificate() (*tls.Certificate, error) {
+	pair := b.record.Pairs[FrontProxyClient]
+	certificate, err := tls.X509KeyPair(pair.Cert, pair.Key)
+	if err != nil {
+		return nil, err
+	}
+	certificate.Leaf, err = parseCert(pair.Cert)
+	return &certificate, err
+}
+
+// ServiceAccountKeyPEM signs the service account tokens
+func (b *Bundle) ServiceAccountKeyPEM() []byte {
+	return b.record.Pairs[ServiceAccount].Key
+}
+
+func (b *Bundle) ServiceAccountKey() (*rsa.PrivateKey, error) {
+	return parseKey(b.ServiceAccountKeyPEM())
+}
+
+// ServiceAccountPublicKeys verify service account tokens, the current key first and the key of a rotation next
+func (b *Bundle) ServiceAccountPublicKeys() ([]interface{}, error) {
+	keys := [][]byte{b.ServiceAccountKeyPEM()}
+	if b.record.NextServiceAccount != nil {
+		keys = append(keys, b.record.NextServiceAccount.Key)
+	}
+
+	var result []interface{}
+	for _, data := range append(keys, b.record.PreviousServiceAccountKeys...) {
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &key.PublicKey)
+	}
+	return result, nil
+}
+
+// Info lists the certificates and keys in the order of Names
+func (b *Bundle) Info() ([]Info, error) {
+	var result []Info
+	for _, name := range Names {
+		pair := b.record.Pairs[name]
+		info := Info{
+			Name:    name,
+			Created: pair.Created,
+		}
+		if len(pair.Cert) > 0 {
+			c, err := parseCert(pair.Cert)
+			if err != nil {
+				return nil, err
+			}
+			info.Subject = c.Subject.CommonName
+			info.NotBefore = c.NotBefore
+			info.NotAfter = c.NotAfter
+			info.Expiring = expiring(name, c.NotAfter)
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// Expiring returns the certificates to renew
+func (b *Bundle) Expiring() ([]string, error) {
+	infos, err := b.Info()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, info := range infos {
+		if info.Expiring {
+			result = append(result, info.Name)
+		}
+	}
+	return result, nil
+}
+
+func expiring(name string, notAfter time.Time) bool {
+	before := renewBefore
+	if name == CA || name == FrontProxyCA {
+		before = renewCABefore
+	}
+	return time.Now().Add(before).After(notAfter)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sorted(values []string) []string {
+	result := append([]string{}, values...)
+	sort.Strings(result)
+	return result
+}
+
+func sortedIPs(ips []net.IP) []string {
+	var result []string
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+	return sorted(result)
+}
+
+// Revision is the revision of the stored bundle of a cluster, zero if it has none yet
+func Revision(ctx context.Context, client kv.Client, clusterUUID string) (int64, error) {
+	current, err := client.Get(ctx, keyPrefix+clusterUUID)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return current.Revision, nil
+}
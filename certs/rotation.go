@@ -0,0 +1,130 @@
+package certs
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	"k8s.io/client-go/util/cert"
+)
+
+const (
+	// RotationTrusting is the phase of a rotation the new CA and service account key are trusted next to the
+	// current ones, the tokens controller hands out both CAs to pods
+	RotationTrusting = "trusting"
+	// RotationSwitched is the phase of a rotation the cluster is served with a certificate of the new CA and
+	// tokens are signed with the new key, the old CA is still trusted
+	RotationSwitched = "switched"
+
+	DefaultRotationOverlap = 24 * time.Hour
+)
+
+var ErrRotating = errors.New("Credentials of the cluster are being rotated")
+
+// Rotation replaces the CA, serving certificate and service account key of a cluster without breaking the
+// clients that trust the old ones.  Each phase lasts the overlap, the old service account key keeps verifying the
+// tokens it signed after the rotation like with Rotate.
+type Rotation struct {
+	Phase          string    `json:"phase"`
+	Started        time.Time `json:"started"`
+	PhaseStarted   time.Time `json:"phaseStarted"`
+	OverlapSeconds int64     `json:"overlapSeconds"`
+}
+
+// Next is when the rotation moves on to the next phase or completes
+func (r *Rotation) Next() time.Time {
+	return r.PhaseStarted.Add(time.Duration(r.OverlapSeconds) * time.Second)
+}
+
+// StartRotation generates the new CA and service account key of a cluster and trusts them, the servers of the
+// cluster pick them up once restarted
+func StartRotation(ctx context.Context, client kv.Client, clusterUUID string, overlap time.Duration) (*Rotation, error) {
+	if overlap <= 0 {
+		overlap = DefaultRotationOverlap
+	}
+
+	bundle, err := update(ctx, client, clusterUUID, func(r *record) (bool, error) {
+		if r.Rotation != nil {
+			return false, ErrRotating
+		}
+
+		ca, err := newCA("kubernetes-ca")
+		if err != nil {
+			return false, err
+		}
+		key, err := cert.NewPrivateKey()
+		if err != nil {
+			return false, err
+		}
+
+		now := time.Now().UTC()
+		r.NextCA = ca
+		r.NextServiceAccount = &keyPair{
+			Key:     cert.EncodePrivateKeyPEM(key),
+			Created: now,
+		}
+		r.Rotation = &Rotation{
+			Phase:          RotationTrusting,
+			Started:        now,
+			PhaseStarted:   now,
+			OverlapSeconds: int64(overlap / time.Second),
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bundle.record.Rotation, nil
+}
+
+// AdvanceRotation moves the rotation of a cluster on to its next phase once its overlap passed, it returns
+// whether it did.  The serving certificate of the new CA is issued by the next Load.
+func AdvanceRotation(ctx context.Context, client kv.Client, clusterUUID string) (bool, error) {
+	advanced := false
+	_, err := update(ctx, client, clusterUUID, func(r *record) (bool, error) {
+		advanced = false
+		if r.Rotation == nil || time.Now().Before(r.Rotation.Next()) {
+			return false, nil
+		}
+
+		switch r.Rotation.Phase {
+		case RotationTrusting:
+			if current, ok := r.Pairs[CA]; ok {
+				r.PreviousCAs = append(r.PreviousCAs, current.Cert)
+			}
+			if current, ok := r.Pairs[ServiceAccount]; ok {
+				r.PreviousServiceAccountKeys = append(r.PreviousServiceAccountKeys, current.Key)
+			}
+			r.Pairs[CA] = r.NextCA
+			r.Pairs[ServiceAccount] = r.NextServiceAccount
+			r.NextCA = nil
+			r.NextServiceAccount = nil
+			r.Rotation.Phase = RotationSwitched
+			r.Rotation.PhaseStarted = time.Now().UTC()
+		default:
+			r.PreviousCAs = nil
+			r.Rotation = nil
+		}
+		advanced = true
+		return true, nil
+	})
+	return advanced, err
+}
+
+// Rotation is the rotation of the credentials of the cluster in progress, nil if none is
+func (b *Bundle) Rotation() *Rotation {
+	return b.record.Rotation
+}
+
+// TrustedCAPEM is the CA of the cluster with the CAs trusted while its credentials are rotated
+func (b *Bundle) TrustedCAPEM() []byte {
+	result := append([]byte{}, b.CAPEM()...)
+	if b.record.NextCA != nil {
+		result = append(result, b.record.NextCA.Cert...)
+	}
+	for _, ca := range b.record.PreviousCAs {
+		result = append(result, ca...)
+	}
+	return result
+}
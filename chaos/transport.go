@@ -0,0 +1,133 @@
+package chaos
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport injects faults into HTTP requests so integration tests can check that netes degrades gracefully
+// when Rancher is slow, failing or returning garbage
+type Transport struct {
+	Base http.RoundTripper
+	// Latency is the maximum random delay added to every request
+	Latency time.Duration
+	// ErrorRate is the probability that a request starts a burst of ErrorBurst 503 responses
+	ErrorRate  float64
+	ErrorBurst int
+	// TruncateRate is the probability that a response body is cut in half
+	TruncateRate float64
+
+	lock      sync.Mutex
+	rand      *rand.Rand
+	remaining int
+}
+
+// Parse reads a spec like "latency=500ms,errors=0.1,burst=5,truncate=0.05"
+func Parse(spec string, base http.RoundTripper) (*Transport, error) {
+	t := &Transport{
+		Base:       base,
+		ErrorBurst: 1,
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid chaos setting %q", part)
+		}
+
+		var err error
+		switch kv[0] {
+		case "latency":
+			t.Latency, err = time.ParseDuration(kv[1])
+		case "errors":
+			t.ErrorRate, err = strconv.ParseFloat(kv[1], 64)
+		case "burst":
+			t.ErrorBurst, err = strconv.Atoi(kv[1])
+		case "truncate":
+			t.TruncateRate, err = strconv.ParseFloat(kv[1], 64)
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chaos setting %q: %v", part, err)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay, fail, truncate := t.roll()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if fail {
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      req.Proto,
+			ProtoMajor: req.ProtoMajor,
+			ProtoMinor: req.ProtoMinor,
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       ioutil.NopCloser(strings.NewReader("injected failure")),
+			Request:    req,
+		}, nil
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil || !truncate {
+		return resp, err
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	content = content[:len(content)/2]
+	resp.Body = ioutil.NopCloser(bytes.NewReader(content))
+	resp.ContentLength = int64(len(content))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+func (t *Transport) roll() (time.Duration, bool, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.rand == nil {
+		t.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	var delay time.Duration
+	if t.Latency > 0 {
+		delay = time.Duration(t.rand.Int63n(int64(t.Latency)))
+	}
+
+	if t.remaining == 0 && t.rand.Float64() < t.ErrorRate {
+		t.remaining = t.ErrorBurst
+	}
+
+	fail := false
+	if t.remaining > 0 {
+		t.remaining--
+		fail = true
+	}
+
+	return delay, fail, t.rand.Float64() < t.TruncateRate
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/rancher/go-rancher/v3"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -41,6 +42,8 @@ func New(cluster *client.Cluster) (*ClientSetSet, error) {
 	c := &ClientSetSet{
 		LoopbackClientConfig: rest.Config{
 			Host: "http://localhost:8089/k8s/clusters/" + cluster.Id + "/",
+			// authenticates the apiserver to itself, see authentication.New
+			BearerToken: string(uuid.NewUUID()),
 			ContentConfig: rest.ContentConfig{
 				ContentType: "application/vnd.kubernetes.protobuf",
 			},
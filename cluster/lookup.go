@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -17,50 +18,108 @@ type Lookup struct {
 	clusterURL string
 }
 
-func NewLookup(clusterURL string) *Lookup {
+func NewLookup(clusterURL string, transport http.RoundTripper) *Lookup {
 	return &Lookup{
 		httpClient: http.Client{
-			Timeout: 5 * time.Second,
+			Timeout:   5 * time.Second,
+			Transport: transport,
 		},
 		clusterURL: clusterURL,
 	}
 }
 
 func (c *Lookup) Lookup(input *http.Request) (*client.Cluster, error) {
-	clusterId := GetClusterID(input)
+	return c.LookupByID(GetClusterID(input), input)
+}
+
+// LookupByID gets the cluster with the Rancher credentials of input, nil if they don't give access to it
+func (c *Lookup) LookupByID(clusterId string, input *http.Request) (*client.Cluster, error) {
 	if clusterId == "" {
 		return nil, nil
 	}
 
-	req, err := http.NewRequest("GET", c.clusterURL + "/" + clusterId, nil)
+	resp, err := c.get(c.clusterURL + "/" + clusterId, input)
 	if err != nil {
 		return nil, err
 	}
+	defer close(resp)
 
-	req.Header.Set("Authorization", getAuthorizationHeader(req))
+	if resp.StatusCode >= 500 {
+		return nil, unavailable(resp)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil
+	}
 
+	cluster := &client.Cluster{}
+	if err := json.NewDecoder(resp.Body).Decode(cluster); err != nil {
+		return nil, errors.Wrap(err, "Parsing clusters response")
+	}
 
-	cookie := getTokenCookie(input)
-	if cookie != nil {
-		req.AddCookie(cookie)
+	return cluster, nil
+}
+
+// LookupByName gets the cluster named name with the Rancher credentials of input, nil if they don't give access
+// to one
+func (c *Lookup) LookupByName(name string, input *http.Request) (*client.Cluster, error) {
+	if name == "" {
+		return nil, nil
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.get(c.clusterURL + "?name=" + url.QueryEscape(name), input)
 	if err != nil {
 		return nil, err
 	}
 	defer close(resp)
 
+	if resp.StatusCode >= 500 {
+		return nil, unavailable(resp)
+	}
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		return nil, nil
 	}
 
-	cluster := &client.Cluster{}
-	if err := json.NewDecoder(resp.Body).Decode(cluster); err != nil {
+	clusters := &client.ClusterCollection{}
+	if err := json.NewDecoder(resp.Body).Decode(clusters); err != nil {
 		return nil, errors.Wrap(err, "Parsing clusters response")
 	}
 
-	return cluster, nil
+	for i := range clusters.Data {
+		if clusters.Data[i].Name == name && clusters.Data[i].Removed == "" {
+			return &clusters.Data[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *Lookup) get(target string, input *http.Request) (*http.Response, error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth := getAuthorizationHeader(input); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+
+	cookie := getTokenCookie(input)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// unavailable is the error of Rancher failing to answer, like the one of the Rancher client
+func unavailable(resp *http.Response) error {
+	return &client.ApiError{
+		StatusCode: resp.StatusCode,
+		Url:        resp.Request.URL.String(),
+		Msg:        "Rancher failed to look up the cluster: " + resp.Status,
+		Status:     resp.Status,
+	}
 }
 
 func GetClusterID(req *http.Request) string {
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rancher/netes/admin/client"
+)
+
+const clustersUsage = `Usage: netes clusters [-admin-url URL] COMMAND
+
+Commands:
+  list                                    list the clusters served by netes
+  get ID                                  show a cluster and its status as JSON
+  create [-description D] [-config FILE] [-template T] NAME
+                                          create a cluster, FILE is its k8sServerConfig as JSON and T
+                                          the template with the defaults of the settings not in FILE
+  templates                               list the templates clusters can be created from
+  delete ID                               delete a cluster
+
+The admin token is read from NETES_ADMIN_TOKEN.
+`
+
+// runClusters runs "netes clusters", it manages the clusters of a running netes through its admin API
+func runClusters(args []string) {
+	flags := flag.NewFlagSet("clusters", flag.ExitOnError)
+	adminURL := flags.String("admin-url", "http://127.0.0.1:8090", "admin API of netes")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, clustersUsage)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c := client.New(*adminURL, os.Getenv("NETES_ADMIN_TOKEN"))
+	var err error
+	switch flags.Arg(0) {
+	case "list":
+		err = listClusters(c)
+	case "get":
+		err = getCluster(c, flags.Args()[1:])
+	case "create":
+		err = createCluster(c, flags.Args()[1:])
+	case "delete":
+		err = deleteCluster(c, flags.Args()[1:])
+	case "templates":
+		err = listTemplates(c)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func listClusters(c *client.Client) error {
+	clusters, err := c.ListClusters()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTATE\tRUNNING\tOBJECTS\tSTORAGE")
+	for _, cluster := range clusters.Data {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%s\n", cluster.ID, cluster.Name, cluster.State, cluster.Running,
+			cluster.Objects, humanBytes(cluster.StorageBytes))
+	}
+	return w.Flush()
+}
+
+func getCluster(c *client.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: netes clusters get ID")
+	}
+
+	cluster, err := c.GetCluster(args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(cluster)
+}
+
+func createCluster(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	description := flags.String("description", "", "description of the cluster")
+	configFile := flags.String("config", "", "file with the k8sServerConfig of the cluster as JSON")
+	template := flags.String("template", "", "template of the cluster")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("Usage: netes clusters create [-description D] [-config FILE] [-template T] NAME")
+	}
+
+	input := &client.ClusterInput{
+		Name:        flags.Arg(0),
+		Description: *description,
+		Template:    *template,
+	}
+	if *configFile != "" {
+		content, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(content, &input.K8sServerConfig); err != nil {
+			return fmt.Errorf("Invalid k8sServerConfig in %s: %v", *configFile, err)
+		}
+	}
+
+	cluster, err := c.CreateCluster(input)
+	if err != nil {
+		return err
+	}
+	return printJSON(cluster)
+}
+
+func listTemplates(c *client.Client) error {
+	templates, err := c.ListTemplates()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDESCRIPTION")
+	for _, t := range templates.Data {
+		fmt.Fprintf(w, "%s\t%s\n", t.Name, t.Description)
+	}
+	return w.Flush()
+}
+
+func deleteCluster(c *client.Client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: netes clusters delete ID")
+	}
+	return c.DeleteCluster(args[0])
+}
+
+func printJSON(obj interface{}) error {
+	content, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,180 @@
+package configfile
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+)
+
+const pollInterval = 10 * time.Second
+
+// Load reads a YAML config file of netes.  Its keys are the environment variables netes is configured with, like
+// NETES_MAX_REQUESTS_INFLIGHT, lists can be YAML sequences and NETES_WATCH_POLL_OVERRIDES a mapping.
+func Load(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		str, err := format(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s in config file %s: %v", key, path, err)
+		}
+		values[key] = str
+	}
+	return values, nil
+}
+
+func format(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			part, err := format(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]interface{}:
+		var parts []string
+		for key, item := range v {
+			part, err := format(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, key+"="+part)
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// File is a config file whose values are in the environment of netes, the environment wins over the file
+type File struct {
+	path        string
+	environment map[string]bool
+	values      map[string]string
+	modTime     time.Time
+}
+
+// Setenv loads the config file at path into the environment, leaving the variables already set alone
+func Setenv(path string) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		path:        path,
+		environment: map[string]bool{},
+		values:      values,
+		modTime:     info.ModTime(),
+	}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			f.environment[key] = true
+			delete(f.values, key)
+			continue
+		}
+		os.Setenv(key, value)
+	}
+	return f, nil
+}
+
+// Watch loads the config file again on SIGHUP and once it changes, until ctx is done.  apply gets the values of
+// the file the environment doesn't override and the keys that changed since the last load.
+func (f *File) Watch(ctx context.Context, apply func(values map[string]string, changed []string)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				logrus.Infof("Received SIGHUP, reloading %s", f.path)
+				f.reload(apply)
+			case <-ticker.C:
+				if info, err := os.Stat(f.path); err == nil && !info.ModTime().Equal(f.modTime) {
+					logrus.Infof("Config file %s changed, reloading", f.path)
+					f.reload(apply)
+				}
+			}
+		}
+	}()
+}
+
+func (f *File) reload(apply func(values map[string]string, changed []string)) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		logrus.Errorf("Failed to reload config file, keeping the current configuration: %v", err)
+		return
+	}
+	// a broken file is reported once, not on every poll
+	f.modTime = info.ModTime()
+	values, err := Load(f.path)
+	if err != nil {
+		logrus.Errorf("Failed to reload config file, keeping the current configuration: %v", err)
+		return
+	}
+
+	for key := range f.environment {
+		delete(values, key)
+	}
+
+	var changed []string
+	for key, value := range values {
+		if old, ok := f.values[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range f.values {
+		if _, ok := values[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+
+	f.values = values
+	if len(changed) > 0 {
+		apply(values, changed)
+	}
+}
@@ -1,16 +1,44 @@
 package controllermanager
 
 import (
+	"context"
+	"os"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/certs"
 	"github.com/rancher/netes/clients"
+	"github.com/rancher/netes/lease"
+	"github.com/rancher/netes/scheduler"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kubernetes/cmd/kube-controller-manager/app"
 	"k8s.io/kubernetes/cmd/kube-controller-manager/app/options"
+	"k8s.io/kubernetes/pkg/client/informers/informers_generated/externalversions"
+	serviceaccountcontroller "k8s.io/kubernetes/pkg/controller/serviceaccount"
+	"k8s.io/kubernetes/pkg/serviceaccount"
 )
 
-func Start(clientsetset *clients.ClientSetSet, stop <-chan struct{}) error {
+const leaseDuration = 15 * time.Second
+
+// Run runs the controllers of a cluster while this netes holds the controller-manager lease of the cluster, so
+// only one of the netes sharing a database runs them.  With embeddedScheduler the pods of the cluster are
+// scheduled under the same lease.
+func Run(ctx context.Context, client kv.Client, clusterUUID string, clientsetset *clients.ClientSetSet, bundle *certs.Bundle,
+	embeddedScheduler bool) {
+	hostname, _ := os.Hostname()
+	e := lease.NewElector(client, "/netes/leases/"+clusterUUID+"/controller-manager",
+		hostname+"_"+string(uuid.NewUUID()), leaseDuration)
+	e.Run(ctx, func(ctx context.Context) error {
+		return Start(clientsetset, bundle, embeddedScheduler, ctx.Done())
+	})
+}
+
+// Start starts the controllers until stop is closed.  Informers are created per call since informers that
+// were stopped can't be started again.  Service account tokens are signed with the key of bundle and carry its
+// CA with the CAs trusted during a rotation.
+func Start(clientsetset *clients.ClientSetSet, bundle *certs.Bundle, embeddedScheduler bool, stop <-chan struct{}) error {
 	// TODO: don't like using cmd/kube-controller-manager/app but the package does too much
 	s := options.NewCMServer()
 
@@ -19,6 +47,8 @@ func Start(clientsetset *clients.ClientSetSet, stop <-chan struct{}) error {
 		return err
 	}
 
+	informers := externalversions.NewSharedInformerFactory(clientsetset.ExternalClient, 10*time.Minute)
+
 	// TODO: Init cloud provider?
 	//cloud, err := cloudprovider.InitCloudProvider(s.CloudProvider, s.CloudConfigFile)
 	//if err != nil {
@@ -31,14 +61,55 @@ func Start(clientsetset *clients.ClientSetSet, stop <-chan struct{}) error {
 
 	ctx := app.ControllerContext{
 		ClientBuilder:      clientsetset.ControllerClientBuilder,
-		InformerFactory:    clientsetset.ExternalSharedInformers,
+		InformerFactory:    informers,
 		Options:            *s,
 		AvailableResources: availableResources,
 		Cloud:              nil,
 		Stop:               stop,
 	}
 
-	return startControllers(ctx)
+	if err := startTokensController(ctx, bundle); err != nil {
+		return err
+	}
+
+	if err := startControllers(ctx); err != nil {
+		return err
+	}
+
+	if embeddedScheduler {
+		scheduler.New(clientsetset.ExternalClient, informers).Start(stop)
+	}
+
+	informers.Start(stop)
+	return nil
+}
+
+// startTokensController is started first like upstream, the other controllers use service accounts.  Upstream
+// reads the key and CA from files.
+func startTokensController(ctx app.ControllerContext, bundle *certs.Bundle) error {
+	privateKey, err := bundle.ServiceAccountKey()
+	if err != nil {
+		return err
+	}
+
+	client, err := ctx.ClientBuilder.Client("tokens-controller")
+	if err != nil {
+		return err
+	}
+
+	controller := serviceaccountcontroller.NewTokensController(
+		ctx.InformerFactory.Core().V1().ServiceAccounts(),
+		ctx.InformerFactory.Core().V1().Secrets(),
+		client,
+		serviceaccountcontroller.TokensControllerOptions{
+			TokenGenerator: serviceaccount.JWTTokenGenerator(privateKey),
+			RootCA:         bundle.TrustedCAPEM(),
+		},
+	)
+	go controller.Run(int(ctx.Options.ConcurrentSATokenSyncs), ctx.Stop)
+
+	ctx.InformerFactory.Start(ctx.Stop)
+	return nil
 }
 
 func startControllers(ctx app.ControllerContext) error {
@@ -0,0 +1,409 @@
+package deprecation
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	usagePrefix = "/netes/deprecations/"
+	// maxUsagesPerCluster bounds the memory and storage used by clients sending random user agents
+	maxUsagesPerCluster = 1000
+	flushInterval       = time.Minute
+	// clients that stopped using deprecated APIs drop out of the report after retention
+	retention = 30 * 24 * time.Hour
+)
+
+// Deprecated maps the group/version/resource, or group/version for a whole group version, of deprecated APIs
+// to the API replacing them.  The core group is the empty group.
+var Deprecated = map[string]string{
+	"extensions/v1beta1/deployments":     "apps/v1beta2",
+	"extensions/v1beta1/networkpolicies": "networking.k8s.io/v1",
+	"authentication.k8s.io/v1beta1":      "authentication.k8s.io/v1",
+	"authorization.k8s.io/v1beta1":       "authorization.k8s.io/v1",
+	"rbac.authorization.k8s.io/v1alpha1": "rbac.authorization.k8s.io/v1beta1",
+	"storage.k8s.io/v1beta1":             "storage.k8s.io/v1",
+	"extensions/v1beta1/daemonsets":      "apps/v1beta2",
+	"extensions/v1beta1/replicasets":     "apps/v1beta2",
+	"apps/v1beta1":                       "apps/v1beta2",
+}
+
+// RemovedIn maps the deprecated APIs like Deprecated to the Kubernetes version that no longer serves them, the
+// clusters using them break when the embedded Kubernetes is upgraded to it
+var RemovedIn = map[string]string{
+	"extensions/v1beta1/deployments":     "1.16",
+	"extensions/v1beta1/networkpolicies": "1.16",
+	"extensions/v1beta1/daemonsets":      "1.16",
+	"extensions/v1beta1/replicasets":     "1.16",
+	"apps/v1beta1":                       "1.16",
+	"authentication.k8s.io/v1beta1":      "1.22",
+	"authorization.k8s.io/v1beta1":       "1.22",
+	"rbac.authorization.k8s.io/v1alpha1": "1.22",
+	"storage.k8s.io/v1beta1":             "1.22",
+}
+
+var requestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "netes_deprecated_api_requests_total",
+	Help: "Number of requests to deprecated APIs per cluster, group, version and resource",
+}, []string{"cluster", "group", "version", "resource"})
+
+func init() {
+	prometheus.MustRegister(requestsCounter)
+}
+
+type Usage struct {
+	Group       string    `json:"group"`
+	Version     string    `json:"version"`
+	Resource    string    `json:"resource"`
+	Replacement string    `json:"replacement"`
+	RemovedIn   string    `json:"removedIn,omitempty"`
+	User        string    `json:"user"`
+	UserAgent   string    `json:"userAgent"`
+	Verbs       []string  `json:"verbs"`
+	Count       int64     `json:"count"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+type usageKey struct {
+	group, version, resource, user, userAgent string
+}
+
+func (u *Usage) key() usageKey {
+	return usageKey{u.Group, u.Version, u.Resource, u.User, u.UserAgent}
+}
+
+// ClusterUsage is the deprecated API usage of a cluster
+type ClusterUsage struct {
+	Cluster string  `json:"cluster"`
+	Usages  []Usage `json:"usages"`
+}
+
+// Tracker counts the requests to deprecated APIs per cluster, resource and client.  The counts are added to the
+// ones in the database every flushInterval, so they cover every netes sharing the database and survive restarts.
+type Tracker struct {
+	sync.Mutex
+	client kv.Client
+	// the usage not flushed yet
+	clusters map[string]map[usageKey]*Usage
+}
+
+func New(client kv.Client) *Tracker {
+	return &Tracker{
+		client:   client,
+		clusters: map[string]map[usageKey]*Usage{},
+	}
+}
+
+// Start flushes the counts until ctx is done, and once more then
+func (t *Tracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				t.flush(context.Background())
+				return
+			case <-ticker.C:
+				t.flush(ctx)
+			}
+		}
+	}()
+}
+
+// Filter records the requests of handler that are for deprecated APIs, it must run after authentication
+func (t *Tracker) Filter(clusterID string, handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if ctx, ok := mapper.Get(req); ok {
+			if info, ok := apirequest.RequestInfoFrom(ctx); ok && info.IsResourceRequest {
+				user := ""
+				if u, ok := apirequest.UserFrom(ctx); ok {
+					user = u.GetName()
+				}
+				t.record(clusterID, info, user, req.UserAgent())
+			}
+		}
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+func replacement(info *apirequest.RequestInfo) (string, string, bool) {
+	key := info.APIGroup + "/" + info.APIVersion + "/" + info.Resource
+	if r, ok := Deprecated[key]; ok {
+		return r, RemovedIn[key], true
+	}
+	key = info.APIGroup + "/" + info.APIVersion
+	r, ok := Deprecated[key]
+	return r, RemovedIn[key], ok
+}
+
+func (t *Tracker) record(clusterID string, info *apirequest.RequestInfo, user, userAgent string) {
+	replacement, removedIn, ok := replacement(info)
+	if !ok {
+		return
+	}
+
+	requestsCounter.WithLabelValues(clusterID, info.APIGroup, info.APIVersion, info.Resource).Inc()
+
+	t.Lock()
+	defer t.Unlock()
+
+	usages, ok := t.clusters[clusterID]
+	if !ok {
+		usages = map[usageKey]*Usage{}
+		t.clusters[clusterID] = usages
+	}
+
+	key := usageKey{info.APIGroup, info.APIVersion, info.Resource, user, userAgent}
+	usage, ok := usages[key]
+	if !ok {
+		if len(usages) >= maxUsagesPerCluster {
+			logrus.Debugf("Not tracking more deprecated API clients of cluster %s", clusterID)
+			return
+		}
+		usage = &Usage{
+			Group:       info.APIGroup,
+			Version:     info.APIVersion,
+			Resource:    info.Resource,
+			Replacement: replacement,
+			RemovedIn:   removedIn,
+			User:        user,
+			UserAgent:   userAgent,
+			FirstSeen:   time.Now(),
+		}
+		usages[key] = usage
+	}
+
+	usage.Count++
+	usage.LastSeen = time.Now()
+	if !contains(usage.Verbs, info.Verb) {
+		usage.Verbs = append(usage.Verbs, info.Verb)
+		sort.Strings(usage.Verbs)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the deprecated API usage of a cluster, most requested first
+func (t *Tracker) List(ctx context.Context, clusterID string) ([]Usage, error) {
+	stored, _, err := t.load(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Lock()
+	result := merge(stored, t.clusters[clusterID])
+	t.Unlock()
+	return result, nil
+}
+
+// Report returns the clusters using deprecated APIs, with the usage of the APIs removed in removedBy or an earlier
+// Kubernetes version, like "1.16", or all their usage if removedBy is empty
+func (t *Tracker) Report(ctx context.Context, removedBy string) ([]ClusterUsage, error) {
+	values, err := t.client.List(ctx, usagePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterIDs := map[string]bool{}
+	for _, value := range values {
+		clusterIDs[strings.TrimPrefix(value.Key, usagePrefix)] = true
+	}
+	t.Lock()
+	for clusterID := range t.clusters {
+		clusterIDs[clusterID] = true
+	}
+	t.Unlock()
+
+	result := []ClusterUsage{}
+	for clusterID := range clusterIDs {
+		usages, err := t.List(ctx, clusterID)
+		if err != nil {
+			return nil, err
+		}
+
+		var removed []Usage
+		for _, u := range usages {
+			if removedBy == "" || (u.RemovedIn != "" && !newerVersion(u.RemovedIn, removedBy)) {
+				removed = append(removed, u)
+			}
+		}
+		if len(removed) > 0 {
+			result = append(result, ClusterUsage{
+				Cluster: clusterID,
+				Usages:  removed,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Cluster < result[j].Cluster
+	})
+	return result, nil
+}
+
+// Delete drops the usage of a removed cluster
+func Delete(ctx context.Context, client kv.Client, clusterID string) error {
+	_, err := client.Delete(ctx, usagePrefix+clusterID)
+	if err == kv.ErrNotExists {
+		return nil
+	}
+	return err
+}
+
+func (t *Tracker) flush(ctx context.Context) {
+	t.Lock()
+	pending := t.clusters
+	t.clusters = map[string]map[usageKey]*Usage{}
+	t.Unlock()
+
+	for clusterID, usages := range pending {
+		if err := t.save(ctx, clusterID, usages); err != nil {
+			logrus.Errorf("Failed to save deprecated API usage of cluster %s: %v", clusterID, err)
+			// counted again with the next flush
+			t.Lock()
+			t.clusters[clusterID] = mergeKeyed(t.clusters[clusterID], usages)
+			t.Unlock()
+		}
+	}
+}
+
+func (t *Tracker) save(ctx context.Context, clusterID string, usages map[usageKey]*Usage) error {
+	for {
+		stored, current, err := t.load(ctx, clusterID)
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(merge(stored, usages))
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			_, err = t.client.Create(ctx, usagePrefix+clusterID, value, 0)
+		} else {
+			_, err = t.client.UpdateOrCreate(ctx, usagePrefix+clusterID, value, current.Revision, 0)
+		}
+		if err == kv.ErrExists || err == kv.ErrNotExists {
+			// another netes saved its usage first
+			continue
+		}
+		return err
+	}
+}
+
+func (t *Tracker) load(ctx context.Context, clusterID string) ([]Usage, *kv.KeyValue, error) {
+	current, err := t.client.Get(ctx, usagePrefix+clusterID)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var usages []Usage
+	if err := json.Unmarshal(current.Value, &usages); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid deprecated API usage of cluster %s", clusterID)
+	}
+	return usages, current, nil
+}
+
+// merge adds the counts of usages to stored, leaving out the usage older than retention, most requested first
+func merge(stored []Usage, usages map[usageKey]*Usage) []Usage {
+	keyed := map[usageKey]*Usage{}
+	for i := range stored {
+		keyed[stored[i].key()] = &stored[i]
+	}
+	keyed = mergeKeyed(keyed, usages)
+
+	cutoff := time.Now().Add(-retention)
+	result := []Usage{}
+	for _, u := range keyed {
+		if u.LastSeen.After(cutoff) {
+			result = append(result, *u)
+		}
+	}
+	if len(result) > maxUsagesPerCluster {
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].LastSeen.After(result[j].LastSeen)
+		})
+		result = result[:maxUsagesPerCluster]
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// mergeKeyed adds the counts of usages to a copy of into
+func mergeKeyed(into, usages map[usageKey]*Usage) map[usageKey]*Usage {
+	result := map[usageKey]*Usage{}
+	for key, u := range into {
+		c := *u
+		c.Verbs = append([]string(nil), u.Verbs...)
+		result[key] = &c
+	}
+
+	for key, u := range usages {
+		existing, ok := result[key]
+		if !ok {
+			c := *u
+			c.Verbs = append([]string(nil), u.Verbs...)
+			result[key] = &c
+			continue
+		}
+
+		existing.Count += u.Count
+		if u.FirstSeen.Before(existing.FirstSeen) {
+			existing.FirstSeen = u.FirstSeen
+		}
+		if u.LastSeen.After(existing.LastSeen) {
+			existing.LastSeen = u.LastSeen
+		}
+		// the API may have been given a removal version since
+		existing.Replacement, existing.RemovedIn = u.Replacement, u.RemovedIn
+		for _, verb := range u.Verbs {
+			if !contains(existing.Verbs, verb) {
+				existing.Verbs = append(existing.Verbs, verb)
+			}
+		}
+		sort.Strings(existing.Verbs)
+	}
+	return result
+}
+
+// newerVersion is whether the Kubernetes version left, like "1.16", is newer than right
+func newerVersion(left, right string) bool {
+	l, r := strings.Split(left, "."), strings.Split(right, ".")
+	for i := 0; i < len(l) || i < len(r); i++ {
+		var lv, rv int
+		if i < len(l) {
+			lv, _ = strconv.Atoi(strings.TrimPrefix(l[i], "v"))
+		}
+		if i < len(r) {
+			rv, _ = strconv.Atoi(strings.TrimPrefix(r[i], "v"))
+		}
+		if lv != rv {
+			return lv > rv
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package drain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DrainedLabel = "io.rancher.k8s.drained"
+	syncInterval = 30 * time.Second
+)
+
+var drainStates = map[string]bool{
+	"deactivating": true,
+	"inactive":     true,
+	"evacuating":   true,
+}
+
+// Controller drains the node of every Rancher host that is being deactivated or evacuated and
+// labels the host once the drain is complete so Rancher knows it can be removed.
+type Controller struct {
+	sync.Mutex
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+	opts          Options
+	inProgress    map[string]bool
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+		opts: Options{
+			Timeout: config.DrainTimeout,
+			Force:   config.DrainForce,
+		},
+		inProgress: map[string]bool{},
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	go wait.Until(c.sync, syncInterval, ctx.Done())
+}
+
+func (c *Controller) sync() {
+	rancherClient, err := c.rancher.Get()
+	if err != nil {
+		logrus.Errorf("Failed to connect to Rancher for node drain: %v", err)
+		return
+	}
+
+	for _, s := range c.serverFactory.Servers() {
+		hosts, err := rancherClient.Host.ListAll(&client.ListOpts{
+			Filters: map[string]interface{}{
+				"clusterId": s.Cluster().Id,
+			},
+		})
+		if err != nil {
+			logrus.Errorf("Failed to list hosts for cluster %s: %v", s.Cluster().Id, err)
+			continue
+		}
+
+		for _, host := range hosts {
+			drained := host.Labels[DrainedLabel] == "true"
+			if drainStates[host.State] && !drained {
+				c.start(rancherClient, s, host, true)
+			} else if host.State == "active" && drained {
+				c.start(rancherClient, s, host, false)
+			}
+		}
+	}
+}
+
+func (c *Controller) start(rancherClient *client.RancherClient, s server.Server, host client.Host, drain bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.inProgress[host.Id] {
+		return
+	}
+	c.inProgress[host.Id] = true
+
+	go func() {
+		defer c.done(host.Id)
+		if err := c.reconcile(rancherClient, s, host, drain); err != nil {
+			logrus.Errorf("Failed to reconcile node for host %s: %v", host.Id, err)
+		}
+	}()
+}
+
+func (c *Controller) done(hostID string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.inProgress, hostID)
+}
+
+func (c *Controller) reconcile(rancherClient *client.RancherClient, s server.Server, host client.Host, drain bool) error {
+	nodeName := types.FirstNotEmpty(host.NodeName, host.Hostname)
+	k8sClient := s.Clients().Client
+
+	if drain {
+		logrus.Infof("Draining node %s for host %s in state %s", nodeName, host.Id, host.State)
+		if err := Drain(k8sClient, nodeName, c.opts); err != nil {
+			return err
+		}
+	} else {
+		logrus.Infof("Uncordoning node %s for reactivated host %s", nodeName, host.Id)
+		if err := Cordon(k8sClient, nodeName, false); err != nil {
+			return err
+		}
+	}
+
+	labels := map[string]string{}
+	for k, v := range host.Labels {
+		labels[k] = v
+	}
+	if drain {
+		labels[DrainedLabel] = "true"
+	} else {
+		delete(labels, DrainedLabel)
+	}
+
+	_, err := rancherClient.Host.Update(&host, map[string]interface{}{
+		"labels": labels,
+	})
+	return err
+}
@@ -0,0 +1,163 @@
+package drain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
+)
+
+const (
+	defaultTimeout = 5 * time.Minute
+	retryInterval  = 5 * time.Second
+)
+
+type Options struct {
+	// Timeout is how long to wait for evictions that are blocked by PodDisruptionBudgets
+	Timeout time.Duration
+	// Force deletes unmanaged pods and deletes pods still blocked when the timeout expires
+	Force bool
+}
+
+func Cordon(client kubernetes.Interface, nodeName string, unschedulable bool) error {
+	node, err := client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if node.Spec.Unschedulable == unschedulable {
+		return nil
+	}
+
+	node.Spec.Unschedulable = unschedulable
+	_, err = client.CoreV1().Nodes().Update(node)
+	return err
+}
+
+// Drain cordons the node and evicts all pods from it.  Evictions go through the eviction
+// subresource so PodDisruptionBudgets are respected.
+func Drain(client kubernetes.Interface, nodeName string, opts Options) error {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	if err := Cordon(client, nodeName, true); err != nil {
+		return err
+	}
+
+	pods, err := podsToEvict(client, nodeName, opts.Force)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	for len(pods) > 0 {
+		var pending []v1.Pod
+		for _, pod := range pods {
+			err := evict(client, pod, opts.Force && time.Now().After(deadline))
+			if errors.IsTooManyRequests(err) {
+				pending = append(pending, pod)
+			} else if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+
+		pods = pending
+		if len(pods) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) && !opts.Force {
+			return fmt.Errorf("timeout draining node %s, %d pods blocked by disruption budgets", nodeName, len(pods))
+		}
+
+		logrus.Infof("Waiting to evict %d pods from node %s", len(pods), nodeName)
+		time.Sleep(retryInterval)
+	}
+
+	return waitForDelete(client, nodeName, time.Now().Add(opts.Timeout))
+}
+
+func evict(client kubernetes.Interface, pod v1.Pod, force bool) error {
+	if force {
+		return client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+	}
+
+	return client.CoreV1().Pods(pod.Namespace).Evict(&policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	})
+}
+
+func listPods(client kubernetes.Interface, nodeName string) ([]v1.Pod, error) {
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+func podsToEvict(client kubernetes.Interface, nodeName string, force bool) ([]v1.Pod, error) {
+	pods, err := listPods(client, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []v1.Pod
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+
+		controller := getController(pod)
+		if controller != nil && controller.Kind == "DaemonSet" {
+			continue
+		}
+		if controller == nil && !force {
+			return nil, fmt.Errorf("pod %s/%s on node %s is not managed by a controller, use force to delete it",
+				pod.Namespace, pod.Name, nodeName)
+		}
+
+		result = append(result, pod)
+	}
+
+	return result, nil
+}
+
+func getController(pod v1.Pod) *metav1.OwnerReference {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return &ref
+		}
+	}
+	return nil
+}
+
+func waitForDelete(client kubernetes.Interface, nodeName string, deadline time.Time) error {
+	for {
+		pods, err := podsToEvict(client, nodeName, true)
+		if err != nil {
+			return err
+		}
+		if len(pods) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %d pods to terminate on node %s", len(pods), nodeName)
+		}
+		time.Sleep(retryInterval)
+	}
+}
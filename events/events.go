@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/go-rancher/v3"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apiserver/pkg/util/webhook"
+)
+
+const (
+	// ClusterCreated is emitted once the control plane of a new cluster is set up, when its first apiserver starts
+	ClusterCreated = "ClusterCreated"
+	// APIServerRestarted is emitted when the apiserver of a cluster is restarted, with the reason in the details
+	APIServerRestarted = "APIServerRestarted"
+	// StorageFailover is emitted when netes is promoted to the primary of the replicated clusters
+	StorageFailover = "StorageFailover"
+	// CertificateRotated is emitted when a certificate or key of a cluster is replaced, with its name in the details
+	CertificateRotated = "CertificateRotated"
+
+	sinkBufferSize   = 1000
+	sinkBatchSize    = 100
+	sinkRetryBackoff = 500 * time.Millisecond
+)
+
+var (
+	eventsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_control_plane_events_total",
+		Help: "Number of control plane events emitted per type",
+	}, []string{"type"})
+	droppedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_control_plane_events_dropped_total",
+		Help: "Number of control plane events a sink lost because it was too slow or kept failing, per sink",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsCounter)
+	prometheus.MustRegister(droppedCounter)
+}
+
+// Event is a change of the control plane of a cluster, or of netes for events without a cluster
+type Event struct {
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Cluster string            `json:"cluster,omitempty"`
+	Replica string            `json:"replica,omitempty"`
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Sink delivers events to a system operators build alerting on, a batch that fails is retried with a backoff
+type Sink interface {
+	Send(events []Event) error
+}
+
+// SinkFactory returns the sink at address, its meaning is up to the sink.  Sinks reporting to Rancher use
+// rancherClient.
+type SinkFactory func(address string, rancherClient func() (*client.RancherClient, error)) (Sink, error)
+
+var (
+	sinksLock sync.Mutex
+	sinks     = map[string]SinkFactory{
+		"log":        newLogSink,
+		"webhook":    newWebhookSink,
+		"rancher":    newRancherSink,
+		"kafka-rest": newKafkaRESTSink,
+	}
+)
+
+// RegisterSink makes a sink available by name, like one producing to a message queue
+func RegisterSink(name string, factory SinkFactory) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	sinks[name] = factory
+}
+
+func getSink(name string) (SinkFactory, bool) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	f, ok := sinks[name]
+	return f, ok
+}
+
+type queue struct {
+	name   string
+	sink   Sink
+	buffer chan Event
+}
+
+// Stream sends the control plane events netes emits to every configured sink.  Each sink has its own queue so a
+// slow sink doesn't hold back the others, events are dropped once the queue of a sink is full.  Events are not
+// persisted, the ones queued when netes stops are lost.  A nil Stream drops all events.
+type Stream struct {
+	replica string
+	queues  []*queue
+}
+
+// New returns a stream to the sinks, which look like "webhook=https://alerts.example.com/netes" or "rancher"
+func New(replica string, sinkSpecs []string, rancherClient func() (*client.RancherClient, error)) (*Stream, error) {
+	s := &Stream{
+		replica: replica,
+	}
+	for _, spec := range sinkSpecs {
+		parts := strings.SplitN(spec, "=", 2)
+		name, address := parts[0], ""
+		if len(parts) == 2 {
+			address = parts[1]
+		}
+
+		factory, ok := getSink(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown event sink %s", name)
+		}
+		sink, err := factory(address, rancherClient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event sink %s: %v", name, err)
+		}
+		s.queues = append(s.queues, &queue{
+			name:   name,
+			sink:   sink,
+			buffer: make(chan Event, sinkBufferSize),
+		})
+	}
+	return s, nil
+}
+
+// Start sends the queued events until ctx is done
+func (s *Stream) Start(ctx context.Context) {
+	for _, q := range s.queues {
+		go q.run(ctx)
+	}
+}
+
+// Emit queues an event for all sinks, its ID, replica and time are set if they are empty
+func (s *Stream) Emit(e Event) {
+	if s == nil {
+		return
+	}
+
+	if e.ID == "" {
+		e.ID = string(uuid.NewUUID())
+	}
+	if e.Replica == "" {
+		e.Replica = s.replica
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	eventsCounter.WithLabelValues(e.Type).Inc()
+
+	for _, q := range s.queues {
+		select {
+		case q.buffer <- e:
+		default:
+			droppedCounter.WithLabelValues(q.name).Inc()
+		}
+	}
+}
+
+func (q *queue) run(ctx context.Context) {
+	for {
+		var batch []Event
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-q.buffer:
+			batch = append(batch, e)
+		}
+
+		// what queued up while the last batch was sent goes along
+	collect:
+		for len(batch) < sinkBatchSize {
+			select {
+			case e := <-q.buffer:
+				batch = append(batch, e)
+			default:
+				break collect
+			}
+		}
+
+		err := webhook.WithExponentialBackoff(sinkRetryBackoff, func() error {
+			return q.sink.Send(batch)
+		})
+		if err != nil {
+			logrus.Errorf("Failed to send %d control plane events to sink %s: %v", len(batch), q.name, err)
+			droppedCounter.WithLabelValues(q.name).Add(float64(len(batch)))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+)
+
+const sinkTimeout = 30 * time.Second
+
+// logSink logs the events, for operators collecting the logs of netes
+type logSink struct{}
+
+func newLogSink(address string, rancherClient func() (*client.RancherClient, error)) (Sink, error) {
+	return logSink{}, nil
+}
+
+func (logSink) Send(events []Event) error {
+	for _, e := range events {
+		logrus.WithFields(logrus.Fields{
+			"event":   e.Type,
+			"cluster": e.Cluster,
+			"details": e.Details,
+		}).Info(e.Message)
+	}
+	return nil
+}
+
+// webhookSink posts the events as a JSON list to a URL
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(address string, rancherClient func() (*client.RancherClient, error)) (Sink, error) {
+	if err := validURL(address); err != nil {
+		return nil, err
+	}
+	return &webhookSink{
+		url:    address,
+		client: &http.Client{Timeout: sinkTimeout},
+	}, nil
+}
+
+func (w *webhookSink) Send(events []Event) error {
+	return post(w.client, w.url, "application/json", events)
+}
+
+// kafkaRESTSink produces the events to a Kafka topic through the REST proxy of Kafka, the address is the topic
+// URL like http://kafka-rest:8082/topics/netes.  The events are keyed by cluster so the events of a cluster stay
+// in order.
+type kafkaRESTSink struct {
+	url    string
+	client *http.Client
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value Event  `json:"value"`
+}
+
+func newKafkaRESTSink(address string, rancherClient func() (*client.RancherClient, error)) (Sink, error) {
+	if err := validURL(address); err != nil {
+		return nil, err
+	}
+	return &kafkaRESTSink{
+		url:    address,
+		client: &http.Client{Timeout: sinkTimeout},
+	}, nil
+}
+
+func (k *kafkaRESTSink) Send(events []Event) error {
+	var records []kafkaRecord
+	for _, e := range events {
+		records = append(records, kafkaRecord{
+			Key:   e.Cluster,
+			Value: e,
+		})
+	}
+	return post(k.client, k.url, "application/vnd.kafka.json.v2+json", map[string]interface{}{
+		"records": records,
+	})
+}
+
+// rancherSink records the events of clusters as external events of the clusters in Rancher, events without a
+// cluster are left out
+type rancherSink struct {
+	rancherClient func() (*client.RancherClient, error)
+}
+
+func newRancherSink(address string, rancherClient func() (*client.RancherClient, error)) (Sink, error) {
+	return &rancherSink{
+		rancherClient: rancherClient,
+	}, nil
+}
+
+func (r *rancherSink) Send(events []Event) error {
+	rancherClient, err := r.rancherClient()
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if e.Cluster == "" {
+			continue
+		}
+		_, err := rancherClient.ExternalEvent.Create(&client.ExternalEvent{
+			ClusterId:  e.Cluster,
+			EventType:  "netes." + e.Type,
+			ExternalId: e.ID,
+			Kind:       "externalEvent",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validURL(address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q is not an http or https URL", address)
+	}
+	return nil
+}
+
+func post(httpClient *http.Client, url, contentType string, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(url, contentType, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const syncInterval = 30 * time.Second
+
+// Controller mirrors Deployments, Services and Ingresses of the hosted clusters into Rancher as generic objects
+// so the Rancher UI can show tenant workloads without credentials of the cluster.  The objects are read-only,
+// changes made in Rancher are overwritten on the next sync.
+type Controller struct {
+	config        *types.GlobalConfig
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		config:        config,
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	go wait.Until(c.sync, syncInterval, ctx.Done())
+}
+
+func (c *Controller) sync() {
+	var rancherClient *client.RancherClient
+
+	for _, s := range c.serverFactory.Servers() {
+		cluster := s.Cluster()
+		names := types.FirstNotLenZero(cluster.K8sServerConfig.ExportResources, c.config.ExportResources)
+
+		for _, name := range names {
+			resource, ok := resources[name]
+			if !ok {
+				continue
+			}
+
+			if rancherClient == nil {
+				var err error
+				if rancherClient, err = c.rancher.Get(); err != nil {
+					logrus.Errorf("Failed to connect to Rancher for resource export: %v", err)
+					return
+				}
+			}
+
+			objects, err := resource.list(s.Clients().Client)
+			if err != nil {
+				logrus.Errorf("Failed to list %s of cluster %s for export: %v", name, cluster.Id, err)
+				continue
+			}
+
+			if err := c.export(rancherClient, cluster.Id, name, resource.kind, objects); err != nil {
+				logrus.Errorf("Failed to export %s of cluster %s: %v", name, cluster.Id, err)
+			}
+		}
+	}
+}
+
+func (c *Controller) export(rancherClient *client.RancherClient, clusterID, name, kind string, objects []object) error {
+	existing := map[string]client.GenericObject{}
+	genericObjects, err := rancherClient.GenericObject.ListAll(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"clusterId": clusterID,
+			"kind":      kind,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, genericObject := range genericObjects {
+		if genericObject.Removed != "" {
+			continue
+		}
+		if _, ok := existing[genericObject.Key]; ok {
+			// created concurrently by another netes serving the cluster
+			if err := rancherClient.GenericObject.Delete(&genericObject); err != nil {
+				return err
+			}
+			continue
+		}
+		existing[genericObject.Key] = genericObject
+	}
+
+	for _, obj := range objects {
+		key := name + "/" + obj.namespace + "/" + obj.name
+		data, err := normalize(obj.data)
+		if err != nil {
+			return err
+		}
+
+		current, ok := existing[key]
+		delete(existing, key)
+
+		if !ok {
+			_, err = rancherClient.GenericObject.Create(&client.GenericObject{
+				ClusterId:    clusterID,
+				Key:          key,
+				Kind:         kind,
+				Name:         obj.name,
+				ResourceData: data,
+			})
+		} else if !reflect.DeepEqual(current.ResourceData, data) {
+			_, err = rancherClient.GenericObject.Update(&current, map[string]interface{}{
+				"resourceData": data,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, stale := range existing {
+		if err := rancherClient.GenericObject.Delete(&stale); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// normalize converts data to what it looks like once read back from Rancher so unchanged objects are not updated
+func normalize(data map[string]interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// object is the read-only view of a Kubernetes object stored in Rancher
+type object struct {
+	namespace string
+	name      string
+	data      map[string]interface{}
+}
+
+type lister func(client kubernetes.Interface) ([]object, error)
+
+// resources maps the resources that can be exported to the kind of the generic objects in Rancher
+var resources = map[string]struct {
+	kind string
+	list lister
+}{
+	"deployments": {"kubernetesDeployment", listDeployments},
+	"services":    {"kubernetesService", listServices},
+	"ingresses":   {"kubernetesIngress", listIngresses},
+}
+
+func listDeployments(client kubernetes.Interface) ([]object, error) {
+	deployments, err := client.ExtensionsV1beta1().Deployments("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []object
+	for _, d := range deployments.Items {
+		var images []string
+		for _, c := range d.Spec.Template.Spec.Containers {
+			images = append(images, c.Image)
+		}
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		result = append(result, newObject(d.ObjectMeta, map[string]interface{}{
+			"images":            images,
+			"replicas":          replicas,
+			"updatedReplicas":   d.Status.UpdatedReplicas,
+			"availableReplicas": d.Status.AvailableReplicas,
+		}))
+	}
+	return result, nil
+}
+
+func listServices(client kubernetes.Interface) ([]object, error) {
+	services, err := client.CoreV1().Services("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []object
+	for _, s := range services.Items {
+		var ports []string
+		for _, p := range s.Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+		}
+		result = append(result, newObject(s.ObjectMeta, map[string]interface{}{
+			"type":        s.Spec.Type,
+			"clusterIP":   s.Spec.ClusterIP,
+			"ports":       ports,
+			"externalIPs": s.Spec.ExternalIPs,
+			"addresses":   addresses(s.Status.LoadBalancer.Ingress),
+		}))
+	}
+	return result, nil
+}
+
+func listIngresses(client kubernetes.Interface) ([]object, error) {
+	ingresses, err := client.ExtensionsV1beta1().Ingresses("").List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []object
+	for _, i := range ingresses.Items {
+		var hosts []string
+		for _, rule := range i.Spec.Rules {
+			if rule.Host != "" {
+				hosts = append(hosts, rule.Host)
+			}
+		}
+		result = append(result, newObject(i.ObjectMeta, map[string]interface{}{
+			"hosts":     hosts,
+			"addresses": addresses(i.Status.LoadBalancer.Ingress),
+		}))
+	}
+	return result, nil
+}
+
+func newObject(meta metav1.ObjectMeta, data map[string]interface{}) object {
+	data["namespace"] = meta.Namespace
+	data["labels"] = meta.Labels
+	data["created"] = meta.CreationTimestamp
+	return object{
+		namespace: meta.Namespace,
+		name:      meta.Name,
+		data:      data,
+	}
+}
+
+func addresses(ingress []v1.LoadBalancerIngress) []string {
+	var result []string
+	for _, i := range ingress {
+		if i.IP != "" {
+			result = append(result, i.IP)
+		} else if i.Hostname != "" {
+			result = append(result, i.Hostname)
+		}
+	}
+	return result
+}
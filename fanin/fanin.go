@@ -0,0 +1,487 @@
+package fanin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/websocket"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/util/wsstream"
+)
+
+// bufferSize is how many events a shared watch keeps for the clients joining it, a client whose resourceVersion
+// is older than the buffer gets a watch of its own.  It is also the backlog a client may have, a client that
+// falls further behind is closed so it watches again.
+const bufferSize = 1000
+
+var (
+	newline = []byte("\n")
+
+	sharedWatchesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_cluster_shared_watches",
+		Help: "Watches of the hosted apiserver of a cluster that are shared by identical watches of clients",
+	}, []string{"cluster"})
+	fannedInGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_cluster_fanned_in_watches",
+		Help: "Watches of clients of a cluster served from a shared watch",
+	}, []string{"cluster"})
+)
+
+func init() {
+	prometheus.MustRegister(sharedWatchesGauge)
+	prometheus.MustRegister(fannedInGauge)
+}
+
+// Hub multiplexes identical watches of a cluster, same resource, namespace and selectors, onto a single watch of
+// its apiserver, so dashboards opening the same watches in many browsers don't each poll the storage.  Clients are
+// authenticated and authorized on their own before they join, the shared watch runs with the user of the client
+// that started it.  Only JSON watches from a resourceVersion, like the ones following a list, are shared,
+// websocket ones included.  A shared watch stops once its last client is gone, when the apiserver ends it all its
+// clients are closed and watch again.
+type Hub struct {
+	clusterID string
+	lock      sync.Mutex
+	watches   map[string]*sharedWatch
+}
+
+func New(clusterID string) *Hub {
+	return &Hub{
+		clusterID: clusterID,
+		watches:   map[string]*sharedWatch{},
+	}
+}
+
+// Filter serves the watches it can share from shared watches of handler, the others are passed on.  It must run
+// after authorization.
+func (h *Hub) Filter(handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		info, ok := apirequest.RequestInfoFrom(ctx)
+		if !ok || !info.IsResourceRequest || info.Verb != "watch" || info.Subresource != "" || !acceptsJSON(req) {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		resourceVersion, err := strconv.ParseUint(req.URL.Query().Get("resourceVersion"), 10, 64)
+		if err != nil || resourceVersion == 0 {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		w, s := h.join(key(req), resourceVersion, func(w *sharedWatch) {
+			go w.run(upstreamRequest(req), ctx, handler, mapper)
+		})
+		if s == nil {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		defer w.unsubscribe(s)
+
+		fannedInGauge.WithLabelValues(h.clusterID).Inc()
+		defer fannedInGauge.WithLabelValues(h.clusterID).Dec()
+		w.serve(rw, req, s)
+	})
+}
+
+func (h *Hub) join(key string, resourceVersion uint64, start func(*sharedWatch)) (*sharedWatch, *subscriber) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if w, ok := h.watches[key]; ok && !w.finished() {
+		// nil if the client is further behind than the buffer
+		return w, w.subscribe(resourceVersion)
+	}
+
+	w := &sharedWatch{
+		hub:     h,
+		key:     key,
+		from:    resourceVersion,
+		ready:   make(chan struct{}),
+		stop:    make(chan bool),
+		clients: map[*subscriber]bool{},
+	}
+	h.watches[key] = w
+	s := w.subscribe(resourceVersion)
+	sharedWatchesGauge.WithLabelValues(h.clusterID).Inc()
+	start(w)
+	return w, s
+}
+
+func (h *Hub) remove(w *sharedWatch) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.watches[w.key] == w {
+		delete(h.watches, w.key)
+	}
+	sharedWatchesGauge.WithLabelValues(h.clusterID).Dec()
+}
+
+type event struct {
+	resourceVersion uint64
+	raw             []byte
+}
+
+type subscriber struct {
+	resourceVersion uint64
+	events          chan []byte
+}
+
+// sharedWatch is a watch of the apiserver and the clients it serves, it has all events after from buffered
+type sharedWatch struct {
+	hub      *Hub
+	key      string
+	ready    chan struct{}
+	stop     chan bool
+	stopOnce sync.Once
+
+	// the response of the apiserver when it didn't start the watch
+	failedStatus int
+	failedHeader http.Header
+	failedBody   []byte
+
+	lock    sync.Mutex
+	done    bool
+	from    uint64
+	buffer  []event
+	clients map[*subscriber]bool
+}
+
+func (w *sharedWatch) finished() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.done
+}
+
+// subscribe adds a client watching from resourceVersion, with the buffered events it didn't see yet queued
+func (w *sharedWatch) subscribe(resourceVersion uint64) *subscriber {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.done || resourceVersion < w.from {
+		return nil
+	}
+	s := &subscriber{
+		resourceVersion: resourceVersion,
+		events:          make(chan []byte, bufferSize),
+	}
+	for _, e := range w.buffer {
+		if e.resourceVersion > resourceVersion {
+			s.events <- e.raw
+		}
+	}
+	w.clients[s] = true
+	return s
+}
+
+// unsubscribe removes a client, the watch of the apiserver is stopped with its last client
+func (w *sharedWatch) unsubscribe(s *subscriber) {
+	w.lock.Lock()
+	delete(w.clients, s)
+	last := len(w.clients) == 0 && !w.done
+	if last {
+		w.done = true
+	}
+	w.lock.Unlock()
+
+	if last {
+		w.stopOnce.Do(func() {
+			close(w.stop)
+		})
+	}
+}
+
+// run watches the apiserver through handler with the request and context of the client that started the watch,
+// neither is tied to the connection of that client
+func (w *sharedWatch) run(req *http.Request, ctx apirequest.Context, handler http.Handler, mapper apirequest.RequestContextMapper) {
+	reader, writer := io.Pipe()
+	rw := &upstreamWriter{
+		watch:  w,
+		header: http.Header{},
+		pipe:   writer,
+	}
+
+	go func() {
+		apirequest.WithRequestContext(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			mapper.Update(req, ctx)
+			handler.ServeHTTP(rw, req)
+		}), mapper).ServeHTTP(rw, req)
+		rw.finish()
+		writer.Close()
+	}()
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err != io.EOF {
+				logrus.Debugf("Shared watch %s of cluster %s ended: %v", w.key, w.hub.clusterID, err)
+			}
+			// the apiserver stops writing once the pipe is closed
+			reader.CloseWithError(err)
+			break
+		}
+		w.publish(raw)
+	}
+
+	w.finish()
+}
+
+// publish sends an event to the clients that didn't see it yet, clients that fell too far behind are dropped
+func (w *sharedWatch) publish(raw []byte) {
+	var e struct {
+		Object struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+		} `json:"object"`
+	}
+	if err := json.Unmarshal(raw, &e); err != nil {
+		logrus.Errorf("Failed to read event of shared watch %s of cluster %s: %v", w.key, w.hub.clusterID, err)
+		return
+	}
+	// errors, like an expired resourceVersion, have none and go to all clients
+	resourceVersion, _ := strconv.ParseUint(e.Object.Metadata.ResourceVersion, 10, 64)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if resourceVersion > 0 {
+		w.buffer = append(w.buffer, event{
+			resourceVersion: resourceVersion,
+			raw:             raw,
+		})
+		if len(w.buffer) > bufferSize {
+			w.from = w.buffer[0].resourceVersion
+			w.buffer = w.buffer[1:]
+		}
+	}
+
+	for s := range w.clients {
+		if resourceVersion > 0 && resourceVersion <= s.resourceVersion {
+			continue
+		}
+		select {
+		case s.events <- raw:
+		default:
+			delete(w.clients, s)
+			close(s.events)
+		}
+	}
+}
+
+// finish closes the clients once the watch of the apiserver ended
+func (w *sharedWatch) finish() {
+	w.lock.Lock()
+	w.done = true
+	for s := range w.clients {
+		delete(w.clients, s)
+		close(s.events)
+	}
+	w.lock.Unlock()
+
+	w.hub.remove(w)
+}
+
+// serve streams the events of the shared watch to a client like the apiserver would, over a websocket or chunked
+func (w *sharedWatch) serve(rw http.ResponseWriter, req *http.Request, s *subscriber) {
+	select {
+	case <-w.ready:
+	case <-req.Context().Done():
+		return
+	}
+
+	if w.failedStatus != 0 {
+		for k, v := range w.failedHeader {
+			rw.Header()[k] = v
+		}
+		rw.WriteHeader(w.failedStatus)
+		rw.Write(w.failedBody)
+		return
+	}
+
+	var timeout <-chan time.Time
+	if seconds, err := strconv.ParseInt(req.URL.Query().Get("timeoutSeconds"), 10, 64); err == nil && seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	if wsstream.IsWebSocketRequest(req) {
+		websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+			closed := make(chan struct{})
+			go func() {
+				// clients don't send anything
+				wsstream.IgnoreReceives(ws, 0)
+				close(closed)
+			}()
+
+			for {
+				select {
+				case <-closed:
+					return
+				case <-timeout:
+					return
+				case raw, ok := <-s.events:
+					if !ok {
+						return
+					}
+					if err := websocket.Message.Send(ws, string(raw)); err != nil {
+						return
+					}
+				}
+			}
+		}).ServeHTTP(rw, req)
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Transfer-Encoding", "chunked")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-timeout:
+			return
+		case raw, ok := <-s.events:
+			if !ok {
+				return
+			}
+			// the event is shared with the other clients
+			if _, err := rw.Write(raw); err != nil {
+				return
+			}
+			if _, err := rw.Write(newline); err != nil {
+				return
+			}
+			if len(s.events) == 0 {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// upstreamWriter is the response of the shared watch, the stream goes to the pipe the events are read from.  An
+// error response is kept for the clients instead.
+type upstreamWriter struct {
+	watch     *sharedWatch
+	header    http.Header
+	pipe      *io.PipeWriter
+	status    int
+	body      bytes.Buffer
+	readyOnce sync.Once
+}
+
+func (u *upstreamWriter) Header() http.Header {
+	return u.header
+}
+
+func (u *upstreamWriter) WriteHeader(status int) {
+	if u.status != 0 {
+		return
+	}
+	u.status = status
+	if status == http.StatusOK {
+		u.readyOnce.Do(func() {
+			close(u.watch.ready)
+		})
+	}
+}
+
+func (u *upstreamWriter) Write(data []byte) (int, error) {
+	u.WriteHeader(http.StatusOK)
+	if u.status != http.StatusOK {
+		return u.body.Write(data)
+	}
+	return u.pipe.Write(data)
+}
+
+func (u *upstreamWriter) Flush() {
+}
+
+// CloseNotify tells the apiserver to stop the watch once the last client is gone
+func (u *upstreamWriter) CloseNotify() <-chan bool {
+	return u.watch.stop
+}
+
+// finish keeps the response of the apiserver when it answered with an error rather than a stream
+func (u *upstreamWriter) finish() {
+	u.readyOnce.Do(func() {
+		w := u.watch
+		w.failedStatus = u.status
+		if w.failedStatus == 0 {
+			w.failedStatus = http.StatusInternalServerError
+		}
+		w.failedHeader = u.header
+		w.failedBody = u.body.Bytes()
+		close(w.ready)
+	})
+}
+
+// upstreamRequest is the request of a client for the shared watch, as a plain JSON stream without a timeout of
+// the client
+func upstreamRequest(req *http.Request) *http.Request {
+	u := *req.URL
+	query := u.Query()
+	query.Del("timeoutSeconds")
+	u.RawQuery = query.Encode()
+
+	header := http.Header{}
+	for k, v := range req.Header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Protocol", "Sec-Websocket-Extensions":
+		default:
+			header[k] = v
+		}
+	}
+	header.Set("Accept", "application/json")
+
+	upstream := &http.Request{}
+	*upstream = *req
+	upstream.URL = &u
+	upstream.Header = header
+	upstream.Body = http.NoBody
+	upstream.ContentLength = 0
+	return upstream.WithContext(context.Background())
+}
+
+// key identifies the watches that get the same events
+func key(req *http.Request) string {
+	query := req.URL.Query()
+	shared := url.Values{}
+	for _, k := range []string{"labelSelector", "fieldSelector", "includeUninitialized"} {
+		if v := query.Get(k); v != "" {
+			shared.Set(k, v)
+		}
+	}
+	return req.URL.Path + "?" + shared.Encode()
+}
+
+func acceptsJSON(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	if strings.Contains(accept, "protobuf") {
+		return false
+	}
+	return accept == "" || strings.Contains(accept, "application/json") || strings.Contains(accept, "*/*")
+}
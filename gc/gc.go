@@ -0,0 +1,286 @@
+package gc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/certs"
+	"github.com/rancher/netes/deprecation"
+	"github.com/rancher/netes/quota"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/server/admission"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	recordPrefix = "/netes/gc/"
+	syncInterval = time.Minute
+	// keys are deleted in batches with a pause in between, so collecting a big cluster doesn't load the database
+	batchSize     = 500
+	batchInterval = 100 * time.Millisecond
+	// collected clusters are reported for this long
+	recordRetention = 7 * 24 * time.Hour
+)
+
+const (
+	Hosted     = "hosted"
+	Removed    = "removed"
+	Collecting = "collecting"
+	Collected  = "collected"
+)
+
+var deletedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "netes_cluster_gc_deleted_keys_total",
+	Help: "Keys of removed clusters deleted from the database",
+})
+
+func init() {
+	prometheus.MustRegister(deletedCounter)
+}
+
+// Record tracks a cluster from when netes first serves it until what netes stored for it is collected
+type Record struct {
+	Cluster string `json:"cluster"`
+	UUID    string `json:"uuid"`
+	Name    string `json:"name"`
+	// Etcd clusters keep their objects in their own etcd, only what netes stored for them is collected
+	Etcd     bool      `json:"etcd,omitempty"`
+	State    string    `json:"state"`
+	Removed  time.Time `json:"removed,omitempty"`
+	Keys     int64     `json:"keys"`
+	Deleted  int64     `json:"deleted"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+
+	revision int64
+}
+
+// Controller deletes what is stored for clusters removed from Rancher: their objects, certificates, admission
+// configuration and leases.  netes records the clusters it serves, so clusters removed while it was down are
+// collected too.  Collection starts ClusterGCDelay after the removal and resumes where it stopped after a restart.
+type Controller struct {
+	config        *types.GlobalConfig
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		config:        config,
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	if c.config.ClusterGCDelay < 0 || c.rancher == nil {
+		return
+	}
+	go wait.Until(func() {
+		if err := c.sync(ctx); err != nil {
+			logrus.Errorf("Failed to collect removed clusters: %v", err)
+		}
+	}, syncInterval, ctx.Done())
+}
+
+func (c *Controller) sync(ctx context.Context) error {
+	kvClient, err := store.Client(c.config)
+	if err != nil {
+		return err
+	}
+
+	records, err := List(ctx, kvClient)
+	if err != nil {
+		return err
+	}
+	byID := map[string]*Record{}
+	for _, r := range records {
+		byID[r.Cluster] = r
+	}
+
+	clusters, err := c.rancher.Clusters()
+	if err != nil {
+		return err
+	}
+
+	for id, cluster := range clusters {
+		r, ok := byID[id]
+		if ok && r.State == Hosted {
+			continue
+		}
+		if ok && r.State != Removed {
+			// a cluster being collected can't come back
+			continue
+		}
+		if r == nil {
+			r = &Record{
+				Cluster: id,
+				UUID:    cluster.Uuid,
+				Name:    cluster.Name,
+				Etcd:    store.Etcd(cluster),
+			}
+		}
+		r.State, r.Removed = Hosted, time.Time{}
+		if err := save(ctx, kvClient, r); err != nil {
+			return err
+		}
+		byID[id] = r
+	}
+
+	for _, r := range byID {
+		switch r.State {
+		case Hosted:
+			if _, ok := clusters[r.Cluster]; ok {
+				continue
+			}
+			// confirm with Rancher before anything gets deleted
+			if cluster, err := c.rancher.Cluster(r.Cluster); err != nil || cluster != nil {
+				continue
+			}
+			logrus.Infof("Cluster %s was removed, collecting its storage in %v", r.Cluster, c.config.ClusterGCDelay)
+			r.State, r.Removed = Removed, time.Now()
+			if err := save(ctx, kvClient, r); err != nil {
+				return err
+			}
+		case Removed, Collecting:
+			if time.Since(r.Removed) < c.config.ClusterGCDelay {
+				continue
+			}
+			if err := c.collect(ctx, kvClient, r); err != nil {
+				logrus.Errorf("Failed to collect cluster %s: %v", r.Cluster, err)
+				r.Error = err.Error()
+				save(ctx, kvClient, r)
+			}
+		case Collected:
+			if time.Since(r.Finished) > recordRetention {
+				if err := kvClient.DeleteVersion(ctx, recordPrefix+r.Cluster, r.revision); err != nil && err != kv.ErrNotExists {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// collect deletes what is stored for a removed cluster, progress is saved after every batch
+func (c *Controller) collect(ctx context.Context, kvClient kv.Client, r *Record) error {
+	if r.State != Collecting {
+		logrus.Infof("Collecting storage of removed cluster %s", r.Cluster)
+		r.State = Collecting
+		if err := save(ctx, kvClient, r); err != nil {
+			return err
+		}
+	}
+
+	c.serverFactory.Remove(r.Cluster, c.config.DrainTimeout)
+
+	var values []*kv.KeyValue
+	if !r.Etcd {
+		objects, err := kvClient.List(ctx, store.ClusterPrefix(&client.Cluster{Uuid: r.UUID})+"/")
+		if err != nil {
+			return err
+		}
+		values = append(values, objects...)
+	}
+	leases, err := kvClient.List(ctx, "/netes/leases/"+r.UUID+"/")
+	if err != nil {
+		return err
+	}
+	values = append(values, leases...)
+	if r.Keys < r.Deleted+int64(len(values)) {
+		r.Keys = r.Deleted + int64(len(values))
+	}
+
+	for i := 0; i < len(values); i += batchSize {
+		end := i + batchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		for _, value := range values[i:end] {
+			if err := kvClient.DeleteVersion(ctx, value.Key, value.Revision); err != nil && err != kv.ErrNotExists {
+				return err
+			}
+			r.Deleted++
+			deletedCounter.Inc()
+		}
+		if err := save(ctx, kvClient, r); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(batchInterval):
+		}
+	}
+
+	// the service account keys go with the certificates, which revokes the tokens of the cluster
+	if err := certs.Delete(ctx, kvClient, r.UUID); err != nil {
+		return err
+	}
+	if err := admission.DeletePluginConfig(ctx, kvClient, r.UUID); err != nil {
+		return err
+	}
+	if err := quota.DeleteAccount(ctx, kvClient, r.Cluster); err != nil {
+		return err
+	}
+	if err := deprecation.Delete(ctx, kvClient, r.Cluster); err != nil {
+		return err
+	}
+
+	r.State, r.Finished, r.Error = Collected, time.Now(), ""
+	logrus.Infof("Collected storage of removed cluster %s, deleted %d keys", r.Cluster, r.Deleted)
+	return save(ctx, kvClient, r)
+}
+
+// List returns the clusters netes serves or served, and how far the collection of the removed ones got
+func List(ctx context.Context, kvClient kv.Client) ([]*Record, error) {
+	values, err := kvClient.List(ctx, recordPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	for _, value := range values {
+		r := &Record{}
+		if err := json.Unmarshal(value.Value, r); err != nil {
+			logrus.Errorf("Failed to read %s: %v", value.Key, err)
+			continue
+		}
+		r.revision = value.Revision
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Cluster < records[j].Cluster
+	})
+	return records, nil
+}
+
+func save(ctx context.Context, kvClient kv.Client, r *Record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	var saved *kv.KeyValue
+	if r.revision == 0 {
+		saved, err = kvClient.Create(ctx, recordPrefix+r.Cluster, value, 0)
+	} else {
+		saved, err = kvClient.UpdateOrCreate(ctx, recordPrefix+r.Cluster, value, r.revision, 0)
+	}
+	if err != nil {
+		return err
+	}
+	r.revision = saved.Revision
+	return nil
+}
@@ -0,0 +1,306 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/proxy"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/kubernetes/pkg/master/ports"
+)
+
+const (
+	checkInterval = 10 * time.Second
+	checkTimeout  = 5 * time.Second
+
+	CheckAPIServer = "apiserver"
+	CheckStorage   = "storage"
+	CheckTunnel    = "tunnel"
+)
+
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Cluster is the health of a hosted cluster.  It is healthy if its apiserver serves and its storage is
+// reachable, ready if it is also connected to its hosts.
+type Cluster struct {
+	ID      string    `json:"id"`
+	Healthy bool      `json:"healthy"`
+	Ready   bool      `json:"ready"`
+	Checks  []Check   `json:"checks"`
+	Checked time.Time `json:"checked"`
+}
+
+type Status struct {
+	OK       bool      `json:"ok"`
+	Clusters []Cluster `json:"clusters"`
+}
+
+// Checker checks the running clusters in the background so probes of many clusters answer right away
+type Checker struct {
+	sync.Mutex
+	config        *types.GlobalConfig
+	serverFactory *server.Factory
+	synced        bool
+	shuttingDown  bool
+	results       map[string]Cluster
+}
+
+func NewChecker(config *types.GlobalConfig, serverFactory *server.Factory) *Checker {
+	return &Checker{
+		config:        config,
+		serverFactory: serverFactory,
+		results:       map[string]Cluster{},
+	}
+}
+
+func (c *Checker) Start(ctx context.Context) {
+	go wait.Until(c.sync, checkInterval, ctx.Done())
+}
+
+func (c *Checker) sync() {
+	servers := c.serverFactory.Servers()
+	results := make(chan Cluster, len(servers))
+
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s server.Server) {
+			defer wg.Done()
+			results <- c.Check(s)
+		}(s)
+	}
+	wg.Wait()
+	close(results)
+
+	byID := map[string]Cluster{}
+	for result := range results {
+		byID[result.ID] = result
+	}
+
+	c.Lock()
+	c.results = byID
+	c.synced = true
+	c.Unlock()
+}
+
+// Get returns the last result of a cluster, checking it now if it was started since
+func (c *Checker) Get(s server.Server) Cluster {
+	c.Lock()
+	result, ok := c.results[s.Cluster().Id]
+	c.Unlock()
+
+	if ok {
+		return result
+	}
+	return c.Check(s)
+}
+
+// Healthz is ok if all clusters are healthy
+func (c *Checker) Healthz() Status {
+	return c.status(func(cluster Cluster) bool {
+		return cluster.Healthy
+	})
+}
+
+// Readyz is ok once all clusters were checked and are ready, until netes shuts down
+func (c *Checker) Readyz() Status {
+	status := c.status(func(cluster Cluster) bool {
+		return cluster.Ready
+	})
+	c.Lock()
+	status.OK = status.OK && c.synced && !c.shuttingDown
+	c.Unlock()
+	return status
+}
+
+// Shutdown fails Readyz so load balancers stop sending new requests
+func (c *Checker) Shutdown() {
+	c.Lock()
+	c.shuttingDown = true
+	c.Unlock()
+}
+
+func (c *Checker) status(ok func(Cluster) bool) Status {
+	c.Lock()
+	defer c.Unlock()
+
+	status := Status{
+		OK:       true,
+		Clusters: []Cluster{},
+	}
+	for _, result := range c.results {
+		status.Clusters = append(status.Clusters, result)
+		status.OK = status.OK && ok(result)
+	}
+	return status
+}
+
+// Check runs the checks of a cluster
+func (c *Checker) Check(s server.Server) Cluster {
+	result := Cluster{
+		ID: s.Cluster().Id,
+		Checks: []Check{
+			c.check(CheckAPIServer, func() (string, error) { return "", checkAPIServer(s) }),
+			c.check(CheckStorage, func() (string, error) { return "", c.checkStorage(s) }),
+			c.check(CheckTunnel, func() (string, error) { return c.checkTunnel(s) }),
+		},
+		Checked: time.Now(),
+	}
+
+	result.Healthy = result.Checks[0].OK && result.Checks[1].OK
+	result.Ready = result.Healthy && result.Checks[2].OK
+	return result
+}
+
+func (c *Checker) check(name string, f func() (string, error)) Check {
+	message, err := f()
+	if err != nil {
+		logrus.Debugf("Health check %s failed: %v", name, err)
+		return Check{
+			Name:    name,
+			Message: err.Error(),
+		}
+	}
+	return Check{
+		Name:    name,
+		OK:      true,
+		Message: message,
+	}
+}
+
+func checkAPIServer(s server.Server) error {
+	content, err := s.Clients().Client.Discovery().RESTClient().Get().AbsPath("/healthz").Timeout(checkTimeout).Do().Raw()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, content)
+	}
+	return nil
+}
+
+func (c *Checker) checkStorage(s server.Server) error {
+	if store.Etcd(s.Cluster()) {
+		return checkEtcd(s)
+	}
+
+	kvClient, err := store.Client(c.config)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	// any key of the cluster, the shard of the cluster is picked by its prefix
+	_, err = kvClient.Get(ctx, store.ClusterPrefix(s.Cluster())+"/namespaces/default")
+	if err == kv.ErrNotExists {
+		return nil
+	}
+	return err
+}
+
+// checkEtcd checks the etcd of a cluster stored in its own through the component statuses of its apiserver,
+// they probe the etcd servers of its storage
+func checkEtcd(s server.Server) error {
+	statuses, err := s.Clients().Client.CoreV1().ComponentStatuses().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses.Items {
+		if !strings.HasPrefix(status.Name, "etcd-") {
+			continue
+		}
+		for _, condition := range status.Conditions {
+			if condition.Type == v1.ComponentHealthy && condition.Status != v1.ConditionTrue {
+				return fmt.Errorf("%s is unhealthy: %s", status.Name, types.FirstNotEmpty(condition.Error, condition.Message))
+			}
+		}
+	}
+	return nil
+}
+
+// checkTunnel dials the kubelet of a node through the egress of the cluster, like the tunnels to its hosts, a
+// cluster without nodes has nothing to connect to and passes
+func (c *Checker) checkTunnel(s server.Server) (string, error) {
+	nodes, err := s.Clients().Client.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	address := ""
+	for _, node := range nodes.Items {
+		if a := nodeAddress(&node); a != "" && (address == "" || nodeReady(&node)) {
+			address = a
+		}
+	}
+	if address == "" {
+		return "no nodes", nil
+	}
+
+	dialer, err := proxy.ClusterDialer(c.config, s.Cluster())
+	if err != nil {
+		return "", err
+	}
+	conns := make(chan net.Conn, 1)
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := dialer("tcp", net.JoinHostPort(address, strconv.Itoa(ports.KubeletPort)))
+		if err != nil {
+			errs <- err
+			return
+		}
+		conns <- conn
+	}()
+
+	select {
+	case conn := <-conns:
+		conn.Close()
+		return "", nil
+	case err := <-errs:
+		return "", err
+	case <-time.After(checkTimeout):
+		go func() {
+			select {
+			case conn := <-conns:
+				conn.Close()
+			case <-errs:
+			}
+		}()
+		return "", fmt.Errorf("timeout dialing %s", address)
+	}
+}
+
+func nodeAddress(node *v1.Node) string {
+	for _, t := range []v1.NodeAddressType{v1.NodeInternalIP, v1.NodeHostName} {
+		for _, address := range node.Status.Addresses {
+			if address.Type == t {
+				return address.Address
+			}
+		}
+	}
+	return ""
+}
+
+func nodeReady(node *v1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
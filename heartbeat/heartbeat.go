@@ -0,0 +1,144 @@
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/netes/health"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// lastError is the most recent failure of a cluster, it is reported until another one happens
+type lastError struct {
+	message string
+	time    time.Time
+}
+
+// Controller pushes the health of the running clusters into their k8sServerStatus in Rancher, so the Rancher UI
+// shows the health of the control plane netes runs for them.  Every push is a heartbeat, a cluster whose
+// lastHeartbeat is older than a few intervals is not served by any netes.
+type Controller struct {
+	sync.Mutex
+	config        *types.GlobalConfig
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+	health        *health.Checker
+	lastErrors    map[string]lastError
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory, checker *health.Checker) *Controller {
+	return &Controller{
+		config:        config,
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+		health:        checker,
+		lastErrors:    map[string]lastError{},
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	if c.config.HeartbeatInterval <= 0 {
+		return
+	}
+	go wait.Until(c.sync, c.config.HeartbeatInterval, ctx.Done())
+}
+
+func (c *Controller) sync() {
+	servers := c.serverFactory.Servers()
+	if len(servers) == 0 {
+		return
+	}
+
+	running := map[string]bool{}
+	for _, s := range servers {
+		cluster := s.Cluster()
+		running[cluster.Id] = true
+		// queued while Rancher is unreachable
+		if err := c.rancher.UpdateStatus(cluster, c.status(s)); err != nil {
+			logrus.Errorf("Failed to report status of cluster %s to Rancher: %v", cluster.Id, err)
+		}
+	}
+
+	c.Lock()
+	for clusterID := range c.lastErrors {
+		if !running[clusterID] {
+			delete(c.lastErrors, clusterID)
+		}
+	}
+	c.Unlock()
+}
+
+// status is the k8sServerStatus of a cluster.  It is a map rather than a client.K8sServerStatus so false and
+// zero values are sent too.
+func (c *Controller) status(s server.Server) map[string]interface{} {
+	clusterID := s.Cluster().Id
+	result := c.health.Get(s)
+	var failures []string
+	for _, check := range result.Checks {
+		if !check.OK {
+			failures = append(failures, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+
+	version := ""
+	if info, err := s.Clients().Client.Discovery().ServerVersion(); err != nil {
+		failures = append(failures, fmt.Sprintf("version: %v", err))
+	} else {
+		version = info.GitVersion
+	}
+
+	var nodes, readyNodes int64
+	if list, err := s.Clients().Client.CoreV1().Nodes().List(metav1.ListOptions{}); err != nil {
+		failures = append(failures, fmt.Sprintf("nodes: %v", err))
+	} else {
+		nodes = int64(len(list.Items))
+		for _, node := range list.Items {
+			if ready(&node) {
+				readyNodes++
+			}
+		}
+	}
+
+	c.Lock()
+	if len(failures) > 0 {
+		c.lastErrors[clusterID] = lastError{
+			message: failures[0],
+			time:    time.Now(),
+		}
+	}
+	last := c.lastErrors[clusterID]
+	c.Unlock()
+
+	status := map[string]interface{}{
+		"healthy":        result.Healthy,
+		"ready":          result.Ready,
+		"version":        version,
+		"nodeCount":      nodes,
+		"readyNodeCount": readyNodes,
+		"lastHeartbeat":  time.Now().UTC().Format(time.RFC3339),
+		"replica":        c.config.ReplicaID,
+		"lastError":      last.message,
+		"lastErrorTime":  "",
+	}
+	if !last.time.IsZero() {
+		status["lastErrorTime"] = last.time.UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+func ready(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package importer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	serverstorage "k8s.io/apiserver/pkg/server/storage"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const apiServiceGroup = "apiregistration.k8s.io"
+
+// skipped are the resources of the hosts and the apiserver of the source cluster, the new cluster gets its own
+var skipped = sets.NewString(
+	"nodes",
+	"events",
+	"componentstatuses",
+)
+
+// Result is what an import copied and what it left out, with the reason
+type Result struct {
+	Objects int      `json:"objects"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+func (r *Result) skip(format string, args ...interface{}) {
+	reason := fmt.Sprintf(format, args...)
+	logrus.Infof("Import skipped %s", reason)
+	r.Skipped = append(r.Skipped, reason)
+}
+
+// Import copies the objects of the cluster kubeconfig points to into the storage of cluster, the server of cluster
+// must be stopped.  Objects keep their UIDs, so owner references hold, and objects the cluster already has are left
+// alone.  Nodes, events, service account tokens and the objects of aggregated APIs aren't copied, pods are
+// scheduled again on the hosts of the new cluster.  Services keep their cluster IPs, the service net of cluster
+// should be the one of the source.
+func Import(ctx context.Context, config *types.GlobalConfig, kvClient kv.Client, cluster *client.Cluster, kubeconfig []byte) (*Result, error) {
+	if store.Etcd(cluster) {
+		return nil, fmt.Errorf("Cluster %s is stored in its own etcd, import into it there", cluster.Id)
+	}
+
+	source, err := restConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(source)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	resourceLists, err := discoveryClient.ServerPreferredResources()
+	if discovery.IsGroupDiscoveryFailedError(err) {
+		result.skip("groups the source cluster failed to discover: %v", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to discover the resources of the source cluster: %v", err)
+	}
+
+	var runtimeConfig []string
+	if cluster.K8sServerConfig != nil {
+		runtimeConfig = cluster.K8sServerConfig.RuntimeConfig
+	}
+	storageFactory, err := store.StorageFactory(config, cluster, append(append([]string{}, config.RuntimeConfig...), runtimeConfig...))
+	if err != nil {
+		return nil, err
+	}
+
+	crdGroups := listCRDGroups(source)
+	i := &importer{
+		kvClient:       kvClient,
+		prefix:         store.ClusterPrefix(cluster),
+		storageFactory: storageFactory,
+		result:         result,
+	}
+	for _, list := range resourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		var custom bool
+		switch {
+		case gv.Group == apiServiceGroup || crdGroups.Has(gv.Group) || gv.Group == v1beta1.GroupName:
+			custom = true
+		case api.Registry.IsRegistered(gv.Group):
+		default:
+			result.skip("%s, served by an aggregated API", list.GroupVersion)
+			continue
+		}
+
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") || !contains(resource.Verbs, "list") || skipped.Has(resource.Name) {
+				continue
+			}
+			if err := i.importResource(ctx, source, gv, resource, custom); err != nil {
+				return result, fmt.Errorf("failed to import %s of %s: %v", resource.Name, list.GroupVersion, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+func restConfig(kubeconfig []byte) (*restclient.Config, error) {
+	raw, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return clientcmd.NewDefaultClientConfig(*raw, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// listCRDGroups returns the groups of the custom resources of the source, none if it has no CRDs
+func listCRDGroups(source *restclient.Config) sets.String {
+	groups := sets.NewString()
+	items, err := list(source, v1beta1.SchemeGroupVersion, metav1.APIResource{Name: "customresourcedefinitions"})
+	if err != nil {
+		return groups
+	}
+	for _, item := range items {
+		if group, ok := nested(item.Object, "spec", "group").(string); ok {
+			groups.Insert(group)
+		}
+	}
+	return groups
+}
+
+func list(source *restclient.Config, gv schema.GroupVersion, resource metav1.APIResource) ([]unstructured.Unstructured, error) {
+	config := *source
+	config.GroupVersion = &gv
+	config.APIPath = dynamic.LegacyAPIPathResolverFunc(schema.GroupVersionKind{Group: gv.Group, Version: gv.Version})
+	dynamicClient, err := dynamic.NewClient(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := dynamicClient.Resource(&resource, metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	objects, ok := obj.(*unstructured.UnstructuredList)
+	if !ok {
+		return nil, fmt.Errorf("unexpected list %T", obj)
+	}
+	return objects.Items, nil
+}
+
+type importer struct {
+	kvClient       kv.Client
+	prefix         string
+	storageFactory *serverstorage.DefaultStorageFactory
+	result         *Result
+}
+
+func (i *importer) importResource(ctx context.Context, source *restclient.Config, gv schema.GroupVersion,
+	resource metav1.APIResource, custom bool) error {
+	items, err := list(source, gv, resource)
+	if err != nil {
+		return err
+	}
+
+	gr := schema.GroupResource{Group: gv.Group, Resource: resource.Name}
+	resourcePrefix := gr.Group + "/" + gr.Resource
+	var codec runtime.Codec
+	if !custom {
+		storageConfig, err := i.storageFactory.NewConfig(gr)
+		if err != nil {
+			i.result.skip("%s, not stored by this cluster: %v", gr, err)
+			return nil
+		}
+		resourcePrefix = i.storageFactory.ResourcePrefix(gr)
+		codec = storageConfig.Codec
+	}
+
+	for _, item := range items {
+		obj := &item
+		if i.skipObject(gr, obj) {
+			continue
+		}
+		prepare(gr, obj)
+
+		value, err := obj.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if codec != nil {
+			internal, err := runtime.Decode(api.Codecs.UniversalDecoder(), value)
+			if err != nil {
+				i.result.skip("%s %s, can't be decoded: %v", gr, name(obj), err)
+				continue
+			}
+			if value, err = runtime.Encode(codec, internal); err != nil {
+				return err
+			}
+		}
+
+		key := path.Join(i.prefix, resourcePrefix, obj.GetNamespace(), obj.GetName())
+		if _, err := i.kvClient.Create(ctx, key, value, 0); err == kv.ErrExists {
+			continue
+		} else if err != nil {
+			return err
+		}
+		i.result.Objects++
+	}
+	return nil
+}
+
+// skipObject leaves out service account tokens, they were signed by the keys of the source and are issued again,
+// the service of the apiserver, and APIServices of groups the new cluster serves itself
+func (i *importer) skipObject(gr schema.GroupResource, obj *unstructured.Unstructured) bool {
+	switch {
+	case gr.Group == "" && gr.Resource == "secrets":
+		return nested(obj.Object, "type") == string(api.SecretTypeServiceAccountToken)
+	case gr.Group == "" && (gr.Resource == "services" || gr.Resource == "endpoints"):
+		return obj.GetNamespace() == metav1.NamespaceDefault && obj.GetName() == "kubernetes"
+	case gr.Group == apiServiceGroup:
+		return nested(obj.Object, "spec", "service") == nil
+	}
+	return false
+}
+
+// prepare clears what the storage sets and unbinds pods from the hosts of the source
+func prepare(gr schema.GroupResource, obj *unstructured.Unstructured) {
+	obj.SetResourceVersion("")
+	obj.SetSelfLink("")
+
+	if gr.Group == "" && gr.Resource == "pods" {
+		if spec, ok := obj.Object["spec"].(map[string]interface{}); ok {
+			delete(spec, "nodeName")
+		}
+		obj.Object["status"] = map[string]interface{}{
+			"phase": "Pending",
+		}
+	}
+}
+
+func nested(obj map[string]interface{}, fields ...string) interface{} {
+	var value interface{} = obj
+	for _, field := range fields {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[field]
+	}
+	return value
+}
+
+func name(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package kubeconfig
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v3"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var ErrNoCredentials = errors.New("Request has no Rancher credentials to put in a kubeconfig")
+
+// Generate returns a kubeconfig for cluster served at serverURL that authenticates with the same Rancher
+// credentials as req, an API key pair or a token.  caData is the CA bundle of the server and can be empty
+// when the server certificate is trusted by the system.
+func Generate(cluster *client.Cluster, serverURL string, caData []byte, req *http.Request) ([]byte, error) {
+	authInfo, err := authInfo(req)
+	if err != nil {
+		return nil, err
+	}
+	return generate(cluster, serverURL, caData, authInfo)
+}
+
+// ForToken returns a kubeconfig like Generate that authenticates with a Rancher token
+func ForToken(cluster *client.Cluster, serverURL string, caData []byte, token string) ([]byte, error) {
+	return generate(cluster, serverURL, caData, &clientcmdapi.AuthInfo{
+		Token: token,
+	})
+}
+
+func generate(cluster *client.Cluster, serverURL string, caData []byte, authInfo *clientcmdapi.AuthInfo) ([]byte, error) {
+	name := cluster.Name
+	if name == "" {
+		name = cluster.Id
+	}
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   serverURL,
+		CertificateAuthorityData: caData,
+	}
+	config.AuthInfos[name] = authInfo
+	config.Contexts[name] = &clientcmdapi.Context{
+		Cluster:  name,
+		AuthInfo: name,
+	}
+	config.CurrentContext = name
+
+	return clientcmd.Write(*config)
+}
+
+// ServerURL is the URL clients reach the cluster at, as seen by req which may have come through a proxy
+func ServerURL(req *http.Request, clusterID string, trustedProxy bool) string {
+	return HostURL(req, trustedProxy) + "/k8s/clusters/" + clusterID
+}
+
+// HostURL is the URL of the host of req, the URL of a cluster when it is served at its own host.  The
+// X-Forwarded-Proto and X-Forwarded-Host headers are only followed if req came from a trusted proxy, anyone else
+// could point the kubeconfig and its credentials at their own server.
+func HostURL(req *http.Request, trustedProxy bool) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" && trustedProxy {
+		scheme = proto
+	}
+
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" && trustedProxy {
+		host = forwarded
+	}
+
+	return scheme + "://" + host
+}
+
+func authInfo(req *http.Request) (*clientcmdapi.AuthInfo, error) {
+	if username, password, ok := req.BasicAuth(); ok {
+		return &clientcmdapi.AuthInfo{
+			Username: username,
+			Password: password,
+		}, nil
+	}
+
+	auth := req.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return &clientcmdapi.AuthInfo{
+			Token: strings.TrimPrefix(auth, "Bearer "),
+		}, nil
+	}
+
+	if cookie, err := req.Cookie("token"); err == nil && cookie.Value != "" {
+		return &clientcmdapi.AuthInfo{
+			Token: cookie.Value,
+		}, nil
+	}
+
+	return nil, ErrNoCredentials
+}
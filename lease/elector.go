@@ -0,0 +1,89 @@
+package lease
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/k8s-sql/kv"
+)
+
+// Elector elects one of the netes sharing a database to run something that must not run more than once, like the
+// global controllers or the controllers of a cluster.  A leader that can't renew its lease stops before it expires.
+type Elector struct {
+	lease    *Lease
+	interval time.Duration
+}
+
+// NewElector elects with the lease at key, it is renewed every third of duration
+func NewElector(client kv.Client, key, holder string, duration time.Duration) *Elector {
+	return &Elector{
+		lease:    New(client, key, holder, "", duration),
+		interval: duration / 3,
+	}
+}
+
+// Run campaigns until ctx is done.  Every time the lease is acquired lead is called with a context that is
+// canceled when the lease is lost, lead starts what it runs and returns, and must stop it once the context is
+// done.  If lead fails the lease is released so another netes can try.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context) error) {
+	key := e.lease.Key()
+	for {
+		ok, err := e.lease.Acquire(ctx)
+		if err != nil {
+			logrus.Errorf("Failed to acquire lease %s: %v", key, err)
+		}
+		if ok {
+			logrus.Infof("Acquired lease %s", key)
+			e.lead(ctx, lead)
+			if err := e.lease.Release(context.Background()); err != nil {
+				logrus.Errorf("Failed to release lease %s: %v", key, err)
+			}
+			logrus.Infof("Released lease %s", key)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+func (e *Elector) lead(ctx context.Context, lead func(ctx context.Context) error) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	failed := make(chan struct{})
+	go func() {
+		if err := lead(leaderCtx); err != nil {
+			logrus.Errorf("Failed to start under lease %s: %v", e.lease.Key(), err)
+			close(failed)
+		}
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-failed:
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := e.lease.Renew(ctx)
+		if err != nil {
+			logrus.Errorf("Failed to renew lease %s: %v", e.lease.Key(), err)
+			// stop in time for the next holder
+			if time.Now().Add(e.interval).Before(e.lease.Expires()) {
+				continue
+			}
+		}
+		if !ok {
+			logrus.Errorf("Lost lease %s", e.lease.Key())
+			return
+		}
+	}
+}
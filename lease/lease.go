@@ -0,0 +1,139 @@
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rancher/k8s-sql/kv"
+)
+
+// Record is the value of a lease key.  Expiry is wall clock time so the clocks of the netes sharing a database must
+// agree to well within the lease duration.
+type Record struct {
+	Holder string `json:"holder"`
+	// Address is where the holder serves what it holds, for the ones routing to it
+	Address string    `json:"address,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// Valid is whether the lease is still held at now
+func (r *Record) Valid(now time.Time) bool {
+	return r != nil && now.Before(r.Expires)
+}
+
+// Read returns the lease at key and its record, both nil if nobody holds it.  A record that can't be decoded is
+// returned as nil with the key, so it can be taken over.
+func Read(ctx context.Context, client kv.Client, key string) (*kv.KeyValue, *Record, error) {
+	current, err := client.Get(ctx, key)
+	if err != nil && err != kv.ErrNotExists {
+		return nil, nil, err
+	}
+	if current == nil {
+		return nil, nil, nil
+	}
+
+	r := &Record{}
+	if err := json.Unmarshal(current.Value, r); err != nil {
+		return current, nil, nil
+	}
+	return current, r, nil
+}
+
+// Write writes record over current, nil if there is none, with the revision checks of the storage.  kv.ErrExists
+// and kv.ErrNotExists mean another holder wrote the lease in between.
+func Write(ctx context.Context, client kv.Client, key string, current *kv.KeyValue, record *Record) (*kv.KeyValue, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil {
+		return client.Create(ctx, key, value, 0)
+	}
+	return client.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+}
+
+// Lease is a key of the database one netes holds at a time until it expires, the holder renews it before.
+type Lease struct {
+	client   kv.Client
+	key      string
+	holder   string
+	address  string
+	duration time.Duration
+
+	current *kv.KeyValue
+	expires time.Time
+}
+
+func New(client kv.Client, key, holder, address string, duration time.Duration) *Lease {
+	return &Lease{
+		client:   client,
+		key:      key,
+		holder:   holder,
+		address:  address,
+		duration: duration,
+	}
+}
+
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// Expires is when the lease runs out unless it is renewed, zero if it isn't held
+func (l *Lease) Expires() time.Time {
+	return l.expires
+}
+
+// Acquire takes the lease if it is free, expired or already held by this holder
+func (l *Lease) Acquire(ctx context.Context) (bool, error) {
+	current, r, err := Read(ctx, l.client, l.key)
+	if err != nil {
+		return false, err
+	}
+	if r.Valid(time.Now()) && r.Holder != l.holder {
+		return false, nil
+	}
+	return l.write(ctx, current)
+}
+
+// Renew extends the lease held, it returns false if another holder took it in between
+func (l *Lease) Renew(ctx context.Context) (bool, error) {
+	if l.current == nil {
+		return false, nil
+	}
+	return l.write(ctx, l.current)
+}
+
+// Release gives up the lease if it is still held, so the next holder doesn't have to wait for it to expire
+func (l *Lease) Release(ctx context.Context) error {
+	current := l.current
+	l.current, l.expires = nil, time.Time{}
+	if current == nil {
+		return nil
+	}
+
+	err := l.client.DeleteVersion(ctx, l.key, current.Revision)
+	if err == kv.ErrNotExists {
+		return nil
+	}
+	return err
+}
+
+func (l *Lease) write(ctx context.Context, current *kv.KeyValue) (bool, error) {
+	expires := time.Now().Add(l.duration)
+	value, err := Write(ctx, l.client, l.key, current, &Record{
+		Holder:  l.holder,
+		Address: l.address,
+		Expires: expires,
+	})
+	if err == kv.ErrExists || err == kv.ErrNotExists {
+		l.current, l.expires = nil, time.Time{}
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	l.current, l.expires = value, expires
+	return true, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/netes/loadgen"
+)
+
+// runLoadgen runs "netes loadgen", it hosts no clusters itself but creates synthetic ones in Rancher and loads the
+// netes serving them
+func runLoadgen(args []string) {
+	config := loadgen.Config{
+		CattleAccessKey: os.Getenv("CATTLE_ACCESS_KEY"),
+		CattleSecretKey: os.Getenv("CATTLE_SECRET_KEY"),
+		AdminToken:      os.Getenv("NETES_ADMIN_TOKEN"),
+	}
+
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	flags.StringVar(&config.CattleURL, "cattle-url", "http://localhost:8081/v3/", "Rancher API to create the clusters in")
+	flags.StringVar(&config.NetesURL, "netes-url", "http://localhost:8089", "netes serving the clusters")
+	flags.StringVar(&config.AdminURL, "admin-url", "", "netes admin API to read the database usage from, like http://127.0.0.1:8090")
+	flags.IntVar(&config.Clusters, "clusters", 10, "clusters to create")
+	flags.IntVar(&config.Pods, "pods", 50, "pods per cluster")
+	flags.DurationVar(&config.PodChurn, "pod-churn", time.Second, "interval a pod of every cluster is replaced at, 0 for none")
+	flags.IntVar(&config.Events, "events", 5, "events created per second in every cluster")
+	flags.IntVar(&config.Watches, "watches", 5, "pod watches per cluster, with as many config map watches with -writers")
+	flags.IntVar(&config.Writers, "writers", 5, "writers per cluster, each updating a config map of its own")
+	flags.DurationVar(&config.WriteInterval, "write-interval", 100*time.Millisecond, "interval every writer updates its config map at")
+	flags.DurationVar(&config.Duration, "duration", 5*time.Minute, "how long to generate load")
+	flags.BoolVar(&config.Keep, "keep", false, "keep the clusters when done")
+	flags.Parse(args)
+
+	report, err := loadgen.Run(context.Background(), config)
+	if err != nil {
+		logrus.Fatalf("Failed to generate load: %v", err)
+	}
+	report.Print(os.Stdout)
+}
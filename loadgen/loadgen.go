@@ -0,0 +1,434 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v3"
+	adminclient "github.com/rancher/netes/admin/client"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	namespace         = "loadgen"
+	nodeName          = "loadgen"
+	readyTimeout      = 5 * time.Minute
+	listInterval      = 10 * time.Second
+	writtenAnnotation = "loadgen/written"
+)
+
+// Config describes the synthetic clusters and the load on each of them
+type Config struct {
+	// Rancher API the clusters are created in
+	CattleURL       string
+	CattleAccessKey string
+	CattleSecretKey string
+	// netes serving the clusters and, optionally, its admin API for the database usage
+	NetesURL   string
+	AdminURL   string
+	AdminToken string
+
+	Clusters int
+	// Pods kept in every cluster, one of them is replaced every PodChurn
+	Pods     int
+	PodChurn time.Duration
+	// Events created per second in every cluster
+	Events int
+	// Watches of the pods and of the config maps of the writers of every cluster
+	Watches int
+	// Writers of every cluster, each updates a config map of its own every WriteInterval.  The watches report how
+	// long updates take to reach them.
+	Writers       int
+	WriteInterval time.Duration
+	Duration      time.Duration
+	// Keep the clusters when done instead of removing them from Rancher
+	Keep bool
+}
+
+// Run creates the clusters, generates load for config.Duration and reports the latencies of the requests and
+// the database usage of the clusters
+func Run(ctx context.Context, config Config) (*Report, error) {
+	rancherClient, err := client.NewRancherClient(&client.ClientOpts{
+		Url:       config.CattleURL,
+		AccessKey: config.CattleAccessKey,
+		SecretKey: config.CattleSecretKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var admin *adminclient.Client
+	if config.AdminURL != "" {
+		admin = adminclient.New(config.AdminURL, config.AdminToken)
+	}
+
+	report := newReport(config)
+	runID := string(uuid.NewUUID())[:8]
+
+	var clusters []*client.Cluster
+	defer func() {
+		if config.Keep {
+			return
+		}
+		for _, c := range clusters {
+			if err := rancherClient.Cluster.Delete(c); err != nil {
+				logrus.Errorf("Failed to remove cluster %s: %v", c.Id, err)
+			}
+		}
+	}()
+
+	for i := 0; i < config.Clusters; i++ {
+		c, err := rancherClient.Cluster.Create(&client.Cluster{
+			Name:     fmt.Sprintf("loadgen-%s-%d", runID, i),
+			Embedded: true,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to create cluster")
+		}
+		clusters = append(clusters, c)
+	}
+
+	workers := make([]*worker, 0, len(clusters))
+	for _, c := range clusters {
+		w, err := newWorker(config, c, report)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, w)
+	}
+
+	for _, w := range workers {
+		start := time.Now()
+		if err := w.waitReady(ctx); err != nil {
+			return nil, errors.Wrapf(err, "Cluster %s did not start", w.cluster.Id)
+		}
+		report.observe("cluster-start", time.Since(start), nil)
+	}
+
+	before, err := storage(admin, clusters)
+	if err != nil {
+		return nil, err
+	}
+	subsystemsBefore, err := scrape(config, clusters)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.run(ctx)
+		}(w)
+	}
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+
+	after, err := storage(admin, clusters)
+	if err != nil {
+		return nil, err
+	}
+	report.Storage = after
+	subsystemsAfter, err := scrape(config, clusters)
+	if err != nil {
+		return nil, err
+	}
+	report.Subsystems = subsystems(subsystemsBefore, subsystemsAfter)
+	report.StorageGrowth = StorageUsage{
+		Rows:  after.Rows - before.Rows,
+		Bytes: after.Bytes - before.Bytes,
+	}
+
+	return report, nil
+}
+
+// storage sums the database usage of the clusters, zero without the admin API
+func storage(admin *adminclient.Client, clusters []*client.Cluster) (StorageUsage, error) {
+	usage := StorageUsage{}
+	if admin == nil {
+		return usage, nil
+	}
+
+	ids := map[string]bool{}
+	for _, c := range clusters {
+		ids[c.Id] = true
+	}
+
+	collection, err := admin.ListStorage()
+	if err != nil {
+		return usage, errors.Wrap(err, "Failed to read storage usage")
+	}
+	for _, s := range collection.Data {
+		if ids[s.Cluster] {
+			usage.Rows += s.Rows
+			usage.Bytes += s.Bytes
+		}
+	}
+	return usage, nil
+}
+
+// scrape reads the histograms of the subsystems of netes for clusters, none without the admin API
+func scrape(config Config, clusters []*client.Cluster) (map[string]*histogram, error) {
+	if config.AdminURL == "" {
+		return nil, nil
+	}
+
+	ids := map[string]bool{}
+	for _, c := range clusters {
+		ids[c.Id] = true
+	}
+	return scrapeSubsystems(config.AdminURL, config.AdminToken, ids)
+}
+
+type worker struct {
+	config      Config
+	cluster     *client.Cluster
+	client      kubernetes.Interface
+	report      *Report
+	pods        []string
+	watchEvents int64
+}
+
+func newWorker(config Config, c *client.Cluster, report *Report) (*worker, error) {
+	k8sClient, err := kubernetes.NewForConfig(&rest.Config{
+		Host:     strings.TrimSuffix(config.NetesURL, "/") + "/k8s/clusters/" + c.Id,
+		Username: config.CattleAccessKey,
+		Password: config.CattleSecretKey,
+		QPS:      1000,
+		Burst:    1000,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &worker{
+		config:  config,
+		cluster: c,
+		client:  k8sClient,
+		report:  report,
+	}, nil
+}
+
+func (w *worker) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	return wait.PollUntil(time.Second, func() (bool, error) {
+		_, err := w.client.CoreV1().Namespaces().Create(&v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespace,
+			},
+		})
+		return err == nil || apierrors.IsAlreadyExists(err), nil
+	}, ctx.Done())
+}
+
+func (w *worker) run(ctx context.Context) {
+	for i := 0; i < w.config.Pods; i++ {
+		w.createPod()
+	}
+
+	for i := 0; i < w.config.Watches; i++ {
+		go w.watch(ctx)
+		if w.config.Writers > 0 {
+			go w.watchWrites(ctx)
+		}
+	}
+	for i := 0; i < w.config.Writers; i++ {
+		go w.write(ctx, fmt.Sprintf("loadgen-writer-%d", i))
+	}
+	if w.config.Events > 0 {
+		go wait.Until(w.createEvent, time.Second/time.Duration(w.config.Events), ctx.Done())
+	}
+	if w.config.PodChurn > 0 {
+		go wait.Until(w.churn, w.config.PodChurn, ctx.Done())
+	}
+	wait.Until(w.listPods, listInterval, ctx.Done())
+
+	atomic.AddInt64(&w.report.WatchEvents, atomic.LoadInt64(&w.watchEvents))
+}
+
+func (w *worker) createPod() {
+	name := "loadgen-" + string(uuid.NewUUID())
+	start := time.Now()
+	_, err := w.client.CoreV1().Pods(namespace).Create(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app": "loadgen",
+			},
+		},
+		Spec: v1.PodSpec{
+			// bound to a node that doesn't exist so no scheduler or kubelet adds load
+			NodeName: nodeName,
+			Containers: []v1.Container{
+				{
+					Name:  "pause",
+					Image: "gcr.io/google_containers/pause-amd64:3.0",
+				},
+			},
+		},
+	})
+	w.report.observe("pod-create", time.Since(start), err)
+	if err == nil {
+		w.pods = append(w.pods, name)
+	}
+}
+
+func (w *worker) churn() {
+	if len(w.pods) == 0 {
+		return
+	}
+
+	i := rand.Intn(len(w.pods))
+	name := w.pods[i]
+	w.pods = append(w.pods[:i], w.pods[i+1:]...)
+
+	start := time.Now()
+	err := w.client.CoreV1().Pods(namespace).Delete(name, metav1.NewDeleteOptions(0))
+	w.report.observe("pod-delete", time.Since(start), err)
+
+	w.createPod()
+}
+
+func (w *worker) createEvent() {
+	start := time.Now()
+	now := metav1.Now()
+	_, err := w.client.CoreV1().Events(namespace).Create(&v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "loadgen-" + string(uuid.NewUUID()),
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Namespace",
+			Name:      namespace,
+			Namespace: namespace,
+		},
+		Reason:         "LoadGenerated",
+		Message:        "Synthetic event of the load generator",
+		Source:         v1.EventSource{Component: "loadgen"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           v1.EventTypeNormal,
+	})
+	w.report.observe("event-create", time.Since(start), err)
+}
+
+func (w *worker) listPods() {
+	start := time.Now()
+	_, err := w.client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	w.report.observe("pod-list", time.Since(start), err)
+}
+
+func (w *worker) watch(ctx context.Context) {
+	for ctx.Err() == nil {
+		start := time.Now()
+		watcher, err := w.client.CoreV1().Pods(namespace).Watch(metav1.ListOptions{})
+		w.report.observe("pod-watch", time.Since(start), err)
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		func() {
+			defer watcher.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case _, ok := <-watcher.ResultChan():
+					if !ok {
+						return
+					}
+					atomic.AddInt64(&w.watchEvents, 1)
+				}
+			}
+		}()
+	}
+}
+
+// write updates the config map name every WriteInterval, with the time of the update for the watches
+func (w *worker) write(ctx context.Context, name string) {
+	configMaps := w.client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Create(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+	})
+	if apierrors.IsAlreadyExists(err) {
+		configMap, err = configMaps.Get(name, metav1.GetOptions{})
+	}
+	if err != nil {
+		w.report.observe("configmap-create", 0, err)
+		return
+	}
+
+	wait.Until(func() {
+		if configMap.Annotations == nil {
+			configMap.Annotations = map[string]string{}
+		}
+		start := time.Now()
+		configMap.Annotations[writtenAnnotation] = start.Format(time.RFC3339Nano)
+		updated, err := configMaps.Update(configMap)
+		w.report.observe("configmap-update", time.Since(start), err)
+		if err == nil {
+			configMap = updated
+		} else if apierrors.IsConflict(err) {
+			if latest, err := configMaps.Get(name, metav1.GetOptions{}); err == nil {
+				configMap = latest
+			}
+		}
+	}, w.config.WriteInterval, ctx.Done())
+}
+
+// watchWrites watches the config maps of the writers and reports how long their updates took to arrive
+func (w *worker) watchWrites(ctx context.Context) {
+	for ctx.Err() == nil {
+		start := time.Now()
+		watcher, err := w.client.CoreV1().ConfigMaps(namespace).Watch(metav1.ListOptions{})
+		w.report.observe("configmap-watch", time.Since(start), err)
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		func() {
+			defer watcher.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event, ok := <-watcher.ResultChan():
+					if !ok {
+						return
+					}
+					atomic.AddInt64(&w.watchEvents, 1)
+					configMap, ok := event.Object.(*v1.ConfigMap)
+					if !ok {
+						continue
+					}
+					if written, err := time.Parse(time.RFC3339Nano, configMap.Annotations[writtenAnnotation]); err == nil {
+						w.report.observe("watch-delivery", time.Since(written), nil)
+					}
+				}
+			}
+		}()
+	}
+}
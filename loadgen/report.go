@@ -0,0 +1,128 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type StorageUsage struct {
+	Rows  int64
+	Bytes int64
+}
+
+// Report has the latencies of the requests of a run by operation and the database usage of its clusters
+type Report struct {
+	sync.Mutex
+
+	Config      Config
+	Elapsed     time.Duration
+	Operations  map[string]*Operation
+	WatchEvents int64
+	// latencies netes measured per subsystem, only known with the admin API
+	Subsystems map[string]*Subsystem
+	// usage at the end of the run and how much it grew during the run, only known with the admin API
+	Storage       StorageUsage
+	StorageGrowth StorageUsage
+}
+
+type Operation struct {
+	Count     int
+	Errors    int
+	latencies []time.Duration
+}
+
+func newReport(config Config) *Report {
+	return &Report{
+		Config:     config,
+		Operations: map[string]*Operation{},
+	}
+}
+
+func (r *Report) observe(name string, latency time.Duration, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	op, ok := r.Operations[name]
+	if !ok {
+		op = &Operation{}
+		r.Operations[name] = op
+	}
+	op.Count++
+	if err != nil {
+		op.Errors++
+		return
+	}
+	op.latencies = append(op.latencies, latency)
+}
+
+// Percentile returns the latency p (0-100) percent of the successful requests stayed under
+func (o *Operation) Percentile(p int) time.Duration {
+	if len(o.latencies) == 0 {
+		return 0
+	}
+	sort.Slice(o.latencies, func(i, j int) bool {
+		return o.latencies[i] < o.latencies[j]
+	})
+	i := len(o.latencies) * p / 100
+	if i >= len(o.latencies) {
+		i = len(o.latencies) - 1
+	}
+	return o.latencies[i]
+}
+
+func (r *Report) Print(out io.Writer) {
+	r.Lock()
+	defer r.Unlock()
+
+	fmt.Fprintf(out, "%d clusters, %d pods with churn %v, %d events/s, %d watches and %d writers every %v per cluster for %v\n\n",
+		r.Config.Clusters, r.Config.Pods, r.Config.PodChurn, r.Config.Events, r.Config.Watches, r.Config.Writers,
+		r.Config.WriteInterval, r.Elapsed.Truncate(time.Second))
+
+	var names []string
+	for name := range r.Operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "OPERATION\tCOUNT\tERRORS\tRATE\tP50\tP90\tP99\tMAX")
+	for _, name := range names {
+		op := r.Operations[name]
+		rate := 0.0
+		if r.Elapsed > 0 {
+			rate = float64(op.Count) / r.Elapsed.Seconds()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f/s\t%v\t%v\t%v\t%v\n", name, op.Count, op.Errors, rate,
+			op.Percentile(50), op.Percentile(90), op.Percentile(99), op.Percentile(100))
+	}
+	w.Flush()
+
+	if len(r.Subsystems) > 0 {
+		var subsystems []string
+		for name := range r.Subsystems {
+			subsystems = append(subsystems, name)
+		}
+		sort.Strings(subsystems)
+
+		fmt.Fprintln(out)
+		w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "SUBSYSTEM\tCOUNT\tMEAN\tP50\tP90\tP99")
+		for _, name := range subsystems {
+			s := r.Subsystems[name]
+			mean := time.Duration(0)
+			if s.Count > 0 {
+				mean = s.Sum / time.Duration(s.Count)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t%v\n", name, s.Count, mean, s.P50, s.P90, s.P99)
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintf(out, "\nwatch events: %d\n", r.WatchEvents)
+	fmt.Fprintf(out, "storage: %d rows, %d bytes (grew by %d rows, %d bytes)\n",
+		r.Storage.Rows, r.Storage.Bytes, r.StorageGrowth.Rows, r.StorageGrowth.Bytes)
+}
@@ -0,0 +1,163 @@
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// subsystemHistograms split the time of the requests to netes by where it is spent, they are read from the
+// metrics of the admin API
+var subsystemHistograms = map[string]string{
+	"netes_request_queue_wait_seconds":         "queue",
+	"netes_apiserver_request_duration_seconds": "apiserver",
+	"netes_storage_operation_duration_seconds": "storage",
+}
+
+// Subsystem has the latencies netes measured for the clusters of a run in one of its subsystems.  Percentiles
+// are estimated from the buckets of the histogram like histogram_quantile of Prometheus.
+type Subsystem struct {
+	Count int64
+	Sum   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+}
+
+// histogram is the cumulative count of observations per upper bound of the buckets, summed over the clusters
+type histogram struct {
+	buckets map[float64]float64
+	count   float64
+	sum     float64
+}
+
+// scrapeSubsystems reads the histograms of the subsystems for the clusters in ids from the admin API
+func scrapeSubsystems(adminURL, token string, ids map[string]bool) (map[string]*histogram, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(adminURL, "/")+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read metrics")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to read metrics: %s", resp.Status)
+	}
+
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse metrics")
+	}
+
+	result := map[string]*histogram{}
+	for name, subsystem := range subsystemHistograms {
+		h := &histogram{buckets: map[float64]float64{}}
+		result[subsystem] = h
+
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !ids[label(metric, "cluster")] || metric.GetHistogram() == nil {
+				continue
+			}
+			hist := metric.GetHistogram()
+			h.count += float64(hist.GetSampleCount())
+			h.sum += hist.GetSampleSum()
+			for _, bucket := range hist.GetBucket() {
+				h.buckets[bucket.GetUpperBound()] += float64(bucket.GetCumulativeCount())
+			}
+		}
+	}
+	return result, nil
+}
+
+func label(metric *dto.Metric, name string) string {
+	for _, pair := range metric.GetLabel() {
+		if pair.GetName() == name {
+			return pair.GetValue()
+		}
+	}
+	return ""
+}
+
+// subsystems returns what the subsystems observed between before and after
+func subsystems(before, after map[string]*histogram) map[string]*Subsystem {
+	result := map[string]*Subsystem{}
+	for name, a := range after {
+		delta := &histogram{
+			buckets: map[float64]float64{},
+			count:   a.count,
+			sum:     a.sum,
+		}
+		for bound, count := range a.buckets {
+			delta.buckets[bound] = count
+		}
+		if b, ok := before[name]; ok {
+			delta.count -= b.count
+			delta.sum -= b.sum
+			for bound, count := range b.buckets {
+				delta.buckets[bound] -= count
+			}
+		}
+
+		result[name] = &Subsystem{
+			Count: int64(delta.count),
+			Sum:   seconds(delta.sum),
+			P50:   seconds(delta.quantile(0.5)),
+			P90:   seconds(delta.quantile(0.9)),
+			P99:   seconds(delta.quantile(0.99)),
+		}
+	}
+	return result
+}
+
+// quantile interpolates linearly within the bucket the quantile falls in, observations over the last bound
+// report the last bound
+func (h *histogram) quantile(q float64) float64 {
+	if h.count <= 0 {
+		return 0
+	}
+
+	var bounds []float64
+	for bound := range h.buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * h.count
+	lower, below := 0.0, 0.0
+	for _, bound := range bounds {
+		count := h.buckets[bound]
+		if count >= rank {
+			if math.IsInf(bound, 1) {
+				return lower
+			}
+			if count == below {
+				return bound
+			}
+			return lower + (bound-lower)*(rank-below)/(count-below)
+		}
+		lower, below = bound, count
+	}
+	return lower
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
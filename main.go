@@ -2,19 +2,50 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/rancher/netes/chaos"
+	"github.com/rancher/netes/configfile"
 	"github.com/rancher/netes/master"
 	"github.com/rancher/netes/store"
 	"github.com/rancher/netes/types"
-	"k8s.io/apiserver/pkg/util/logs"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/util/logs"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "loadgen" {
+		runLoadgen(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		runAgent(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "clusters" {
+		runClusters(os.Args[2:])
+		return
+	}
+
 	utilruntime.ReallyCrash = false
 	logs.InitLogs()
 
+	// a YAML file of the environment variables below, the environment wins over it.  Some of the settings are
+	// applied again on SIGHUP or when the file changes, see types.GlobalConfig.
+	var configFile *configfile.File
+	if path := os.Getenv("NETES_CONFIG_FILE"); path != "" {
+		f, err := configfile.Setenv(path)
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "Failed to load NETES_CONFIG_FILE=%s: %v", path, err)
+			os.Exit(1)
+		}
+		configFile = f
+	}
+
 	dsn := os.Getenv("NETES_DB_DSN")
 	if dsn == "" {
 		user := getenv("NETES_MYSQL_USER", "cattle")
@@ -32,11 +63,47 @@ func main() {
 		)
 	}
 
+	var shardDSNs []string
+	if shards := os.Getenv("NETES_DB_SHARD_DSNS"); shards != "" {
+		shardDSNs = strings.Split(shards, ",")
+	}
+
+	var rancherTransport http.RoundTripper
+	if spec := os.Getenv("NETES_RANCHER_CHAOS"); spec != "" {
+		transport, err := chaos.Parse(spec, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "Invalid NETES_RANCHER_CHAOS=%s: %v", spec, err)
+			os.Exit(1)
+		}
+		fmt.Println("Injecting faults into requests to Rancher:", spec)
+		rancherTransport = transport
+	}
+
+	hostname, _ := os.Hostname()
+
 	err := master.New(&types.GlobalConfig{
-		Dialect:    "mysql",
-		DSN:        dsn,
-		CattleURL:  "http://localhost:8081/v3/",
-		ListenAddr: ":8089",
+		ConfigFile: configFile,
+		// debug, info, warning or error
+		LogLevel: getenv("NETES_LOG_LEVEL", "info"),
+		// mysql-binary migrates to binary encoded keys
+		Dialect:   getenv("NETES_DB_DIALECT", "mysql"),
+		DSN:       dsn,
+		ShardDSNs: shardDSNs,
+		// node status heartbeats
+		CoalesceWindow:      getenvDuration("NETES_COALESCE_WINDOW", "0s"),
+		CoalesceResources:   []string{"minions"},
+		Audit:               os.Getenv("NETES_AUDIT") == "true",
+		CattleURL:           getenv("NETES_RANCHER_URL", "http://localhost:8081/v3/"),
+		CattleAccessKey:     os.Getenv("CATTLE_ACCESS_KEY"),
+		CattleSecretKey:     os.Getenv("CATTLE_SECRET_KEY"),
+		RancherTransport:    rancherTransport,
+		ListenAddr:          getenv("NETES_LISTEN_ADDR", ":8089"),
+		AdminListenAddr:     getenv("NETES_ADMIN_LISTEN_ADDR", "127.0.0.1:8090"),
+		AdminToken:          os.Getenv("NETES_ADMIN_TOKEN"),
+		AdminGRPCListenAddr: os.Getenv("NETES_ADMIN_GRPC_LISTEN_ADDR"),
+		TLSCertFile:         os.Getenv("NETES_TLS_CERT_FILE"),
+		TLSKeyFile:          os.Getenv("NETES_TLS_KEY_FILE"),
+		TLSCAFile:           os.Getenv("NETES_TLS_CA_FILE"),
 		AdmissionControllers: []string{
 			"NamespaceLifecycle",
 			"LimitRanger",
@@ -47,10 +114,131 @@ func main() {
 			"DefaultTolerationSeconds",
 		},
 		ServiceNetCidr: "10.43.0.0/24",
+		DrainTimeout:   5 * time.Minute,
+		DrainForce:     os.Getenv("NETES_DRAIN_FORCE") == "true",
+		// how long the objects of a deleted namespace can be restored
+		NamespaceDeleteWindow: getenvDuration("NETES_NAMESPACE_DELETE_WINDOW", "0s"),
+		// how long the storage of a removed cluster is kept, in case the removal was a mistake
+		ClusterGCDelay: getenvDuration("NETES_CLUSTER_GC_DELAY", "24h"),
+		// the k8sServerStatus of the clusters in Rancher, shown as control plane health
+		HeartbeatInterval: getenvDuration("NETES_HEARTBEAT_INTERVAL", "1m"),
+		// wedged apiservers are restarted instead of waiting for someone to restart netes
+		UnhealthyRestartTimeout: getenvDuration("NETES_UNHEALTHY_RESTART_TIMEOUT", "2m"),
+		// Rancher hiccups are retried for this long before netes falls back to the cached clusters
+		RancherRetryMaxElapsed: getenvDuration("NETES_RANCHER_RETRY_MAX_ELAPSED", "10s"),
+		// changes in Rancher are picked up from its event stream, the TTLs bound staleness when it is down
+		AuthCacheTTL:         getenvDuration("NETES_AUTH_CACHE_TTL", "1m"),
+		AuthNegativeCacheTTL: getenvDuration("NETES_AUTH_NEGATIVE_CACHE_TTL", "10s"),
+		AuthOfflineTTL:       getenvDuration("NETES_AUTH_OFFLINE_TTL", "1h"),
+		// backups taken and restored through the admin API, S3 credentials come from the AWS environment
+		BackupTarget: os.Getenv("NETES_BACKUP_TARGET"),
+		// only needed when several netes share a database, overrides look like "pods=1s,events=30s"
+		WatchPollInterval:  getenvDuration("NETES_WATCH_POLL_INTERVAL", "0s"),
+		WatchPollJitter:    getenvDuration("NETES_WATCH_POLL_JITTER", "0s"),
+		WatchPollIntervals: getenvDurations("NETES_WATCH_POLL_OVERRIDES"),
+		// for dashboards opening the same watches in many browsers
+		WatchFanIn: os.Getenv("NETES_WATCH_FAN_IN") == "true",
+		// upstream apiserver defaults unless set
+		MaxRequestsInflight:         getenvInt("NETES_MAX_REQUESTS_INFLIGHT"),
+		MaxMutatingRequestsInflight: getenvInt("NETES_MAX_MUTATING_REQUESTS_INFLIGHT"),
+		MinRequestTimeout:           getenvInt("NETES_MIN_REQUEST_TIMEOUT"),
+		// per resource in a namespace and for all objects of a cluster
+		MaxObjectsPerNamespace: getenvInt("NETES_MAX_OBJECTS_PER_NAMESPACE"),
+		MaxObjectsPerCluster:   getenvInt("NETES_MAX_OBJECTS_PER_CLUSTER"),
+		// ordered log of every write with its value, read through the admin API by replication consumers
+		MutationLog:          os.Getenv("NETES_MUTATION_LOG") == "true",
+		MutationLogRetention: getenvDuration("NETES_MUTATION_LOG_RETENTION", "168h"),
+		// standby of the primary at NETES_REPLICATION_SOURCE, clusters look like "1c1,1c2/namespaces"
+		ReplicationSource:      os.Getenv("NETES_REPLICATION_SOURCE"),
+		ReplicationSourceToken: os.Getenv("NETES_REPLICATION_SOURCE_TOKEN"),
+		ReplicationTargets:     getenvList("NETES_REPLICATION_CLUSTERS"),
+		// "webhook" with the URL of a service checking image signatures as config
+		ImageVerifier:       os.Getenv("NETES_IMAGE_VERIFIER"),
+		ImageVerifierConfig: os.Getenv("NETES_IMAGE_VERIFIER_CONFIG"),
+		// "baseline" or "restricted", pods of namespaces like "kube-system,monitoring" are exempt
+		PodSecurityLevel:            os.Getenv("NETES_POD_SECURITY_LEVEL"),
+		PodSecurityExemptNamespaces: getenvList("NETES_POD_SECURITY_EXEMPT_NAMESPACES"),
+		// pods with schedulerName unset or default-scheduler, other schedulers can still run in the cluster
+		EmbeddedScheduler: os.Getenv("NETES_EMBEDDED_SCHEDULER") == "true",
+		// hosts dedicated to kube-system pods like DNS, looking like "dedicated=system:NoSchedule"
+		SystemTaints:       getenvList("NETES_SYSTEM_TAINTS"),
+		SystemNodeSelector: getenvList("NETES_SYSTEM_NODE_SELECTOR"),
+		// requests over NETES_MAX_REQUESTS_INFLIGHT wait up to this long instead of failing with 429 right away
+		RequestQueueTimeout: getenvDuration("NETES_REQUEST_QUEUE_TIMEOUT", "0s"),
+		// resources of the clusters shown in Rancher, like "deployments,services,ingresses"
+		ExportResources: getenvList("NETES_EXPORT_RESOURCES"),
+		// *.yaml, *.yml and *.json manifests applied to new clusters, like namespaces, RBAC and network policies
+		BootstrapManifestsDir: os.Getenv("NETES_BOOTSTRAP_MANIFESTS_DIR"),
+		// a default StorageClass backed by the openstorage of the hosts
+		OpenStorageEndpoint:  os.Getenv("NETES_OPENSTORAGE_ENDPOINT"),
+		OpenStorageDriver:    getenv("NETES_OPENSTORAGE_DRIVER", "pxd"),
+		OpenStorageByDefault: os.Getenv("NETES_OPENSTORAGE_BY_DEFAULT") == "true",
+		// templates like tenant.yaml with admission config, feature gates, audit policy, RBAC and StorageClasses
+		ClusterTemplatesDir: os.Getenv("NETES_CLUSTER_TEMPLATES_DIR"),
+		// audit.k8s.io/v1alpha1 policy of the hosted apiservers, events are labeled with cluster and account
+		AuditPolicyFile:        os.Getenv("NETES_AUDIT_POLICY_FILE"),
+		AuditLogPath:           os.Getenv("NETES_AUDIT_LOG_PATH"),
+		AuditWebhookConfigFile: os.Getenv("NETES_AUDIT_WEBHOOK_CONFIG_FILE"),
+		// a JSON line per request with cluster, user, verb, resource, latency, code and bytes, for the log pipeline
+		AccessLogPath:        os.Getenv("NETES_ACCESS_LOG_PATH"),
+		AccessLogByDefault:   getenv("NETES_ACCESS_LOG_BY_DEFAULT", "true") == "true",
+		AccessLogSampleRatio: getenvFloat("NETES_ACCESS_LOG_SAMPLE_RATIO", "1"),
+		// tenant clusters are locked down, dev clusters can open up in Rancher
+		AnonymousAuth:     os.Getenv("NETES_ANONYMOUS_AUTH") == "true",
+		InsecureLocalhost: os.Getenv("NETES_INSECURE_LOCALHOST") == "true",
+		AlwaysAllowPaths:  strings.Split(getenv("NETES_ALWAYS_ALLOW_PATHS", "/healthz,/version"), ","),
+		// Rancher credentials only, clusters can add client certificates, OIDC, a token webhook or a proxy in Rancher
+		AuthenticationChain: strings.Split(getenv("NETES_AUTHENTICATION_CHAIN", "rancher"), ","),
+		// grace period of requests on SIGTERM, before the database connections are closed
+		ShutdownTimeout: getenvDuration("NETES_SHUTDOWN_TIMEOUT", "30s"),
+		// clusters at hosts like <cluster>.k8s.example.com, with certificates like <cluster>.crt and <cluster>.key
+		ClusterDomain:  os.Getenv("NETES_CLUSTER_DOMAIN"),
+		ClusterCertDir: os.Getenv("NETES_CLUSTER_CERT_DIR"),
+		// or certificates from Let's Encrypt, stored in the database and renewed a month before they expire
+		ACMEDirectoryURL: os.Getenv("NETES_ACME_DIRECTORY_URL"),
+		ACMEEmail:        os.Getenv("NETES_ACME_EMAIL"),
+		// bound service account tokens of the TokenRequest API, as projected into pods by kubelets
+		ServiceAccountIssuer:             getenv("NETES_SERVICE_ACCOUNT_ISSUER", "https://kubernetes.default.svc"),
+		ServiceAccountMaxTokenExpiration: getenvDuration("NETES_SERVICE_ACCOUNT_MAX_TOKEN_EXPIRATION", "0s"),
+		// project owners, members and read-only members get the access of the admin, edit and view roles
+		RancherAuthorization: os.Getenv("NETES_RANCHER_AUTHORIZATION") == "true",
+		// every project gets a namespace, namespaces of removed projects are deleted
+		ProjectNamespaces: os.Getenv("NETES_PROJECT_NAMESPACES") == "true",
+		// enabled API groups and versions like "batch/v2alpha1=true,api/legacy=true", and feature gates of the process
+		RuntimeConfig: getenvList("NETES_RUNTIME_CONFIG"),
+		FeatureGates:  getenvList("NETES_FEATURE_GATES"),
+		// per cluster budgets so one cluster can't take the resources of the process
+		MaxWatchesPerCluster:    getenvInt("NETES_MAX_WATCHES_PER_CLUSTER"),
+		MaxGoroutinesPerCluster: getenvInt("NETES_MAX_GOROUTINES_PER_CLUSTER"),
+		// stop the apiservers of clusters without requests for this long, they start again on their next request
+		IdleTimeout: getenvDuration("NETES_IDLE_TIMEOUT", "0s"),
+		// URL the other replicas forward requests for the clusters of this one to, like http://10.0.0.5:8089
+		ReplicaID:      getenv("NETES_REPLICA_ID", hostname),
+		ReplicaAddress: os.Getenv("NETES_REPLICA_ADDRESS"),
+		LeaseDuration:  getenvDuration("NETES_LEASE_DURATION", "30s"),
+		// replicas sharing a database without NETES_REPLICA_ADDRESS, drain, export and RBAC sync run on one
+		LeaderElection: os.Getenv("NETES_LEADER_ELECTION") == "true",
+		// CIDRs of load balancers and replicas, needed for clusters with allowed source ranges and for kubeconfigs
+		// behind them
+		TrustedProxies: getenvList("NETES_TRUSTED_PROXIES"),
+		// OpenTelemetry collector like http://otel-collector:4318/v1/traces, the trace id is returned as X-Request-Id
+		TracingEndpoint:    os.Getenv("NETES_TRACING_ENDPOINT"),
+		TracingSampleRatio: getenvFloat("NETES_TRACING_SAMPLE_RATIO", "0.01"),
+		// node agent tunnels with Rancher as fallback, or a konnectivity-style proxy like
+		// NETES_EGRESS=http-connect NETES_EGRESS_ADDRESS=unix:///var/run/konnectivity.sock
+		Egress:        getenv("NETES_EGRESS", "tunnel"),
+		EgressAddress: os.Getenv("NETES_EGRESS_ADDRESS"),
+		// the proxy environment variables apply to outbound calls unless a proxy is set
+		OutboundProxy:  os.Getenv("NETES_OUTBOUND_PROXY"),
+		OutboundCAFile: os.Getenv("NETES_OUTBOUND_CA_FILE"),
+		// control plane events go to sinks like "log,webhook=https://alerts.example.com/netes,rancher" or
+		// "kafka-rest=http://kafka-rest:8082/topics/netes"
+		EventSinks: getenvList("NETES_EVENT_SINKS"),
 	}).Run()
-
-	fmt.Fprintf(os.Stdout, "Failed to run netes: %v", err)
-	os.Exit(1)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "Failed to run netes: %v", err)
+		os.Exit(1)
+	}
 }
 
 func getenv(key, def string) string {
@@ -60,3 +248,67 @@ func getenv(key, def string) string {
 	}
 	return val
 }
+
+func getenvDuration(key, def string) time.Duration {
+	val := getenv(key, def)
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "Invalid duration %s=%s: %v", key, val, err)
+		os.Exit(1)
+	}
+	return d
+}
+
+func getenvDurations(key string) map[string]time.Duration {
+	result := map[string]time.Duration{}
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			fmt.Fprintf(os.Stdout, "Invalid %s=%s: expected prefix=duration", key, part)
+			os.Exit(1)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			fmt.Fprintf(os.Stdout, "Invalid duration %s=%s: %v", key, part, err)
+			os.Exit(1)
+		}
+		result[kv[0]] = d
+	}
+	return result
+}
+
+func getenvList(key string) []string {
+	var result []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func getenvFloat(key, def string) float64 {
+	val := getenv(key, def)
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "Invalid number %s=%s: %v", key, val, err)
+		os.Exit(1)
+	}
+	return f
+}
+
+func getenvInt(key string) int64 {
+	val := os.Getenv(key)
+	if val == "" {
+		return 0
+	}
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "Invalid number %s=%s: %v", key, val, err)
+		os.Exit(1)
+	}
+	return i
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/authcache"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/shard"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	syncInterval = 30 * time.Second
+	drainTimeout = 30 * time.Second
+)
+
+// Manager keeps the running servers in sync with the clusters in Rancher, starting servers of new clusters,
+// restarting servers whose configuration changed and stopping servers of removed clusters.  Changes are applied
+// as Rancher publishes them, clusters are also listed periodically in case an event was missed.  While Rancher is
+// unreachable the clusters are kept running with their cached specs, the first sync once it is back reconciles
+// them.
+type Manager struct {
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+	shards        *shard.Coordinator
+	idleTimeout   time.Duration
+	authCache     *authcache.Invalidator
+}
+
+func New(config *types.GlobalConfig, serverFactory *server.Factory) *Manager {
+	return &Manager{
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+		shards:        config.Shards,
+		idleTimeout:   config.IdleTimeout,
+		authCache:     config.AuthCache,
+	}
+}
+
+// Start keeps the servers in sync, with replicas sharing the clusters only the servers of the clusters this one
+// holds the lease of run, and they are synced again when leases are taken over or lost
+func (m *Manager) Start(ctx context.Context) {
+	if m.shards != nil {
+		m.shards.Start(ctx, m.sync)
+	}
+	go wait.Until(m.sync, syncInterval, ctx.Done())
+	go m.subscribe(ctx)
+}
+
+func (m *Manager) sync() {
+	clusters, err := m.clusters()
+	if err != nil {
+		logrus.Errorf("Failed to list clusters: %v", err)
+		return
+	}
+
+	if m.shards != nil {
+		var ids []string
+		for id := range clusters {
+			ids = append(ids, id)
+		}
+		m.shards.SetClusters(ids)
+	}
+
+	for _, c := range clusters {
+		m.apply(c)
+	}
+
+	for _, s := range m.serverFactory.Servers() {
+		id := s.Cluster().Id
+		if m.shards != nil && !m.shards.Owns(id) {
+			logrus.Infof("Cluster %s is served by another replica, stopping its server", id)
+			m.serverFactory.Remove(id, drainTimeout)
+		} else if _, ok := clusters[id]; !ok {
+			logrus.Infof("Cluster %s was removed, stopping its server", id)
+			m.serverFactory.Remove(id, drainTimeout)
+		} else if m.idleTimeout > 0 && m.serverFactory.Idle(id) > m.idleTimeout {
+			logrus.Infof("Cluster %s is idle, stopping its server until its next request", id)
+			m.serverFactory.Remove(id, drainTimeout)
+		}
+	}
+}
+
+func (m *Manager) clusters() (map[string]*client.Cluster, error) {
+	return m.rancher.Clusters()
+}
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/rancher"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// subscribe applies the cluster changes Rancher publishes on /subscribe as they happen, the periodic sync only
+// catches what was missed.  Changes of API keys, accounts, projects and their members drop the cached
+// authentication and authorization results they may affect.  Every (re)connect starts with a full sync, events may
+// have been lost while the stream was down.
+func (m *Manager) subscribe(ctx context.Context) {
+	rancherClient, err := m.rancher.Get()
+	for backoff := minBackoff; err != nil; {
+		logrus.Errorf("Failed to connect to Rancher for its event stream, retrying in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		rancherClient, err = m.rancher.Get()
+	}
+
+	events := rancherClient.SubscribeEvents(ctx, &client.SubscribeOpts{
+		OnConnect: m.sync,
+		OnDisconnect: func(err error, retryIn time.Duration) {
+			logrus.Errorf("Rancher event stream failed, reconnecting in %v: %v", retryIn, err)
+		},
+		MinBackoff: minBackoff,
+		MaxBackoff: maxBackoff,
+	})
+	for e := range events {
+		m.handle(e)
+	}
+}
+
+func (m *Manager) handle(e client.Event) {
+	if e.Name != client.RESOURCE_CHANGE_EVENT || len(e.Data.Resource) == 0 {
+		return
+	}
+
+	switch e.ResourceType {
+	case client.CLUSTER_TYPE:
+		c, ok := e.Resource.(*client.Cluster)
+		if !ok {
+			logrus.Errorf("Failed to read change of cluster %s", e.ResourceId)
+			return
+		}
+		m.rancher.Remember(c)
+		m.apply(c)
+	case "apiKey", "credential", "project":
+		// all of them carry the cluster they belong to, if any
+		r := struct {
+			ClusterID string `json:"clusterId"`
+		}{}
+		if err := json.Unmarshal(e.Data.Resource, &r); err != nil {
+			logrus.Errorf("Failed to read change of %s %s: %v", e.ResourceType, e.ResourceId, err)
+			return
+		}
+		m.authCache.Invalidate(e.ResourceType, r.ClusterID)
+	case "projectMember", "account", "identity":
+		m.authCache.Invalidate(e.ResourceType, "")
+	}
+}
+
+// apply restarts or stops the running server of a cluster that changed, servers are started by the first request
+// of their cluster
+func (m *Manager) apply(c *client.Cluster) {
+	if rancher.Hosted(c) {
+		if m.shards != nil && !m.shards.Owns(c.Id) {
+			return
+		}
+		if err := m.serverFactory.Ensure(c, drainTimeout); err != nil {
+			logrus.Errorf("Failed to restart server of cluster %s: %v", c.Id, err)
+		}
+		return
+	}
+
+	m.authCache.Forget(c.Id)
+	if _, ok := m.serverFactory.Server(c.Id); ok {
+		logrus.Infof("Cluster %s was removed, stopping its server", c.Id)
+		m.serverFactory.Remove(c.Id, drainTimeout)
+	}
+}
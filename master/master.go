@@ -1,13 +1,47 @@
 package master
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/acmecert"
+	"github.com/rancher/netes/admin"
+	"github.com/rancher/netes/authcache"
+	"github.com/rancher/netes/budget"
 	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/deprecation"
+	"github.com/rancher/netes/drain"
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/export"
+	"github.com/rancher/netes/gc"
+	"github.com/rancher/netes/health"
+	"github.com/rancher/netes/heartbeat"
+	"github.com/rancher/netes/lease"
+	"github.com/rancher/netes/manager"
+	"github.com/rancher/netes/projects"
+	"github.com/rancher/netes/provisioner"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/rbac"
+	"github.com/rancher/netes/replication"
+	"github.com/rancher/netes/rotation"
 	"github.com/rancher/netes/router"
+	"github.com/rancher/netes/rpc"
 	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/shard"
+	"github.com/rancher/netes/sni"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/supervisor"
+	"github.com/rancher/netes/tracing"
+	"github.com/rancher/netes/tunnel"
 	"github.com/rancher/netes/types"
+	"github.com/rancher/netes/usage"
+	"golang.org/x/crypto/acme"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/kubernetes/pkg/capabilities"
 )
 
@@ -18,8 +52,9 @@ func New(c *types.GlobalConfig) *Master {
 }
 
 type Master struct {
-	config        *types.GlobalConfig
-	serverFactory *server.Factory
+	config           *types.GlobalConfig
+	serverFactory    *server.Factory
+	acmeCertificates *acmecert.Manager
 }
 
 func (m *Master) Run() error {
@@ -33,13 +68,227 @@ func (m *Master) Run() error {
 		PerConnectionBandwidthLimitBytesPerSec: 0,
 	})
 
+	if err := setLogLevel(m.config.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level: %v", err)
+	}
+
+	if err := utilfeature.DefaultFeatureGate.Set(strings.Join(m.config.FeatureGates, ",")); err != nil {
+		return fmt.Errorf("invalid feature gates: %v", err)
+	}
+
 	if m.config.Lookup == nil {
-		m.config.Lookup = cluster.NewLookup(m.config.CattleURL + "/clusters")
+		m.config.Lookup = cluster.NewLookup(m.config.CattleURL+"/clusters", m.config.RancherTransport)
+	}
+
+	if m.config.RancherClient == nil {
+		var retry *client.RetryPolicy
+		if m.config.RancherRetryMaxElapsed > 0 {
+			retry = client.DefaultRetryPolicy()
+			retry.MaxElapsedTime = m.config.RancherRetryMaxElapsed
+		}
+		m.config.RancherClient = rancher.New(m.config.CattleURL, m.config.CattleAccessKey, m.config.CattleSecretKey,
+			m.config.RancherTransport, retry)
+	}
+
+	store.Register(m.config)
+
+	specClient, err := store.Client(m.config)
+	if err != nil {
+		return err
+	}
+	m.config.RancherClient.SetCache(specClient)
+
+	// stops the controllers on shutdown so they don't start servers while the running ones are drained
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if m.config.Usage == nil {
+		client, err := store.Client(m.config)
+		if err != nil {
+			return err
+		}
+		m.config.Usage = usage.New(client)
+	}
+	m.config.Usage.Start(ctx)
+
+	if m.config.Deprecations == nil {
+		client, err := store.Client(m.config)
+		if err != nil {
+			return err
+		}
+		m.config.Deprecations = deprecation.New(client)
+	}
+	m.config.Deprecations.Start(ctx)
+
+	if m.config.Replication == nil && m.config.ReplicationSource != "" {
+		client, err := store.Client(m.config)
+		if err != nil {
+			return err
+		}
+		m.config.Replication = replication.New(client, m.config.ReplicationSource, m.config.ReplicationSourceToken,
+			m.config.ReplicationTargets)
+	}
+	if m.config.Replication != nil {
+		if err := m.config.Replication.Start(ctx); err != nil {
+			return err
+		}
+	}
+
+	if m.config.Shards == nil && m.config.ReplicaAddress != "" {
+		client, err := store.Client(m.config)
+		if err != nil {
+			return err
+		}
+		m.config.Shards = shard.New(client, m.config.ReplicaID, m.config.ReplicaAddress, m.config.LeaseDuration)
+	}
+
+	if m.config.Events == nil && len(m.config.EventSinks) > 0 {
+		m.config.Events, err = events.New(m.config.ReplicaID, m.config.EventSinks, m.config.RancherClient.Get)
+		if err != nil {
+			return err
+		}
+	}
+	if m.config.Events != nil {
+		m.config.Events.Start(ctx)
+	}
+
+	if m.config.Tracer == nil && m.config.TracingEndpoint != "" {
+		m.config.Tracer = tracing.New(m.config.TracingEndpoint, m.config.TracingSampleRatio)
+	}
+	if m.config.Tracer != nil {
+		m.config.Tracer.Start(ctx)
+	}
+
+	if m.config.ConfigFile != nil {
+		m.config.ConfigFile.Watch(ctx, m.reload)
+	}
+
+	if m.config.Tunnels == nil {
+		m.config.Tunnels = tunnel.NewServer(m.config.Tracer)
+	}
+
+	if m.config.AuthCache == nil {
+		m.config.AuthCache = authcache.NewInvalidator()
+	}
+
+	if m.config.Budgets == nil {
+		m.config.Budgets = budget.New()
+	}
+
+	if m.config.TLSCertFile != "" {
+		acmeCertificates, err := acmecert.New(m.config)
+		if err != nil {
+			return err
+		}
+		m.acmeCertificates = acmeCertificates
+	} else if m.config.ACMEDirectoryURL != "" {
+		logrus.Warnf("Not obtaining ACME certificates, they are only served when netes terminates TLS")
 	}
 
 	m.serverFactory = server.NewFactory(m.config)
-	r := router.New(m.config)
+	m.config.Budgets.Start(ctx, func(clusterID string) {
+		if err := m.serverFactory.Restart(clusterID, "goroutine budget exceeded", m.config.DrainTimeout); err != nil {
+			logrus.Errorf("Failed to restart server of cluster %s: %v", clusterID, err)
+		}
+	})
+	checker := health.NewChecker(m.config, m.serverFactory)
+	r := router.New(m.config, m.serverFactory, checker)
+
+	manager.New(m.config, m.serverFactory).Start(ctx)
+	rotation.NewController(m.config, m.serverFactory).Start(ctx)
+	supervisor.New(m.config, m.serverFactory, checker).Start(ctx)
+	if err := m.startSingletons(ctx, checker); err != nil {
+		return err
+	}
+	checker.Start(ctx)
+
+	if m.config.AdminListenAddr != "" {
+		go func() {
+			fmt.Println("Admin API listening on", m.config.AdminListenAddr)
+			fmt.Println(http.ListenAndServe(m.config.AdminListenAddr, admin.New(m.config, m.serverFactory, checker)))
+		}()
+	}
+
+	if m.config.AdminGRPCListenAddr != "" {
+		go func() {
+			fmt.Println("Admin gRPC API listening on", m.config.AdminGRPCListenAddr)
+			fmt.Println(rpc.New(m.config, m.serverFactory).ListenAndServe(m.config.AdminGRPCListenAddr))
+		}()
+	}
+
+	server := &http.Server{
+		Addr:    m.config.ListenAddr,
+		Handler: m.config.Tracer.Filter(r),
+		// HTTP/2 can not be upgraded, disable it so exec, attach and port-forward can use SPDY over TLS
+		TLSNextProto: map[string]func(*http.Server, *tls.Conn, http.Handler){},
+	}
+	var getCertificates []func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	if m.config.ClusterCertDir != "" {
+		getCertificates = append(getCertificates, sni.NewCertificates(m.config.ClusterDomain, m.config.ClusterCertDir).GetCertificate)
+	}
+	if m.acmeCertificates != nil {
+		getCertificates = append(getCertificates, m.acmeCertificates.GetCertificate)
+	}
+	server.TLSConfig = &tls.Config{
+		// clusters with client-cert or auth-proxy in their authentication chain verify the certificates
+		ClientAuth: tls.RequestClientCert,
+	}
+	if len(getCertificates) > 0 {
+		server.TLSConfig.GetCertificate = sni.Chain(getCertificates...)
+		// the CA validates the hosts of ACME certificates with TLS-ALPN-01
+		server.TLSConfig.NextProtos = []string{"http/1.1", acme.ALPNProto}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		waitForSignal()
+		cancel()
+		m.shutdown(server, checker)
+		close(stopped)
+	}()
 
 	fmt.Println("Listening on", m.config.ListenAddr)
-	return http.ListenAndServe(m.config.ListenAddr, r)
+	if m.config.TLSCertFile != "" {
+		err = server.ListenAndServeTLS(m.config.TLSCertFile, m.config.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	<-stopped
+	return nil
+}
+
+// startSingletons starts the controllers writing to Rancher and the nodes of the clusters.  Replicas sharing a
+// database without sharing the clusters all run every server, so only the elected leader runs them.
+func (m *Master) startSingletons(ctx context.Context, checker *health.Checker) error {
+	start := func(ctx context.Context) {
+		drain.NewController(m.config, m.serverFactory).Start(ctx)
+		export.NewController(m.config, m.serverFactory).Start(ctx)
+		gc.NewController(m.config, m.serverFactory).Start(ctx)
+		heartbeat.NewController(m.config, m.serverFactory, checker).Start(ctx)
+		if m.acmeCertificates != nil {
+			m.acmeCertificates.Start(ctx)
+		}
+		projects.NewController(m.config, m.serverFactory).Start(ctx)
+		provisioner.NewController(m.config, m.serverFactory).Start(ctx)
+		rbac.NewController(m.config, m.serverFactory).Start(ctx)
+	}
+
+	if !m.config.LeaderElection || m.config.Shards != nil {
+		start(ctx)
+		return nil
+	}
+
+	client, err := store.Client(m.config)
+	if err != nil {
+		return err
+	}
+	go lease.NewElector(client, "/netes/leader/controllers", m.config.ReplicaID, m.config.LeaseDuration).Run(ctx, func(ctx context.Context) error {
+		start(ctx)
+		return nil
+	})
+	return nil
 }
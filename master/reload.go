@@ -0,0 +1,108 @@
+package master
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func setLogLevel(level string) error {
+	if level == "" {
+		level = "info"
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(parsed)
+	return nil
+}
+
+// reload applies the changed settings of the config file, settings removed from it go back to their defaults.
+// Invalid values are logged and keep the current setting, the limits and budgets apply to the servers started
+// afterwards.
+func (m *Master) reload(values map[string]string, changed []string) {
+	c := m.config
+	c.Reloading.Lock()
+	defer c.Reloading.Unlock()
+
+	var restart []string
+	for _, key := range changed {
+		switch key {
+		case "NETES_LOG_LEVEL":
+			if err := setLogLevel(values[key]); err != nil {
+				logrus.Errorf("Ignoring %s of the config file: %v", key, err)
+				continue
+			}
+			c.LogLevel = values[key]
+		case "NETES_TRACING_SAMPLE_RATIO":
+			parseFloat(values, key, "0.01", &c.TracingSampleRatio)
+			c.Tracer.SetSampleRatio(c.TracingSampleRatio)
+		case "NETES_ACCESS_LOG_BY_DEFAULT":
+			c.AccessLogByDefault = values[key] != "false"
+		case "NETES_ACCESS_LOG_SAMPLE_RATIO":
+			parseFloat(values, key, "1", &c.AccessLogSampleRatio)
+		case "NETES_MAX_REQUESTS_INFLIGHT":
+			parseInt(values, key, &c.MaxRequestsInflight)
+		case "NETES_MAX_MUTATING_REQUESTS_INFLIGHT":
+			parseInt(values, key, &c.MaxMutatingRequestsInflight)
+		case "NETES_MIN_REQUEST_TIMEOUT":
+			parseInt(values, key, &c.MinRequestTimeout)
+		case "NETES_REQUEST_QUEUE_TIMEOUT":
+			parseDuration(values, key, "0s", &c.RequestQueueTimeout)
+		case "NETES_MAX_WATCHES_PER_CLUSTER":
+			parseInt(values, key, &c.MaxWatchesPerCluster)
+		case "NETES_MAX_GOROUTINES_PER_CLUSTER":
+			parseInt(values, key, &c.MaxGoroutinesPerCluster)
+		default:
+			restart = append(restart, key)
+		}
+	}
+
+	if len(restart) > 0 {
+		logrus.Warnf("Changes of %s in the config file take a restart of netes", strings.Join(restart, ", "))
+	}
+	logrus.Infof("Reloaded config file, changed %s", strings.Join(changed, ", "))
+}
+
+func parseFloat(values map[string]string, key, def string, f *float64) {
+	value := values[key]
+	if value == "" {
+		value = def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logrus.Errorf("Ignoring invalid number %s=%s of the config file: %v", key, value, err)
+		return
+	}
+	*f = parsed
+}
+
+func parseInt(values map[string]string, key string, i *int64) {
+	value := values[key]
+	if value == "" {
+		*i = 0
+		return
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		logrus.Errorf("Ignoring invalid number %s=%s of the config file: %v", key, value, err)
+		return
+	}
+	*i = parsed
+}
+
+func parseDuration(values map[string]string, key, def string, d *time.Duration) {
+	value := values[key]
+	if value == "" {
+		value = def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.Errorf("Ignoring invalid duration %s=%s of the config file: %v", key, value, err)
+		return
+	}
+	*d = parsed
+}
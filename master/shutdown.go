@@ -0,0 +1,54 @@
+package master
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/k8s-sql"
+	"github.com/rancher/netes/health"
+)
+
+func waitForSignal() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	<-signals
+
+	go func() {
+		<-signals
+		logrus.Warn("Received second signal, exiting without waiting for requests")
+		os.Exit(1)
+	}()
+}
+
+// shutdown fails readiness, stops accepting connections and closes idle ones, then waits for in flight requests
+// including watches and exec sessions before closing the servers of the clusters and the database connections.
+// HTTP/2 is disabled so there are no streams to send GOAWAY on.
+func (m *Master) shutdown(server *http.Server, checker *health.Checker) {
+	logrus.Infof("Shutting down, waiting up to %v for requests to complete", m.config.ShutdownTimeout)
+	checker.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.ShutdownTimeout)
+	defer cancel()
+
+	server.SetKeepAlivesEnabled(false)
+	go func() {
+		if err := server.Shutdown(ctx); err != nil && err != context.DeadlineExceeded {
+			logrus.Errorf("Failed to shut down listener: %v", err)
+		}
+	}()
+
+	m.serverFactory.Shutdown(m.config.ShutdownTimeout)
+	if m.config.Shards != nil {
+		m.config.Shards.Release(context.Background())
+	}
+
+	// the grace period may be over, coalesced writes are still written
+	if err := rdbms.Close(context.Background()); err != nil {
+		logrus.Errorf("Failed to close storage: %v", err)
+	}
+	logrus.Info("Shut down")
+}
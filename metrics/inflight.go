@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+var (
+	activeLock sync.Mutex
+	activeID   int64
+	// the requests being served by the hosted apiservers by cluster
+	active = map[string]map[int64]*ActiveRequest{}
+)
+
+// ActiveRequest is a request a hosted apiserver is serving
+type ActiveRequest struct {
+	Cluster     string    `json:"cluster"`
+	Kind        string    `json:"kind"`
+	Verb        string    `json:"verb"`
+	Resource    string    `json:"resource,omitempty"`
+	Subresource string    `json:"subresource,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Path        string    `json:"path"`
+	User        string    `json:"user,omitempty"`
+	UserAgent   string    `json:"userAgent,omitempty"`
+	Started     time.Time `json:"started"`
+	AgeSeconds  float64   `json:"ageSeconds"`
+}
+
+// ActiveRequests lists the requests being served for a cluster, or for every cluster if clusterID is empty, that
+// are older than minAge, oldest first
+func ActiveRequests(clusterID string, minAge time.Duration) []ActiveRequest {
+	activeLock.Lock()
+	defer activeLock.Unlock()
+
+	now := time.Now()
+	result := []ActiveRequest{}
+	for cluster, requests := range active {
+		if clusterID != "" && cluster != clusterID {
+			continue
+		}
+		for _, r := range requests {
+			age := now.Sub(r.Started)
+			if age < minAge {
+				continue
+			}
+			request := *r
+			request.AgeSeconds = age.Seconds()
+			result = append(result, request)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+	return result
+}
+
+// startRequest records a request being served until the returned func is called
+func startRequest(clusterID, kind string, ctx apirequest.Context, info *apirequest.RequestInfo, path, userAgent string) func() {
+	r := &ActiveRequest{
+		Cluster:     clusterID,
+		Kind:        kind,
+		Verb:        info.Verb,
+		Resource:    info.Resource,
+		Subresource: info.Subresource,
+		Namespace:   info.Namespace,
+		Name:        info.Name,
+		Path:        path,
+		UserAgent:   userAgent,
+		Started:     time.Now(),
+	}
+	if u, ok := apirequest.UserFrom(ctx); ok {
+		r.User = u.GetName()
+	}
+
+	activeLock.Lock()
+	activeID++
+	id := activeID
+	requests, ok := active[clusterID]
+	if !ok {
+		requests = map[int64]*ActiveRequest{}
+		active[clusterID] = requests
+	}
+	requests[id] = r
+	activeLock.Unlock()
+
+	return func() {
+		activeLock.Lock()
+		defer activeLock.Unlock()
+		delete(requests, id)
+		if len(requests) == 0 {
+			delete(active, clusterID)
+		}
+	}
+}
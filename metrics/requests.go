@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+var (
+	nonMutatingRequestVerbs = sets.NewString("get", "list", "watch")
+
+	requestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_apiserver_requests_total",
+		Help: "Number of requests to the hosted apiservers per cluster, verb, resource and response code",
+	}, []string{"cluster", "verb", "resource", "code"})
+	requestHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "netes_apiserver_request_duration_seconds",
+		Help:    "Time to serve requests to the hosted apiservers per cluster, verb and resource, without long running requests",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"cluster", "verb", "resource"})
+	inflightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_apiserver_inflight_requests",
+		Help: "Requests being served by the hosted apiservers per cluster and kind, readonly, mutating or long-running",
+	}, []string{"cluster", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(requestCounter)
+	prometheus.MustRegister(requestHistogram)
+	prometheus.MustRegister(inflightGauge)
+}
+
+// Filter records the requests of a cluster, it must run after the request info is resolved.  The upstream
+// apiserver metrics are shared by all clusters of the process, these are labeled with the cluster.  Requests
+// being served are listed by ActiveRequests.
+func Filter(clusterID string, handler http.Handler, mapper apirequest.RequestContextMapper, longRunning apirequest.LongRunningRequestCheck) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		requestInfo, ok := apirequest.RequestInfoFrom(ctx)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		kind := "mutating"
+		isLongRunning := longRunning != nil && longRunning(req, requestInfo)
+		if isLongRunning {
+			kind = "long-running"
+		} else if nonMutatingRequestVerbs.Has(requestInfo.Verb) {
+			kind = "readonly"
+		}
+
+		inflight := inflightGauge.WithLabelValues(clusterID, kind)
+		inflight.Inc()
+		defer inflight.Dec()
+		defer startRequest(clusterID, kind, ctx, requestInfo, req.URL.Path, req.UserAgent())()
+
+		start := time.Now()
+		delegate := &responseWriterDelegator{ResponseWriter: rw}
+		handler.ServeHTTP(wrap(delegate), req)
+
+		requestCounter.WithLabelValues(clusterID, requestInfo.Verb, requestInfo.Resource, strconv.Itoa(delegate.status())).Inc()
+		if !isLongRunning {
+			requestHistogram.WithLabelValues(clusterID, requestInfo.Verb, requestInfo.Resource).Observe(time.Since(start).Seconds())
+		}
+	})
+}
+
+// wrap keeps the optional interfaces of the response writer, watches need to flush and exec to hijack
+func wrap(delegate *responseWriterDelegator) http.ResponseWriter {
+	_, closeNotifier := delegate.ResponseWriter.(http.CloseNotifier)
+	_, flusher := delegate.ResponseWriter.(http.Flusher)
+	_, hijacker := delegate.ResponseWriter.(http.Hijacker)
+	if closeNotifier && flusher && hijacker {
+		return &fancyResponseWriterDelegator{delegate}
+	}
+	return delegate
+}
+
+type responseWriterDelegator struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (r *responseWriterDelegator) WriteHeader(code int) {
+	r.code = code
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseWriterDelegator) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseWriterDelegator) status() int {
+	if !r.wroteHeader {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+type fancyResponseWriterDelegator struct {
+	*responseWriterDelegator
+}
+
+func (f *fancyResponseWriterDelegator) CloseNotify() <-chan bool {
+	return f.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (f *fancyResponseWriterDelegator) Flush() {
+	f.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (f *fancyResponseWriterDelegator) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return f.ResponseWriter.(http.Hijacker).Hijack()
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/netes/tracing"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+)
+
+var (
+	storageHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "netes_storage_operation_duration_seconds",
+		Help:    "Time of the storage operations of the hosted apiservers per cluster, resource and operation",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"cluster", "resource", "operation"})
+	storageErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_storage_operation_errors_total",
+		Help: "Number of failed storage operations of the hosted apiservers per cluster, resource and operation",
+	}, []string{"cluster", "resource", "operation"})
+)
+
+func init() {
+	prometheus.MustRegister(storageHistogram)
+	prometheus.MustRegister(storageErrorCounter)
+}
+
+// StorageDecorator times the storage operations of a cluster, not found and conflicts count as errors
+func StorageDecorator(clusterID string, decorator generic.StorageDecorator) generic.StorageDecorator {
+	return func(copier runtime.ObjectCopier, config *storagebackend.Config, capacity *int, objectType runtime.Object,
+		resourcePrefix string, keyFunc func(obj runtime.Object) (string, error), newListFunc func() runtime.Object,
+		getAttrsFunc storage.AttrFunc, trigger storage.TriggerPublisherFunc) (storage.Interface, factory.DestroyFunc) {
+		s, destroy := decorator(copier, config, capacity, objectType, resourcePrefix, keyFunc, newListFunc,
+			getAttrsFunc, trigger)
+		return &timedStorage{
+			Interface: s,
+			clusterID: clusterID,
+			resource:  strings.TrimPrefix(resourcePrefix, "/"),
+		}, destroy
+	}
+}
+
+type timedStorage struct {
+	storage.Interface
+	clusterID string
+	resource  string
+}
+
+func (t *timedStorage) observe(ctx context.Context, operation string, start time.Time, err error) {
+	if span := tracing.StartAt(ctx, "storage."+operation, start); span != nil {
+		span.SetAttribute("netes.cluster", t.clusterID)
+		span.SetAttribute("k8s.resource", t.resource)
+		span.End(err)
+	}
+
+	storageHistogram.WithLabelValues(t.clusterID, t.resource, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		storageErrorCounter.WithLabelValues(t.clusterID, t.resource, operation).Inc()
+	}
+}
+
+func (t *timedStorage) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	start := time.Now()
+	err := t.Interface.Create(ctx, key, obj, out, ttl)
+	t.observe(ctx, "create", start, err)
+	return err
+}
+
+func (t *timedStorage) Delete(ctx context.Context, key string, out runtime.Object, preconditions *storage.Preconditions) error {
+	start := time.Now()
+	err := t.Interface.Delete(ctx, key, out, preconditions)
+	t.observe(ctx, "delete", start, err)
+	return err
+}
+
+func (t *timedStorage) Watch(ctx context.Context, key string, resourceVersion string, p storage.SelectionPredicate) (watch.Interface, error) {
+	start := time.Now()
+	w, err := t.Interface.Watch(ctx, key, resourceVersion, p)
+	t.observe(ctx, "watch", start, err)
+	return w, err
+}
+
+func (t *timedStorage) WatchList(ctx context.Context, key string, resourceVersion string, p storage.SelectionPredicate) (watch.Interface, error) {
+	start := time.Now()
+	w, err := t.Interface.WatchList(ctx, key, resourceVersion, p)
+	t.observe(ctx, "watchList", start, err)
+	return w, err
+}
+
+func (t *timedStorage) Get(ctx context.Context, key string, resourceVersion string, objPtr runtime.Object, ignoreNotFound bool) error {
+	start := time.Now()
+	err := t.Interface.Get(ctx, key, resourceVersion, objPtr, ignoreNotFound)
+	t.observe(ctx, "get", start, err)
+	return err
+}
+
+func (t *timedStorage) GetToList(ctx context.Context, key string, resourceVersion string, p storage.SelectionPredicate, listObj runtime.Object) error {
+	start := time.Now()
+	err := t.Interface.GetToList(ctx, key, resourceVersion, p, listObj)
+	t.observe(ctx, "getToList", start, err)
+	return err
+}
+
+func (t *timedStorage) List(ctx context.Context, key string, resourceVersion string, p storage.SelectionPredicate, listObj runtime.Object) error {
+	start := time.Now()
+	err := t.Interface.List(ctx, key, resourceVersion, p, listObj)
+	t.observe(ctx, "list", start, err)
+	return err
+}
+
+func (t *timedStorage) GuaranteedUpdate(ctx context.Context, key string, ptrToType runtime.Object, ignoreNotFound bool,
+	preconditions *storage.Preconditions, tryUpdate storage.UpdateFunc, suggestion ...runtime.Object) error {
+	start := time.Now()
+	err := t.Interface.GuaranteedUpdate(ctx, key, ptrToType, ignoreNotFound, preconditions, tryUpdate, suggestion...)
+	t.observe(ctx, "guaranteedUpdate", start, err)
+	return err
+}
@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rancher/netes/usage"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	// SummaryPath serves the summary of the usage of a cluster to the users of the cluster, like
+	// kubectl get --raw /netes/metrics.  It is authorized like the other non-resource URLs of the cluster.
+	SummaryPath = "/netes/metrics"
+
+	// rates are averaged over summarySlots of summarySlot
+	summarySlot  = 10 * time.Second
+	summarySlots = 30
+	topResources = 10
+)
+
+var (
+	windowsLock sync.Mutex
+	windows     = map[string]*window{}
+)
+
+// Summary is the usage of the control plane of a cluster, it only has what the cluster itself did.  Rates are of
+// the requests this netes served.
+type Summary struct {
+	Cluster                   string            `json:"cluster"`
+	WindowSeconds             int64             `json:"windowSeconds"`
+	RequestsPerSecond         float64           `json:"requestsPerSecond"`
+	MutatingRequestsPerSecond float64           `json:"mutatingRequestsPerSecond"`
+	ErrorsPerSecond           float64           `json:"errorsPerSecond"`
+	Objects                   int64             `json:"objects"`
+	StorageBytes              int64             `json:"storageBytes"`
+	Resources                 []ResourceSummary `json:"resources"`
+}
+
+// ResourceSummary is the usage of a resource of a cluster, objects and bytes are only known for clusters stored
+// in the database of netes and refreshed every few minutes
+type ResourceSummary struct {
+	Resource          string  `json:"resource"`
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Objects           int64   `json:"objects"`
+	StorageBytes      int64   `json:"storageBytes"`
+}
+
+// SummaryFilter counts the requests of a cluster and serves its summary at SummaryPath, it must run after the
+// request info is resolved.  tracker is the storage usage of the cluster, nil if it isn't tracked.
+func SummaryFilter(clusterID string, tracker *usage.Tracker, handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	w := getWindow(clusterID)
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == SummaryPath {
+			if req.Method != http.MethodGet {
+				http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(rw).Encode(w.summary(clusterID, tracker, time.Now()))
+			return
+		}
+
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+		info, ok := apirequest.RequestInfoFrom(ctx)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		delegate := &responseWriterDelegator{ResponseWriter: rw}
+		handler.ServeHTTP(wrap(delegate), req)
+
+		resource := ""
+		if info.IsResourceRequest {
+			groupResource := schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}
+			resource = groupResource.String()
+		}
+		w.record(time.Now(), resource, !nonMutatingRequestVerbs.Has(info.Verb), delegate.status() >= 500)
+	})
+}
+
+func getWindow(clusterID string) *window {
+	windowsLock.Lock()
+	defer windowsLock.Unlock()
+
+	w, ok := windows[clusterID]
+	if !ok {
+		w = &window{}
+		windows[clusterID] = w
+	}
+	return w
+}
+
+// window counts the requests of a cluster in the last summarySlots
+type window struct {
+	sync.Mutex
+	slots [summarySlots]slot
+}
+
+type slot struct {
+	index     int64
+	requests  int64
+	mutating  int64
+	errors    int64
+	resources map[string]int64
+}
+
+func (w *window) record(now time.Time, resource string, mutating, failed bool) {
+	index := now.UnixNano() / int64(summarySlot)
+
+	w.Lock()
+	defer w.Unlock()
+
+	s := &w.slots[index%summarySlots]
+	if s.index != index {
+		*s = slot{
+			index:     index,
+			resources: map[string]int64{},
+		}
+	}
+	s.requests++
+	if mutating {
+		s.mutating++
+	}
+	if failed {
+		s.errors++
+	}
+	if resource != "" {
+		s.resources[resource]++
+	}
+}
+
+func (w *window) summary(clusterID string, tracker *usage.Tracker, now time.Time) *Summary {
+	seconds := (summarySlots * summarySlot).Seconds()
+	oldest := now.UnixNano()/int64(summarySlot) - summarySlots
+
+	result := &Summary{
+		Cluster:       clusterID,
+		WindowSeconds: int64(seconds),
+	}
+	resources := map[string]*ResourceSummary{}
+	resource := func(name string) *ResourceSummary {
+		r, ok := resources[name]
+		if !ok {
+			r = &ResourceSummary{Resource: name}
+			resources[name] = r
+		}
+		return r
+	}
+
+	w.Lock()
+	for _, s := range w.slots {
+		if s.index <= oldest {
+			continue
+		}
+		result.RequestsPerSecond += float64(s.requests) / seconds
+		result.MutatingRequestsPerSecond += float64(s.mutating) / seconds
+		result.ErrorsPerSecond += float64(s.errors) / seconds
+		for name, count := range s.resources {
+			resource(name).RequestsPerSecond += float64(count) / seconds
+		}
+	}
+	w.Unlock()
+
+	if tracker != nil {
+		for _, stored := range tracker.ListCluster(clusterID) {
+			r := resource(stored.Resource)
+			r.Objects += stored.Rows
+			r.StorageBytes += stored.Bytes
+			result.Objects += stored.Rows
+			result.StorageBytes += stored.Bytes
+		}
+	}
+
+	result.Resources = []ResourceSummary{}
+	for _, r := range resources {
+		result.Resources = append(result.Resources, *r)
+	}
+	sort.Slice(result.Resources, func(i, j int) bool {
+		a, b := result.Resources[i], result.Resources[j]
+		if a.RequestsPerSecond != b.RequestsPerSecond {
+			return a.RequestsPerSecond > b.RequestsPerSecond
+		}
+		if a.StorageBytes != b.StorageBytes {
+			return a.StorageBytes > b.StorageBytes
+		}
+		return a.Resource < b.Resource
+	})
+	if len(result.Resources) > topResources {
+		result.Resources = result.Resources[:topResources]
+	}
+	return result
+}
@@ -0,0 +1,244 @@
+package projects
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/rbac"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// NameAnnotation is the name of the project of a namespace, kept up to date when the project is renamed
+	NameAnnotation = "io.rancher.project.name"
+
+	syncInterval = 30 * time.Second
+)
+
+var (
+	invalidNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+	// namespaces of the cluster itself, they are in no project
+	systemNamespaces = map[string]bool{
+		metav1.NamespaceSystem: true,
+		metav1.NamespacePublic: true,
+	}
+)
+
+// Controller keeps the namespaces of the running clusters and the Rancher projects of the clusters consistent,
+// so the quotas and access of projects apply to the right namespaces.  Projects without a namespace get one
+// named after them, namespaces without a project are put in the project owning the cluster and namespaces of
+// projects removed from Rancher are deleted, with NamespaceDeleteWindow to restore them.  Namespaces labeled with
+// a project Rancher doesn't know in the cluster are treated like namespaces without a project.
+type Controller struct {
+	config        *types.GlobalConfig
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		config:        config,
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	if !c.config.ProjectNamespaces {
+		return
+	}
+	go wait.Until(c.sync, syncInterval, ctx.Done())
+}
+
+func (c *Controller) sync() {
+	rancherClient, err := c.rancher.Get()
+	if err != nil {
+		logrus.Errorf("Failed to connect to Rancher for project namespace sync: %v", err)
+		return
+	}
+
+	for _, s := range c.serverFactory.Servers() {
+		if err := c.reconcile(rancherClient, s); err != nil {
+			logrus.Errorf("Failed to sync project namespaces of cluster %s: %v", s.Cluster().Id, err)
+		}
+	}
+}
+
+func (c *Controller) reconcile(rancherClient *client.RancherClient, s server.Server) error {
+	clusterID := s.Cluster().Id
+	k8sClient := s.Clients().Client
+
+	list, err := rancherClient.Project.List(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"clusterId": clusterID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	projects := map[string]*client.Project{}
+	var owner *client.Project
+	for i := range list.Data {
+		project := &list.Data[i]
+		if !active(project) {
+			continue
+		}
+		projects[project.Id] = project
+		if project.ClusterOwner && owner == nil {
+			owner = project
+		}
+	}
+
+	namespaces, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]*v1.Namespace{}
+	hasNamespace := map[string]bool{}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+		byName[ns.Name] = ns
+		if systemNamespaces[ns.Name] || ns.DeletionTimestamp != nil {
+			continue
+		}
+
+		projectID := ns.Labels[rbac.ProjectLabel]
+		if projectID == "" {
+			if owner == nil {
+				continue
+			}
+			projectID = owner.Id
+		} else if _, ok := projects[projectID]; !ok {
+			removed, err := c.removed(rancherClient, clusterID, projectID)
+			if err != nil {
+				return err
+			}
+			if removed {
+				logrus.Infof("Deleting namespace %s of cluster %s, its project %s was removed", ns.Name, clusterID,
+					projectID)
+				if err := k8sClient.CoreV1().Namespaces().Delete(ns.Name, &metav1.DeleteOptions{}); err != nil &&
+					!errors.IsNotFound(err) {
+					return err
+				}
+				continue
+			}
+			logrus.Warnf("Namespace %s of cluster %s is labeled with project %s which is not a project of the cluster",
+				ns.Name, clusterID, projectID)
+			projectID = ""
+			if owner != nil {
+				projectID = owner.Id
+			}
+		}
+
+		hasNamespace[projectID] = true
+		if err := label(k8sClient, ns, projects[projectID]); err != nil {
+			return err
+		}
+	}
+
+	for id, project := range projects {
+		if hasNamespace[id] {
+			continue
+		}
+		name := namespaceName(project)
+		if ns, ok := byName[name]; ok && ns.Labels[rbac.ProjectLabel] != id {
+			name += "-" + strings.ToLower(project.Id)
+		}
+		if _, ok := byName[name]; ok {
+			continue
+		}
+
+		logrus.Infof("Creating namespace %s of cluster %s for project %s", name, clusterID, id)
+		_, err := k8sClient.CoreV1().Namespaces().Create(&v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					rbac.ProjectLabel: id,
+				},
+				Annotations: map[string]string{
+					NameAnnotation: project.Name,
+				},
+			},
+		})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removed is whether a project was removed from the cluster in Rancher.  Projects Rancher never heard of, or
+// of other clusters, are not removed, their label is wrong.
+func (c *Controller) removed(rancherClient *client.RancherClient, clusterID, projectID string) (bool, error) {
+	project, err := rancherClient.Project.ById(projectID)
+	if err != nil {
+		return false, err
+	}
+	return project != nil && project.ClusterId == clusterID && !active(project), nil
+}
+
+// label puts a namespace in a project, or out of any project if project is nil
+func label(k8sClient kubernetes.Interface, ns *v1.Namespace, project *client.Project) error {
+	projectID, name := "", ""
+	if project != nil {
+		projectID, name = project.Id, project.Name
+	}
+	if ns.Labels[rbac.ProjectLabel] == projectID && ns.Annotations[NameAnnotation] == name {
+		return nil
+	}
+
+	updated := *ns
+	updated.Labels = copyMap(ns.Labels)
+	updated.Annotations = copyMap(ns.Annotations)
+	if projectID == "" {
+		delete(updated.Labels, rbac.ProjectLabel)
+		delete(updated.Annotations, NameAnnotation)
+	} else {
+		updated.Labels[rbac.ProjectLabel] = projectID
+		updated.Annotations[NameAnnotation] = name
+	}
+	_, err := k8sClient.CoreV1().Namespaces().Update(&updated)
+	if errors.IsConflict(err) || errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func copyMap(m map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+func active(project *client.Project) bool {
+	return project.Removed == "" && project.State != "removing" && project.State != "removed" &&
+		project.State != "purging" && project.State != "purged"
+}
+
+// namespaceName is the project name as a DNS label, or the project id if nothing of the name is left
+func namespaceName(project *client.Project) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(project.Name), "-"), "-")
+	if len(name) > 40 {
+		name = strings.TrimRight(name[:40], "-")
+	}
+	if name == "" {
+		return strings.ToLower(project.Id)
+	}
+	return name
+}
@@ -0,0 +1,95 @@
+package provisioner
+
+import (
+	"fmt"
+	"path"
+
+	volumeclient "github.com/libopenstorage/openstorage/api/client/volume"
+	osdvolume "github.com/libopenstorage/openstorage/volume"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// Parameters of a StorageClass netes handles itself, the others are openstorage volume options
+	paramDriver    = "driver"
+	paramEndpoint  = "endpoint"
+	paramNFSServer = "nfsServer"
+	paramNFSPath   = "nfsPath"
+
+	// The driver, endpoint and volume a persistent volume was created with, so it is deleted with the same
+	// driver after its class changed or went away
+	annDriver   = "openstorage.netes.rancher.io/driver"
+	annEndpoint = "openstorage.netes.rancher.io/endpoint"
+	annVolumeID = "openstorage.netes.rancher.io/volume-id"
+
+	driverNFS = "nfs"
+	driverPXD = "pxd"
+)
+
+// driverKey is an openstorage driver at an endpoint, empty is the unix socket of the driver on the netes host
+type driverKey struct {
+	name     string
+	endpoint string
+}
+
+// drivers are the clients of the openstorage drivers a cluster uses, created as claims need them
+type drivers map[driverKey]osdvolume.VolumeDriver
+
+func (d drivers) get(key driverKey) (osdvolume.VolumeDriver, error) {
+	if driver, ok := d[key]; ok {
+		return driver, nil
+	}
+	osdClient, err := volumeclient.NewDriverClient(key.endpoint, key.name, driverVersion)
+	if err != nil {
+		return nil, err
+	}
+	driver := volumeclient.VolumeDriver(osdClient)
+	d[key] = driver
+	return driver, nil
+}
+
+// volumeOptions are the parameters of a class without the ones of netes
+func volumeOptions(parameters map[string]string) map[string]string {
+	options := map[string]string{}
+	for k, v := range parameters {
+		switch k {
+		case paramDriver, paramEndpoint, paramNFSServer, paramNFSPath:
+		default:
+			options[k] = v
+		}
+	}
+	return options
+}
+
+// validate checks that kubelets can mount volumes of a driver without an openstorage of their own for it before
+// a volume is created.  Volumes of drivers like buse only exist on the openstorage host.
+func validate(driver string, parameters map[string]string) error {
+	switch driver {
+	case driverNFS:
+		if parameters[paramNFSServer] == "" || parameters[paramNFSPath] == "" {
+			return fmt.Errorf("class parameters %s and %s of the nfs export are required", paramNFSServer, paramNFSPath)
+		}
+		return nil
+	case driverPXD:
+		return nil
+	}
+	return fmt.Errorf("volumes of openstorage driver %s can't be mounted by kubelets", driver)
+}
+
+// volumeSource is how kubelets mount a volume, volumes of the nfs driver are directories of its export and pxd
+// volumes are mounted by the Portworx plugin of kubelets
+func volumeSource(driver string, parameters map[string]string, volumeID string) v1.PersistentVolumeSource {
+	if driver == driverNFS {
+		return v1.PersistentVolumeSource{
+			NFS: &v1.NFSVolumeSource{
+				Server: parameters[paramNFSServer],
+				Path:   path.Join(parameters[paramNFSPath], volumeID),
+			},
+		}
+	}
+	return v1.PersistentVolumeSource{
+		PortworxVolume: &v1.PortworxVolumeSource{
+			VolumeID: volumeID,
+		},
+	}
+}
@@ -0,0 +1,330 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	osdapi "github.com/libopenstorage/openstorage/api"
+	osdspec "github.com/libopenstorage/openstorage/api/spec"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	storagev1 "k8s.io/client-go/pkg/apis/storage/v1"
+)
+
+const (
+	// Name is the provisioner of the StorageClass netes installs, the claims of the class are left to it by the
+	// persistent volume controller
+	Name             = "netes.rancher.io/openstorage"
+	StorageClassName = "openstorage"
+
+	annStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
+	annProvisionedBy      = "pv.kubernetes.io/provisioned-by"
+	annDefaultClass       = "storageclass.beta.kubernetes.io/is-default-class"
+	// the claim a volume was created for, so volumes can be found again
+	claimLabel = "pvc"
+
+	driverVersion = "v1"
+	syncInterval  = 15 * time.Second
+	gib           = 1024 * 1024 * 1024
+)
+
+// Controller provisions the persistent volumes of clusters with openstorage enabled.  The clusters get a default
+// StorageClass of the provisioner, claims of it are fulfilled with volumes created through the openstorage
+// volume API and bound to the claim as volumes kubelets mount themselves, like NFS, so clusters get dynamic
+// storage without a provisioner of their own.  Volumes of released claims are deleted unless their reclaim
+// policy was changed to Retain.
+type Controller struct {
+	config        *types.GlobalConfig
+	serverFactory *server.Factory
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		config:        config,
+		serverFactory: serverFactory,
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	go wait.Until(c.sync, syncInterval, ctx.Done())
+}
+
+// Enabled is whether volumes of a cluster are provisioned.  It is enabled or disabled in Rancher with "true" or
+// "false", clusters without either follow the global default.
+func Enabled(config *types.GlobalConfig, cluster *client.Cluster) bool {
+	switch cluster.K8sServerConfig.OpenStorage {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return config.OpenStorageByDefault
+}
+
+func (c *Controller) sync() {
+	for _, s := range c.serverFactory.Servers() {
+		if !Enabled(c.config, s.Cluster()) {
+			continue
+		}
+		if err := c.reconcile(s); err != nil {
+			logrus.Errorf("Failed to provision volumes of cluster %s: %v", s.Cluster().Id, err)
+		}
+	}
+}
+
+func (c *Controller) reconcile(s server.Server) error {
+	cluster := s.Cluster()
+	k8sClient := s.Clients().Client
+
+	if err := ensureStorageClass(k8sClient); err != nil {
+		return err
+	}
+
+	p := &provisioner{
+		clusterID:     cluster.Id,
+		k8sClient:     k8sClient,
+		drivers:       drivers{},
+		defaultDriver: c.config.OpenStorageDriver,
+		endpoint:      types.FirstNotEmpty(cluster.K8sServerConfig.OpenStorageEndpoint, c.config.OpenStorageEndpoint),
+	}
+
+	claims, err := k8sClient.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if claim.Status.Phase != v1.ClaimPending || claim.Spec.VolumeName != "" ||
+			claim.Annotations[annStorageProvisioner] != Name {
+			continue
+		}
+		if err := p.provision(claim); err != nil {
+			logrus.Errorf("Failed to provision volume of claim %s/%s of cluster %s: %v", claim.Namespace, claim.Name,
+				cluster.Id, err)
+			p.event(claim, err)
+		}
+	}
+
+	volumes, err := k8sClient.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range volumes.Items {
+		pv := &volumes.Items[i]
+		if pv.Annotations[annProvisionedBy] != Name || pv.Status.Phase != v1.VolumeReleased ||
+			pv.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimDelete {
+			continue
+		}
+		if err := p.delete(pv); err != nil {
+			logrus.Errorf("Failed to delete volume %s of cluster %s: %v", pv.Name, cluster.Id, err)
+		}
+	}
+	return nil
+}
+
+// ensureStorageClass installs the StorageClass of the provisioner, it is the default unless the cluster already
+// has one
+func ensureStorageClass(k8sClient kubernetes.Interface) error {
+	classes, err := k8sClient.StorageV1().StorageClasses().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	hasDefault := false
+	for _, class := range classes.Items {
+		if class.Name == StorageClassName {
+			return nil
+		}
+		if class.Annotations[annDefaultClass] == "true" {
+			hasDefault = true
+		}
+	}
+
+	class := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: StorageClassName,
+		},
+		Provisioner: Name,
+	}
+	if !hasDefault {
+		class.Annotations = map[string]string{
+			annDefaultClass: "true",
+		}
+	}
+	_, err = k8sClient.StorageV1().StorageClasses().Create(class)
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+type provisioner struct {
+	clusterID     string
+	k8sClient     kubernetes.Interface
+	drivers       drivers
+	defaultDriver string
+	endpoint      string
+}
+
+// provision creates a volume of the size the claim requests, rounded up to GiB, with the parameters of its class
+// as openstorage volume options like repl or io_priority.  Classes pick the openstorage driver and its endpoint
+// with the driver and endpoint parameters, the nfs driver also needs the nfsServer and nfsPath of its export.
+func (p *provisioner) provision(claim *v1.PersistentVolumeClaim) error {
+	// the volume controller hasn't bound the volume of a previous sync yet
+	name := "pvc-" + string(claim.UID)
+	if _, err := p.k8sClient.CoreV1().PersistentVolumes().Get(name, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	className := claimClass(claim)
+	class, err := p.k8sClient.StorageV1().StorageClasses().Get(className, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	key := driverKey{
+		name:     types.FirstNotEmpty(class.Parameters[paramDriver], p.defaultDriver),
+		endpoint: types.FirstNotEmpty(class.Parameters[paramEndpoint], p.endpoint),
+	}
+	if err := validate(key.name, class.Parameters); err != nil {
+		return err
+	}
+	driver, err := p.drivers.get(key)
+	if err != nil {
+		return err
+	}
+
+	capacity := claim.Spec.Resources.Requests[v1.ResourceStorage]
+	size := (capacity.Value() + gib - 1) / gib
+	spec, err := osdspec.NewSpecHandler().SpecFromOpts(volumeOptions(class.Parameters))
+	if err != nil {
+		return err
+	}
+	spec.Size = uint64(size * gib)
+
+	volumeID, err := driver.Create(&osdapi.VolumeLocator{
+		Name: name,
+		VolumeLabels: map[string]string{
+			claimLabel: claim.Name,
+		},
+	}, &osdapi.Source{}, spec)
+	if err != nil {
+		return err
+	}
+
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				annProvisionedBy: Name,
+				annDriver:        key.name,
+				annEndpoint:      key.endpoint,
+				annVolumeID:      volumeID,
+			},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: resource.MustParse(fmt.Sprintf("%dGi", size)),
+			},
+			AccessModes:                   claim.Spec.AccessModes,
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimDelete,
+			StorageClassName:              className,
+			ClaimRef: &v1.ObjectReference{
+				Kind:            "PersistentVolumeClaim",
+				APIVersion:      "v1",
+				Namespace:       claim.Namespace,
+				Name:            claim.Name,
+				UID:             claim.UID,
+				ResourceVersion: claim.ResourceVersion,
+			},
+			PersistentVolumeSource: volumeSource(key.name, class.Parameters, volumeID),
+		},
+	}
+	if _, err := p.k8sClient.CoreV1().PersistentVolumes().Create(pv); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	logrus.Infof("Provisioned volume %s of %dGi for claim %s/%s of cluster %s", volumeID, size, claim.Namespace,
+		claim.Name, p.clusterID)
+	return nil
+}
+
+// delete deletes the volume with the driver it was created with, volumes from before the driver annotations
+// are pxd volumes of the default driver
+func (p *provisioner) delete(pv *v1.PersistentVolume) error {
+	volumeID := pv.Annotations[annVolumeID]
+	if volumeID == "" && pv.Spec.PortworxVolume != nil {
+		volumeID = pv.Spec.PortworxVolume.VolumeID
+	}
+	if volumeID != "" {
+		driver, err := p.drivers.get(driverKey{
+			name:     types.FirstNotEmpty(pv.Annotations[annDriver], p.defaultDriver),
+			endpoint: types.FirstNotEmpty(pv.Annotations[annEndpoint], p.endpoint),
+		})
+		if err != nil {
+			return err
+		}
+		if err := driver.Delete(volumeID); err != nil {
+			return err
+		}
+	}
+
+	err := p.k8sClient.CoreV1().PersistentVolumes().Delete(pv.Name, &metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	logrus.Infof("Deleted volume %s of cluster %s", pv.Name, p.clusterID)
+	return nil
+}
+
+// event tells the owner of the claim why it stays pending, like upstream provisioners do
+func (p *provisioner) event(claim *v1.PersistentVolumeClaim, err error) {
+	now := metav1.Now()
+	_, eventErr := p.k8sClient.CoreV1().Events(claim.Namespace).Create(&v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: claim.Name + "-",
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:            "PersistentVolumeClaim",
+			APIVersion:      "v1",
+			Namespace:       claim.Namespace,
+			Name:            claim.Name,
+			UID:             claim.UID,
+			ResourceVersion: claim.ResourceVersion,
+		},
+		Reason:         "ProvisioningFailed",
+		Message:        fmt.Sprintf("Failed to provision volume with StorageClass %q: %v", claimClass(claim), err),
+		Source:         v1.EventSource{Component: Name},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           v1.EventTypeWarning,
+	})
+	if eventErr != nil {
+		logrus.Warnf("Failed to record provisioning event of claim %s/%s in cluster %s: %v", claim.Namespace,
+			claim.Name, p.clusterID, eventErr)
+	}
+}
+
+func claimClass(claim *v1.PersistentVolumeClaim) string {
+	if class, ok := claim.Annotations[v1.BetaStorageClassAnnotation]; ok {
+		return class
+	}
+	if claim.Spec.StorageClassName != nil {
+		return *claim.Spec.StorageClassName
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/types"
+)
+
+const (
+	egressDialTimeout = 30 * time.Second
+
+	// EgressTunnel dials through the tunnels of the node agents and through Rancher when no agent is connected
+	EgressTunnel = "tunnel"
+	// EgressRancher dials through Rancher only
+	EgressRancher = "rancher"
+	// EgressDirect dials from the netes host, for clusters whose nodes it can reach
+	EgressDirect = "direct"
+	// EgressHTTPConnect dials through an HTTP CONNECT proxy like the konnectivity server, at an address like
+	// http://konnectivity:8131, https://konnectivity:8131 or unix:///var/run/konnectivity.sock
+	EgressHTTPConnect = "http-connect"
+)
+
+// Dialer opens connections from the control plane of a cluster to its nodes and services
+type Dialer func(network, addr string) (net.Conn, error)
+
+// Egress returns the dialer of a cluster, address is the egress address of the cluster, its meaning is up to
+// the egress
+type Egress func(config *types.GlobalConfig, cluster *client.Cluster, address string) (Dialer, error)
+
+var (
+	egressesLock sync.Mutex
+	egresses     = map[string]Egress{
+		EgressTunnel:      tunnelEgress,
+		EgressRancher:     rancherEgress,
+		EgressDirect:      directEgress,
+		EgressHTTPConnect: httpConnectEgress,
+	}
+)
+
+// RegisterEgress makes an egress available to clusters by name
+func RegisterEgress(name string, egress Egress) {
+	egressesLock.Lock()
+	defer egressesLock.Unlock()
+	egresses[name] = egress
+}
+
+func getEgress(name string) (Egress, bool) {
+	egressesLock.Lock()
+	defer egressesLock.Unlock()
+	e, ok := egresses[name]
+	return e, ok
+}
+
+// ClusterDialer dials the webhooks, kubelets, aggregated APIs and services of cluster through the egress of the
+// cluster set in Rancher, or the global one.  The default egress is the tunnels of the node agents with Rancher
+// as fallback.
+func ClusterDialer(config *types.GlobalConfig, cluster *client.Cluster) (Dialer, error) {
+	name, address := config.Egress, config.EgressAddress
+	if cluster.K8sServerConfig != nil && cluster.K8sServerConfig.Egress != "" {
+		name, address = cluster.K8sServerConfig.Egress, cluster.K8sServerConfig.EgressAddress
+	}
+	if name == "" {
+		name = EgressTunnel
+	}
+
+	egress, ok := getEgress(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown egress %s of cluster %s", name, cluster.Id)
+	}
+	dialer, err := egress(config, cluster, address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress %s of cluster %s: %v", name, cluster.Id, err)
+	}
+	return dialer, nil
+}
+
+func rancherEgress(config *types.GlobalConfig, cluster *client.Cluster, address string) (Dialer, error) {
+	return NewDialer(cluster, config.CattleAccessKey, config.CattleSecretKey, config.RancherTransport), nil
+}
+
+func tunnelEgress(config *types.GlobalConfig, cluster *client.Cluster, address string) (Dialer, error) {
+	dialer := NewDialer(cluster, config.CattleAccessKey, config.CattleSecretKey, config.RancherTransport)
+	if config.Tunnels == nil {
+		return dialer, nil
+	}
+	return config.Tunnels.Dialer(cluster.Id, dialer), nil
+}
+
+func directEgress(config *types.GlobalConfig, cluster *client.Cluster, address string) (Dialer, error) {
+	d := &net.Dialer{Timeout: egressDialTimeout}
+	return d.Dial, nil
+}
+
+func httpConnectEgress(config *types.GlobalConfig, cluster *client.Cluster, address string) (Dialer, error) {
+	proxyURL, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var dial func() (net.Conn, error)
+	d := &net.Dialer{Timeout: egressDialTimeout}
+	switch proxyURL.Scheme {
+	case "http":
+		dial = func() (net.Conn, error) {
+			return d.Dial("tcp", proxyURL.Host)
+		}
+	case "https":
+		tlsConfig := &tls.Config{ServerName: proxyURL.Hostname()}
+		dial = func() (net.Conn, error) {
+			return tls.DialWithDialer(d, "tcp", proxyURL.Host, tlsConfig)
+		}
+	case "unix":
+		dial = func() (net.Conn, error) {
+			return d.Dial("unix", proxyURL.Path)
+		}
+	default:
+		return nil, fmt.Errorf("expected an http, https or unix proxy address, got %q", address)
+	}
+
+	return func(network, addr string) (net.Conn, error) {
+		if network != "tcp" {
+			return nil, fmt.Errorf("can't dial %s through an HTTP CONNECT proxy", network)
+		}
+		conn, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		if err := connect(conn, cluster.Id, addr); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}, nil
+}
+
+// connect asks the proxy on conn to connect to addr, the cluster is passed along so one proxy can serve the
+// clusters of several tenants
+func connect(conn net.Conn, clusterID, addr string) error {
+	conn.SetDeadline(time.Now().Add(egressDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{
+			"X-Netes-Cluster": []string{clusterID},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// the proxy sends nothing after its response before the client speaks, nothing past it is buffered
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+	return nil
+}
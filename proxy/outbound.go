@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// OutboundTransport is the transport of the calls made on behalf of a cluster to services outside of it, like its
+// authentication, audit and image verification webhooks and its OIDC issuer.  Unlike the egress they don't go to
+// the nodes of the cluster but through the outbound proxy of the cluster set in Rancher, or the global one, and
+// trust the outbound CAs of the cluster next to the system ones.  Without a proxy the proxy environment variables
+// of netes apply.
+func OutboundTransport(config *types.GlobalConfig, cluster *client.Cluster) (*http.Transport, error) {
+	return OutboundTLSTransport(config, cluster, nil)
+}
+
+// OutboundWebhook returns a client of a webhook like upstream does from a kubeconfig file, its requests are sent
+// to the server of the kubeconfig as is, through the outbound transport of the cluster.  The CA of the kubeconfig
+// is trusted with the outbound CAs.
+func OutboundWebhook(config *types.GlobalConfig, cluster *client.Cluster, kubeconfig []byte, codec runtime.Codec) (*rest.RESTClient, error) {
+	raw, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := clientcmd.NewDefaultClientConfig(*raw, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := rest.TLSConfigFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := OutboundTLSTransport(config, cluster, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	// the TLS options are in the transport, the credentials are still added by the client
+	restConfig.TLSClientConfig = rest.TLSClientConfig{}
+	restConfig.Transport = transport
+
+	restConfig.ContentConfig.NegotiatedSerializer = serializer.NegotiatedSerializerWrapper(runtime.SerializerInfo{Serializer: codec})
+	return rest.UnversionedRESTClientFor(restConfig)
+}
+
+// OutboundTLSTransport is OutboundTransport with the TLS config of the service called, the outbound CAs are trusted
+// next to the CAs of the config, or the system ones if it has none
+func OutboundTLSTransport(config *types.GlobalConfig, cluster *client.Cluster, tlsConfig *tls.Config) (*http.Transport, error) {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+
+	caPEM, err := outboundCAs(config, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(caPEM) > 0 {
+		if tlsConfig.RootCAs == nil {
+			if tlsConfig.RootCAs, err = x509.SystemCertPool(); err != nil {
+				tlsConfig.RootCAs = x509.NewCertPool()
+			}
+		}
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("invalid outbound CAs of cluster %s: no certificates found", cluster.Id)
+		}
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	if address := types.FirstNotEmpty(cluster.K8sServerConfig.OutboundProxy, config.OutboundProxy); address != "" {
+		proxyURL, err := url.Parse(address)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid outbound proxy %q of cluster %s", address, cluster.Id)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return utilnet.SetTransportDefaults(transport), nil
+}
+
+// outboundCAs is the CA bundle of the cluster set in Rancher, or the global one
+func outboundCAs(config *types.GlobalConfig, cluster *client.Cluster) ([]byte, error) {
+	if cluster.K8sServerConfig.OutboundCa != "" {
+		return []byte(cluster.K8sServerConfig.OutboundCa), nil
+	}
+	if config.OutboundCAFile != "" {
+		return ioutil.ReadFile(config.OutboundCAFile)
+	}
+	return nil, nil
+}
@@ -25,27 +25,34 @@ const (
 	callbackHost = "localhost:8080"
 )
 
-func NewDialer(cluster *client.Cluster, accessKey, secretKey string) func(network, addr string) (net.Conn, error) {
+func NewDialer(cluster *client.Cluster, accessKey, secretKey string, transport http.RoundTripper) func(network, addr string) (net.Conn, error) {
 	d := &dialer{
 		clusterID: cluster.Id,
 		accessKey: accessKey,
 		secretKey: secretKey,
+		httpClient: &http.Client{
+			Transport: transport,
+		},
 	}
 	return d.Dial
 }
 
 type dialer struct {
-	clusterID string
-	accessKey string
-	secretKey string
+	clusterID  string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
 }
 
 func (p *dialer) Dial(network, addr string) (net.Conn, error) {
 	conn, err := p.openConnection(network, addr)
+	if err != nil {
+		return nil, err
+	}
 	return &wsConn{
 		Conn: conn,
 		conn: &WebSocketIO{conn},
-	}, err
+	}, nil
 }
 
 func (p *dialer) openConnection(network, addr string) (*websocket.Conn, error) {
@@ -65,7 +72,7 @@ func (p *dialer) openConnection(network, addr string) (*websocket.Conn, error) {
 	}
 	req.SetBasicAuth(p.accessKey, p.secretKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
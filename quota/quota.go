@@ -0,0 +1,172 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
+)
+
+const (
+	quotaPrefix   = "/netes/quotas/accounts/"
+	accountPrefix = "/netes/quotas/clusters/"
+)
+
+// Quota limits the clusters an account creates through the admin APIs and what they store, zero is no limit.
+// Objects and StorageBytes are only enforced when storage usage is tracked.
+type Quota struct {
+	Account      string `json:"account"`
+	Clusters     int64  `json:"clusters,omitempty"`
+	Objects      int64  `json:"objects,omitempty"`
+	StorageBytes int64  `json:"storageBytes,omitempty"`
+}
+
+// Usage is what the running clusters of an account use of its quota
+type Usage struct {
+	Clusters     int64 `json:"clusters"`
+	Objects      int64 `json:"objects"`
+	StorageBytes int64 `json:"storageBytes"`
+}
+
+// ExceededError is returned for clusters of an account that used up its quota
+type ExceededError struct {
+	Account  string
+	Resource string
+	Limit    int64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("Account %s has reached its quota of %d %s", e.Account, e.Limit, e.Resource)
+}
+
+// Get returns the quota of an account, nil if it has none
+func Get(ctx context.Context, kvClient kv.Client, account string) (*Quota, error) {
+	value, err := kvClient.Get(ctx, quotaPrefix+account)
+	if err == kv.ErrNotExists {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	q := &Quota{}
+	return q, json.Unmarshal(value.Value, q)
+}
+
+func List(ctx context.Context, kvClient kv.Client) ([]*Quota, error) {
+	values, err := kvClient.List(ctx, quotaPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var quotas []*Quota
+	for _, value := range values {
+		q := &Quota{}
+		if err := json.Unmarshal(value.Value, q); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].Account < quotas[j].Account
+	})
+	return quotas, nil
+}
+
+func Set(ctx context.Context, kvClient kv.Client, q *Quota) error {
+	value, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+
+	existing, err := kvClient.Get(ctx, quotaPrefix+q.Account)
+	if err == kv.ErrNotExists {
+		_, err = kvClient.Create(ctx, quotaPrefix+q.Account, value, 0)
+		return err
+	} else if err != nil {
+		return err
+	}
+	_, err = kvClient.UpdateOrCreate(ctx, quotaPrefix+q.Account, value, existing.Revision, 0)
+	return err
+}
+
+func Delete(ctx context.Context, kvClient kv.Client, account string) error {
+	_, err := kvClient.Delete(ctx, quotaPrefix+account)
+	if err == kv.ErrNotExists {
+		return nil
+	}
+	return err
+}
+
+// SetAccount records the account a cluster was created for
+func SetAccount(ctx context.Context, kvClient kv.Client, clusterID, account string) error {
+	_, err := kvClient.Create(ctx, accountPrefix+clusterID, []byte(account), 0)
+	return err
+}
+
+// DeleteAccount forgets the account of a removed cluster
+func DeleteAccount(ctx context.Context, kvClient kv.Client, clusterID string) error {
+	_, err := kvClient.Delete(ctx, accountPrefix+clusterID)
+	if err == kv.ErrNotExists {
+		return nil
+	}
+	return err
+}
+
+// Used adds up the clusters of an account that Rancher still has and what they store
+func Used(ctx context.Context, config *types.GlobalConfig, kvClient kv.Client, account string) (Usage, error) {
+	var used Usage
+
+	values, err := kvClient.List(ctx, accountPrefix)
+	if err != nil {
+		return used, err
+	}
+	clusters, err := config.RancherClient.Clusters()
+	if err != nil {
+		return used, err
+	}
+
+	owned := map[string]bool{}
+	for _, value := range values {
+		clusterID := strings.TrimPrefix(value.Key, accountPrefix)
+		if string(value.Value) == account && clusters[clusterID] != nil {
+			owned[clusterID] = true
+		}
+	}
+	used.Clusters = int64(len(owned))
+
+	if config.Usage != nil {
+		for _, resource := range config.Usage.List() {
+			if owned[resource.Cluster] {
+				used.Objects += resource.Rows
+				used.StorageBytes += resource.Bytes
+			}
+		}
+	}
+	return used, nil
+}
+
+// Check returns an ExceededError if the account can't have another cluster
+func Check(ctx context.Context, config *types.GlobalConfig, kvClient kv.Client, account string) error {
+	q, err := Get(ctx, kvClient, account)
+	if err != nil || q == nil {
+		return err
+	}
+
+	used, err := Used(ctx, config, kvClient, account)
+	if err != nil {
+		return err
+	}
+	switch {
+	case q.Clusters > 0 && used.Clusters >= q.Clusters:
+		return &ExceededError{Account: account, Resource: "clusters", Limit: q.Clusters}
+	case q.Objects > 0 && used.Objects >= q.Objects:
+		return &ExceededError{Account: account, Resource: "objects", Limit: q.Objects}
+	case q.StorageBytes > 0 && used.StorageBytes >= q.StorageBytes:
+		return &ExceededError{Account: account, Resource: "bytes of storage", Limit: q.StorageBytes}
+	}
+	return nil
+}
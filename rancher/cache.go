@@ -0,0 +1,253 @@
+package rancher
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+)
+
+// specPrefix is where the last known specs of the hosted clusters are kept, the replicas sharing the database all
+// see the same clusters in Rancher
+const specPrefix = "/netes/rancher/clusters/"
+
+// statusUpdate is a k8sServerStatus of a cluster waiting for Rancher to be reachable again
+type statusUpdate struct {
+	cluster *client.Cluster
+	status  map[string]interface{}
+}
+
+// Unreachable is whether err means Rancher could not answer, because it or the network to it is down or
+// overloaded, rather than it refusing the request
+func Unreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apiErr, ok := errors.Cause(err).(*client.ApiError); ok {
+		return apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+// SetCache keeps the specs of the hosted clusters in the database, so their servers keep running, and start after
+// a restart, with the last known specs while Rancher is unreachable
+func (c *Client) SetCache(kvClient kv.Client) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	c.cache = kvClient
+}
+
+// Reachable is whether Rancher answered the last request
+func (c *Client) Reachable() bool {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return !c.offline
+}
+
+// CachedCluster returns the last known spec of a hosted cluster, nil if it isn't cached
+func (c *Client) CachedCluster(id string) (*client.Cluster, error) {
+	kvClient := c.kvClient()
+	if kvClient == nil {
+		return nil, nil
+	}
+
+	current, err := kvClient.Get(context.Background(), specPrefix+id)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cluster := &client.Cluster{}
+	if err := json.Unmarshal(current.Value, cluster); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (c *Client) cachedClusters() map[string]*client.Cluster {
+	kvClient := c.kvClient()
+	if kvClient == nil {
+		return nil
+	}
+
+	list, err := kvClient.List(context.Background(), specPrefix)
+	if err != nil {
+		logrus.Errorf("Failed to read the cached cluster specs: %v", err)
+		return nil
+	}
+
+	result := map[string]*client.Cluster{}
+	for _, entry := range list {
+		cluster := &client.Cluster{}
+		if err := json.Unmarshal(entry.Value, cluster); err != nil {
+			logrus.Errorf("Failed to read the cached spec %s: %v", entry.Key, err)
+			continue
+		}
+		result[cluster.Id] = cluster
+	}
+	return result
+}
+
+// Remember caches the spec of a cluster Rancher published, a cluster that isn't hosted anymore is forgotten
+func (c *Client) Remember(cluster *client.Cluster) {
+	if !Hosted(cluster) {
+		c.forget(cluster.Id)
+		return
+	}
+
+	kvClient := c.kvClient()
+	if kvClient == nil {
+		return
+	}
+
+	value, err := json.Marshal(cluster)
+	if err != nil {
+		logrus.Errorf("Failed to cache the spec of cluster %s: %v", cluster.Id, err)
+		return
+	}
+
+	c.stateLock.Lock()
+	unchanged := bytes.Equal(c.saved[cluster.Id], value)
+	c.stateLock.Unlock()
+	if unchanged {
+		return
+	}
+
+	ctx := context.Background()
+	key := specPrefix + cluster.Id
+	current, err := kvClient.Get(ctx, key)
+	if err == kv.ErrNotExists || (err == nil && current == nil) {
+		_, err = kvClient.Create(ctx, key, value, 0)
+	} else if err == nil {
+		_, err = kvClient.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to cache the spec of cluster %s: %v", cluster.Id, err)
+		return
+	}
+
+	c.stateLock.Lock()
+	c.saved[cluster.Id] = value
+	c.stateLock.Unlock()
+}
+
+// rememberAll caches the specs of all hosted clusters and forgets the ones of clusters that aren't anymore
+func (c *Client) rememberAll(clusters map[string]*client.Cluster) {
+	kvClient := c.kvClient()
+	if kvClient == nil {
+		return
+	}
+
+	for _, cluster := range clusters {
+		c.Remember(cluster)
+	}
+
+	list, err := kvClient.List(context.Background(), specPrefix)
+	if err != nil {
+		logrus.Errorf("Failed to read the cached cluster specs: %v", err)
+		return
+	}
+	for _, entry := range list {
+		id := strings.TrimPrefix(entry.Key, specPrefix)
+		if _, ok := clusters[id]; !ok {
+			c.forget(id)
+		}
+	}
+}
+
+func (c *Client) forget(id string) {
+	c.stateLock.Lock()
+	delete(c.saved, id)
+	c.stateLock.Unlock()
+
+	kvClient := c.kvClient()
+	if kvClient == nil {
+		return
+	}
+	if _, err := kvClient.Delete(context.Background(), specPrefix+id); err != nil && err != kv.ErrNotExists {
+		logrus.Errorf("Failed to drop the cached spec of cluster %s: %v", id, err)
+	}
+}
+
+func (c *Client) kvClient() kv.Client {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	return c.cache
+}
+
+// UpdateStatus sets the k8sServerStatus of a cluster in Rancher.  While Rancher is unreachable the latest status of
+// every cluster is queued instead, and sent once Rancher answers again.
+func (c *Client) UpdateStatus(cluster *client.Cluster, status map[string]interface{}) error {
+	err := c.updateStatus(cluster, status)
+	c.observe(err)
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if Unreachable(err) {
+		c.pending[cluster.Id] = statusUpdate{
+			cluster: cluster,
+			status:  status,
+		}
+		return nil
+	}
+	// a queued status is older than this one
+	delete(c.pending, cluster.Id)
+	return err
+}
+
+func (c *Client) updateStatus(cluster *client.Cluster, status map[string]interface{}) error {
+	rancherClient, err := c.Get()
+	if err != nil {
+		return err
+	}
+	_, err = rancherClient.Cluster.Update(cluster, map[string]interface{}{
+		"k8sServerStatus": status,
+	})
+	return err
+}
+
+// observe tracks whether Rancher answers from the result of a request to it, once it answers again after an
+// outage the queued status updates are sent.  The servers are reconciled with Rancher by the next sync.
+func (c *Client) observe(err error) {
+	unreachable := Unreachable(err)
+
+	c.stateLock.Lock()
+	wasOffline := c.offline
+	c.offline = unreachable
+	c.stateLock.Unlock()
+
+	if unreachable && !wasOffline {
+		logrus.Warnf("Rancher is unreachable, serving the clusters from their cached specs: %v", err)
+	} else if !unreachable && wasOffline {
+		logrus.Infof("Rancher is reachable again")
+		go c.flush()
+	}
+}
+
+func (c *Client) flush() {
+	c.stateLock.Lock()
+	pending := c.pending
+	c.pending = map[string]statusUpdate{}
+	c.stateLock.Unlock()
+
+	for id, update := range pending {
+		err := c.updateStatus(update.cluster, update.status)
+		if Unreachable(err) {
+			c.observe(err)
+			c.stateLock.Lock()
+			// newer statuses were queued in the meantime
+			if _, ok := c.pending[id]; !ok {
+				c.pending[id] = update
+			}
+			c.stateLock.Unlock()
+		} else if err != nil {
+			logrus.Errorf("Failed to send the queued status of cluster %s to Rancher: %v", id, err)
+		}
+	}
+}
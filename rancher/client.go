@@ -0,0 +1,57 @@
+package rancher
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+)
+
+// Client lazily connects to Rancher so netes can start before the Rancher API is reachable.  With a cache the
+// clusters keep being served from their last known specs while Rancher is unreachable.
+type Client struct {
+	sync.Mutex
+	opts   client.ClientOpts
+	client *client.RancherClient
+
+	stateLock sync.Mutex
+	cache     kv.Client
+	// saved are the specs last written to the cache by cluster, unchanged specs aren't written again
+	saved   map[string][]byte
+	offline bool
+	pending map[string]statusUpdate
+}
+
+// New returns a client of the Rancher API at url, the failed requests are retried following retry if it isn't nil
+func New(url, accessKey, secretKey string, transport http.RoundTripper, retry *client.RetryPolicy) *Client {
+	return &Client{
+		opts: client.ClientOpts{
+			Url:       url,
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+			Transport: transport,
+			Retry:     retry,
+		},
+		saved:   map[string][]byte{},
+		pending: map[string]statusUpdate{},
+	}
+}
+
+func (c *Client) Get() (*client.RancherClient, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	opts := c.opts
+	rancherClient, err := client.NewRancherClient(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = rancherClient
+	return c.client, nil
+}
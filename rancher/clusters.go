@@ -0,0 +1,119 @@
+package rancher
+
+import (
+	"context"
+	"time"
+
+	"github.com/rancher/go-rancher/v3"
+)
+
+// listTimeout bounds listing all the pages of clusters, each request is also bounded by the client timeout
+const listTimeout = 2 * time.Minute
+
+var removedStates = map[string]bool{
+	"removing": true,
+	"removed":  true,
+	"purging":  true,
+	"purged":   true,
+}
+
+// Hosted is whether netes serves the cluster, an embedded cluster that is not being removed
+func Hosted(c *client.Cluster) bool {
+	return c.Embedded && !removedStates[c.State]
+}
+
+// Clusters returns the clusters netes serves by id.  While Rancher is unreachable they are the last known ones
+// from the cache.
+func (c *Client) Clusters() (map[string]*client.Cluster, error) {
+	result, err := c.listClusters()
+	c.observe(err)
+	if err == nil {
+		c.rememberAll(result)
+		return result, nil
+	}
+	if Unreachable(err) {
+		if cached := c.cachedClusters(); len(cached) > 0 {
+			return cached, nil
+		}
+	}
+	return result, err
+}
+
+func (c *Client) listClusters() (map[string]*client.Cluster, error) {
+	rancherClient, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), listTimeout)
+	defer cancel()
+
+	clusters, err := rancherClient.Cluster.ListAllContext(ctx, &client.ListOpts{})
+	result := map[string]*client.Cluster{}
+	for i := range clusters {
+		cluster := &clusters[i]
+		if Hosted(cluster) {
+			result[cluster.Id] = cluster
+		}
+	}
+
+	return result, err
+}
+
+// Cluster returns a cluster netes serves, nil if there is none with the id.  While Rancher is unreachable it is the
+// last known one from the cache, the error is returned if the cluster isn't cached.
+func (c *Client) Cluster(id string) (*client.Cluster, error) {
+	cluster, err := c.getCluster(id)
+	c.observe(err)
+	if err == nil {
+		if cluster == nil {
+			c.forget(id)
+			return nil, nil
+		}
+		c.Remember(cluster)
+		if !Hosted(cluster) {
+			return nil, nil
+		}
+		return cluster, nil
+	}
+
+	if Unreachable(err) {
+		if cached, cacheErr := c.CachedCluster(id); cacheErr == nil && cached != nil {
+			return cached, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) getCluster(id string) (*client.Cluster, error) {
+	rancherClient, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, err := rancherClient.Cluster.ById(id)
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// CreateCluster creates a cluster served by netes, netes starts its server once Rancher publishes it
+func (c *Client) CreateCluster(cluster *client.Cluster) (*client.Cluster, error) {
+	rancherClient, err := c.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	cluster.Embedded = true
+	return rancherClient.Cluster.Create(cluster)
+}
+
+// DeleteCluster removes a cluster, netes stops its server once Rancher publishes the removal
+func (c *Client) DeleteCluster(cluster *client.Cluster) error {
+	rancherClient, err := c.Get()
+	if err != nil {
+		return err
+	}
+	return rancherClient.Cluster.Delete(cluster)
+}
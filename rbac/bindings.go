@@ -0,0 +1,152 @@
+package rbac
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	rbacv1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+const (
+	ManagedLabel = "io.rancher.rbac.managed"
+	ProjectLabel = "io.rancher.project.id"
+
+	clusterMemberRole    = "rancher-cluster-member"
+	clusterMemberBinding = "rancher-cluster-members"
+)
+
+var managedSelector = metav1.ListOptions{
+	LabelSelector: ManagedLabel + "=true",
+}
+
+func managedMeta(name, namespace string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			ManagedLabel: "true",
+		},
+	}
+}
+
+// EnsureClusterMemberRole creates the role that lets members of any project of the cluster see the cluster
+// scoped resources they need to find their way around
+func EnsureClusterMemberRole(client kubernetes.Interface) error {
+	role := &rbacv1.ClusterRole{
+		ObjectMeta: managedMeta(clusterMemberRole, ""),
+		Rules: []rbacv1.PolicyRule{
+			{
+				Verbs:     []string{"get", "list", "watch"},
+				APIGroups: []string{""},
+				Resources: []string{"namespaces", "nodes"},
+			},
+		},
+	}
+
+	existing, err := client.RbacV1beta1().ClusterRoles().Get(role.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.RbacV1beta1().ClusterRoles().Create(role)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(existing.Rules, role.Rules) {
+		return nil
+	}
+	existing.Rules = role.Rules
+	_, err = client.RbacV1beta1().ClusterRoles().Update(existing)
+	return err
+}
+
+// SyncClusterRoleBindings makes the managed ClusterRoleBindings exactly bindings, deleting the others
+func SyncClusterRoleBindings(client kubernetes.Interface, bindings []rbacv1.ClusterRoleBinding) error {
+	bindingClient := client.RbacV1beta1().ClusterRoleBindings()
+
+	existing, err := bindingClient.List(managedSelector)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]*rbacv1.ClusterRoleBinding{}
+	for i := range existing.Items {
+		current[existing.Items[i].Name] = &existing.Items[i]
+	}
+
+	for i := range bindings {
+		binding := &bindings[i]
+		binding.ObjectMeta = managedMeta(binding.Name, "")
+
+		old, ok := current[binding.Name]
+		delete(current, binding.Name)
+		if !ok {
+			_, err = bindingClient.Create(binding)
+		} else if old.RoleRef != binding.RoleRef {
+			if err = bindingClient.Delete(old.Name, &metav1.DeleteOptions{}); err == nil {
+				_, err = bindingClient.Create(binding)
+			}
+		} else if !reflect.DeepEqual(old.Subjects, binding.Subjects) {
+			old.Subjects = binding.Subjects
+			_, err = bindingClient.Update(old)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range current {
+		if err := bindingClient.Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SyncRoleBindings makes the managed RoleBindings of all namespaces exactly bindings, deleting the others
+func SyncRoleBindings(client kubernetes.Interface, bindings []rbacv1.RoleBinding) error {
+	existing, err := client.RbacV1beta1().RoleBindings("").List(managedSelector)
+	if err != nil {
+		return err
+	}
+
+	current := map[string]*rbacv1.RoleBinding{}
+	for i := range existing.Items {
+		binding := &existing.Items[i]
+		current[binding.Namespace+"/"+binding.Name] = binding
+	}
+
+	for i := range bindings {
+		binding := &bindings[i]
+		binding.ObjectMeta = managedMeta(binding.Name, binding.Namespace)
+		bindingClient := client.RbacV1beta1().RoleBindings(binding.Namespace)
+
+		key := binding.Namespace + "/" + binding.Name
+		old, ok := current[key]
+		delete(current, key)
+		if !ok {
+			_, err = bindingClient.Create(binding)
+		} else if old.RoleRef != binding.RoleRef {
+			if err = bindingClient.Delete(old.Name, &metav1.DeleteOptions{}); err == nil {
+				_, err = bindingClient.Create(binding)
+			}
+		} else if !reflect.DeepEqual(old.Subjects, binding.Subjects) {
+			old.Subjects = binding.Subjects
+			_, err = bindingClient.Update(old)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, binding := range current {
+		err := client.RbacV1beta1().RoleBindings(binding.Namespace).Delete(binding.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	rbacv1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+const syncInterval = 30 * time.Second
+
+// roles maps Rancher project roles to the ClusterRoles granted in the namespaces of the project
+var roles = map[string]string{
+	"owner":      "admin",
+	"member":     "edit",
+	"readonly":   "view",
+	"restricted": "view",
+}
+
+// Controller materializes the members of the Rancher projects of every running cluster as RBAC bindings.
+// Project members are bound in the namespaces labeled with the project id, members of any project of the
+// cluster can read the namespaces and nodes.  Users are named by the login of their Rancher identity and groups by
+// their external id, like the authenticator names them, bindings are labeled so the ones Rancher no longer grants
+// are deleted.
+type Controller struct {
+	rancher       *rancher.Client
+	serverFactory *server.Factory
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		rancher:       config.RancherClient,
+		serverFactory: serverFactory,
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	go wait.Until(c.sync, syncInterval, ctx.Done())
+}
+
+func (c *Controller) sync() {
+	rancherClient, err := c.rancher.Get()
+	if err != nil {
+		logrus.Errorf("Failed to connect to Rancher for RBAC sync: %v", err)
+		return
+	}
+
+	for _, s := range c.serverFactory.Servers() {
+		if err := c.reconcile(rancherClient, s); err != nil {
+			logrus.Errorf("Failed to sync RBAC of cluster %s: %v", s.Cluster().Id, err)
+		}
+	}
+}
+
+func (c *Controller) reconcile(rancherClient *client.RancherClient, s server.Server) error {
+	k8sClient := s.Clients().Client
+
+	projects, err := rancherClient.Project.ListAll(&client.ListOpts{
+		Filters: map[string]interface{}{
+			"clusterId": s.Cluster().Id,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var (
+		roleBindings   []rbacv1.RoleBinding
+		clusterMembers = map[rbacv1.Subject]bool{}
+		logins         = map[string]string{}
+	)
+	for _, project := range projects {
+		members, err := rancherClient.ProjectMember.ListAll(&client.ListOpts{
+			Filters: map[string]interface{}{
+				"projectId": project.Id,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		byRole := map[string][]rbacv1.Subject{}
+		for _, member := range members {
+			role, ok := roles[member.Role]
+			if !ok || member.State != "active" {
+				continue
+			}
+			subject, err := toSubject(rancherClient, member, logins)
+			if err != nil {
+				return err
+			}
+			byRole[role] = append(byRole[role], subject)
+			clusterMembers[subject] = true
+		}
+
+		namespaces, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{
+			LabelSelector: ProjectLabel + "=" + project.Id,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, ns := range namespaces.Items {
+			for role, subjects := range byRole {
+				roleBindings = append(roleBindings, rbacv1.RoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "rancher-project-" + role,
+						Namespace: ns.Name,
+					},
+					Subjects: sortSubjects(subjects),
+					RoleRef:  roleRef("ClusterRole", role),
+				})
+			}
+		}
+	}
+
+	if err := EnsureClusterMemberRole(k8sClient); err != nil {
+		return err
+	}
+
+	if err := SyncRoleBindings(k8sClient, roleBindings); err != nil {
+		return err
+	}
+
+	var clusterRoleBindings []rbacv1.ClusterRoleBinding
+	if len(clusterMembers) > 0 {
+		var subjects []rbacv1.Subject
+		for subject := range clusterMembers {
+			subjects = append(subjects, subject)
+		}
+		clusterRoleBindings = append(clusterRoleBindings, rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: clusterMemberBinding,
+			},
+			Subjects: sortSubjects(subjects),
+			RoleRef:  roleRef("ClusterRole", clusterMemberRole),
+		})
+	}
+
+	return SyncClusterRoleBindings(k8sClient, clusterRoleBindings)
+}
+
+// toSubject names a member like the authenticator names its users, groups by their external id and users by the
+// login of their identity.  The logins already looked up are in logins by identity id.
+func toSubject(rancherClient *client.RancherClient, member client.ProjectMember, logins map[string]string) (rbacv1.Subject, error) {
+	subject := rbacv1.Subject{
+		Kind:     rbacv1.GroupKind,
+		APIGroup: rbacv1.GroupName,
+		Name:     member.ExternalId,
+	}
+	if strings.HasSuffix(member.ExternalIdType, "_group") ||
+		strings.HasSuffix(member.ExternalIdType, "_team") ||
+		strings.HasSuffix(member.ExternalIdType, "_org") {
+		return subject, nil
+	}
+
+	id := member.ExternalIdType + ":" + member.ExternalId
+	login, ok := logins[id]
+	if !ok {
+		identity, err := rancherClient.Identity.ById(id)
+		if err != nil {
+			return subject, err
+		}
+		if identity == nil || identity.Login == "" {
+			return subject, fmt.Errorf("no login for identity %s of project member %s", id, member.Id)
+		}
+		login = identity.Login
+		logins[id] = login
+	}
+
+	subject.Kind = rbacv1.UserKind
+	subject.Name = login
+	return subject, nil
+}
+
+func roleRef(kind, name string) rbacv1.RoleRef {
+	return rbacv1.RoleRef{
+		APIGroup: rbacv1.GroupName,
+		Kind:     kind,
+		Name:     name,
+	}
+}
+
+// sortSubjects orders subjects so unchanged memberships compare equal to the existing bindings
+func sortSubjects(subjects []rbacv1.Subject) []rbacv1.Subject {
+	sort.Slice(subjects, func(i, j int) bool {
+		if subjects[i].Kind != subjects[j].Kind {
+			return subjects[i].Kind < subjects[j].Kind
+		}
+		return subjects[i].Name < subjects[j].Name
+	})
+	return subjects
+}
@@ -0,0 +1,55 @@
+package replication
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+)
+
+// Checksum of the keys under prefix, without events.  Events are written with a TTL and expire on the primary and
+// the standby independently, comparing them would report divergence every time one side expired them first.
+type Checksum struct {
+	Prefix string `json:"prefix"`
+	Count  int64  `json:"count"`
+	SHA256 string `json:"sha256"`
+	// Current is set by the primary when nothing but events was written after the id the standby applied, only
+	// then the checksums of both sides can be compared
+	Current bool `json:"current"`
+}
+
+func ComputeChecksum(ctx context.Context, client kv.Client, prefix string) (Checksum, error) {
+	kvs, err := client.List(ctx, prefix)
+	if err != nil {
+		return Checksum{}, err
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+
+	checksum := Checksum{
+		Prefix: prefix,
+	}
+	hash := sha256.New()
+	for _, kv := range kvs {
+		if IsEvent(kv.Key) {
+			continue
+		}
+		checksum.Count++
+		hash.Write([]byte(kv.Key))
+		hash.Write([]byte{0})
+		hash.Write(kv.Value)
+		hash.Write([]byte{0})
+	}
+	checksum.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return checksum, nil
+}
+
+// IsEvent returns true for the keys of events, /k8s/cluster/<uuid>/events/<namespace>/<name>
+func IsEvent(key string) bool {
+	parts := strings.SplitN(strings.TrimPrefix(key, "/"), "/", 5)
+	return len(parts) == 5 && parts[3] == "events"
+}
@@ -0,0 +1,373 @@
+package replication
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/k8s-sql/kv"
+	adminclient "github.com/rancher/netes/admin/client"
+	"golang.org/x/net/context"
+)
+
+const (
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+
+	pollInterval   = time.Second
+	verifyInterval = 5 * time.Minute
+	pageSize       = 1000
+	stateKey       = "/netes/replication"
+)
+
+var lagGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "netes_replication_lag_seconds",
+	Help: "Seconds since the standby last read the mutation log of the primary to its end",
+}, []string{"cluster", "prefix"})
+
+var divergedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "netes_replication_diverged",
+	Help: "1 if the copy of the standby differs from the primary after applying the same mutations",
+}, []string{"cluster", "prefix"})
+
+func init() {
+	prometheus.MustRegister(lagGauge, divergedGauge)
+}
+
+type Target struct {
+	Cluster string `json:"cluster"`
+	Prefix  string `json:"prefix,omitempty"`
+	// LastID is the id of the last mutation of the primary applied here
+	LastID int64 `json:"lastId"`
+	// LastMutation is when the last applied mutation was made on the primary
+	LastMutation time.Time `json:"lastMutation,omitempty"`
+	// LastSync is when the mutation log of the primary was last read to its end
+	LastSync time.Time `json:"lastSync,omitempty"`
+	// LastVerified is when the copy was last compared with the primary, Diverged is whether they differed
+	LastVerified time.Time `json:"lastVerified,omitempty"`
+	Diverged     bool      `json:"diverged"`
+	Error        string    `json:"error,omitempty"`
+
+	verifyAttempt time.Time
+}
+
+type Status struct {
+	Role       string   `json:"role"`
+	Source     string   `json:"source"`
+	Targets    []Target `json:"targets"`
+	LagSeconds float64  `json:"lagSeconds"`
+}
+
+// Replicator keeps the storage of selected clusters, or prefixes of them, a copy of a primary netes in another
+// site by applying the mutation log of the primary.  As the standby it rejects writes to the replicated clusters,
+// promoting it stops replication and allows writes, demoting it resumes replication from the last applied
+// mutation.  The role and positions are kept in the storage so they survive restarts.  Keys the primary created
+// with a TTL, events, expire on the standby as well.  Every few minutes the copy is compared with the primary by
+// checksum, a difference is reported as divergence until the next comparison finds them equal.
+type Replicator struct {
+	sync.Mutex
+	client  kv.Client
+	source  *adminclient.Client
+	targets []*Target
+	role    string
+	cancel  context.CancelFunc
+}
+
+// New replicates targets, each "<clusterId>" or "<clusterId>/<prefix>", from the admin API of the primary at
+// sourceURL
+func New(client kv.Client, sourceURL, sourceToken string, targets []string) *Replicator {
+	r := &Replicator{
+		client: client,
+		source: adminclient.New(sourceURL, sourceToken),
+		role:   RoleStandby,
+	}
+	for _, t := range targets {
+		t = strings.Trim(t, "/")
+		if t == "" {
+			continue
+		}
+		parts := strings.SplitN(t, "/", 2)
+		target := &Target{
+			Cluster: parts[0],
+		}
+		if len(parts) == 2 {
+			target.Prefix = parts[1]
+		}
+		r.targets = append(r.targets, target)
+	}
+	return r
+}
+
+func (r *Replicator) Start(ctx context.Context) error {
+	role, err := r.load(ctx, path.Join(stateKey, "role"))
+	if err != nil {
+		return err
+	}
+	if role != "" {
+		r.role = role
+	}
+
+	for _, t := range r.targets {
+		lastID, err := r.load(ctx, cursorKey(t))
+		if err != nil {
+			return err
+		}
+		if lastID != "" {
+			if t.LastID, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+				return err
+			}
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if r.role == RoleStandby {
+		r.startReplication()
+	}
+	return nil
+}
+
+// IsStandby returns true if writes to the cluster must be rejected because it is replicated from the primary
+func (r *Replicator) IsStandby(clusterID string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.role != RoleStandby {
+		return false
+	}
+	for _, t := range r.targets {
+		if t.Cluster == clusterID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Replicator) Promote(ctx context.Context) error {
+	return r.setRole(ctx, RolePrimary)
+}
+
+func (r *Replicator) Demote(ctx context.Context) error {
+	return r.setRole(ctx, RoleStandby)
+}
+
+func (r *Replicator) setRole(ctx context.Context, role string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.role == role {
+		return nil
+	}
+	if err := r.save(ctx, path.Join(stateKey, "role"), role); err != nil {
+		return err
+	}
+
+	logrus.Infof("Replication role changed from %s to %s", r.role, role)
+	r.role = role
+	if role == RoleStandby {
+		r.startReplication()
+	} else if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	return nil
+}
+
+func (r *Replicator) Status() Status {
+	r.Lock()
+	defer r.Unlock()
+
+	status := Status{
+		Role:    r.role,
+		Source:  r.source.URL,
+		Targets: []Target{},
+	}
+	for _, t := range r.targets {
+		status.Targets = append(status.Targets, *t)
+		if lag := lag(t); lag > status.LagSeconds {
+			status.LagSeconds = lag
+		}
+	}
+	return status
+}
+
+func lag(t *Target) float64 {
+	if t.LastSync.IsZero() {
+		return 0
+	}
+	return time.Since(t.LastSync).Seconds()
+}
+
+func (r *Replicator) startReplication() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(ctx)
+}
+
+func (r *Replicator) run(ctx context.Context) {
+	for {
+		for _, t := range r.targets {
+			err := r.sync(ctx, t)
+			if err == nil && time.Since(t.verifyAttempt) > verifyInterval {
+				r.Lock()
+				t.verifyAttempt = time.Now()
+				r.Unlock()
+				err = r.verify(ctx, t)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			r.Lock()
+			t.Error = ""
+			if err != nil {
+				logrus.Errorf("Failed to replicate cluster %s: %v", t.Cluster, err)
+				t.Error = err.Error()
+			}
+			lagGauge.WithLabelValues(t.Cluster, t.Prefix).Set(lag(t))
+			r.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// sync applies the mutation log of the primary until it reaches the end
+func (r *Replicator) sync(ctx context.Context, t *Target) error {
+	for {
+		r.Lock()
+		lastID := t.LastID
+		r.Unlock()
+
+		mutations, err := r.source.ListMutations(t.Cluster, &adminclient.ListMutationsOpts{
+			Prefix: t.Prefix,
+			After:  lastID,
+			Limit:  pageSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, m := range mutations.Data {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := r.apply(ctx, m); err != nil {
+				return err
+			}
+			if err := r.save(ctx, cursorKey(t), strconv.FormatInt(m.ID, 10)); err != nil {
+				return err
+			}
+
+			r.Lock()
+			t.LastID = m.ID
+			t.LastMutation = m.Time
+			r.Unlock()
+		}
+
+		if len(mutations.Data) < pageSize {
+			r.Lock()
+			t.LastSync = time.Now()
+			r.Unlock()
+			return nil
+		}
+	}
+}
+
+// verify compares the checksum of the copy with the one of the primary.  The comparison is skipped when the
+// primary wrote more than events after the last applied mutation, the two can't be compared then.
+func (r *Replicator) verify(ctx context.Context, t *Target) error {
+	r.Lock()
+	lastID := t.LastID
+	r.Unlock()
+
+	remote, err := r.source.GetMutationChecksum(t.Cluster, &adminclient.GetMutationChecksumOpts{
+		Prefix: t.Prefix,
+		After:  lastID,
+	})
+	if err != nil {
+		return err
+	}
+	if !remote.Current {
+		return nil
+	}
+
+	local, err := ComputeChecksum(ctx, r.client, remote.Prefix)
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	t.LastVerified = time.Now()
+	t.Diverged = local.Count != remote.Count || local.SHA256 != remote.SHA256
+	if t.Diverged {
+		logrus.Errorf("Replica of cluster %s diverged from the primary at mutation %d: %d keys with checksum %s, primary has %d keys with checksum %s",
+			t.Cluster, lastID, local.Count, local.SHA256, remote.Count, remote.SHA256)
+		divergedGauge.WithLabelValues(t.Cluster, t.Prefix).Set(1)
+	} else {
+		divergedGauge.WithLabelValues(t.Cluster, t.Prefix).Set(0)
+	}
+	return nil
+}
+
+func (r *Replicator) apply(ctx context.Context, m adminclient.Mutation) error {
+	if m.Operation == "delete" {
+		_, err := r.client.Delete(ctx, m.Key)
+		if err == kv.ErrNotExists {
+			return nil
+		}
+		return err
+	}
+
+	// the TTL counts from the creation on the primary, keys that already expired there are not created
+	var ttl uint64
+	if m.TTL > 0 {
+		remaining := time.Duration(m.TTL)*time.Second - time.Since(m.Time)
+		if remaining < time.Second {
+			return nil
+		}
+		ttl = uint64(remaining / time.Second)
+	}
+	return r.put(ctx, m.Key, m.Value, ttl)
+}
+
+// put sets the value of key regardless of its revision, revisions are not kept in step with the primary.  ttl only
+// applies when the key is created, like in the storage.
+func (r *Replicator) put(ctx context.Context, key string, value []byte, ttl uint64) error {
+	current, err := r.client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		_, err = r.client.Create(ctx, key, value, ttl)
+		return err
+	}
+	_, err = r.client.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+	return err
+}
+
+func (r *Replicator) load(ctx context.Context, key string) (string, error) {
+	value, err := r.client.Get(ctx, key)
+	if err != nil || value == nil {
+		return "", err
+	}
+	return string(value.Value), nil
+}
+
+func (r *Replicator) save(ctx context.Context, key, value string) error {
+	return r.put(ctx, key, []byte(value), 0)
+}
+
+func cursorKey(t *Target) string {
+	return path.Join(stateKey, "cursor", t.Cluster, t.Prefix)
+}
@@ -0,0 +1,89 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/netes/certs"
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const syncInterval = 10 * time.Minute
+
+// Controller rotates the certificates of running clusters before they expire and restarts the clusters to
+// serve the new ones.  It moves the rotations of the credentials of clusters through their phases.  Clusters
+// whose certificates were rotated by another netes sharing the database are restarted too.
+type Controller struct {
+	config        *types.GlobalConfig
+	serverFactory *server.Factory
+}
+
+func NewController(config *types.GlobalConfig, serverFactory *server.Factory) *Controller {
+	return &Controller{
+		config:        config,
+		serverFactory: serverFactory,
+	}
+}
+
+func (c *Controller) Start(ctx context.Context) {
+	go wait.Until(c.sync, syncInterval, ctx.Done())
+}
+
+func (c *Controller) sync() {
+	for _, s := range c.serverFactory.Servers() {
+		if err := c.reconcile(s); err != nil {
+			logrus.Errorf("Failed to rotate certificates of cluster %s: %v", s.Cluster().Id, err)
+		}
+	}
+}
+
+func (c *Controller) reconcile(s server.Server) error {
+	kvClient, err := store.Client(c.config)
+	if err != nil {
+		return err
+	}
+
+	cluster := s.Cluster()
+	bundle := s.Certificates()
+
+	expiring, err := bundle.Expiring()
+	if err != nil {
+		return err
+	}
+	for _, name := range expiring {
+		logrus.Infof("Rotating expiring certificate %s of cluster %s", name, cluster.Id)
+		if err := certs.Rotate(context.Background(), kvClient, cluster.Uuid, name); err != nil {
+			return err
+		}
+		c.config.Events.Emit(events.Event{
+			Type:    events.CertificateRotated,
+			Cluster: cluster.Id,
+			Message: fmt.Sprintf("Rotated expiring certificate %s of cluster %s", name, cluster.Id),
+			Details: map[string]string{"name": name, "reason": "expiring"},
+		})
+	}
+
+	advanced, err := certs.AdvanceRotation(context.Background(), kvClient, cluster.Uuid)
+	if err != nil {
+		return err
+	}
+	if advanced {
+		logrus.Infof("Credential rotation of cluster %s moved on to its next phase", cluster.Id)
+	}
+
+	revision, err := certs.Revision(context.Background(), kvClient, cluster.Uuid)
+	if err != nil {
+		return err
+	}
+	if revision == bundle.Revision {
+		return nil
+	}
+
+	return c.serverFactory.Restart(cluster.Id, "certificates rotated", c.config.DrainTimeout)
+}
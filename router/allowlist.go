@@ -0,0 +1,140 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/accesslog"
+	"github.com/rancher/netes/tracing"
+)
+
+var deniedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "netes_cluster_denied_requests_total",
+	Help: "Requests rejected because their source is not in the allowed source ranges of the cluster",
+}, []string{"cluster"})
+
+func init() {
+	prometheus.MustRegister(deniedCounter)
+}
+
+// allowed enforces the allowed source ranges of a cluster, requests from elsewhere get a 403 and are recorded in
+// the access log and the log of netes.  Clusters without ranges are reachable from anywhere.
+func (r *Router) allowed(rw http.ResponseWriter, req *http.Request, c *client.Cluster) bool {
+	if c.K8sServerConfig == nil || len(c.K8sServerConfig.AllowedSourceRanges) == 0 {
+		return true
+	}
+
+	allowed, invalid := parseRanges(c.K8sServerConfig.AllowedSourceRanges)
+	if len(invalid) > 0 {
+		logrus.Warnf("Ignoring invalid allowed source ranges %v of cluster %s", invalid, c.Id)
+	}
+	ip := r.sourceIP(req)
+	if ip != nil && contains(allowed, ip) {
+		return true
+	}
+
+	source := ip.String()
+	if ip == nil {
+		source = req.RemoteAddr
+	}
+	logrus.WithFields(logrus.Fields{
+		"cluster": c.Id,
+		"source":  source,
+		"method":  req.Method,
+		"uri":     req.URL.RequestURI(),
+	}).Warn("Rejected request from outside the allowed source ranges of the cluster")
+	deniedCounter.WithLabelValues(c.Id).Inc()
+	accesslog.Record(r.config, &accesslog.Entry{
+		Time:      time.Now().UTC(),
+		Cluster:   c.Id,
+		Method:    req.Method,
+		URI:       req.URL.RequestURI(),
+		Code:      http.StatusForbidden,
+		SourceIP:  source,
+		UserAgent: req.UserAgent(),
+		RequestID: tracing.FromContext(req.Context()).TraceID(),
+		Reason:    "source not in allowed source ranges",
+	})
+
+	response(rw, http.StatusForbidden, "Source "+source+" is not allowed to reach the cluster")
+	return false
+}
+
+// sourceIP is the address of the client, the X-Forwarded-For entries added by trusted proxies like load balancers
+// and other netes replicas are followed back to the first hop that isn't trusted
+func (r *Router) sourceIP(req *http.Request) net.IP {
+	ip := remoteIP(req)
+	if ip == nil || !contains(r.trustedProxies, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !contains(r.trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// trustedProxy is whether req came from a trusted proxy, whose X-Forwarded headers are believed
+func (r *Router) trustedProxy(req *http.Request) bool {
+	ip := remoteIP(req)
+	return ip != nil && contains(r.trustedProxies, ip)
+}
+
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// parseRanges reads CIDRs and single addresses, it returns the invalid entries separately
+func parseRanges(ranges []string) ([]*net.IPNet, []string) {
+	var (
+		result  []*net.IPNet
+		invalid []string
+	)
+	for _, value := range ranges {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			invalid = append(invalid, value)
+			continue
+		}
+		result = append(result, cidr)
+	}
+	return result, invalid
+}
+
+func contains(ranges []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range ranges {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,27 +2,79 @@ package router
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/authorization"
 	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/health"
+	"github.com/rancher/netes/kubeconfig"
 	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/shard"
+	"github.com/rancher/netes/sni"
+	"github.com/rancher/netes/tracing"
 	"github.com/rancher/netes/types"
 )
 
+// forwardedHeader marks requests a replica forwarded to the replica holding the cluster, they are not forwarded again
+const forwardedHeader = "X-Netes-Forwarded-By"
+
 type Router struct {
-	clusterLookup *cluster.Lookup
-	serverFactory *server.Factory
+	config         *types.GlobalConfig
+	clusterLookup  *cluster.Lookup
+	serverFactory  *server.Factory
+	health         *health.Checker
+	trustedProxies []*net.IPNet
 }
 
-func New(config *types.GlobalConfig) *Router {
+func New(config *types.GlobalConfig, serverFactory *server.Factory, checker *health.Checker) *Router {
+	trustedProxies, invalid := parseRanges(config.TrustedProxies)
+	if len(invalid) > 0 {
+		logrus.Warnf("Ignoring invalid trusted proxies %v", invalid)
+	}
+
 	return &Router{
-		clusterLookup: config.Lookup,
-		serverFactory: server.NewFactory(config),
+		config:         config,
+		clusterLookup:  config.Lookup,
+		serverFactory:  serverFactory,
+		health:         checker,
+		trustedProxies: trustedProxies,
 	}
 }
 
 func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// requests to <cluster>.<domain> are routed like the path of the cluster
+	hostRouted := false
+	if label := sni.ClusterLabel(req.Host, r.config.ClusterDomain); label != "" && !strings.HasPrefix(req.URL.Path, "/k8s/clusters/") {
+		clusterID, err := r.hostClusterID(label, req)
+		if err != nil {
+			response(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if clusterID == "" {
+			response(rw, http.StatusNotFound, "No cluster available")
+			return
+		}
+
+		prefix := "/k8s/clusters/" + clusterID
+		req.URL.Path = prefix + req.URL.Path
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = prefix + req.URL.RawPath
+		}
+		hostRouted = true
+	}
+
+	if r.config.Shards != nil && r.forward(rw, req) {
+		return
+	}
+
 	c, handler, err := r.serverFactory.Get(req)
 	if err != nil {
 		response(rw, http.StatusInternalServerError, err.Error())
@@ -30,17 +82,190 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	if c == nil {
-		response(rw, http.StatusNotFound, "No c available")
+		response(rw, http.StatusNotFound, "No cluster available")
+		return
+	}
+
+	if !r.allowed(rw, req, c) {
+		return
+	}
+
+	if req.Method == http.MethodGet && req.URL.Path == "/k8s/clusters/"+c.Id+"/kubeconfig" {
+		trusted := r.trustedProxy(req)
+		serverURL := kubeconfig.ServerURL(req, c.Id, trusted)
+		if hostRouted {
+			serverURL = kubeconfig.HostURL(req, trusted)
+		}
+		r.kubeconfig(rw, req, c, serverURL)
+		return
+	}
+
+	if req.Method == http.MethodGet && req.URL.Path == "/k8s/clusters/"+c.Id+"/tunnel" {
+		r.tunnel(rw, req, c)
+		return
+	}
+
+	// clusters that don't allow anyone to see /healthz get the one of their apiserver, which authenticates
+	if req.Method == http.MethodGet && req.URL.Path == "/k8s/clusters/"+c.Id+"/healthz" &&
+		authorization.AlwaysAllowed(r.config, c, "/healthz") {
+		r.healthz(rw, req, c)
 		return
 	}
 
+	tracing.FromContext(req.Context()).SetAttribute("netes.cluster", c.Id)
 	ctx := cluster.StoreCluster(req.Context(), c)
 	handler.ServeHTTP(rw, req.WithContext(ctx))
 }
 
+// forward proxies requests for clusters held by another replica to it, it returns whether the request was handled
+func (r *Router) forward(rw http.ResponseWriter, req *http.Request) bool {
+	clusterID := cluster.GetClusterID(req)
+	if clusterID == "" {
+		return false
+	}
+
+	address, err := r.config.Shards.Route(req.Context(), clusterID)
+	if err == nil && address != "" && req.Header.Get(forwardedHeader) != "" {
+		// the replicas don't agree yet who holds it
+		err = shard.ErrNoOwner
+	}
+	if err == shard.ErrNoOwner {
+		rw.Header().Set("Retry-After", "1")
+		response(rw, http.StatusServiceUnavailable, err.Error())
+		return true
+	} else if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return true
+	} else if address == "" {
+		return false
+	}
+
+	target, err := url.Parse(address)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return true
+	}
+
+	req.Header.Set(forwardedHeader, r.config.ReplicaID)
+	tracing.Inject(req)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	// watches are streamed
+	proxy.FlushInterval = -1
+	proxy.ServeHTTP(rw, req)
+	return true
+}
+
+// kubeconfig is served here rather than by the cluster so it is available to anyone Rancher lets see the
+// cluster, using the credentials they looked it up with.  Running clusters are routed without asking Rancher,
+// so the credentials are checked here.
+func (r *Router) kubeconfig(rw http.ResponseWriter, req *http.Request, c *client.Cluster, serverURL string) {
+	c, err := r.clusterLookup.LookupByID(c.Id, req)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if c == nil {
+		response(rw, http.StatusNotFound, "No cluster available")
+		return
+	}
+
+	var caData []byte
+	if r.config.TLSCAFile != "" {
+		if caData, err = ioutil.ReadFile(r.config.TLSCAFile); err != nil {
+			response(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	content, err := kubeconfig.Generate(c, serverURL, caData, req)
+	if err == kubeconfig.ErrNoCredentials {
+		response(rw, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rw.Header().Set("content-type", "application/yaml")
+	rw.Write(content)
+}
+
+// tunnel serves the agents of the nodes of the cluster, with Rancher credentials that give access to it, like
+// the ones of the Rancher agent of the host
+func (r *Router) tunnel(rw http.ResponseWriter, req *http.Request, c *client.Cluster) {
+	c, err := r.clusterLookup.LookupByID(c.Id, req)
+	if err != nil {
+		response(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if c == nil {
+		response(rw, http.StatusNotFound, "No cluster available")
+		return
+	}
+
+	r.config.Tunnels.Serve(rw, req, c.Id)
+}
+
+// hostClusterID resolves the cluster name or id of a host, running clusters first so requests to them don't need
+// to ask Rancher
+func (r *Router) hostClusterID(label string, req *http.Request) (string, error) {
+	for _, s := range r.serverFactory.Servers() {
+		if c := s.Cluster(); c.Id == label || strings.ToLower(c.Name) == label {
+			return c.Id, nil
+		}
+	}
+
+	c, err := r.clusterLookup.LookupByID(label, req)
+	if err != nil || c != nil {
+		return clusterID(c), err
+	}
+	c, err = r.clusterLookup.LookupByName(label, req)
+	return clusterID(c), err
+}
+
+func clusterID(c *client.Cluster) string {
+	if c == nil {
+		return ""
+	}
+	return c.Id
+}
+
+// healthz replaces the healthz of the apiserver of the cluster, which only knows about itself, with the checks of
+// netes.  Like upstream it is ok or lists the checks without their reasons.
+func (r *Router) healthz(rw http.ResponseWriter, req *http.Request, c *client.Cluster) {
+	s, ok := r.serverFactory.Server(c.Id)
+	if !ok {
+		response(rw, http.StatusNotFound, "No cluster available")
+		return
+	}
+
+	result := r.health.Get(s)
+	_, verbose := req.URL.Query()["verbose"]
+	if result.Ready && !verbose {
+		fmt.Fprint(rw, "ok")
+		return
+	}
+
+	if !result.Ready {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+	for _, check := range result.Checks {
+		if check.OK {
+			fmt.Fprintf(rw, "[+]%s ok\n", check.Name)
+		} else {
+			fmt.Fprintf(rw, "[-]%s failed: reason withheld\n", check.Name)
+		}
+	}
+	if result.Ready {
+		fmt.Fprint(rw, "healthz check passed\n")
+	} else {
+		fmt.Fprint(rw, "healthz check failed\n")
+	}
+}
+
 func response(rw http.ResponseWriter, code int, message string) {
-	rw.WriteHeader(code)
 	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(code)
 	json.NewEncoder(rw).Encode(&client.Error{
 		Status:  int64(code),
 		Message: message,
@@ -0,0 +1,106 @@
+package rpc
+
+import "github.com/golang/protobuf/proto"
+
+// The messages of netes.proto, encoded by the struct tags like the code protoc-gen-go generates
+
+type Cluster struct {
+	Id          string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name        string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	State       string `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	Uuid        string `protobuf:"bytes,5,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	Running     bool   `protobuf:"varint,6,opt,name=running,proto3" json:"running,omitempty"`
+}
+
+func (m *Cluster) Reset()         { *m = Cluster{} }
+func (m *Cluster) String() string { return proto.CompactTextString(m) }
+func (*Cluster) ProtoMessage()    {}
+
+type CreateClusterRequest struct {
+	Name            string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Description     string `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	K8SServerConfig []byte `protobuf:"bytes,3,opt,name=k8s_server_config,json=k8sServerConfig,proto3" json:"k8s_server_config,omitempty"`
+	Template        string `protobuf:"bytes,4,opt,name=template,proto3" json:"template,omitempty"`
+	Account         string `protobuf:"bytes,5,opt,name=account,proto3" json:"account,omitempty"`
+}
+
+func (m *CreateClusterRequest) Reset()         { *m = CreateClusterRequest{} }
+func (m *CreateClusterRequest) String() string { return proto.CompactTextString(m) }
+func (*CreateClusterRequest) ProtoMessage()    {}
+
+type DeleteClusterRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (m *DeleteClusterRequest) Reset()         { *m = DeleteClusterRequest{} }
+func (m *DeleteClusterRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteClusterRequest) ProtoMessage()    {}
+
+type DeleteClusterResponse struct {
+}
+
+func (m *DeleteClusterResponse) Reset()         { *m = DeleteClusterResponse{} }
+func (m *DeleteClusterResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteClusterResponse) ProtoMessage()    {}
+
+type ListClustersRequest struct {
+}
+
+func (m *ListClustersRequest) Reset()         { *m = ListClustersRequest{} }
+func (m *ListClustersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListClustersRequest) ProtoMessage()    {}
+
+type ListClustersResponse struct {
+	Clusters []*Cluster `protobuf:"bytes,1,rep,name=clusters" json:"clusters,omitempty"`
+}
+
+func (m *ListClustersResponse) Reset()         { *m = ListClustersResponse{} }
+func (m *ListClustersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListClustersResponse) ProtoMessage()    {}
+
+type GetKubeconfigRequest struct {
+	Id        string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ServerUrl string `protobuf:"bytes,2,opt,name=server_url,json=serverUrl,proto3" json:"server_url,omitempty"`
+	Token     string `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+}
+
+func (m *GetKubeconfigRequest) Reset()         { *m = GetKubeconfigRequest{} }
+func (m *GetKubeconfigRequest) String() string { return proto.CompactTextString(m) }
+func (*GetKubeconfigRequest) ProtoMessage()    {}
+
+type GetKubeconfigResponse struct {
+	Kubeconfig []byte `protobuf:"bytes,1,opt,name=kubeconfig,proto3" json:"kubeconfig,omitempty"`
+}
+
+func (m *GetKubeconfigResponse) Reset()         { *m = GetKubeconfigResponse{} }
+func (m *GetKubeconfigResponse) String() string { return proto.CompactTextString(m) }
+func (*GetKubeconfigResponse) ProtoMessage()    {}
+
+type StatsRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (m *StatsRequest) Reset()         { *m = StatsRequest{} }
+func (m *StatsRequest) String() string { return proto.CompactTextString(m) }
+func (*StatsRequest) ProtoMessage()    {}
+
+type ClusterStats struct {
+	Id          string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Running     bool   `protobuf:"varint,2,opt,name=running,proto3" json:"running,omitempty"`
+	IdleSeconds int64  `protobuf:"varint,3,opt,name=idle_seconds,json=idleSeconds,proto3" json:"idle_seconds,omitempty"`
+	Rows        int64  `protobuf:"varint,4,opt,name=rows,proto3" json:"rows,omitempty"`
+	Bytes       int64  `protobuf:"varint,5,opt,name=bytes,proto3" json:"bytes,omitempty"`
+}
+
+func (m *ClusterStats) Reset()         { *m = ClusterStats{} }
+func (m *ClusterStats) String() string { return proto.CompactTextString(m) }
+func (*ClusterStats) ProtoMessage()    {}
+
+type StatsResponse struct {
+	Stats []*ClusterStats `protobuf:"bytes,1,rep,name=stats" json:"stats,omitempty"`
+}
+
+func (m *StatsResponse) Reset()         { *m = StatsResponse{} }
+func (m *StatsResponse) String() string { return proto.CompactTextString(m) }
+func (*StatsResponse) ProtoMessage()    {}
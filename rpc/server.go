@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/kubeconfig"
+	"github.com/rancher/netes/quota"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/templates"
+	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Server manages the clusters hosted by netes for orchestrators, clusters are created and deleted in Rancher with
+// the credentials of netes and picked up from there like the ones created in Rancher
+type Server struct {
+	config        *types.GlobalConfig
+	serverFactory *server.Factory
+}
+
+func New(config *types.GlobalConfig, serverFactory *server.Factory) *Server {
+	return &Server{
+		config:        config,
+		serverFactory: serverFactory,
+	}
+}
+
+// ListenAndServe serves the Admin service on addr, calls must carry the admin token when there is one.  Without a
+// token it only serves on a loopback address.
+func (s *Server) ListenAndServe(addr string) error {
+	if s.config.AdminToken == "" && !loopback(addr) {
+		return fmt.Errorf("refusing to serve the admin gRPC API on %s without NETES_ADMIN_TOKEN, set it or listen on a loopback address", addr)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	g := grpc.NewServer(grpc.UnaryInterceptor(s.authenticate))
+	RegisterAdminServer(g, s)
+	return g.Serve(l)
+}
+
+func (s *Server) authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.config.AdminToken == "" {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromContext(ctx)
+	for _, auth := range md["authorization"] {
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.config.AdminToken)) == 1 {
+			return handler(ctx, req)
+		}
+	}
+	return nil, grpc.Errorf(codes.Unauthenticated, "Unauthorized")
+}
+
+// loopback is whether addr only listens on a loopback interface
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) rancher() (*rancher.Client, error) {
+	if s.config.RancherClient == nil {
+		return nil, grpc.Errorf(codes.Unavailable, "No Rancher configured")
+	}
+	return s.config.RancherClient, nil
+}
+
+func (s *Server) lookup(id string) (*client.Cluster, error) {
+	r, err := s.rancher()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.Cluster(id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "%v", err)
+	}
+	if c == nil {
+		return nil, grpc.Errorf(codes.NotFound, "Cluster %s not found", id)
+	}
+	return c, nil
+}
+
+func (s *Server) CreateCluster(ctx context.Context, req *CreateClusterRequest) (*Cluster, error) {
+	if req.Name == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Name is required")
+	}
+
+	cluster := &client.Cluster{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if len(req.K8SServerConfig) > 0 {
+		cluster.K8sServerConfig = &client.K8sServerConfig{}
+		if err := json.Unmarshal(req.K8SServerConfig, cluster.K8sServerConfig); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "Invalid k8s server config: %v", err)
+		}
+	}
+	t, err := templates.Get(s.config, req.Template)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "Failed to load template %s: %v", req.Template, err)
+	} else if t == nil && req.Template != "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Template %s not found", req.Template)
+	} else if t != nil {
+		t.Apply(cluster)
+	}
+
+	r, err := s.rancher()
+	if err != nil {
+		return nil, err
+	}
+	var kvClient kv.Client
+	if req.Account != "" {
+		if kvClient, err = store.Client(s.config); err == nil {
+			err = quota.Check(ctx, s.config, kvClient, req.Account)
+		}
+		if exceeded, ok := err.(*quota.ExceededError); ok {
+			return nil, grpc.Errorf(codes.ResourceExhausted, "%v", exceeded)
+		} else if err != nil {
+			return nil, grpc.Errorf(codes.Unavailable, "Failed to check quota of account %s: %v", req.Account, err)
+		}
+	}
+	created, err := r.CreateCluster(cluster)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "Failed to create cluster: %v", err)
+	}
+	if req.Account != "" {
+		if err := quota.SetAccount(ctx, kvClient, created.Id, req.Account); err != nil {
+			return nil, grpc.Errorf(codes.Internal, "Failed to record account of cluster %s: %v", created.Id, err)
+		}
+	}
+
+	if t != nil {
+		kvClient, err := store.Client(s.config)
+		if err == nil {
+			err = t.Configure(ctx, kvClient, created.Uuid)
+		}
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "Failed to configure cluster %s: %v", created.Id, err)
+		}
+	}
+
+	logrus.Infof("Created cluster %s (%s) through the admin API", created.Name, created.Id)
+	return s.cluster(created), nil
+}
+
+func (s *Server) DeleteCluster(ctx context.Context, req *DeleteClusterRequest) (*DeleteClusterResponse, error) {
+	c, err := s.lookup(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := s.rancher()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.DeleteCluster(c); err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "Failed to delete cluster %s: %v", c.Id, err)
+	}
+
+	logrus.Infof("Deleted cluster %s (%s) through the admin API", c.Name, c.Id)
+	return &DeleteClusterResponse{}, nil
+}
+
+func (s *Server) ListClusters(ctx context.Context, req *ListClustersRequest) (*ListClustersResponse, error) {
+	r, err := s.rancher()
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := r.Clusters()
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unavailable, "Failed to list clusters: %v", err)
+	}
+
+	resp := &ListClustersResponse{}
+	for _, c := range clusters {
+		resp.Clusters = append(resp.Clusters, s.cluster(c))
+	}
+	return resp, nil
+}
+
+func (s *Server) GetKubeconfig(ctx context.Context, req *GetKubeconfigRequest) (*GetKubeconfigResponse, error) {
+	if req.ServerUrl == "" || req.Token == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "Server URL and token are required")
+	}
+
+	c, err := s.lookup(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var caData []byte
+	if s.config.TLSCAFile != "" {
+		if caData, err = ioutil.ReadFile(s.config.TLSCAFile); err != nil {
+			return nil, grpc.Errorf(codes.Internal, "%v", err)
+		}
+	}
+
+	content, err := kubeconfig.ForToken(c, req.ServerUrl, caData, req.Token)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Internal, "%v", err)
+	}
+	return &GetKubeconfigResponse{
+		Kubeconfig: content,
+	}, nil
+}
+
+// Stats returns the stats of the clusters running on this replica, or of the cluster of the request
+func (s *Server) Stats(ctx context.Context, req *StatsRequest) (*StatsResponse, error) {
+	stats := map[string]*ClusterStats{}
+	for _, server := range s.serverFactory.Servers() {
+		id := server.Cluster().Id
+		stats[id] = &ClusterStats{
+			Id:          id,
+			Running:     true,
+			IdleSeconds: int64(s.serverFactory.Idle(id) / time.Second),
+		}
+	}
+	if s.config.Usage != nil {
+		for _, resource := range s.config.Usage.List() {
+			if stats[resource.Cluster] == nil {
+				stats[resource.Cluster] = &ClusterStats{
+					Id: resource.Cluster,
+				}
+			}
+			stats[resource.Cluster].Rows += resource.Rows
+			stats[resource.Cluster].Bytes += resource.Bytes
+		}
+	}
+
+	resp := &StatsResponse{}
+	if req.Id != "" {
+		if stats[req.Id] == nil {
+			return nil, grpc.Errorf(codes.NotFound, "No stats of cluster %s", req.Id)
+		}
+		resp.Stats = append(resp.Stats, stats[req.Id])
+		return resp, nil
+	}
+	for _, stat := range stats {
+		resp.Stats = append(resp.Stats, stat)
+	}
+	return resp, nil
+}
+
+func (s *Server) cluster(c *client.Cluster) *Cluster {
+	_, running := s.serverFactory.Server(c.Id)
+	return &Cluster{
+		Id:          c.Id,
+		Name:        c.Name,
+		Description: c.Description,
+		State:       c.State,
+		Uuid:        c.Uuid,
+		Running:     running,
+	}
+}
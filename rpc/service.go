@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const serviceName = "netes.admin.v1.Admin"
+
+// AdminServer is the Admin service of netes.proto
+type AdminServer interface {
+	CreateCluster(context.Context, *CreateClusterRequest) (*Cluster, error)
+	DeleteCluster(context.Context, *DeleteClusterRequest) (*DeleteClusterResponse, error)
+	ListClusters(context.Context, *ListClustersRequest) (*ListClustersResponse, error)
+	GetKubeconfig(context.Context, *GetKubeconfigRequest) (*GetKubeconfigResponse, error)
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&adminServiceDesc, srv)
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("CreateCluster", func() interface{} { return &CreateClusterRequest{} },
+			func(ctx context.Context, srv AdminServer, in interface{}) (interface{}, error) {
+				return srv.CreateCluster(ctx, in.(*CreateClusterRequest))
+			}),
+		unary("DeleteCluster", func() interface{} { return &DeleteClusterRequest{} },
+			func(ctx context.Context, srv AdminServer, in interface{}) (interface{}, error) {
+				return srv.DeleteCluster(ctx, in.(*DeleteClusterRequest))
+			}),
+		unary("ListClusters", func() interface{} { return &ListClustersRequest{} },
+			func(ctx context.Context, srv AdminServer, in interface{}) (interface{}, error) {
+				return srv.ListClusters(ctx, in.(*ListClustersRequest))
+			}),
+		unary("GetKubeconfig", func() interface{} { return &GetKubeconfigRequest{} },
+			func(ctx context.Context, srv AdminServer, in interface{}) (interface{}, error) {
+				return srv.GetKubeconfig(ctx, in.(*GetKubeconfigRequest))
+			}),
+		unary("Stats", func() interface{} { return &StatsRequest{} },
+			func(ctx context.Context, srv AdminServer, in interface{}) (interface{}, error) {
+				return srv.Stats(ctx, in.(*StatsRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "netes.proto",
+}
+
+// unary is the method handler protoc-gen-go would generate for a method
+func unary(name string, newRequest func() interface{},
+	call func(ctx context.Context, srv AdminServer, in interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := newRequest()
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(ctx, srv.(AdminServer), in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + serviceName + "/" + name,
+			}
+			return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(ctx, srv.(AdminServer), req)
+			})
+		},
+	}
+}
+
+// AdminClient calls the Admin service of a netes, the admin token is passed with grpc.WithPerRPCCredentials and
+// Token
+type AdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) *AdminClient {
+	return &AdminClient{cc: cc}
+}
+
+func (c *AdminClient) CreateCluster(ctx context.Context, in *CreateClusterRequest, opts ...grpc.CallOption) (*Cluster, error) {
+	out := &Cluster{}
+	return out, grpc.Invoke(ctx, "/"+serviceName+"/CreateCluster", in, out, c.cc, opts...)
+}
+
+func (c *AdminClient) DeleteCluster(ctx context.Context, in *DeleteClusterRequest, opts ...grpc.CallOption) (*DeleteClusterResponse, error) {
+	out := &DeleteClusterResponse{}
+	return out, grpc.Invoke(ctx, "/"+serviceName+"/DeleteCluster", in, out, c.cc, opts...)
+}
+
+func (c *AdminClient) ListClusters(ctx context.Context, in *ListClustersRequest, opts ...grpc.CallOption) (*ListClustersResponse, error) {
+	out := &ListClustersResponse{}
+	return out, grpc.Invoke(ctx, "/"+serviceName+"/ListClusters", in, out, c.cc, opts...)
+}
+
+func (c *AdminClient) GetKubeconfig(ctx context.Context, in *GetKubeconfigRequest, opts ...grpc.CallOption) (*GetKubeconfigResponse, error) {
+	out := &GetKubeconfigResponse{}
+	return out, grpc.Invoke(ctx, "/"+serviceName+"/GetKubeconfig", in, out, c.cc, opts...)
+}
+
+func (c *AdminClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := &StatsResponse{}
+	return out, grpc.Invoke(ctx, "/"+serviceName+"/Stats", in, out, c.cc, opts...)
+}
+
+// Token is the admin token of a netes as credentials of the calls of a client
+type Token string
+
+func (t Token) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + string(t),
+	}, nil
+}
+
+// RequireTransportSecurity is false, the admin API is served without TLS like the admin HTTP API
+func (t Token) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,280 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/pkg/api/v1"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/clientset"
+	"k8s.io/kubernetes/pkg/client/informers/informers_generated/externalversions"
+	corelisters "k8s.io/kubernetes/pkg/client/listers/core/v1"
+	"k8s.io/kubernetes/plugin/pkg/scheduler/algorithm"
+	"k8s.io/kubernetes/plugin/pkg/scheduler/algorithm/predicates"
+	"k8s.io/kubernetes/plugin/pkg/scheduler/schedulercache"
+)
+
+const (
+	syncInterval = time.Second
+	// how long a bound pod counts against its node before the informer has seen the binding
+	assumeTimeout = 30 * time.Second
+)
+
+var filters = []algorithm.FitPredicate{
+	predicates.GeneralPredicates,
+	predicates.PodToleratesNodeTaints,
+	predicates.CheckNodeMemoryPressurePredicate,
+	predicates.CheckNodeDiskPressurePredicate,
+}
+
+type assumedPod struct {
+	pod     *v1.Pod
+	expires time.Time
+}
+
+// Scheduler binds the pods of a cluster that are for the default scheduler to a node.  Nodes are filtered
+// with the upstream resource, host port, node selector and affinity, taint and pressure predicates and the
+// least requested node wins.  Inter-pod affinity, volume zones and preemption are not supported, clusters
+// needing them should run kube-scheduler with a different schedulerName.
+type Scheduler struct {
+	sync.Mutex
+	client  clientset.Interface
+	pods    corelisters.PodLister
+	nodes   corelisters.NodeLister
+	synced  []func() bool
+	assumed map[types.UID]assumedPod
+}
+
+// New registers the informers the scheduler needs with informers, they must be started by the caller
+func New(client clientset.Interface, informers externalversions.SharedInformerFactory) *Scheduler {
+	pods := informers.Core().V1().Pods()
+	nodes := informers.Core().V1().Nodes()
+	return &Scheduler{
+		client:  client,
+		pods:    pods.Lister(),
+		nodes:   nodes.Lister(),
+		synced:  []func() bool{pods.Informer().HasSynced, nodes.Informer().HasSynced},
+		assumed: map[types.UID]assumedPod{},
+	}
+}
+
+func (s *Scheduler) Start(stop <-chan struct{}) {
+	go wait.Until(s.sync, syncInterval, stop)
+}
+
+func (s *Scheduler) sync() {
+	for _, synced := range s.synced {
+		if !synced() {
+			return
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	pods, err := s.pods.List(labels.Everything())
+	if err != nil {
+		logrus.Errorf("Failed to list pods to schedule: %v", err)
+		return
+	}
+
+	var pending []*v1.Pod
+	podsByNode := map[string][]*v1.Pod{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" {
+			delete(s.assumed, pod.UID)
+			if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+				podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
+			}
+		} else if _, ok := s.assumed[pod.UID]; !ok && s.responsibleFor(pod) {
+			pending = append(pending, pod)
+		}
+	}
+
+	now := time.Now()
+	for uid, assumed := range s.assumed {
+		if now.After(assumed.expires) {
+			delete(s.assumed, uid)
+		} else {
+			podsByNode[assumed.pod.Spec.NodeName] = append(podsByNode[assumed.pod.Spec.NodeName], assumed.pod)
+		}
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+
+	nodes, err := s.nodes.List(labels.Everything())
+	if err != nil {
+		logrus.Errorf("Failed to list nodes to schedule pods: %v", err)
+		return
+	}
+
+	// oldest first so a burst of new pods doesn't starve the ones waiting longest
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreationTimestamp.Before(pending[j].CreationTimestamp)
+	})
+
+	for _, pod := range pending {
+		nodeName, reasons := s.selectNode(pod, nodes, podsByNode)
+		if nodeName == "" {
+			s.unschedulable(pod, len(nodes), reasons)
+			continue
+		}
+		if err := s.bind(pod, nodeName); err != nil {
+			logrus.Errorf("Failed to bind pod %s/%s to node %s: %v", pod.Namespace, pod.Name, nodeName, err)
+			continue
+		}
+		bound := *pod
+		bound.Spec.NodeName = nodeName
+		s.assumed[pod.UID] = assumedPod{
+			pod:     &bound,
+			expires: now.Add(assumeTimeout),
+		}
+		podsByNode[nodeName] = append(podsByNode[nodeName], &bound)
+	}
+}
+
+func (s *Scheduler) responsibleFor(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	return pod.Spec.SchedulerName == "" || pod.Spec.SchedulerName == v1.DefaultSchedulerName
+}
+
+// selectNode returns the name of the least requested node that fits pod, or the counts of the reasons the
+// nodes don't fit
+func (s *Scheduler) selectNode(pod *v1.Pod, nodes []*v1.Node, podsByNode map[string][]*v1.Pod) (string, map[string]int) {
+	reasons := map[string]int{}
+	request := predicates.GetResourceRequest(pod)
+
+	bestNode := ""
+	bestScore := int64(-1)
+	for _, node := range nodes {
+		if reason := nodeUnavailable(node); reason != "" {
+			reasons[reason]++
+			continue
+		}
+
+		nodeInfo := schedulercache.NewNodeInfo(podsByNode[node.Name]...)
+		if err := nodeInfo.SetNode(node); err != nil {
+			logrus.Errorf("Failed to read node %s: %v", node.Name, err)
+			continue
+		}
+
+		if !fits(pod, nodeInfo, reasons) {
+			continue
+		}
+
+		if score := leastRequested(request, nodeInfo); score > bestScore {
+			bestNode, bestScore = node.Name, score
+		}
+	}
+
+	return bestNode, reasons
+}
+
+func nodeUnavailable(node *v1.Node) string {
+	if node.Spec.Unschedulable {
+		return "node(s) were unschedulable"
+	}
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady && cond.Status != v1.ConditionTrue {
+			return "node(s) were not ready"
+		}
+		if cond.Type == v1.NodeOutOfDisk && cond.Status != v1.ConditionFalse {
+			return "node(s) were out of disk space"
+		}
+		if cond.Type == v1.NodeNetworkUnavailable && cond.Status != v1.ConditionFalse {
+			return "node(s) had unavailable network"
+		}
+	}
+	return ""
+}
+
+func fits(pod *v1.Pod, nodeInfo *schedulercache.NodeInfo, reasons map[string]int) bool {
+	for _, filter := range filters {
+		fit, failures, err := filter(pod, nil, nodeInfo)
+		if err != nil {
+			logrus.Errorf("Failed to check if pod %s/%s fits node %s: %v", pod.Namespace, pod.Name, nodeInfo.Node().Name, err)
+			return false
+		}
+		if !fit {
+			for _, failure := range failures {
+				reasons[failure.GetReason()]++
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// leastRequested scores from 0 to 20 how much cpu and memory would be left on the node after adding request
+func leastRequested(request *schedulercache.Resource, nodeInfo *schedulercache.NodeInfo) int64 {
+	requested := nodeInfo.NonZeroRequest()
+	allocatable := nodeInfo.AllocatableResource()
+	return free(requested.MilliCPU+request.MilliCPU, allocatable.MilliCPU) +
+		free(requested.Memory+request.Memory, allocatable.Memory)
+}
+
+func free(requested, capacity int64) int64 {
+	if capacity == 0 || requested > capacity {
+		return 0
+	}
+	return (capacity - requested) * 10 / capacity
+}
+
+func (s *Scheduler) bind(pod *v1.Pod, nodeName string) error {
+	return s.client.CoreV1().Pods(pod.Namespace).Bind(&v1.Binding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID,
+		},
+		Target: v1.ObjectReference{
+			Kind: "Node",
+			Name: nodeName,
+		},
+	})
+}
+
+// unschedulable sets the PodScheduled condition the way kube-scheduler does, so kubectl describe and the
+// status rollup show why the pod is pending
+func (s *Scheduler) unschedulable(pod *v1.Pod, nodeCount int, reasons map[string]int) {
+	var parts []string
+	for reason, count := range reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", count, reason))
+	}
+	sort.Strings(parts)
+
+	message := fmt.Sprintf("0/%d nodes are available", nodeCount)
+	if len(parts) > 0 {
+		message += ": " + strings.Join(parts, ", ")
+	}
+	message += "."
+
+	status := pod.Status
+	status.Conditions = append([]v1.PodCondition(nil), pod.Status.Conditions...)
+	if !podutil.UpdatePodCondition(&status, &v1.PodCondition{
+		Type:    v1.PodScheduled,
+		Status:  v1.ConditionFalse,
+		Reason:  v1.PodReasonUnschedulable,
+		Message: message,
+	}) {
+		return
+	}
+
+	update := *pod
+	update.Status = status
+	if _, err := s.client.CoreV1().Pods(pod.Namespace).UpdateStatus(&update); err != nil {
+		logrus.Errorf("Failed to update status of unschedulable pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+}
@@ -1,9 +1,18 @@
 package admission
 
 import (
+	"fmt"
+	"net"
+
+	"github.com/Sirupsen/logrus"
 	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
 	"github.com/rancher/netes/clients"
+	"github.com/rancher/netes/proxy"
+	"github.com/rancher/netes/store"
 	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/apiserver/pkg/admission/initializer"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
@@ -34,10 +43,11 @@ import (
 	"k8s.io/kubernetes/plugin/pkg/admission/securitycontext/scdeny"
 	"k8s.io/kubernetes/plugin/pkg/admission/serviceaccount"
 	"k8s.io/kubernetes/plugin/pkg/admission/storageclass/setdefault"
-	"k8s.io/kubernetes/plugin/pkg/admission/webhook"
 )
 
-func New(config *types.GlobalConfig, cluster *client.Cluster, authz authorizer.Authorizer, clients *clients.ClientSetSet) (admission.Interface, error) {
+func New(config *types.GlobalConfig, cluster *client.Cluster, authz authorizer.Authorizer, clients *clients.ClientSetSet,
+	resourcePrefix func(schema.GroupResource) string, dialer func(network, addr string) (net.Conn, error),
+	stopCh <-chan struct{}) (admission.Interface, error) {
 	pluginInitializer := kubeapiserveradmission.NewPluginInitializer(clients.InternalClient,
 		clients.ExternalClient,
 		clients.InternalSharedInformers,
@@ -46,20 +56,129 @@ func New(config *types.GlobalConfig, cluster *client.Cluster, authz authorizer.A
 		api.Registry.RESTMapper(),
 		quotainstall.NewRegistry(nil, nil))
 
-	names := types.FirstNotLenZero(cluster.K8sServerConfig.AdmissionControllers, config.AdmissionControllers)
-	pluginsConfigProvider, err := admission.ReadAdmissionConfiguration(names,"")
+	kvClient, err := store.Client(config)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginConfig, err := LoadPluginConfig(context.Background(), kvClient, cluster.Uuid)
 	if err != nil {
 		return nil, err
 	}
+	names := pluginConfig.names(types.FirstNotLenZero(cluster.K8sServerConfig.AdmissionControllers, config.AdmissionControllers))
 
 	genericInitializer, err := initializer.New(clients.Client, clients.SharedInformers, authz)
 	if err != nil {
 		return nil, err
 	}
 
-	return admissionPlugins().NewFromPlugins(names,
-		pluginsConfigProvider,
-		admission.PluginInitializers{genericInitializer, pluginInitializer})
+	plugins, err := newPlugins(names,
+		pluginConfig,
+		admission.PluginInitializers{genericInitializer, pluginInitializer, dialerInitializer{dialer}, stopChInitializer{stopCh}})
+	if err != nil {
+		return nil, err
+	}
+
+	var handlers []admission.Interface
+	if config.Replication != nil {
+		handlers = append(handlers, newStandby(config.Replication, cluster.Id))
+	}
+
+	taints := types.FirstNotLenZero(cluster.K8sServerConfig.SystemTaints, config.SystemTaints)
+	nodeSelector := types.FirstNotLenZero(cluster.K8sServerConfig.SystemNodeSelector, config.SystemNodeSelector)
+	if len(taints) > 0 || len(nodeSelector) > 0 {
+		placement, err := newSystemPlacement(taints, nodeSelector)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, placement)
+	}
+	handlers = append(handlers, plugins)
+
+	// after the plugins, so the pods are checked as they were mutated
+	level := types.FirstNotEmpty(cluster.K8sServerConfig.PodSecurityLevel, config.PodSecurityLevel)
+	if level != "" && level != PodSecurityPrivileged {
+		security, err := newPodSecurity(level,
+			types.FirstNotLenZero(cluster.K8sServerConfig.PodSecurityExemptNamespaces, config.PodSecurityExemptNamespaces))
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, security)
+	}
+
+	if verifier := types.FirstNotEmpty(pluginConfig.ImageVerifier, config.ImageVerifier); verifier != "" {
+		transport, err := proxy.OutboundTransport(config, cluster)
+		if err != nil {
+			return nil, err
+		}
+		verification, err := newImageVerification(verifier,
+			types.FirstNotEmpty(pluginConfig.ImageVerifierConfig, config.ImageVerifierConfig), transport)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, verification)
+	}
+
+	maxPerNamespace := types.FirstNotZero(cluster.K8sServerConfig.MaxObjectsPerNamespace, config.MaxObjectsPerNamespace)
+	maxPerCluster := types.FirstNotZero(cluster.K8sServerConfig.MaxObjectsPerCluster, config.MaxObjectsPerCluster)
+	if (maxPerNamespace > 0 || maxPerCluster > 0) && store.Etcd(cluster) {
+		logrus.Warnf("Object count quotas are not enforced for cluster %s, objects are only counted in the database", cluster.Id)
+	} else if maxPerNamespace > 0 || maxPerCluster > 0 {
+		counter, ok := kvClient.(kv.Counter)
+		if !ok {
+			return nil, fmt.Errorf("storage can not count objects for object count quotas")
+		}
+		// like the resource quota the object count isn't charged for dry runs
+		objectCount := newObjectCount(counter, store.ClusterPrefix(cluster), resourcePrefix, maxPerNamespace, maxPerCluster)
+		handlers = append(handlers, skipDryRun{objectCount})
+	}
+
+	if len(handlers) == 1 {
+		return plugins, nil
+	}
+	return admission.NewChainHandler(handlers...), nil
+}
+
+// chargesQuota are the plugins that charge what they admit to a quota, dry runs don't
+var chargesQuota = map[string]bool{
+	"ResourceQuota": true,
+}
+
+// newPlugins chains the named plugins like Plugins.NewFromPlugins, with the ones that charge quotas skipping dry runs
+func newPlugins(names []string, configProvider admission.ConfigProvider, initializer admission.PluginInitializer) (admission.Interface, error) {
+	registered := admissionPlugins()
+
+	var plugins []admission.Interface
+	for _, name := range names {
+		config, err := configProvider.ConfigFor(name)
+		if err != nil {
+			return nil, err
+		}
+		plugin, err := registered.InitPlugin(name, config, initializer)
+		if err != nil {
+			return nil, err
+		}
+		if plugin == nil {
+			continue
+		}
+		if chargesQuota[name] {
+			plugin = skipDryRun{plugin}
+		}
+		plugins = append(plugins, plugin)
+	}
+	return admission.NewChainHandler(plugins...), nil
+}
+
+// skipDryRun admits dry runs without asking the plugin
+type skipDryRun struct {
+	admission.Interface
+}
+
+func (s skipDryRun) Admit(a admission.Attributes) error {
+	if store.IsDryRun(a.GetUserInfo()) {
+		return nil
+	}
+	return s.Interface.Admit(a)
 }
 
 func admissionPlugins() *admission.Plugins {
@@ -89,7 +208,7 @@ func admissionPlugins() *admission.Plugins {
 	scdeny.Register(plugins)
 	serviceaccount.Register(plugins)
 	setdefault.Register(plugins)
-	webhook.Register(plugins)
+	registerWebhook(plugins)
 
 	return plugins
 }
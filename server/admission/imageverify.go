@@ -0,0 +1,152 @@
+package admission
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/netes/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	verifyCacheSize        = 4096
+	verifyCacheTTL         = 5 * time.Minute
+	verifyNegativeCacheTTL = 30 * time.Second
+)
+
+// ImageVerifier checks that an image is signed by someone trusted by config, the verifier specific policy
+// of a cluster.  An error means the verifier couldn't tell.
+type ImageVerifier interface {
+	Verify(image, config string) (ImageVerification, error)
+}
+
+// ImageVerification is the decision of a verifier.  Digest is the digest the image resolved to, results are only
+// cached by digest as the tag of an image can be moved to another one.
+type ImageVerification struct {
+	Trusted bool
+	Reason  string
+	Digest  string
+}
+
+// OutboundImageVerifier is implemented by verifiers calling a service outside of the cluster, the verifier of a
+// cluster calls it through the outbound transport of the cluster
+type OutboundImageVerifier interface {
+	ImageVerifier
+	WithTransport(transport http.RoundTripper) ImageVerifier
+}
+
+var (
+	imageVerifiersLock sync.Mutex
+	imageVerifiers     = map[string]ImageVerifier{}
+)
+
+// RegisterImageVerifier makes a verifier available to clusters by name
+func RegisterImageVerifier(name string, verifier ImageVerifier) {
+	imageVerifiersLock.Lock()
+	defer imageVerifiersLock.Unlock()
+	imageVerifiers[name] = verifier
+}
+
+func getImageVerifier(name string) (ImageVerifier, bool) {
+	imageVerifiersLock.Lock()
+	defer imageVerifiersLock.Unlock()
+	v, ok := imageVerifiers[name]
+	return v, ok
+}
+
+// imageVerification rejects pods with images the verifier does not trust.  Results are cached by digest so pods
+// of images pinned to a digest don't each wait for the verifier, untrusted results for a shorter time so a newly
+// signed image is admitted quickly.  Images referenced by tag are verified every time.  If the verifier fails the
+// pod is rejected.
+type imageVerification struct {
+	*admission.Handler
+	verifier ImageVerifier
+	config   string
+	cache    *cache.LRUExpireCache
+}
+
+func newImageVerification(name, config string, transport http.RoundTripper) (*imageVerification, error) {
+	verifier, ok := getImageVerifier(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown image verifier %s", name)
+	}
+	if outbound, ok := verifier.(OutboundImageVerifier); ok {
+		verifier = outbound.WithTransport(transport)
+	}
+
+	return &imageVerification{
+		Handler:  admission.NewHandler(admission.Create, admission.Update),
+		verifier: verifier,
+		config:   config,
+		cache:    cache.NewLRUExpireCache(verifyCacheSize),
+	}, nil
+}
+
+func (v *imageVerification) Admit(a admission.Attributes) error {
+	if a.GetResource().GroupResource() != api.Resource("pods") || a.GetSubresource() != "" {
+		return nil
+	}
+
+	pod, ok := a.GetObject().(*api.Pod)
+	if !ok {
+		return nil
+	}
+
+	var containers []api.Container
+	containers = append(containers, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+
+	for _, container := range containers {
+		result, err := v.verify(container.Image)
+		if err != nil {
+			logrus.Errorf("Failed to verify image %s: %v", container.Image, err)
+			return admission.NewForbidden(a, fmt.Errorf("image %s could not be verified: %v", container.Image, err))
+		}
+		if !result.Trusted {
+			return admission.NewForbidden(a, fmt.Errorf("image %s is not trusted: %s", container.Image, result.Reason))
+		}
+	}
+
+	return nil
+}
+
+func (v *imageVerification) verify(image string) (ImageVerification, error) {
+	digest := imageDigest(image)
+	if digest != "" {
+		if cached, ok := v.cache.Get(digest); ok {
+			return cached.(ImageVerification), nil
+		}
+	}
+
+	result, err := v.verifier.Verify(image, v.config)
+	if err != nil {
+		return ImageVerification{}, err
+	}
+
+	// the digest the verifier resolved is what it checked, pods pinned to it use the result
+	digest = types.FirstNotEmpty(result.Digest, digest)
+	if digest == "" {
+		return result, nil
+	}
+	if result.Trusted {
+		v.cache.Add(digest, result, verifyCacheTTL)
+	} else {
+		v.cache.Add(digest, result, verifyNegativeCacheTTL)
+	}
+	return result, nil
+}
+
+// imageDigest returns the digest an image is pinned to, like sha256:... for image@sha256:..., empty for images
+// referenced by tag
+func imageDigest(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
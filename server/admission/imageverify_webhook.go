@@ -0,0 +1,78 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const webhookVerifierTimeout = 10 * time.Second
+
+func init() {
+	RegisterImageVerifier("webhook", &webhookVerifier{
+		httpClient: &http.Client{
+			Timeout: webhookVerifierTimeout,
+		},
+	})
+}
+
+type webhookRequest struct {
+	Image string `json:"image"`
+}
+
+type webhookResponse struct {
+	Trusted bool   `json:"trusted"`
+	Reason  string `json:"reason,omitempty"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+// webhookVerifier asks the service at the URL given as config, which can wrap Notary, cosign or any other
+// signing scheme.  It posts {"image": ...} and expects {"trusted": bool, "reason": ..., "digest": ...} back, the
+// digest being the one the image resolved to.
+type webhookVerifier struct {
+	httpClient *http.Client
+}
+
+func (w *webhookVerifier) WithTransport(transport http.RoundTripper) ImageVerifier {
+	return &webhookVerifier{
+		httpClient: &http.Client{
+			Timeout:   webhookVerifierTimeout,
+			Transport: transport,
+		},
+	}
+}
+
+func (w *webhookVerifier) Verify(image, config string) (ImageVerification, error) {
+	if config == "" {
+		return ImageVerification{}, fmt.Errorf("webhook image verifier needs a URL as config")
+	}
+
+	body, err := json.Marshal(&webhookRequest{
+		Image: image,
+	})
+	if err != nil {
+		return ImageVerification{}, err
+	}
+
+	resp, err := w.httpClient.Post(config, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return ImageVerification{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return ImageVerification{}, fmt.Errorf("image verifier returned %d", resp.StatusCode)
+	}
+
+	result := webhookResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return ImageVerification{}, err
+	}
+	return ImageVerification{
+		Trusted: result.Trusted,
+		Reason:  result.Reason,
+		Digest:  result.Digest,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package admission
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+)
+
+// objectCount rejects creates once a namespace holds too many objects of one resource or the cluster holds too
+// many objects overall, counted by the storage so the database is protected from runaway controllers
+type objectCount struct {
+	*admission.Handler
+	counter         kv.Counter
+	prefix          string
+	resourcePrefix  func(schema.GroupResource) string
+	maxPerNamespace int64
+	maxPerCluster   int64
+}
+
+func newObjectCount(counter kv.Counter, prefix string, resourcePrefix func(schema.GroupResource) string, maxPerNamespace, maxPerCluster int64) *objectCount {
+	return &objectCount{
+		Handler:         admission.NewHandler(admission.Create),
+		counter:         counter,
+		prefix:          prefix,
+		resourcePrefix:  resourcePrefix,
+		maxPerNamespace: maxPerNamespace,
+		maxPerCluster:   maxPerCluster,
+	}
+}
+
+func (o *objectCount) Admit(a admission.Attributes) error {
+	if a.GetSubresource() != "" {
+		return nil
+	}
+
+	if o.maxPerNamespace > 0 && a.GetNamespace() != "" {
+		resource := a.GetResource().GroupResource()
+		key := path.Join(o.prefix, o.resourcePrefix(resource), a.GetNamespace()) + "/"
+		if o.exceeds(key, o.maxPerNamespace) {
+			return admission.NewForbidden(a, fmt.Errorf("namespace %s has reached the maximum of %d %s",
+				a.GetNamespace(), o.maxPerNamespace, resource.String()))
+		}
+	}
+
+	if o.maxPerCluster > 0 && o.exceeds(o.prefix+"/", o.maxPerCluster) {
+		return admission.NewForbidden(a, fmt.Errorf("cluster has reached the maximum of %d objects", o.maxPerCluster))
+	}
+
+	return nil
+}
+
+func (o *objectCount) exceeds(key string, max int64) bool {
+	count, err := o.counter.Count(context.Background(), key)
+	if err != nil {
+		logrus.Errorf("Failed to count objects under %s, allowing create: %v", key, err)
+		return false
+	}
+	return count >= max
+}
@@ -0,0 +1,114 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const pluginConfigPrefix = "/netes/admission/"
+
+// PluginConfig is the admission plugin configuration of a cluster set through the admin API, stored by the uuid of
+// the cluster like its storage so a cluster recreated with the same id starts from the defaults.  Enabled replaces
+// the admission controllers of the cluster in Rancher and the global defaults, Disabled is removed from them.
+// Config is the configuration file content of a plugin by plugin name.  ImageVerifier and ImageVerifierConfig
+// override the global image verifier of netes, they live here because Rancher doesn't know about them.
+type PluginConfig struct {
+	Enabled             []string          `json:"enabled,omitempty"`
+	Disabled            []string          `json:"disabled,omitempty"`
+	Config              map[string]string `json:"config,omitempty"`
+	ImageVerifier       string            `json:"imageVerifier,omitempty"`
+	ImageVerifierConfig string            `json:"imageVerifierConfig,omitempty"`
+}
+
+// ConfigFor returns the configuration of a plugin, nil if none is set
+func (c *PluginConfig) ConfigFor(pluginName string) (io.Reader, error) {
+	if config, ok := c.Config[pluginName]; ok {
+		return strings.NewReader(config), nil
+	}
+	return nil, nil
+}
+
+func (c *PluginConfig) names(defaults []string) []string {
+	names := defaults
+	if len(c.Enabled) > 0 {
+		names = c.Enabled
+	}
+
+	disabled := sets.NewString(c.Disabled...)
+	var result []string
+	for _, name := range names {
+		if !disabled.Has(name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// Validate checks that the plugins and the image verifier are known to netes
+func (c *PluginConfig) Validate() error {
+	if c.ImageVerifier != "" {
+		if _, ok := getImageVerifier(c.ImageVerifier); !ok {
+			return fmt.Errorf("unknown image verifier %s", c.ImageVerifier)
+		}
+	}
+
+	registered := sets.NewString(admissionPlugins().Registered()...)
+	for _, names := range [][]string{c.Enabled, c.Disabled} {
+		for _, name := range names {
+			if !registered.Has(name) {
+				return fmt.Errorf("unknown admission plugin %s", name)
+			}
+		}
+	}
+	for name := range c.Config {
+		if !registered.Has(name) {
+			return fmt.Errorf("unknown admission plugin %s", name)
+		}
+	}
+	return nil
+}
+
+// LoadPluginConfig returns the admission plugin configuration of a cluster, empty if none is set
+func LoadPluginConfig(ctx context.Context, client kv.Client, clusterUUID string) (*PluginConfig, error) {
+	config := &PluginConfig{}
+	current, err := client.Get(ctx, pluginConfigPrefix+clusterUUID)
+	if err != nil || current == nil {
+		return config, err
+	}
+	return config, json.Unmarshal(current.Value, config)
+}
+
+// SavePluginConfig stores the admission plugin configuration of a cluster, servers use it once restarted
+func SavePluginConfig(ctx context.Context, client kv.Client, clusterUUID string, config *PluginConfig) error {
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	key := pluginConfigPrefix + clusterUUID
+	current, err := client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		_, err = client.Create(ctx, key, value, 0)
+	} else {
+		_, err = client.UpdateOrCreate(ctx, key, value, current.Revision, 0)
+	}
+	return err
+}
+
+// DeletePluginConfig removes the admission plugin configuration of a cluster
+func DeletePluginConfig(ctx context.Context, client kv.Client, clusterUUID string) error {
+	_, err := client.Delete(ctx, pluginConfigPrefix+clusterUUID)
+	if err == kv.ErrNotExists {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,219 @@
+package admission
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/security/apparmor"
+)
+
+const (
+	// PodSecurityPrivileged enforces nothing, the default
+	PodSecurityPrivileged = "privileged"
+	// PodSecurityBaseline rejects pods using the known privilege escalations, like host namespaces, privileged
+	// containers and host paths, like the baseline Pod Security Standard
+	PodSecurityBaseline = "baseline"
+	// PodSecurityRestricted also requires pods to run as non-root, drop all capabilities, use a seccomp profile and
+	// only the volume types of the restricted PodSecurityPolicy of upstream
+	PodSecurityRestricted = "restricted"
+)
+
+var (
+	// the capabilities the container runtime grants by default
+	baselineCapabilities = sets.NewString("AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+		"NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT")
+	restrictedCapabilities = sets.NewString("NET_BIND_SERVICE")
+	safeSysctls            = sets.NewString("kernel.shm_rmid_forced", "net.ipv4.ip_local_port_range", "net.ipv4.tcp_syncookies")
+	seLinuxTypes           = sets.NewString("", "container_t", "container_init_t", "container_kvm_t")
+)
+
+// podSecurity rejects pods that don't meet the pod security level of the cluster, so the hosting provider can
+// guarantee a minimum security posture whatever the tenant does with its RBAC.  Pods of the exempt namespaces are
+// not checked.
+type podSecurity struct {
+	*admission.Handler
+	level  string
+	exempt sets.String
+}
+
+// ValidatePodSecurityLevel checks a pod security level set for a cluster, empty is privileged
+func ValidatePodSecurityLevel(level string) error {
+	switch level {
+	case "", PodSecurityPrivileged, PodSecurityBaseline, PodSecurityRestricted:
+		return nil
+	}
+	return fmt.Errorf("invalid pod security level %s, expected %s, %s or %s", level,
+		PodSecurityPrivileged, PodSecurityBaseline, PodSecurityRestricted)
+}
+
+func newPodSecurity(level string, exemptNamespaces []string) (*podSecurity, error) {
+	if err := ValidatePodSecurityLevel(level); err != nil {
+		return nil, err
+	}
+
+	return &podSecurity{
+		Handler: admission.NewHandler(admission.Create, admission.Update),
+		level:   level,
+		exempt:  sets.NewString(exemptNamespaces...),
+	}, nil
+}
+
+func (p *podSecurity) Admit(a admission.Attributes) error {
+	if a.GetResource().GroupResource() != api.Resource("pods") || a.GetSubresource() != "" {
+		return nil
+	}
+	if p.exempt.Has(a.GetNamespace()) {
+		return nil
+	}
+
+	pod, ok := a.GetObject().(*api.Pod)
+	if !ok {
+		return nil
+	}
+
+	if violations := p.violations(pod); len(violations) > 0 {
+		return admission.NewForbidden(a, fmt.Errorf("violates the %s pod security level of the cluster: %s", p.level,
+			strings.Join(violations, ", ")))
+	}
+	return nil
+}
+
+func (p *podSecurity) violations(pod *api.Pod) []string {
+	restricted := p.level == PodSecurityRestricted
+	var result []string
+
+	podContext := pod.Spec.SecurityContext
+	if podContext == nil {
+		podContext = &api.PodSecurityContext{}
+	}
+	if podContext.HostNetwork {
+		result = append(result, "hostNetwork")
+	}
+	if podContext.HostPID {
+		result = append(result, "hostPID")
+	}
+	if podContext.HostIPC {
+		result = append(result, "hostIPC")
+	}
+	if !allowedSELinux(podContext.SELinuxOptions) {
+		result = append(result, "seLinuxOptions")
+	}
+
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil {
+			result = append(result, fmt.Sprintf("hostPath volume %s", v.Name))
+		} else if restricted && !restrictedVolume(v.VolumeSource) {
+			result = append(result, fmt.Sprintf("volume %s is not a configMap, downwardAPI, emptyDir, persistentVolumeClaim, projected or secret", v.Name))
+		}
+	}
+
+	if pod.Annotations[api.SeccompPodAnnotationKey] == "unconfined" {
+		result = append(result, "unconfined seccomp profile")
+	}
+	if pod.Annotations[api.UnsafeSysctlsPodAnnotationKey] != "" {
+		result = append(result, "unsafe sysctls")
+	}
+	for _, sysctl := range strings.Split(pod.Annotations[api.SysctlsPodAnnotationKey], ",") {
+		name := strings.SplitN(sysctl, "=", 2)[0]
+		if name != "" && !safeSysctls.Has(name) {
+			result = append(result, fmt.Sprintf("sysctl %s", name))
+		}
+	}
+
+	var containers []api.Container
+	containers = append(containers, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, c := range containers {
+		result = append(result, p.containerViolations(pod, podContext, c)...)
+	}
+	return result
+}
+
+func (p *podSecurity) containerViolations(pod *api.Pod, podContext *api.PodSecurityContext, c api.Container) []string {
+	restricted := p.level == PodSecurityRestricted
+	var result []string
+	violation := func(format string, args ...interface{}) {
+		result = append(result, fmt.Sprintf("container %s: ", c.Name)+fmt.Sprintf(format, args...))
+	}
+
+	context := c.SecurityContext
+	if context == nil {
+		context = &api.SecurityContext{}
+	}
+	if context.Privileged != nil && *context.Privileged {
+		violation("privileged")
+	}
+	if !allowedSELinux(context.SELinuxOptions) {
+		violation("seLinuxOptions")
+	}
+	for _, port := range c.Ports {
+		if port.HostPort != 0 {
+			violation("hostPort %d", port.HostPort)
+		}
+	}
+
+	if profile, ok := pod.Annotations[apparmor.ContainerAnnotationKeyPrefix+c.Name]; ok &&
+		profile != apparmor.ProfileRuntimeDefault && !strings.HasPrefix(profile, apparmor.ProfileNamePrefix) {
+		violation("AppArmor profile %s", profile)
+	}
+	seccomp, ok := pod.Annotations[api.SeccompContainerAnnotationKeyPrefix+c.Name]
+	if !ok {
+		seccomp = pod.Annotations[api.SeccompPodAnnotationKey]
+	} else if seccomp == "unconfined" {
+		violation("unconfined seccomp profile")
+	}
+
+	allowedCapabilities := baselineCapabilities
+	if restricted {
+		allowedCapabilities = restrictedCapabilities
+	}
+	dropsAll := false
+	if context.Capabilities != nil {
+		for _, capability := range context.Capabilities.Add {
+			if !allowedCapabilities.Has(strings.TrimPrefix(string(capability), "CAP_")) {
+				violation("capability %s", capability)
+			}
+		}
+		for _, capability := range context.Capabilities.Drop {
+			dropsAll = dropsAll || capability == "ALL"
+		}
+	}
+
+	if !restricted {
+		return result
+	}
+
+	if !dropsAll {
+		violation("capabilities are not dropped with ALL")
+	}
+	if seccomp != "runtime/default" && seccomp != "docker/default" && !strings.HasPrefix(seccomp, "localhost/") {
+		violation("no runtime/default or localhost seccomp profile")
+	}
+	runAsNonRoot := context.RunAsNonRoot
+	if runAsNonRoot == nil {
+		runAsNonRoot = podContext.RunAsNonRoot
+	}
+	if runAsNonRoot == nil || !*runAsNonRoot {
+		violation("runAsNonRoot is not true")
+	}
+	runAsUser := context.RunAsUser
+	if runAsUser == nil {
+		runAsUser = podContext.RunAsUser
+	}
+	if runAsUser != nil && *runAsUser == 0 {
+		violation("runAsUser is 0")
+	}
+	return result
+}
+
+func allowedSELinux(options *api.SELinuxOptions) bool {
+	return options == nil || (options.User == "" && options.Role == "" && seLinuxTypes.Has(options.Type))
+}
+
+func restrictedVolume(source api.VolumeSource) bool {
+	return source.ConfigMap != nil || source.DownwardAPI != nil || source.EmptyDir != nil ||
+		source.PersistentVolumeClaim != nil || source.Projected != nil || source.Secret != nil
+}
@@ -0,0 +1,43 @@
+package admission
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+)
+
+const standbyRetrySeconds = 30
+
+type standbyChecker interface {
+	IsStandby(clusterID string) bool
+}
+
+// standby rejects writes while the cluster is replicated from a primary in another site, they would be
+// overwritten by replication and never reach the primary
+type standby struct {
+	*admission.Handler
+	checker   standbyChecker
+	clusterID string
+}
+
+func newStandby(checker standbyChecker, clusterID string) *standby {
+	return &standby{
+		Handler:   admission.NewHandler(admission.Create, admission.Update, admission.Delete),
+		checker:   checker,
+		clusterID: clusterID,
+	}
+}
+
+func (s *standby) Admit(a admission.Attributes) error {
+	if !s.checker.IsStandby(s.clusterID) {
+		return nil
+	}
+
+	err := apierrors.NewServiceUnavailable(fmt.Sprintf("cluster %s is a replication standby", s.clusterID))
+	err.ErrStatus.Details = &metav1.StatusDetails{
+		RetryAfterSeconds: standbyRetrySeconds,
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package admission
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/helper"
+	kubelettypes "k8s.io/kubernetes/pkg/kubelet/types"
+)
+
+// systemPlacement places the pods of kube-system, the DNS and metrics addons, on the hosts dedicated to them.
+// System pods get a toleration for every system taint, the system node selector and the critical pod
+// annotation so they are rescheduled before tenant pods and not evicted by the kubelet.  Pods of other
+// namespaces can't tolerate the system taints, so tenants can't take the capacity of the system hosts.
+type systemPlacement struct {
+	*admission.Handler
+	taints       []api.Taint
+	nodeSelector map[string]string
+}
+
+func newSystemPlacement(taints, nodeSelector []string) (*systemPlacement, error) {
+	p := &systemPlacement{
+		Handler:      admission.NewHandler(admission.Create, admission.Update),
+		nodeSelector: map[string]string{},
+	}
+
+	for _, spec := range taints {
+		taint, err := parseTaint(spec)
+		if err != nil {
+			return nil, err
+		}
+		p.taints = append(p.taints, taint)
+	}
+
+	for _, spec := range nodeSelector {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid system node selector %s, expected key=value", spec)
+		}
+		p.nodeSelector[parts[0]] = parts[1]
+	}
+
+	return p, nil
+}
+
+// parseTaint parses key=value:effect or key:effect like kubectl taint
+func parseTaint(spec string) (api.Taint, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return api.Taint{}, fmt.Errorf("invalid system taint %s, expected key=value:effect", spec)
+	}
+
+	taint := api.Taint{
+		Effect: api.TaintEffect(spec[i+1:]),
+	}
+	parts := strings.SplitN(spec[:i], "=", 2)
+	taint.Key = parts[0]
+	if len(parts) == 2 {
+		taint.Value = parts[1]
+	}
+
+	switch taint.Effect {
+	case api.TaintEffectNoSchedule, api.TaintEffectPreferNoSchedule, api.TaintEffectNoExecute:
+	default:
+		return api.Taint{}, fmt.Errorf("invalid effect of system taint %s", spec)
+	}
+	if taint.Key == "" {
+		return api.Taint{}, fmt.Errorf("invalid system taint %s, key is empty", spec)
+	}
+	return taint, nil
+}
+
+func (p *systemPlacement) Admit(a admission.Attributes) error {
+	if a.GetResource().GroupResource() != api.Resource("pods") || a.GetSubresource() != "" {
+		return nil
+	}
+
+	pod, ok := a.GetObject().(*api.Pod)
+	if !ok {
+		return nil
+	}
+
+	if a.GetNamespace() != metav1.NamespaceSystem {
+		for i := range pod.Spec.Tolerations {
+			for j := range p.taints {
+				if helper.TolerationToleratesTaint(&pod.Spec.Tolerations[i], &p.taints[j]) {
+					return admission.NewForbidden(a, fmt.Errorf("only pods of %s can tolerate the taint %s of system hosts",
+						metav1.NamespaceSystem, p.taints[j].ToString()))
+				}
+			}
+		}
+		return nil
+	}
+
+	// the node selector and tolerations can't be changed once the pod is scheduled
+	if a.GetOperation() != admission.Create {
+		return nil
+	}
+
+	for i := range p.taints {
+		if !tolerates(pod, &p.taints[i]) {
+			pod.Spec.Tolerations = append(pod.Spec.Tolerations, toleration(p.taints[i]))
+		}
+	}
+
+	for key, value := range p.nodeSelector {
+		if _, ok := pod.Spec.NodeSelector[key]; ok {
+			continue
+		}
+		if pod.Spec.NodeSelector == nil {
+			pod.Spec.NodeSelector = map[string]string{}
+		}
+		pod.Spec.NodeSelector[key] = value
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[kubelettypes.CriticalPodAnnotationKey] = ""
+
+	return nil
+}
+
+func tolerates(pod *api.Pod, taint *api.Taint) bool {
+	for i := range pod.Spec.Tolerations {
+		if helper.TolerationToleratesTaint(&pod.Spec.Tolerations[i], taint) {
+			return true
+		}
+	}
+	return false
+}
+
+func toleration(taint api.Taint) api.Toleration {
+	t := api.Toleration{
+		Key:      taint.Key,
+		Operator: api.TolerationOpExists,
+		Effect:   taint.Effect,
+	}
+	if taint.Value != "" {
+		t.Operator = api.TolerationOpEqual
+		t.Value = taint.Value
+	}
+	return t
+}
@@ -0,0 +1,217 @@
+package admission
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubernetes/pkg/api"
+	admissionv1alpha1 "k8s.io/kubernetes/pkg/apis/admission/v1alpha1"
+	"k8s.io/kubernetes/pkg/apis/admissionregistration/v1alpha1"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/clientset"
+	"k8s.io/kubernetes/pkg/kubeapiserver/admission/configuration"
+	"k8s.io/kubernetes/plugin/pkg/admission/webhook"
+)
+
+const (
+	webhookPluginName  = "GenericAdmissionWebhook"
+	webhookServicePort = "443"
+	webhookTimeout     = 30 * time.Second
+)
+
+type dialer func(network, addr string) (net.Conn, error)
+
+// wantsDialer is implemented by plugins calling into the cluster
+type wantsDialer interface {
+	SetDialer(dialer dialer)
+}
+
+type dialerInitializer struct {
+	dialer dialer
+}
+
+func (d dialerInitializer) Initialize(plugin admission.Interface) {
+	if wants, ok := plugin.(wantsDialer); ok {
+		wants.SetDialer(d.dialer)
+	}
+}
+
+// wantsStopCh is implemented by plugins running goroutines that must end with the apiserver
+type wantsStopCh interface {
+	SetStopCh(stopCh <-chan struct{})
+}
+
+type stopChInitializer struct {
+	stopCh <-chan struct{}
+}
+
+func (s stopChInitializer) Initialize(plugin admission.Interface) {
+	if wants, ok := plugin.(wantsStopCh); ok {
+		wants.SetStopCh(s.stopCh)
+	}
+}
+
+// registerWebhook registers the GenericAdmissionWebhook of netes.  Upstream calls the webhook services at their
+// service IP, which the control plane can't reach, so the ExternalAdmissionHooks of the cluster are called
+// through the tunnel to its hosts instead.
+func registerWebhook(plugins *admission.Plugins) {
+	plugins.Register(webhookPluginName, func(configFile io.Reader) (admission.Interface, error) {
+		return &tunnelWebhook{
+			Handler: admission.NewHandler(admission.Connect, admission.Create, admission.Delete, admission.Update),
+			negotiatedSerializer: serializer.NegotiatedSerializerWrapper(runtime.SerializerInfo{
+				Serializer: api.Codecs.LegacyCodec(admissionv1alpha1.SchemeGroupVersion),
+			}),
+		}, nil
+	})
+}
+
+type tunnelWebhook struct {
+	*admission.Handler
+	client               clientset.Interface
+	hookSource           webhook.WebhookSource
+	dialer               dialer
+	stopCh               <-chan struct{}
+	negotiatedSerializer runtime.NegotiatedSerializer
+}
+
+func (w *tunnelWebhook) SetExternalKubeClientSet(client clientset.Interface) {
+	w.client = client
+	w.hookSource = configuration.NewExternalAdmissionHookConfigurationManager(
+		client.Admissionregistration().ExternalAdmissionHookConfigurations())
+}
+
+func (w *tunnelWebhook) SetDialer(dialer dialer) {
+	w.dialer = dialer
+}
+
+func (w *tunnelWebhook) SetStopCh(stopCh <-chan struct{}) {
+	w.stopCh = stopCh
+}
+
+func (w *tunnelWebhook) Validate() error {
+	if w.hookSource == nil {
+		return fmt.Errorf("the %s admission plugin requires a Kubernetes client to be provided", webhookPluginName)
+	}
+	if w.dialer == nil {
+		return fmt.Errorf("the %s admission plugin requires a dialer to the cluster", webhookPluginName)
+	}
+	if w.stopCh == nil {
+		return fmt.Errorf("the %s admission plugin requires the stop channel of the apiserver", webhookPluginName)
+	}
+	go w.hookSource.Run(w.stopCh)
+	return nil
+}
+
+// Admit calls the matching hooks in parallel, like upstream it fails open if a hook can't be called
+func (w *tunnelWebhook) Admit(attr admission.Attributes) error {
+	hookConfig, err := w.hookSource.ExternalAdmissionHooks()
+	if err == configuration.ErrDisabled {
+		return nil
+	} else if err != nil {
+		e := apierrors.NewServerTimeout(attr.GetResource().GroupResource(), string(attr.GetOperation()), 1)
+		e.ErrStatus.Message = fmt.Sprintf("Unable to refresh the ExternalAdmissionHook configuration: %v", err)
+		e.ErrStatus.Reason = "LoadingConfiguration"
+		return e
+	}
+
+	hooks := hookConfig.ExternalAdmissionHooks
+	errs := make(chan error, len(hooks))
+	wg := sync.WaitGroup{}
+	wg.Add(len(hooks))
+	for i := range hooks {
+		go func(hook *v1alpha1.ExternalAdmissionHook) {
+			defer wg.Done()
+			err := w.callHook(hook, attr)
+			if callErr, ok := err.(*webhook.ErrCallingWebhook); ok {
+				logrus.Warnf("Failed calling webhook %s: %v", hook.Name, callErr)
+			} else if err != nil {
+				errs <- err
+			}
+		}(&hooks[i])
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+func (w *tunnelWebhook) callHook(h *v1alpha1.ExternalAdmissionHook, attr admission.Attributes) error {
+	matches := false
+	for _, r := range h.Rules {
+		m := webhook.RuleMatcher{Rule: r, Attr: attr}
+		if m.Matches() {
+			matches = true
+			break
+		}
+	}
+	if !matches {
+		return nil
+	}
+
+	client, err := w.hookClient(h)
+	if err != nil {
+		return &webhook.ErrCallingWebhook{WebhookName: h.Name, Reason: err}
+	}
+
+	request := admissionv1alpha1.NewAdmissionReview(attr)
+	if err := client.Post().Context(context.TODO()).Body(&request).Do().Into(&request); err != nil {
+		return &webhook.ErrCallingWebhook{WebhookName: h.Name, Reason: err}
+	}
+
+	if request.Status.Allowed {
+		return nil
+	}
+	if request.Status.Result == nil {
+		return fmt.Errorf("admission webhook %q denied the request without explanation", h.Name)
+	}
+	return &apierrors.StatusError{
+		ErrStatus: *request.Status.Result,
+	}
+}
+
+func (w *tunnelWebhook) hookClient(h *v1alpha1.ExternalAdmissionHook) (*rest.RESTClient, error) {
+	ref := h.ClientConfig.Service
+	service, err := w.client.CoreV1().Services(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == "None" {
+		return nil, fmt.Errorf("service %s/%s has no cluster IP", ref.Namespace, ref.Name)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: ref.Name + "." + ref.Namespace + ".svc",
+	}
+	if len(h.ClientConfig.CABundle) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(h.ClientConfig.CABundle)
+	}
+
+	return rest.UnversionedRESTClientFor(&rest.Config{
+		Host: "https://" + net.JoinHostPort(service.Spec.ClusterIP, webhookServicePort),
+		Transport: &http.Transport{
+			Dial:            w.dialer,
+			TLSClientConfig: tlsConfig,
+			// every call gets its own transport, don't keep tunnels open
+			DisableKeepAlives: true,
+		},
+		UserAgent: "kube-apiserver-admission",
+		Timeout:   webhookTimeout,
+		ContentConfig: rest.ContentConfig{
+			NegotiatedSerializer: w.negotiatedSerializer,
+		},
+	})
+}
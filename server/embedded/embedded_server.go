@@ -5,37 +5,56 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/go-openapi/spec"
 	"github.com/pkg/errors"
 	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/accesslog"
+	"github.com/rancher/netes/aggregator"
+	"github.com/rancher/netes/audit"
 	"github.com/rancher/netes/authentication"
 	"github.com/rancher/netes/authorization"
+	"github.com/rancher/netes/bootstrap"
+	"github.com/rancher/netes/certs"
 	"github.com/rancher/netes/clients"
 	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/controllermanager"
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/fanin"
+	"github.com/rancher/netes/metrics"
 	"github.com/rancher/netes/proxy"
 	"github.com/rancher/netes/server/admission"
+	"github.com/rancher/netes/sni"
 	"github.com/rancher/netes/store"
+	"github.com/rancher/netes/throttle"
+	"github.com/rancher/netes/tokenrequest"
+	"github.com/rancher/netes/tracing"
 	"github.com/rancher/netes/types"
+	apiextensionsapiserver "k8s.io/apiextensions-apiserver/pkg/apiserver"
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/sets"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/apiserver/pkg/server/filters"
 	"k8s.io/apiserver/pkg/server/storage"
 	"k8s.io/kubernetes/pkg/api"
+	serviceaccountcontroller "k8s.io/kubernetes/pkg/controller/serviceaccount"
 	"k8s.io/kubernetes/pkg/generated/openapi"
 	kubeletclient "k8s.io/kubernetes/pkg/kubelet/client"
 	"k8s.io/kubernetes/pkg/master"
 	"k8s.io/kubernetes/pkg/master/ports"
+	rbacrest "k8s.io/kubernetes/pkg/registry/rbac/rest"
+	"k8s.io/kubernetes/pkg/serviceaccount"
 	"k8s.io/kubernetes/pkg/version"
 )
 
 type embeddedServer struct {
 	master  *master.Master
 	cluster *client.Cluster
+	clients *clients.ClientSetSet
+	trash   *store.Trash
+	certs   *certs.Bundle
 	cancel  context.CancelFunc
 }
 
@@ -46,7 +65,9 @@ func (e *embeddedServer) Close() {
 func (e *embeddedServer) Handler() http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		c := cluster.GetCluster(req.Context())
-		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/k8s/clusters/"+c.Id)
+		prefix := "/k8s/clusters/" + c.Id
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, prefix)
+		req.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, prefix)
 		e.master.GenericAPIServer.Handler.ServeHTTP(rw, req)
 	})
 }
@@ -55,20 +76,40 @@ func (e *embeddedServer) Cluster() *client.Cluster {
 	return e.cluster
 }
 
+func (e *embeddedServer) Clients() *clients.ClientSetSet {
+	return e.clients
+}
+
+func (e *embeddedServer) Trash() *store.Trash {
+	return e.trash
+}
+
+func (e *embeddedServer) Certificates() *certs.Bundle {
+	return e.certs
+}
+
 func New(config *types.GlobalConfig, cluster *client.Cluster, lookup *cluster.Lookup) (*embeddedServer, error) {
-	storageFactory, err := store.StorageFactory(
-		fmt.Sprintf("/k8s/cluster/%s", cluster.Uuid),
-		config)
+	// the runtime config of the cluster overrides the global one entry by entry
+	storageFactory, err := store.StorageFactory(config, cluster,
+		append(append([]string{}, config.RuntimeConfig...), cluster.K8sServerConfig.RuntimeConfig...))
 	if err != nil {
 		return nil, err
 	}
+	checkFeatureGates(cluster)
 
 	clientsetset, err := clients.New(cluster)
 	if err != nil {
 		return nil, err
 	}
 
-	genericApiServerConfig, err := genericConfig(config, cluster, lookup, storageFactory, clientsetset)
+	trash := store.NewTrash(config.NamespaceDeleteWindow)
+
+	manifests, err := bootstrap.Manifests(config, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	kvClient, err := store.Client(config)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +119,36 @@ func New(config *types.GlobalConfig, cluster *client.Cluster, lookup *cluster.Lo
 		return nil, errors.Wrap(err, "Invalid service net cidr")
 	}
 
-	dialer := proxy.NewDialer(cluster, os.Getenv("CATTLE_ACCESS_KEY"), os.Getenv("CATTLE_SECRET_KEY"))
+	bundle, err := certs.Load(context.Background(), kvClient, cluster.Uuid, servingHosts(config, cluster),
+		[]net.IP{apiServerServiceIP})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load certificates")
+	}
+
+	frontProxyClientCert, err := bundle.FrontProxyClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := proxy.ClusterDialer(config, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	apiAggregator, err := aggregator.New(bundle.FrontProxyCAPEM(), frontProxyClientCert, clientsetset, dialer)
+	if err != nil {
+		return nil, err
+	}
+
+	// everything started for the server ends with ctx, also when it fails to start
+	ctx, cancel := context.WithCancel(context.Background())
+
+	genericApiServerConfig, err := genericConfig(config, cluster, lookup, storageFactory, trash, clientsetset, apiAggregator,
+		bundle, dialer, ctx.Done())
+	if err != nil {
+		cancel()
+		return nil, err
+	}
 
 	masterConfig := &master.Config{
 		GenericConfig: genericApiServerConfig,
@@ -88,7 +158,7 @@ func New(config *types.GlobalConfig, cluster *client.Cluster, lookup *cluster.Lo
 		EnableCoreControllers:   true,
 		EventTTL:                1 * time.Hour,
 		KubeletClientConfig: kubeletclient.KubeletClientConfig{
-			Dial:         dialer,
+			Dial:         utilnet.DialFunc(dialer),
 			Port:         ports.KubeletPort,
 			ReadOnlyPort: ports.KubeletReadOnlyPort,
 			PreferredAddressTypes: []string{
@@ -120,27 +190,88 @@ func New(config *types.GlobalConfig, cluster *client.Cluster, lookup *cluster.Lo
 		ServiceNodePortRange: utilnet.PortRange{Base: 30000, Size: 2768},
 
 		MasterCount: 1,
+
+		ClientCARegistrationHook: apiAggregator.RegistrationHook(),
 	}
 
-	kubeAPIServer, err := masterConfig.Complete().New(genericapiserver.EmptyDelegate, nil)
+	// CRDs are served by an apiextensions server the kube apiserver delegates unknown paths to, it shares the
+	// generic config so it is behind the same authentication, authorization and admission
+	crdRESTOptions, customResourceRESTOptions := store.APIExtensionsRESTOptions(config, cluster)
+	apiExtensionsGenericConfig := *genericApiServerConfig
+	apiExtensionsGenericConfig.RESTOptionsGetter = crdRESTOptions
+	apiExtensionsConfig := &apiextensionsapiserver.Config{
+		GenericConfig:        &apiExtensionsGenericConfig,
+		CRDRESTOptionsGetter: customResourceRESTOptions,
+	}
+	apiExtensionsServer, err := apiExtensionsConfig.Complete().New(genericapiserver.EmptyDelegate)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	kubeAPIServer, err := masterConfig.Complete().New(apiExtensionsServer.GenericAPIServer, customResourceRESTOptions)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
 	kubeAPIServer.GenericAPIServer.AddPostStartHook("start-kube-apiserver-informers", func(context genericapiserver.PostStartHookContext) error {
 		clientsetset.Start(context.StopCh)
 		return nil
 	})
 	kubeAPIServer.GenericAPIServer.PrepareRun()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	trash.Start(ctx)
+
+	if backend := genericApiServerConfig.AuditBackend; backend != nil {
+		if err := backend.Run(ctx.Done()); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
 
 	kubeAPIServer.GenericAPIServer.RunPostStartHooks(ctx.Done())
-	//go controllermanager.Start(clientsetset, ctx.Done())
+	apiAggregator.Start(ctx)
+	go controllermanager.Run(ctx, kvClient, cluster.Uuid, clientsetset, bundle, config.EmbeddedScheduler)
+	go bootstrap.Run(ctx, cluster.Id, clientsetset, manifests)
+
+	if bundle.Created() {
+		config.Events.Emit(events.Event{
+			Type:    events.ClusterCreated,
+			Cluster: cluster.Id,
+			Message: fmt.Sprintf("Created the control plane of cluster %s", cluster.Id),
+			Details: map[string]string{"name": cluster.Name, "uuid": cluster.Uuid},
+		})
+	}
 
 	return &embeddedServer{
 		master:  kubeAPIServer,
 		cluster: cluster,
+		clients: clientsetset,
+		trash:   trash,
+		certs:   bundle,
 		cancel:  cancel,
 	}, nil
 }
 
+// servingHosts are the names of the apiserver in the cluster and, with a cluster domain, the names the cluster is
+// routed by
+func servingHosts(config *types.GlobalConfig, cluster *client.Cluster) []string {
+	hosts := []string{
+		"kubernetes",
+		"kubernetes.default",
+		"kubernetes.default.svc",
+		"kubernetes.default.svc.cluster.local",
+	}
+	if config.ClusterDomain != "" {
+		for _, label := range []string{cluster.Id, cluster.Name} {
+			if label != "" && sni.ClusterLabel(label+"."+config.ClusterDomain, config.ClusterDomain) == label {
+				hosts = append(hosts, label+"."+config.ClusterDomain)
+			}
+		}
+	}
+	return hosts
+}
+
 func serviceNet(config *types.GlobalConfig, cluster *client.Cluster) (net.IPNet, net.IP, error) {
 	cidr := types.FirstNotEmpty(cluster.K8sServerConfig.ServiceNetCidr, config.ServiceNetCidr)
 	_, cidrNet, err := net.ParseCIDR(cidr)
@@ -152,13 +283,15 @@ func serviceNet(config *types.GlobalConfig, cluster *client.Cluster) (net.IPNet,
 }
 
 func genericConfig(config *types.GlobalConfig, cluster *client.Cluster, lookup *cluster.Lookup,
-	storageFactory storage.StorageFactory, clientsetset *clients.ClientSetSet) (*genericapiserver.Config, error) {
-	authz, err := authorization.New()
+	storageFactory storage.StorageFactory, trash *store.Trash, clientsetset *clients.ClientSetSet,
+	apiAggregator *aggregator.Aggregator, bundle *certs.Bundle, dialer func(network, addr string) (net.Conn, error),
+	stopCh <-chan struct{}) (*genericapiserver.Config, error) {
+	authz, err := authorization.New(config, cluster, clientsetset)
 	if err != nil {
 		return nil, err
 	}
 
-	admissions, err := admission.New(config, cluster, authz, clientsetset)
+	admissions, err := admission.New(config, cluster, authz, clientsetset, store.ResourcePrefix(storageFactory), dialer, stopCh)
 	if err != nil {
 		return nil, err
 	}
@@ -182,15 +315,98 @@ func genericConfig(config *types.GlobalConfig, cluster *client.Cluster, lookup *
 		sets.NewString("attach", "exec", "proxy", "log", "portforward"),
 	)
 	genericApiServerConfig.LoopbackClientConfig = &clientsetset.LoopbackClientConfig
+	// the bootstrap roles are reconciled by bootstrap.Run, the upstream hook exits the process when it fails
+	genericApiServerConfig.DisabledPostStartHooks.Insert(rbacrest.PostStartHookName)
 	genericApiServerConfig.AdmissionControl = admissions
 	genericApiServerConfig.Authorizer = authz
-	genericApiServerConfig.RESTOptionsGetter = &store.RESTOptionsFactory{storageFactory}
-	genericApiServerConfig.Authenticator = authentication.New(lookup)
+	genericApiServerConfig.AuditBackend, genericApiServerConfig.AuditPolicyChecker, err = audit.New(config, cluster)
+	if err != nil {
+		return nil, err
+	}
+	genericApiServerConfig.RESTOptionsGetter = &store.RESTOptionsFactory{
+		StorageFactory: storageFactory,
+		Trash:          trash,
+		Usage:          store.Usage(config, cluster),
+		ClusterID:      cluster.Id,
+	}
+	serviceAccountKeys, err := bundle.ServiceAccountPublicKeys()
+	if err != nil {
+		return nil, err
+	}
+	serviceAccountKey, err := bundle.ServiceAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	tokenIssuer := tokenrequest.NewIssuer(config.ServiceAccountIssuer, config.ServiceAccountMaxTokenExpiration,
+		serviceAccountKey, clientsetset.Client)
+	genericApiServerConfig.Authenticator, err = authentication.New(config, cluster, lookup, clientsetset.LoopbackClientConfig.BearerToken,
+		serviceaccount.JWTTokenAuthenticator(serviceAccountKeys, true, serviceaccountcontroller.NewGetterFromClient(clientsetset.ExternalClient)),
+		tokenrequest.NewAuthenticator(config.ServiceAccountIssuer, serviceAccountKeys, clientsetset.Client))
+	if err != nil {
+		return nil, err
+	}
 	genericApiServerConfig.Authorizer = authz
 	genericApiServerConfig.PublicAddress = net.ParseIP("169.254.169.250")
 	genericApiServerConfig.ReadWritePort = 9348
 	genericApiServerConfig.EnableDiscovery = true
 	genericApiServerConfig.Version = &apiVersion
 
+	// the limits can change when the config file is reloaded, the server keeps the ones it started with
+	config.Reloading.RLock()
+	if v := types.FirstNotZero(cluster.K8sServerConfig.MaxRequestsInflight, config.MaxRequestsInflight); v > 0 {
+		genericApiServerConfig.MaxRequestsInFlight = int(v)
+	}
+	if v := types.FirstNotZero(cluster.K8sServerConfig.MaxMutatingRequestsInflight, config.MaxMutatingRequestsInflight); v > 0 {
+		genericApiServerConfig.MaxMutatingRequestsInFlight = int(v)
+	}
+	if v := types.FirstNotZero(cluster.K8sServerConfig.MinRequestTimeout, config.MinRequestTimeout); v > 0 {
+		genericApiServerConfig.MinRequestTimeout = int(v)
+	}
+	requestQueueTimeout := config.RequestQueueTimeout
+	maxWatches := types.FirstNotZero(cluster.K8sServerConfig.MaxWatches, config.MaxWatchesPerCluster)
+	maxGoroutines := types.FirstNotZero(cluster.K8sServerConfig.MaxGoroutines, config.MaxGoroutinesPerCluster)
+	config.Reloading.RUnlock()
+
+	// queue instead of the upstream limit rejecting requests over the limit right away
+	var limiter *throttle.Limiter
+	if requestQueueTimeout > 0 {
+		limiter = throttle.New(cluster.Id, genericApiServerConfig.MaxRequestsInFlight,
+			genericApiServerConfig.MaxMutatingRequestsInFlight, requestQueueTimeout)
+		genericApiServerConfig.MaxRequestsInFlight = 0
+		genericApiServerConfig.MaxMutatingRequestsInFlight = 0
+	}
+
+	// kubectl repeats discovery on every invocation, serve it from memory until CRDs or APIServices change
+	discoveryCache := apiAggregator.NewCache()
+	var watches *fanin.Hub
+	if config.WatchFanIn {
+		watches = fanin.New(cluster.Id)
+	}
+	genericApiServerConfig.BuildHandlerChainFunc = func(apiHandler http.Handler, c *genericapiserver.Config) http.Handler {
+		// aggregated APIs get the dryRun parameter and handle it themselves
+		handler := store.DryRunFilter(apiHandler, c.RequestContextMapper)
+		handler = tokenIssuer.Filter(handler, c.RequestContextMapper)
+		// watches of aggregated APIs are not shared
+		if watches != nil {
+			handler = watches.Filter(handler, c.RequestContextMapper)
+		}
+		handler = apiAggregator.Filter(handler, c.RequestContextMapper)
+		handler = discoveryCache.Filter(handler)
+		if config.Deprecations != nil {
+			handler = config.Deprecations.Filter(cluster.Id, handler, c.RequestContextMapper)
+		}
+		if limiter != nil {
+			handler = limiter.Filter(handler, c.RequestContextMapper, c.LongRunningFunc)
+		}
+		if config.Budgets != nil {
+			handler = config.Budgets.Filter(cluster.Id, maxWatches, maxGoroutines, handler, c.RequestContextMapper)
+		}
+		handler = metrics.SummaryFilter(cluster.Id, store.Usage(config, cluster), handler, c.RequestContextMapper)
+		handler = metrics.Filter(cluster.Id, handler, c.RequestContextMapper, c.LongRunningFunc)
+		handler = accesslog.Filter(config, cluster, handler, c.RequestContextMapper)
+		handler = tracing.Filter(cluster.Id, handler, c.RequestContextMapper)
+		return authentication.WebSocketFilter(genericapiserver.DefaultBuildHandlerChain(handler, c))
+	}
+
 	return genericApiServerConfig, nil
 }
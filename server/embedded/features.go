@@ -0,0 +1,32 @@
+package embedded
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/go-rancher/v3"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+)
+
+// checkFeatureGates warns about feature gates set for a cluster that the process doesn't have.  Upstream reads the
+// gates from a global, so they apply to all clusters served by a netes and are set with NETES_FEATURE_GATES.
+func checkFeatureGates(cluster *client.Cluster) {
+	for _, entry := range cluster.K8sServerConfig.FeatureGates {
+		kv := strings.SplitN(entry, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		enabled := true
+		if len(kv) == 2 {
+			var err error
+			if enabled, err = strconv.ParseBool(strings.TrimSpace(kv[1])); err != nil {
+				logrus.Warnf("Invalid feature gate %q of cluster %s", entry, cluster.Id)
+				continue
+			}
+		}
+
+		if utilfeature.DefaultFeatureGate.Enabled(utilfeature.Feature(name)) != enabled {
+			logrus.Warnf("Feature gate %s=%t of cluster %s is ignored, feature gates are shared by all clusters of "+
+				"the process", name, enabled, cluster.Id)
+		}
+	}
+}
@@ -1,17 +1,61 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/pkg/locker"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/budget"
 	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/server/admission"
 	"github.com/rancher/netes/server/embedded"
+	"github.com/rancher/netes/store"
 	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
 	"golang.org/x/sync/syncmap"
 )
 
+var (
+	errShuttingDown = errors.New("netes is shutting down")
+
+	serversGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "netes_cluster_servers",
+		Help: "Number of hosted apiservers running",
+	})
+	startCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_cluster_server_starts_total",
+		Help: "Number of times the apiserver of a cluster was started, restarts included, per cluster and result",
+	}, []string{"cluster", "result"})
+	startGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_cluster_server_start_seconds",
+		Help: "Time the last start of the apiserver of a cluster took",
+	}, []string{"cluster"})
+	restartCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_cluster_server_restarts_total",
+		Help: "Number of times the apiserver of a cluster was restarted for a configuration change",
+	}, []string{"cluster"})
+)
+
+func init() {
+	prometheus.MustRegister(serversGauge)
+	prometheus.MustRegister(startCounter)
+	prometheus.MustRegister(startGauge)
+	prometheus.MustRegister(restartCounter)
+}
+
 type Factory struct {
+	admission     syncmap.Map
+	closed        int32
 	clusterLookup *cluster.Lookup
 	clusters      syncmap.Map
 	config        *types.GlobalConfig
@@ -54,24 +98,223 @@ func (s *Factory) Get(req *http.Request) (*client.Cluster, http.Handler, error)
 	}
 
 	cluster, err := s.clusterLookup.Lookup(req)
+	if rancher.Unreachable(err) && s.config.RancherClient != nil {
+		// the credentials are still checked by the authenticators of the cluster
+		if cached, cacheErr := s.config.RancherClient.CachedCluster(clusterID); cacheErr == nil && cached != nil {
+			cluster, err = cached, nil
+		}
+	}
 	if err != nil || cluster == nil {
 		return nil, nil, err
 	}
 
-	if cluster.K8sServerConfig == nil {
-		cluster.K8sServerConfig = &client.K8sServerConfig{}
-	}
-
-	var server interface{}
-	server, err = s.newServer(cluster)
+	server, err := s.start(cluster)
 	if err != nil || server == nil {
 		return nil, nil, err
 	}
 
-	server, _ = s.servers.LoadOrStore(cluster.Id, server)
-	s.clusters.LoadOrStore(cluster.Id, cluster)
+	return cluster, server.Handler(), nil
+}
+
+// Ensure restarts the server of cluster if it is running and its configuration or its admission plugin
+// configuration changed, draining the old server for up to drainTimeout.  Servers that aren't running are started
+// by the first request of their cluster.
+func (s *Factory) Ensure(c *client.Cluster, drainTimeout time.Duration) error {
+	s.serverLock.Lock("cluster." + c.Id)
+	defer s.serverLock.Unlock("cluster." + c.Id)
+
+	existing, ok := s.clusters.Load(c.Id)
+	if !ok || (!changed(existing.(*client.Cluster), c) && !s.admissionChanged(c)) {
+		return nil
+	}
+
+	logrus.Infof("Configuration of cluster %s changed, restarting", c.Id)
+	restartCounter.WithLabelValues(c.Id).Inc()
+	s.remove(c.Id, drainTimeout)
+	defer s.restarted(c.Id, "configuration changed")
+
+	_, err := s.start(c)
+	return err
+}
+
+// Restart rebuilds the server of a cluster if it is running, draining the old server for up to drainTimeout.  The
+// reason is told to the control plane event sinks.
+func (s *Factory) Restart(clusterID, reason string, drainTimeout time.Duration) error {
+	s.serverLock.Lock("cluster." + clusterID)
+	defer s.serverLock.Unlock("cluster." + clusterID)
+
+	existing, ok := s.clusters.Load(clusterID)
+	if !ok {
+		return nil
+	}
+
+	logrus.Infof("Restarting server of cluster %s", clusterID)
+	restartCounter.WithLabelValues(clusterID).Inc()
+	s.remove(clusterID, drainTimeout)
+	defer s.restarted(clusterID, reason)
+	_, err := s.start(existing.(*client.Cluster))
+	return err
+}
+
+func (s *Factory) restarted(clusterID, reason string) {
+	message := fmt.Sprintf("Restarted the apiserver of cluster %s", clusterID)
+	if _, running := s.servers.Load(clusterID); !running {
+		message = fmt.Sprintf("The apiserver of cluster %s was stopped to restart it but failed to start", clusterID)
+	}
+	s.config.Events.Emit(events.Event{
+		Type:    events.APIServerRestarted,
+		Cluster: clusterID,
+		Message: message,
+		Details: map[string]string{"reason": reason},
+	})
+}
+
+// Offline runs f with the server of a cluster stopped, draining it for up to drainTimeout first.  No server of the
+// cluster starts before f returns, a server that was running is started again afterwards.
+func (s *Factory) Offline(clusterID string, drainTimeout time.Duration, f func() error) error {
+	s.serverLock.Lock("cluster." + clusterID)
+	defer s.serverLock.Unlock("cluster." + clusterID)
+
+	existing, running := s.clusters.Load(clusterID)
+	if server, ok := s.detach(clusterID); ok {
+		stop(clusterID, server, drainTimeout)
+	}
+
+	err := f()
+	if running {
+		if _, startErr := s.start(existing.(*client.Cluster)); err == nil {
+			err = startErr
+		}
+	}
+	return err
+}
+
+// Remove stops the server of a cluster.  New requests are not routed to it anymore and in flight requests
+// get up to timeout to complete before it is closed.
+func (s *Factory) Remove(clusterID string, timeout time.Duration) {
+	s.serverLock.Lock("cluster." + clusterID)
+	defer s.serverLock.Unlock("cluster." + clusterID)
+
+	s.remove(clusterID, timeout)
+}
+
+// Shutdown stops the servers of all clusters and starts no new ones.  In flight requests get up to timeout to
+// complete, it returns once all servers are closed.
+func (s *Factory) Shutdown(timeout time.Duration) {
+	atomic.StoreInt32(&s.closed, 1)
+
+	var wg sync.WaitGroup
+	for _, server := range s.Servers() {
+		clusterID := server.Cluster().Id
+		s.serverLock.Lock("cluster." + clusterID)
+		tracked, ok := s.detach(clusterID)
+		s.serverLock.Unlock("cluster." + clusterID)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stop(clusterID, tracked, timeout)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Factory) remove(clusterID string, timeout time.Duration) {
+	if server, ok := s.detach(clusterID); ok {
+		go stop(clusterID, server, timeout)
+	}
+}
+
+// detach stops routing requests to the server of a cluster
+func (s *Factory) detach(clusterID string) (*trackedServer, bool) {
+	server, ok := s.servers.Load(clusterID)
+	if !ok {
+		return nil, false
+	}
+
+	s.servers.Delete(clusterID)
+	s.clusters.Delete(clusterID)
+	s.admission.Delete(clusterID)
+	serversGauge.Dec()
+
+	return server.(*trackedServer), true
+}
+
+func stop(clusterID string, server *trackedServer, timeout time.Duration) {
+	server.drain(timeout)
+	server.Close()
+	logrus.Infof("Stopped server of cluster %s", clusterID)
+}
+
+func (s *Factory) start(c *client.Cluster) (Server, error) {
+	if atomic.LoadInt32(&s.closed) == 1 {
+		return nil, errShuttingDown
+	}
+
+	if c.K8sServerConfig == nil {
+		c.K8sServerConfig = &client.K8sServerConfig{}
+	}
+
+	pluginConfig, err := s.pluginConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var server Server
+	budget.Label(c.Id, func() {
+		server, err = s.newServer(c)
+	})
+	if err != nil {
+		startCounter.WithLabelValues(c.Id, "error").Inc()
+		return nil, err
+	} else if server == nil {
+		return nil, nil
+	}
+	if atomic.LoadInt32(&s.closed) == 1 {
+		server.Close()
+		return nil, errShuttingDown
+	}
+	startCounter.WithLabelValues(c.Id, "success").Inc()
+	startGauge.WithLabelValues(c.Id).Set(time.Since(start).Seconds())
+
+	tracked := newTrackedServer(server)
+	serversGauge.Inc()
+	s.servers.Store(c.Id, tracked)
+	s.clusters.Store(c.Id, c)
+	s.admission.Store(c.Id, pluginConfig)
+
+	return tracked, nil
+}
+
+func (s *Factory) Server(clusterID string) (Server, bool) {
+	server, ok := s.servers.Load(clusterID)
+	if !ok {
+		return nil, false
+	}
+	return server.(Server), true
+}
+
+// Idle returns how long the server of a cluster has not served a request, zero while it is serving one or when it
+// is not running
+func (s *Factory) Idle(clusterID string) time.Duration {
+	server, ok := s.servers.Load(clusterID)
+	if !ok {
+		return 0
+	}
+	return server.(*trackedServer).idle()
+}
 
-	return cluster, server.(Server).Handler(), nil
+func (s *Factory) Servers() []Server {
+	var servers []Server
+	s.servers.Range(func(key, value interface{}) bool {
+		servers = append(servers, value.(Server))
+		return true
+	})
+	return servers
 }
 
 func (s *Factory) newServer(c *client.Cluster) (Server, error) {
@@ -81,3 +324,118 @@ func (s *Factory) newServer(c *client.Cluster) (Server, error) {
 
 	return nil, nil
 }
+
+func (s *Factory) pluginConfig(c *client.Cluster) (*admission.PluginConfig, error) {
+	kvClient, err := store.Client(s.config)
+	if err != nil {
+		return nil, err
+	}
+	return admission.LoadPluginConfig(context.Background(), kvClient, c.Uuid)
+}
+
+// admissionChanged picks up admission plugin configuration set through the admin API of another netes
+func (s *Factory) admissionChanged(c *client.Cluster) bool {
+	existing, ok := s.admission.Load(c.Id)
+	if !ok {
+		return false
+	}
+	current, err := s.pluginConfig(c)
+	if err != nil {
+		logrus.Errorf("Failed to load admission configuration of cluster %s: %v", c.Id, err)
+		return false
+	}
+	return !reflect.DeepEqual(existing, current)
+}
+
+func changed(old, new *client.Cluster) bool {
+	return old.Uuid != new.Uuid ||
+		old.Embedded != new.Embedded ||
+		!reflect.DeepEqual(serverConfig(old), serverConfig(new))
+}
+
+func serverConfig(c *client.Cluster) client.K8sServerConfig {
+	if c.K8sServerConfig == nil {
+		return client.K8sServerConfig{}
+	}
+	config := *c.K8sServerConfig
+	config.Resource = client.Resource{}
+	return config
+}
+
+// trackedServer counts in flight requests so a server can be drained before it is closed, and when the last
+// request ended so idle servers can be stopped.  Once it drains it rejects new requests.
+type trackedServer struct {
+	Server
+	lock        sync.Mutex
+	active      int
+	lastRequest time.Time
+	draining    bool
+	// drained is closed once the server drains and has no request in flight
+	drained chan struct{}
+}
+
+func newTrackedServer(server Server) *trackedServer {
+	return &trackedServer{
+		Server:      server,
+		lastRequest: time.Now(),
+		drained:     make(chan struct{}),
+	}
+}
+
+func (t *trackedServer) Handler() http.Handler {
+	handler := t.Server.Handler()
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !t.begin() {
+			http.Error(rw, "the server of the cluster is stopping, retry", http.StatusServiceUnavailable)
+			return
+		}
+		defer t.end()
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+func (t *trackedServer) begin() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.draining {
+		return false
+	}
+	t.active++
+	return true
+}
+
+func (t *trackedServer) end() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.active--
+	t.lastRequest = time.Now()
+	if t.draining && t.active == 0 {
+		close(t.drained)
+	}
+}
+
+func (t *trackedServer) idle() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.active > 0 {
+		return 0
+	}
+	return time.Since(t.lastRequest)
+}
+
+// drain rejects new requests and waits for up to timeout for the ones in flight to end
+func (t *trackedServer) drain(timeout time.Duration) {
+	t.lock.Lock()
+	if !t.draining {
+		t.draining = true
+		if t.active == 0 {
+			close(t.drained)
+		}
+	}
+	t.lock.Unlock()
+
+	select {
+	case <-t.drained:
+	case <-time.After(timeout):
+	}
+}
@@ -2,11 +2,18 @@ package server
 
 import (
 	"net/http"
+
 	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/certs"
+	"github.com/rancher/netes/clients"
+	"github.com/rancher/netes/store"
 )
 
 type Server interface {
 	Close()
 	Handler() http.Handler
 	Cluster() *client.Cluster
+	Clients() *clients.ClientSetSet
+	Trash() *store.Trash
+	Certificates() *certs.Bundle
 }
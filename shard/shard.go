@@ -0,0 +1,383 @@
+package shard
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/lease"
+	"golang.org/x/net/context"
+)
+
+const (
+	leasePrefix   = "/netes/leases/"
+	replicaPrefix = "/netes/replicas/"
+)
+
+// ErrNoOwner is returned for clusters no replica can serve right now, like one just released by a replica
+// handing it over to another
+var ErrNoOwner = errors.New("no netes replica owns the cluster")
+
+// held is a lease of this replica, by its revision
+type held struct {
+	revision int64
+	expires  time.Time
+}
+
+// Coordinator shares the clusters between the netes replicas using a database.  Every cluster is served by the
+// replica holding its lease, replicas renew the leases they hold and take over the ones that expired.  Each
+// replica holds about its share of the clusters, so clusters move to new replicas and away from dead ones.
+type Coordinator struct {
+	sync.Mutex
+	client        kv.Client
+	id            string
+	address       string
+	leaseDuration time.Duration
+	onChange      func()
+
+	clusters map[string]bool
+	owned    map[string]held
+	// clusters handed over to another replica, not taken back until their lease would have expired
+	released map[string]time.Time
+	// leases of other replicas read to route requests, so not every request reads the database
+	routes map[string]*lease.Record
+}
+
+func New(client kv.Client, id, address string, leaseDuration time.Duration) *Coordinator {
+	return &Coordinator{
+		client:        client,
+		id:            id,
+		address:       address,
+		leaseDuration: leaseDuration,
+		clusters:      map[string]bool{},
+		owned:         map[string]held{},
+		released:      map[string]time.Time{},
+		routes:        map[string]*lease.Record{},
+	}
+}
+
+// Start renews and rebalances the leases until ctx is done, onChange is called when clusters were taken over
+// or lost so their servers are started or stopped
+func (c *Coordinator) Start(ctx context.Context, onChange func()) {
+	c.onChange = onChange
+	go func() {
+		ticker := time.NewTicker(c.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			if err := c.sync(ctx); err != nil {
+				logrus.Errorf("Failed to sync cluster leases: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// SetClusters sets the clusters to share, the ones the replicas serve
+func (c *Coordinator) SetClusters(ids []string) {
+	clusters := map[string]bool{}
+	for _, id := range ids {
+		clusters[id] = true
+	}
+
+	c.Lock()
+	c.clusters = clusters
+	c.Unlock()
+}
+
+// Owns is whether this replica serves the cluster
+func (c *Coordinator) Owns(clusterID string) bool {
+	c.Lock()
+	defer c.Unlock()
+	h, ok := c.owned[clusterID]
+	return ok && time.Now().Before(h.expires)
+}
+
+// Route returns the address of the replica serving the cluster, empty when it's this one.  A cluster no replica
+// holds is taken over.
+func (c *Coordinator) Route(ctx context.Context, clusterID string) (string, error) {
+	if c.Owns(clusterID) {
+		return "", nil
+	}
+
+	c.Lock()
+	route := c.routes[clusterID]
+	c.Unlock()
+	// a lease may be handed over before it expires, so it is only used for a part of its duration
+	if route.Valid(time.Now().Add(c.leaseDuration / 2)) {
+		return route.Address, nil
+	}
+
+	current, l, err := c.get(ctx, leasePrefix+clusterID)
+	if err != nil {
+		return "", err
+	}
+	if l.Valid(time.Now()) && l.Holder != c.id {
+		c.Lock()
+		c.routes[clusterID] = l
+		c.Unlock()
+		return l.Address, nil
+	}
+
+	c.Lock()
+	released, ok := c.released[clusterID]
+	c.Unlock()
+	if ok && time.Since(released) < c.leaseDuration {
+		return "", ErrNoOwner
+	}
+
+	acquired, err := c.acquire(ctx, clusterID, current)
+	if err != nil {
+		return "", err
+	}
+	if acquired {
+		c.changed()
+		return "", nil
+	}
+
+	// another replica was faster
+	_, l, err = c.get(ctx, leasePrefix+clusterID)
+	if err != nil {
+		return "", err
+	}
+	if !l.Valid(time.Now()) {
+		return "", ErrNoOwner
+	}
+	return l.Address, nil
+}
+
+// Release gives up all leases so the other replicas take over right away, netes calls it on shutdown
+func (c *Coordinator) Release(ctx context.Context) {
+	c.Lock()
+	owned := c.owned
+	c.owned = map[string]held{}
+	c.Unlock()
+
+	for clusterID, h := range owned {
+		if err := c.client.DeleteVersion(ctx, leasePrefix+clusterID, h.revision); err != nil {
+			logrus.Errorf("Failed to release lease of cluster %s: %v", clusterID, err)
+		}
+	}
+	if _, err := c.client.Delete(ctx, replicaPrefix+c.id); err != nil {
+		logrus.Errorf("Failed to unregister replica %s: %v", c.id, err)
+	}
+}
+
+func (c *Coordinator) sync(ctx context.Context) error {
+	if err := c.register(ctx); err != nil {
+		return err
+	}
+
+	replicas, err := c.liveReplicas(ctx)
+	if err != nil {
+		return err
+	}
+
+	changed := c.renew(ctx)
+	if c.rebalance(ctx, replicas) {
+		changed = true
+	}
+	if changed {
+		c.changed()
+	}
+	return nil
+}
+
+// register announces this replica, the share of every replica depends on how many are alive
+func (c *Coordinator) register(ctx context.Context) error {
+	key := replicaPrefix + c.id
+	current, _, err := c.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = c.put(ctx, key, current)
+	return err
+}
+
+func (c *Coordinator) liveReplicas(ctx context.Context) (int, error) {
+	values, err := c.client.List(ctx, replicaPrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	replicas := 0
+	for _, value := range values {
+		l := &lease.Record{}
+		if json.Unmarshal(value.Value, l) == nil && l.Valid(now) {
+			replicas++
+		}
+	}
+	if replicas == 0 {
+		replicas = 1
+	}
+	return replicas, nil
+}
+
+// renew extends the leases held, the ones another replica took or that expired before they could be renewed are
+// lost.  It returns whether any was lost.
+func (c *Coordinator) renew(ctx context.Context) bool {
+	c.Lock()
+	owned := map[string]held{}
+	for clusterID, h := range c.owned {
+		owned[clusterID] = h
+	}
+	c.Unlock()
+
+	lost := false
+	for clusterID, h := range owned {
+		expires := time.Now().Add(c.leaseDuration)
+		value, err := c.put(ctx, leasePrefix+clusterID, &kv.KeyValue{Revision: h.revision})
+		if err != nil && err != kv.ErrNotExists && err != kv.ErrExists {
+			logrus.Errorf("Failed to renew lease of cluster %s: %v", clusterID, err)
+			if time.Now().Before(h.expires) {
+				continue
+			}
+		}
+
+		c.Lock()
+		if _, ok := c.owned[clusterID]; ok {
+			if err == nil {
+				c.owned[clusterID] = held{revision: value.Revision, expires: expires}
+			} else {
+				logrus.Infof("Lost lease of cluster %s", clusterID)
+				delete(c.owned, clusterID)
+				lost = true
+			}
+		}
+		c.Unlock()
+	}
+	return lost
+}
+
+// rebalance takes over clusters without a valid lease and hands over clusters, until this replica holds its share
+func (c *Coordinator) rebalance(ctx context.Context, replicas int) bool {
+	c.Lock()
+	share := int(math.Ceil(float64(len(c.clusters)) / float64(replicas)))
+	var owned, candidates []string
+	for clusterID := range c.owned {
+		owned = append(owned, clusterID)
+	}
+	for clusterID := range c.clusters {
+		if _, ok := c.owned[clusterID]; !ok {
+			candidates = append(candidates, clusterID)
+		}
+	}
+	for clusterID, released := range c.released {
+		if time.Since(released) > c.leaseDuration {
+			delete(c.released, clusterID)
+		}
+	}
+	for clusterID, route := range c.routes {
+		if !route.Valid(time.Now()) {
+			delete(c.routes, clusterID)
+		}
+	}
+	c.Unlock()
+
+	changed := false
+	held := len(owned)
+	for _, clusterID := range owned {
+		if held <= share {
+			break
+		}
+		if c.release(ctx, clusterID) {
+			held--
+			changed = true
+		}
+	}
+
+	now := time.Now()
+	for _, clusterID := range candidates {
+		if held >= share {
+			break
+		}
+
+		c.Lock()
+		released, ok := c.released[clusterID]
+		c.Unlock()
+		if ok && now.Sub(released) < c.leaseDuration {
+			continue
+		}
+
+		current, l, err := c.get(ctx, leasePrefix+clusterID)
+		if err != nil {
+			logrus.Errorf("Failed to read lease of cluster %s: %v", clusterID, err)
+			continue
+		}
+		if l.Valid(now) {
+			continue
+		}
+
+		acquired, err := c.acquire(ctx, clusterID, current)
+		if err != nil {
+			logrus.Errorf("Failed to take over cluster %s: %v", clusterID, err)
+			continue
+		}
+		if acquired {
+			held++
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (c *Coordinator) acquire(ctx context.Context, clusterID string, current *kv.KeyValue) (bool, error) {
+	expires := time.Now().Add(c.leaseDuration)
+	value, err := c.put(ctx, leasePrefix+clusterID, current)
+	if err == kv.ErrExists || err == kv.ErrNotExists {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	logrus.Infof("Took over cluster %s", clusterID)
+	c.Lock()
+	c.owned[clusterID] = held{revision: value.Revision, expires: expires}
+	delete(c.released, clusterID)
+	c.Unlock()
+	return true, nil
+}
+
+func (c *Coordinator) release(ctx context.Context, clusterID string) bool {
+	c.Lock()
+	h, ok := c.owned[clusterID]
+	delete(c.owned, clusterID)
+	c.released[clusterID] = time.Now()
+	c.Unlock()
+	if !ok {
+		return false
+	}
+
+	logrus.Infof("Handing over cluster %s to another replica", clusterID)
+	if err := c.client.DeleteVersion(ctx, leasePrefix+clusterID, h.revision); err != nil {
+		logrus.Errorf("Failed to release lease of cluster %s: %v", clusterID, err)
+	}
+	return true
+}
+
+// put writes the lease of this replica over current, nil if there is none
+func (c *Coordinator) put(ctx context.Context, key string, current *kv.KeyValue) (*kv.KeyValue, error) {
+	return lease.Write(ctx, c.client, key, current, &lease.Record{
+		Holder:  c.id,
+		Address: c.address,
+		Expires: time.Now().Add(c.leaseDuration),
+	})
+}
+
+func (c *Coordinator) get(ctx context.Context, key string) (*kv.KeyValue, *lease.Record, error) {
+	return lease.Read(ctx, c.client, key)
+}
+
+func (c *Coordinator) changed() {
+	if c.onChange != nil {
+		go c.onChange()
+	}
+}
@@ -0,0 +1,102 @@
+package sni
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ClusterLabel returns the cluster name or id of a host like <cluster>.<domain>, empty if host is not a cluster
+// host of domain
+func ClusterLabel(host, domain string) string {
+	if domain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	label := strings.TrimSuffix(host, "."+strings.ToLower(strings.Trim(domain, ".")))
+	if label == host || len(validation.IsDNS1123Label(label)) > 0 {
+		return ""
+	}
+	return label
+}
+
+type cachedCertificate struct {
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+// Certificates serves the certificate <cluster>.crt and <cluster>.key of a directory for the cluster hosts of
+// a domain.  Hosts without a certificate get the default certificate of the listener, a wildcard certificate
+// of the domain covers all clusters.  Files are read again once they change.
+type Certificates struct {
+	sync.Mutex
+	domain string
+	dir    string
+	cache  map[string]cachedCertificate
+}
+
+func NewCertificates(domain, dir string) *Certificates {
+	return &Certificates{
+		domain: domain,
+		dir:    dir,
+		cache:  map[string]cachedCertificate{},
+	}
+}
+
+func (c *Certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	label := ClusterLabel(hello.ServerName, c.domain)
+	if label == "" {
+		return nil, nil
+	}
+
+	certFile := filepath.Join(c.dir, label+".crt")
+	keyFile := filepath.Join(c.dir, label+".key")
+	info, err := os.Stat(certFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if cached, ok := c.cache[label]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.certificate, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		logrus.Errorf("Failed to load certificate of %s: %v", hello.ServerName, err)
+		return nil, nil
+	}
+	c.cache[label] = cachedCertificate{
+		certificate: &certificate,
+		modTime:     info.ModTime(),
+	}
+	return &certificate, nil
+}
+
+// Chain returns the certificate of the first of getters that has one, like the certificates of a directory
+// before the ones obtained from an ACME CA
+func Chain(getters ...func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		for _, get := range getters {
+			if certificate, err := get(hello); certificate != nil || err != nil {
+				return certificate, err
+			}
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,255 @@
+package status
+
+import (
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const maxFailingPods = 100
+
+// embeddedComponents run inside netes, the apiserver probes them on the localhost of netes which tells nothing
+// about the cluster so they are left out
+var embeddedComponents = map[string]bool{
+	"controller-manager": true,
+	"scheduler":          true,
+}
+
+var failingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"RunContainerError":          true,
+}
+
+type Cluster struct {
+	ID                   string      `json:"id"`
+	Name                 string      `json:"name"`
+	State                string      `json:"state"`
+	Transitioning        string      `json:"transitioning,omitempty"`
+	TransitioningMessage string      `json:"transitioningMessage,omitempty"`
+	Healthy              bool        `json:"healthy"`
+	Hosts                []Host      `json:"hosts"`
+	Components           []Component `json:"components"`
+	FailingPods          []Pod       `json:"failingPods"`
+	// Errors lists the parts that could not be read, the rest of the document is still filled in
+	Errors []string `json:"errors,omitempty"`
+}
+
+type Host struct {
+	ID                   string      `json:"id,omitempty"`
+	Name                 string      `json:"name,omitempty"`
+	NodeName             string      `json:"nodeName"`
+	State                string      `json:"state,omitempty"`
+	AgentState           string      `json:"agentState,omitempty"`
+	TransitioningMessage string      `json:"transitioningMessage,omitempty"`
+	Ready                string      `json:"ready"`
+	Conditions           []Condition `json:"conditions"`
+}
+
+type Condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type Component struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+type Pod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	NodeName  string `json:"nodeName,omitempty"`
+	Phase     string `json:"phase"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Rollup combines what Rancher knows about a cluster and its hosts with the view of Kubernetes on the nodes,
+// components and pods into one document.  Hosts and nodes are joined by node name, a node without a host or a
+// host without a node is listed with the other half empty.
+func Rollup(rancherClient *client.RancherClient, s server.Server) *Cluster {
+	c := s.Cluster()
+	result := &Cluster{
+		ID:                   c.Id,
+		Name:                 c.Name,
+		State:                c.State,
+		Transitioning:        c.Transitioning,
+		TransitioningMessage: c.TransitioningMessage,
+		Hosts:                []Host{},
+		Components:           []Component{},
+		FailingPods:          []Pod{},
+	}
+
+	hostsByNode := map[string]*Host{}
+	var nodeNames []string
+	if rancherClient != nil {
+		if latest, err := rancherClient.Cluster.ById(c.Id); err != nil {
+			result.Errors = append(result.Errors, "rancher cluster: "+err.Error())
+		} else if latest != nil {
+			result.State = latest.State
+			result.Transitioning = latest.Transitioning
+			result.TransitioningMessage = latest.TransitioningMessage
+		}
+
+		hosts, err := rancherClient.Host.ListAll(&client.ListOpts{
+			Filters: map[string]interface{}{
+				"clusterId": c.Id,
+			},
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, "rancher hosts: "+err.Error())
+		} else {
+			for _, h := range hosts {
+				nodeName := types.FirstNotEmpty(h.NodeName, h.Hostname)
+				hostsByNode[nodeName] = &Host{
+					ID:                   h.Id,
+					Name:                 h.Name,
+					NodeName:             nodeName,
+					State:                h.State,
+					AgentState:           h.AgentState,
+					TransitioningMessage: h.TransitioningMessage,
+					Conditions:           []Condition{},
+				}
+				nodeNames = append(nodeNames, nodeName)
+			}
+		}
+	}
+
+	k8sClient := s.Clients().Client
+
+	nodes, err := k8sClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		result.Errors = append(result.Errors, "nodes: "+err.Error())
+	} else {
+		for _, node := range nodes.Items {
+			host, ok := hostsByNode[node.Name]
+			if !ok {
+				host = &Host{
+					NodeName: node.Name,
+				}
+				hostsByNode[node.Name] = host
+				nodeNames = append(nodeNames, node.Name)
+			}
+			host.Conditions = []Condition{}
+			for _, cond := range node.Status.Conditions {
+				host.Conditions = append(host.Conditions, Condition{
+					Type:    string(cond.Type),
+					Status:  string(cond.Status),
+					Reason:  cond.Reason,
+					Message: cond.Message,
+				})
+				if cond.Type == v1.NodeReady {
+					host.Ready = string(cond.Status)
+				}
+			}
+		}
+	}
+
+	for _, name := range nodeNames {
+		host := hostsByNode[name]
+		if host.Conditions == nil {
+			host.Conditions = []Condition{}
+		}
+		result.Hosts = append(result.Hosts, *host)
+	}
+
+	components, err := k8sClient.CoreV1().ComponentStatuses().List(metav1.ListOptions{})
+	if err != nil {
+		result.Errors = append(result.Errors, "components: "+err.Error())
+	} else {
+		for _, cs := range components.Items {
+			if embeddedComponents[cs.Name] {
+				continue
+			}
+			component := Component{
+				Name: cs.Name,
+			}
+			for _, cond := range cs.Conditions {
+				if cond.Type == v1.ComponentHealthy {
+					component.Healthy = cond.Status == v1.ConditionTrue
+					component.Message = cond.Message
+					if cond.Error != "" {
+						component.Message = cond.Error
+					}
+				}
+			}
+			result.Components = append(result.Components, component)
+		}
+	}
+
+	pods, err := k8sClient.CoreV1().Pods("").List(metav1.ListOptions{})
+	if err != nil {
+		result.Errors = append(result.Errors, "pods: "+err.Error())
+	} else {
+		for _, pod := range pods.Items {
+			if len(result.FailingPods) >= maxFailingPods {
+				break
+			}
+			if failing, ok := failingPod(pod); ok {
+				result.FailingPods = append(result.FailingPods, failing)
+			}
+		}
+	}
+
+	result.Healthy = healthy(result)
+	return result
+}
+
+func failingPod(pod v1.Pod) (Pod, bool) {
+	result := Pod{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		NodeName:  pod.Spec.NodeName,
+		Phase:     string(pod.Status.Phase),
+		Reason:    pod.Status.Reason,
+		Message:   pod.Status.Message,
+	}
+
+	if pod.Status.Phase == v1.PodFailed {
+		return result, true
+	}
+
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && failingReasons[cs.State.Waiting.Reason] {
+			result.Reason = cs.State.Waiting.Reason
+			result.Message = cs.State.Waiting.Message
+			return result, true
+		}
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodScheduled && cond.Status == v1.ConditionFalse {
+			result.Reason = cond.Reason
+			result.Message = cond.Message
+			return result, true
+		}
+	}
+
+	return result, false
+}
+
+func healthy(c *Cluster) bool {
+	if len(c.Errors) > 0 || c.State != "active" {
+		return false
+	}
+	for _, host := range c.Hosts {
+		if host.Ready != string(v1.ConditionTrue) || (host.State != "" && host.State != "active") {
+			return false
+		}
+	}
+	for _, component := range c.Components {
+		if !component.Healthy {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"path"
+
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/netes/metrics"
+	"github.com/rancher/netes/types"
+	"github.com/rancher/netes/usage"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsapiserver "k8s.io/apiextensions-apiserver/pkg/apiserver"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/server/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+// APIExtensionsRESTOptionsFactory stores CRDs or custom resources under <group>/<resource> of the cluster
+// prefix, like upstream, so custom resources of different groups with the same name don't collide
+type APIExtensionsRESTOptionsFactory struct {
+	StorageConfig storagebackend.Config
+	Usage         *usage.Tracker
+	ClusterID     string
+}
+
+// APIExtensionsRESTOptions returns the options for CRDs and for the custom resources they define
+func APIExtensionsRESTOptions(config *types.GlobalConfig, cluster *client.Cluster) (*APIExtensionsRESTOptionsFactory, *APIExtensionsRESTOptionsFactory) {
+	crdConfig := storagebackend.NewDefaultConfig(ClusterPrefix(cluster), apiextensionsapiserver.Scheme,
+		apiextensionsapiserver.Codecs.LegacyCodec(v1beta1.SchemeGroupVersion))
+	backend(crdConfig, config, cluster)
+
+	customResourceConfig := *crdConfig
+	customResourceConfig.Codec = unstructured.UnstructuredJSONScheme
+	customResourceConfig.Copier = apiextensionsapiserver.UnstructuredCopier{}
+
+	return &APIExtensionsRESTOptionsFactory{
+		StorageConfig: *crdConfig,
+		Usage:         Usage(config, cluster),
+		ClusterID:     cluster.Id,
+	}, &APIExtensionsRESTOptionsFactory{
+		StorageConfig: customResourceConfig,
+		Usage:         Usage(config, cluster),
+		ClusterID:     cluster.Id,
+	}
+}
+
+func (f *APIExtensionsRESTOptionsFactory) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	storageConfig := f.StorageConfig
+	ret := generic.RESTOptions{
+		StorageConfig:           &storageConfig,
+		Decorator:               metrics.StorageDecorator(f.ClusterID, generic.UndecoratedStorage),
+		DeleteCollectionWorkers: 1,
+		EnableGarbageCollection: true,
+		ResourcePrefix:          customResourcePrefix(resource),
+	}
+
+	if f.Usage != nil {
+		f.Usage.Track(f.ClusterID, resource.String(), path.Join("/", storageConfig.Prefix, ret.ResourcePrefix)+"/")
+	}
+
+	return ret, nil
+}
+
+func customResourcePrefix(resource schema.GroupResource) string {
+	return resource.Group + "/" + resource.Resource
+}
+
+// ResourcePrefix returns where the objects of a resource are stored relative to the cluster prefix, including
+// CRDs and custom resources which storageFactory doesn't know about
+func ResourcePrefix(storageFactory storage.StorageFactory) func(schema.GroupResource) string {
+	return func(resource schema.GroupResource) string {
+		if api.Registry.IsRegistered(resource.Group) {
+			return storageFactory.ResourcePrefix(resource)
+		}
+		return customResourcePrefix(resource)
+	}
+}
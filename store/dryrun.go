@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/k8s-sql/kv"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	dryRunAll = "All"
+
+	// DryRunExtra is the extra the user of dry run requests gets, admission plugins only get the user of a request
+	// and leave out what a dry run must not charge, like the usage of resource quotas
+	DryRunExtra = "netes.rancher.io/dry-run"
+)
+
+// dryRunUnsupported are resources whose REST storage writes other storage outside of the request context, a dry
+// run would go through with those writes.  Services allocate cluster IPs and node ports on create and update, and
+// release them on delete, through the allocator storage.
+var dryRunUnsupported = map[schema.GroupResource]bool{
+	{Group: "", Resource: "services"}: true,
+}
+
+// DryRunFilter runs write requests with dryRun=All through admission and validation like any other write, the
+// store returns the result without writing it.  Admission plugins that change other objects still do, like
+// upstream before plugins declared whether they support dry run, except for the quotas that skip dry runs by
+// DryRunExtra.
+func DryRunFilter(handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if _, ok := q["dryRun"]; !ok {
+			// the extras of authenticating proxies and impersonation can't turn a write into a dry run for quotas
+			if ctx, ok := mapper.Get(req); ok {
+				if u, ok := apirequest.UserFrom(ctx); ok && IsDryRun(u) {
+					if err := mapper.Update(req, apirequest.WithUser(ctx, dryRunUser(u, false))); err != nil {
+						responsewriters.InternalError(rw, req, err)
+						return
+					}
+				}
+			}
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			responsewriters.InternalError(rw, req, fmt.Errorf("no context found for request"))
+			return
+		}
+
+		for _, value := range q["dryRun"] {
+			if value != dryRunAll {
+				err := apierrors.NewBadRequest(fmt.Sprintf("Invalid dryRun value %q, only %q is supported", value, dryRunAll))
+				responsewriters.ErrorNegotiated(ctx, err, api.Codecs, api.Registry.GroupOrDie(api.GroupName).GroupVersion, rw, req)
+				return
+			}
+		}
+
+		if info, ok := apirequest.RequestInfoFrom(ctx); ok && info.IsResourceRequest {
+			groupResource := schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}
+			if dryRunUnsupported[groupResource] {
+				err := apierrors.NewBadRequest(fmt.Sprintf("dryRun is not supported for %s", groupResource.String()))
+				responsewriters.ErrorNegotiated(ctx, err, api.Codecs, api.Registry.GroupOrDie(api.GroupName).GroupVersion, rw, req)
+				return
+			}
+		}
+
+		ctx = kv.WithDryRun(ctx)
+		if u, ok := apirequest.UserFrom(ctx); ok {
+			ctx = apirequest.WithUser(ctx, dryRunUser(u, true))
+		}
+		if err := mapper.Update(req, ctx); err != nil {
+			responsewriters.InternalError(rw, req, err)
+			return
+		}
+
+		// the parameter is unknown to the options of this apiserver version
+		q.Del("dryRun")
+		req.URL.RawQuery = q.Encode()
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+// IsDryRun is whether u is the user of a dry run request
+func IsDryRun(u user.Info) bool {
+	return u != nil && len(u.GetExtra()[DryRunExtra]) > 0
+}
+
+func dryRunUser(u user.Info, dryRun bool) user.Info {
+	extra := map[string][]string{}
+	for k, v := range u.GetExtra() {
+		if k != DryRunExtra {
+			extra[k] = v
+		}
+	}
+	if dryRun {
+		extra[DryRunExtra] = []string{"true"}
+	}
+	return &user.DefaultInfo{
+		Name:   u.GetName(),
+		UID:    u.GetUID(),
+		Groups: u.GetGroups(),
+		Extra:  extra,
+	}
+}
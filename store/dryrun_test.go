@@ -0,0 +1,181 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rancher/k8s-sql"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/filters"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/kubernetes/pkg/api"
+	_ "k8s.io/kubernetes/pkg/api/install"
+)
+
+func newTestStore(t *testing.T) (storage.Interface, kv.Client) {
+	client := rdbms.NewMemoryClient(context.Background())
+	codec := api.Codecs.LegacyCodec(schema.GroupVersion{Version: "v1"})
+	s := kv.New(client, codec, "/registry", value.NewMutableTransformer(value.IdentityTransformer))
+
+	pod := &api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"}}
+	if err := s.Create(context.Background(), "pods/default/existing", pod, &api.Pod{}, 0); err != nil {
+		t.Fatalf("Failed to create existing pod: %v", err)
+	}
+	return s, client
+}
+
+// stored returns the stored value of key, failing the test if it can't be read
+func stored(t *testing.T, client kv.Client, key string) *kv.KeyValue {
+	value, err := client.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", key, err)
+	}
+	return value
+}
+
+func TestDryRunCreate(t *testing.T) {
+	s, client := newTestStore(t)
+	ctx := kv.WithDryRun(context.Background())
+
+	out := &api.Pod{}
+	pod := &api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"}}
+	if err := s.Create(ctx, "pods/default/new", pod, out, 0); err != nil {
+		t.Fatalf("Dry run create failed: %v", err)
+	}
+	if out.Name != "new" {
+		t.Errorf("Expected the created pod to be returned, got %q", out.Name)
+	}
+
+	existing := &api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"}}
+	if err := s.Create(ctx, "pods/default/existing", existing, &api.Pod{}, 0); !storage.IsNodeExist(err) {
+		t.Errorf("Expected a dry run create of an existing pod to fail with key exists, got %v", err)
+	}
+
+	if stored(t, client, "/registry/pods/default/new") != nil {
+		t.Errorf("Dry run create stored the pod")
+	}
+}
+
+func TestDryRunUpdate(t *testing.T) {
+	s, client := newTestStore(t)
+	ctx := kv.WithDryRun(context.Background())
+
+	out := &api.Pod{}
+	err := s.GuaranteedUpdate(ctx, "pods/default/existing", out, false, nil, storage.SimpleUpdate(func(obj runtime.Object) (runtime.Object, error) {
+		pod := obj.(*api.Pod)
+		pod.Labels = map[string]string{"updated": "true"}
+		return pod, nil
+	}))
+	if err != nil {
+		t.Fatalf("Dry run update failed: %v", err)
+	}
+	if out.Labels["updated"] != "true" {
+		t.Errorf("Expected the updated pod to be returned, got labels %v", out.Labels)
+	}
+
+	if stored(t, client, "/registry/pods/default/existing").Revision != 1 {
+		t.Errorf("Dry run update changed the stored pod")
+	}
+}
+
+func TestDryRunDelete(t *testing.T) {
+	s, client := newTestStore(t)
+	ctx := kv.WithDryRun(context.Background())
+
+	out := &api.Pod{}
+	if err := s.Delete(ctx, "pods/default/existing", out, nil); err != nil {
+		t.Fatalf("Dry run delete failed: %v", err)
+	}
+	if out.Name != "existing" {
+		t.Errorf("Expected the deleted pod to be returned, got %q", out.Name)
+	}
+
+	if err := s.Delete(ctx, "pods/default/missing", &api.Pod{}, nil); !storage.IsNotFound(err) {
+		t.Errorf("Expected a dry run delete of a missing pod to fail with not found, got %v", err)
+	}
+
+	if stored(t, client, "/registry/pods/default/existing") == nil {
+		t.Errorf("Dry run delete removed the pod")
+	}
+}
+
+func TestDryRunFilter(t *testing.T) {
+	var dryRun, dryRunUser bool
+	var rawQuery string
+	inner := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rawQuery = req.URL.RawQuery
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	mapper := apirequest.NewRequestContextMapper()
+	handler := dryRunHandler(mapper, inner, &dryRun, &dryRunUser)
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		dryRun bool
+	}{
+		{"POST", "/api/v1/namespaces/default/pods?dryRun=All", http.StatusOK, true},
+		{"POST", "/api/v1/namespaces/default/pods", http.StatusOK, false},
+		{"POST", "/api/v1/namespaces/default/pods?dryRun=Some", http.StatusBadRequest, false},
+		{"POST", "/api/v1/namespaces/default/services?dryRun=All", http.StatusBadRequest, false},
+		{"DELETE", "/api/v1/namespaces/default/services/web?dryRun=All", http.StatusBadRequest, false},
+	}
+	for _, test := range tests {
+		dryRun, dryRunUser, rawQuery = false, false, ""
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(test.method, test.url, nil))
+
+		if rw.Code != test.code {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.url, test.code, rw.Code)
+		}
+		if dryRun != test.dryRun {
+			t.Errorf("%s %s: expected dry run %v, got %v", test.method, test.url, test.dryRun, dryRun)
+		}
+		if dryRunUser != test.dryRun {
+			t.Errorf("%s %s: expected the user to be marked dry run %v, got %v", test.method, test.url, test.dryRun, dryRunUser)
+		}
+		if strings.Contains(rawQuery, "dryRun") {
+			t.Errorf("%s %s: dryRun was passed on", test.method, test.url)
+		}
+	}
+}
+
+// dryRunHandler records whether requests reach inner as dry runs, the user of every request claims to be the user
+// of a dry run which only dry runs may keep
+func dryRunHandler(mapper apirequest.RequestContextMapper, inner http.Handler, dryRun, dryRunUser *bool) http.Handler {
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if ctx, ok := mapper.Get(req); ok {
+			*dryRun = kv.IsDryRun(ctx)
+			u, _ := apirequest.UserFrom(ctx)
+			*dryRunUser = IsDryRun(u)
+		}
+		inner.ServeHTTP(rw, req)
+	})
+	claimDryRun := func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			ctx, _ := mapper.Get(req)
+			mapper.Update(req, apirequest.WithUser(ctx, &user.DefaultInfo{
+				Name:  "test",
+				Extra: map[string][]string{DryRunExtra: {"true"}},
+			}))
+			handler.ServeHTTP(rw, req)
+		})
+	}
+	resolver := &apirequest.RequestInfoFactory{
+		APIPrefixes:          sets.NewString("api", "apis"),
+		GrouplessAPIPrefixes: sets.NewString("api"),
+	}
+	return apirequest.WithRequestContext(filters.WithRequestInfo(claimDryRun(DryRunFilter(handler, mapper)), resolver, mapper), mapper)
+}
@@ -2,7 +2,10 @@ package store
 
 import (
 	"fmt"
+	"path"
 
+	"github.com/rancher/netes/metrics"
+	"github.com/rancher/netes/usage"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/registry/generic"
 	"k8s.io/apiserver/pkg/server/storage"
@@ -10,6 +13,9 @@ import (
 
 type RESTOptionsFactory struct {
 	StorageFactory storage.StorageFactory
+	Trash          *Trash
+	Usage          *usage.Tracker
+	ClusterID      string
 }
 
 func (f *RESTOptionsFactory) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
@@ -21,11 +27,15 @@ func (f *RESTOptionsFactory) GetRESTOptions(resource schema.GroupResource) (gene
 	ret := generic.RESTOptions{
 		StorageConfig: storageConfig,
 		//Decorator:     registry.StorageWithCacher(100),
-		Decorator:               generic.UndecoratedStorage,
+		Decorator:               metrics.StorageDecorator(f.ClusterID, f.Trash.Decorator),
 		DeleteCollectionWorkers: 1,
 		EnableGarbageCollection: true,
 		ResourcePrefix:          f.StorageFactory.ResourcePrefix(resource),
 	}
 
+	if f.Usage != nil {
+		f.Usage.Track(f.ClusterID, resource.String(), path.Join("/", storageConfig.Prefix, ret.ResourcePrefix)+"/")
+	}
+
 	return ret, nil
 }
@@ -1,9 +1,15 @@
 package store
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/rancher/go-rancher/v3"
 	"github.com/rancher/k8s-sql"
 	_ "github.com/rancher/k8s-sql/dialect/mysql"
+	"github.com/rancher/k8s-sql/kv"
 	"github.com/rancher/netes/types"
+	"github.com/rancher/netes/usage"
 	serverstorage "k8s.io/apiserver/pkg/server/storage"
 	"k8s.io/apiserver/pkg/storage/storagebackend"
 	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
@@ -15,17 +21,86 @@ import (
 
 const StorageTypeRDBMS = "mysql"
 
-func init() {
-	factory.Register(StorageTypeRDBMS, rdbms.NewRDBMSStorage)
+func Register(config *types.GlobalConfig) {
+	factory.Register(StorageTypeRDBMS, rdbms.NewRDBMSStorageWithOptions(options(config)))
+}
+
+// Client returns the kv client shared by the storage of all clusters
+func Client(config *types.GlobalConfig) (kv.Client, error) {
+	return rdbms.NewClient(serverList(config), options(config))
+}
+
+func options(config *types.GlobalConfig) rdbms.Options {
+	return rdbms.Options{
+		CoalesceWindow:       config.CoalesceWindow,
+		CoalesceResources:    config.CoalesceResources,
+		Audit:                config.Audit,
+		MutationLog:          config.MutationLog,
+		MutationLogRetention: config.MutationLogRetention,
+		PollInterval:         config.WatchPollInterval,
+		PollJitter:           config.WatchPollJitter,
+		PollIntervals:        config.WatchPollIntervals,
+	}
 }
 
-func StorageFactory(pathPrefix string, config *types.GlobalConfig) (*serverstorage.DefaultStorageFactory, error) {
-	storageConfig := storagebackend.NewDefaultConfig(pathPrefix, api.Scheme, nil)
-	storageConfig.Type = StorageTypeRDBMS
-	storageConfig.ServerList = []string{
+func serverList(config *types.GlobalConfig) []string {
+	return append([]string{
 		config.Dialect,
 		config.DSN,
+	}, config.ShardDSNs...)
+}
+
+// ClusterPrefix is the key prefix of everything stored for a cluster
+func ClusterPrefix(cluster *client.Cluster) string {
+	return fmt.Sprintf("/k8s/cluster/%s", cluster.Uuid)
+}
+
+// Etcd is whether the cluster is stored in its own etcd instead of the database shared by all clusters.  Only its
+// objects are, its certificates and the rest netes keeps for it stay in the database.
+func Etcd(cluster *client.Cluster) bool {
+	return cluster.K8sServerConfig != nil && len(cluster.K8sServerConfig.EtcdServers) > 0
+}
+
+// backend points storageConfig to the etcd of the cluster or the shared database
+func backend(storageConfig *storagebackend.Config, config *types.GlobalConfig, cluster *client.Cluster) {
+	if !Etcd(cluster) {
+		storageConfig.Type = StorageTypeRDBMS
+		storageConfig.ServerList = serverList(config)
+		return
+	}
+
+	storageConfig.Type = storagebackend.StorageTypeETCD3
+	storageConfig.ServerList = cluster.K8sServerConfig.EtcdServers
+	storageConfig.CAFile = cluster.K8sServerConfig.EtcdCAFile
+	storageConfig.CertFile = cluster.K8sServerConfig.EtcdCertFile
+	storageConfig.KeyFile = cluster.K8sServerConfig.EtcdKeyFile
+}
+
+// Usage returns the tracker of the storage used by the cluster, nil for clusters in etcd as usage is counted in
+// the database
+func Usage(config *types.GlobalConfig, cluster *client.Cluster) *usage.Tracker {
+	if Etcd(cluster) {
+		return nil
 	}
+	return config.Usage
+}
+
+// StorageFactory returns the storage of a cluster with the API groups, versions and resources enabled by
+// runtimeConfig, like the --runtime-config of upstream.  Everything is enabled unless runtimeConfig says otherwise.
+func StorageFactory(config *types.GlobalConfig, cluster *client.Cluster, runtimeConfig []string) (*serverstorage.DefaultStorageFactory, error) {
+	resourceConfig := flag.ConfigurationMap{
+		"api/all": "true",
+	}
+	for _, entry := range runtimeConfig {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "true")
+		}
+		resourceConfig[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	storageConfig := storagebackend.NewDefaultConfig(ClusterPrefix(cluster), api.Scheme, nil)
+	backend(storageConfig, config, cluster)
 
 	return kubeapiserver.NewStorageFactory(
 		*storageConfig,
@@ -35,7 +110,5 @@ func StorageFactory(pathPrefix string, config *types.GlobalConfig) (*serverstora
 		nil,
 		nil,
 		master.DefaultAPIResourceConfigSource(),
-		flag.ConfigurationMap{
-			"api/all": "true",
-		})
+		resourceConfig)
 }
@@ -0,0 +1,338 @@
+package store
+
+import (
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	trashPrefix          = "/.trash/content/"
+	trashNamespacePrefix = "/.trash/namespaces"
+	namespacesPrefix     = "/namespaces"
+	trashedAnnotation    = "netes.rancher.io/trashed"
+	purgeInterval        = time.Minute
+)
+
+// Trash retains the objects of a deleted namespace for a grace window before they are purged so a mistaken
+// namespace deletion can be restored.  Objects are kept under /.trash/<namespace>/ in the cluster prefix which
+// is not visible through the API.
+type Trash struct {
+	sync.Mutex
+	window time.Duration
+	stores map[string]*trashStorage
+}
+
+type trashStorage struct {
+	storage.Interface
+	trash          *Trash
+	resourcePrefix string
+	objectType     runtime.Object
+	keyFunc        func(obj runtime.Object) (string, error)
+	newListFunc    func() runtime.Object
+}
+
+func NewTrash(window time.Duration) *Trash {
+	return &Trash{
+		window: window,
+		stores: map[string]*trashStorage{},
+	}
+}
+
+func (t *Trash) Start(ctx context.Context) {
+	if t.window <= 0 {
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(purgeInterval):
+				t.purge(ctx)
+			}
+		}
+	}()
+}
+
+func (t *Trash) Decorator(copier runtime.ObjectCopier, config *storagebackend.Config, capacity *int, objectType runtime.Object,
+	resourcePrefix string, keyFunc func(obj runtime.Object) (string, error), newListFunc func() runtime.Object,
+	getAttrsFunc storage.AttrFunc, trigger storage.TriggerPublisherFunc) (storage.Interface, factory.DestroyFunc) {
+	s, destroy := generic.NewRawStorage(config)
+	if t.window <= 0 {
+		return s, destroy
+	}
+
+	ts := &trashStorage{
+		Interface:      s,
+		trash:          t,
+		resourcePrefix: resourcePrefix,
+		objectType:     objectType,
+		keyFunc:        keyFunc,
+		newListFunc:    newListFunc,
+	}
+
+	t.Lock()
+	t.stores[resourcePrefix] = ts
+	t.Unlock()
+
+	return ts, destroy
+}
+
+func (t *Trash) store(resourcePrefix string) *trashStorage {
+	t.Lock()
+	defer t.Unlock()
+	return t.stores[resourcePrefix]
+}
+
+func (t *Trash) allStores() []*trashStorage {
+	t.Lock()
+	defer t.Unlock()
+
+	var result []*trashStorage
+	for _, s := range t.stores {
+		result = append(result, s)
+	}
+	return result
+}
+
+func (t *Trash) getNamespace(ctx context.Context, name string) (*api.Namespace, error) {
+	namespaces := t.store(namespacesPrefix)
+	if namespaces == nil {
+		return nil, nil
+	}
+
+	ns := &api.Namespace{}
+	if err := namespaces.Interface.Get(ctx, path.Join(namespacesPrefix, name), "", ns, true); err != nil {
+		return nil, err
+	}
+	if ns.Name == "" {
+		return nil, nil
+	}
+	return ns, nil
+}
+
+func (t *Trash) terminating(ctx context.Context, name string) (bool, error) {
+	ns, err := t.getNamespace(ctx, name)
+	if err != nil || ns == nil {
+		return false, err
+	}
+	return ns.Status.Phase == api.NamespaceTerminating, nil
+}
+
+func (s *trashStorage) Delete(ctx context.Context, key string, out runtime.Object, preconditions *storage.Preconditions) error {
+	namespace, trash, err := s.shouldTrash(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if trash {
+		if err := s.moveToTrash(ctx, namespace, key); err != nil {
+			return err
+		}
+	}
+
+	return s.Interface.Delete(ctx, key, out, preconditions)
+}
+
+func (s *trashStorage) shouldTrash(ctx context.Context, key string) (string, bool, error) {
+	if s.resourcePrefix == namespacesPrefix {
+		namespace := path.Base(key)
+		terminating, err := s.trash.terminating(ctx, namespace)
+		return namespace, terminating, err
+	}
+
+	namespace, ok := genericapirequest.NamespaceFrom(ctx)
+	if !ok || namespace == "" {
+		return "", false, nil
+	}
+
+	terminating, err := s.trash.terminating(ctx, namespace)
+	return namespace, terminating, err
+}
+
+func (s *trashStorage) newObject() runtime.Object {
+	return reflect.New(reflect.TypeOf(s.objectType).Elem()).Interface().(runtime.Object)
+}
+
+func (s *trashStorage) moveToTrash(ctx context.Context, namespace, key string) error {
+	obj := s.newObject()
+	if err := s.Interface.Get(ctx, key, "", obj, true); err != nil {
+		return err
+	}
+
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if objMeta.GetName() == "" {
+		return nil
+	}
+
+	objMeta.SetResourceVersion("")
+	if s.resourcePrefix == namespacesPrefix {
+		annotations := objMeta.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[trashedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		objMeta.SetAnnotations(annotations)
+	}
+
+	trashKey := s.trashKey(namespace, key)
+	s.Interface.Delete(ctx, trashKey, s.newObject(), nil)
+	return s.Interface.Create(ctx, trashKey, obj, s.newObject(), 0)
+}
+
+func (s *trashStorage) trashKey(namespace, key string) string {
+	if s.resourcePrefix == namespacesPrefix {
+		return path.Join(trashNamespacePrefix, namespace)
+	}
+	return trashPrefix + namespace + key
+}
+
+func (s *trashStorage) listTrash(ctx context.Context, namespace string) ([]runtime.Object, error) {
+	var err error
+	list := s.newListFunc()
+	if s.resourcePrefix == namespacesPrefix {
+		err = s.Interface.GetToList(ctx, s.trashKey(namespace, ""), "", storage.Everything, list)
+	} else {
+		err = s.Interface.List(ctx, trashPrefix+namespace+s.resourcePrefix, "", storage.Everything, list)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta.ExtractList(list)
+}
+
+func (s *trashStorage) deleteTrash(ctx context.Context, namespace string, obj runtime.Object) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return err
+	}
+	return s.Interface.Delete(ctx, s.trashKey(namespace, key), s.newObject(), nil)
+}
+
+// Restore recreates a deleted namespace and all of its objects from the trash
+func (t *Trash) Restore(ctx context.Context, namespace string) error {
+	existing, err := t.getNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errors.Errorf("namespace %s still exists", namespace)
+	}
+
+	namespaces := t.store(namespacesPrefix)
+	if namespaces == nil {
+		return errors.Errorf("namespace %s not found in trash", namespace)
+	}
+
+	trashed, err := namespaces.listTrash(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if len(trashed) == 0 {
+		return errors.Errorf("namespace %s not found in trash", namespace)
+	}
+
+	ns := trashed[0].(*api.Namespace)
+	delete(ns.Annotations, trashedAnnotation)
+	ns.Status.Phase = api.NamespaceActive
+	ns.Spec.Finalizers = []api.FinalizerName{api.FinalizerKubernetes}
+	if err := namespaces.restore(ctx, namespace, ns); err != nil {
+		return err
+	}
+
+	for _, s := range t.allStores() {
+		if s.resourcePrefix == namespacesPrefix {
+			continue
+		}
+
+		objs, err := s.listTrash(ctx, namespace)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range objs {
+			if err := s.restore(ctx, namespace, obj); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *trashStorage) restore(ctx context.Context, namespace string, obj runtime.Object) error {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	objMeta.SetResourceVersion("")
+	objMeta.SetDeletionTimestamp(nil)
+	objMeta.SetDeletionGracePeriodSeconds(nil)
+
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Interface.Create(ctx, key, obj, s.newObject(), 0); err != nil {
+		return err
+	}
+
+	return s.deleteTrash(ctx, namespace, obj)
+}
+
+func (t *Trash) purge(ctx context.Context) {
+	namespaces := t.store(namespacesPrefix)
+	if namespaces == nil {
+		return
+	}
+
+	list := namespaces.newListFunc()
+	if err := namespaces.Interface.List(ctx, trashNamespacePrefix, "", storage.Everything, list); err != nil {
+		logrus.Errorf("Failed to list trash: %v", err)
+		return
+	}
+
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return
+	}
+
+	for _, obj := range objs {
+		ns := obj.(*api.Namespace)
+		trashed, err := time.Parse(time.RFC3339, ns.Annotations[trashedAnnotation])
+		if err != nil || time.Now().Sub(trashed) < t.window {
+			continue
+		}
+
+		logrus.Infof("Purging namespace %s deleted at %v", ns.Name, trashed)
+		for _, s := range t.allStores() {
+			objs, err := s.listTrash(ctx, ns.Name)
+			if err != nil {
+				logrus.Errorf("Failed to purge namespace %s: %v", ns.Name, err)
+				continue
+			}
+			for _, obj := range objs {
+				s.deleteTrash(ctx, ns.Name, obj)
+			}
+		}
+	}
+}
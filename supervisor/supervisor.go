@@ -0,0 +1,219 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/netes/health"
+	"github.com/rancher/netes/server"
+	"github.com/rancher/netes/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	checkInterval = 10 * time.Second
+	minBackoff    = 30 * time.Second
+	maxBackoff    = 10 * time.Minute
+)
+
+var (
+	unhealthyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_cluster_apiserver_unhealthy",
+		Help: "1 while the apiserver of a cluster fails its health check with its storage reachable, 0 otherwise",
+	}, []string{"cluster"})
+	supervisorRestartCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_cluster_supervisor_restarts_total",
+		Help: "Number of times the apiserver of a cluster was restarted because it stayed unhealthy, per result",
+	}, []string{"cluster", "result"})
+	panicCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "netes_panics_total",
+		Help: "Panics recovered in the process, a cluster whose goroutine panicked may need a restart",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(unhealthyGauge)
+	prometheus.MustRegister(supervisorRestartCounter)
+	prometheus.MustRegister(panicCounter)
+}
+
+// state is what the supervisor knows about a cluster, restarts back off from minBackoff up to maxBackoff and the
+// backoff is reset once the cluster stayed healthy for maxBackoff
+type state struct {
+	unhealthySince time.Time
+	healthySince   time.Time
+	backoff        time.Duration
+	nextRestart    time.Time
+}
+
+// Supervisor restarts the apiservers of clusters that are wedged, failing their health check while their storage
+// is reachable, so one broken cluster doesn't need a restart of netes.  Panics netes recovers from, like the
+// ones of controllers, trigger a check of all clusters right away.
+type Supervisor struct {
+	config        *types.GlobalConfig
+	serverFactory *server.Factory
+	health        *health.Checker
+	states        map[string]*state
+	panicked      chan struct{}
+}
+
+func New(config *types.GlobalConfig, serverFactory *server.Factory, checker *health.Checker) *Supervisor {
+	return &Supervisor{
+		config:        config,
+		serverFactory: serverFactory,
+		health:        checker,
+		states:        map[string]*state{},
+		panicked:      make(chan struct{}, 1),
+	}
+}
+
+func (s *Supervisor) Start(ctx context.Context) {
+	if s.config.UnhealthyRestartTimeout <= 0 {
+		return
+	}
+
+	utilruntime.PanicHandlers = append(utilruntime.PanicHandlers, func(r interface{}) {
+		panicCounter.Inc()
+		select {
+		case s.panicked <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sync(false)
+			case <-s.panicked:
+				logrus.Warnf("Recovered from a panic, checking the health of all clusters")
+				s.sync(true)
+			}
+		}
+	}()
+}
+
+// sync checks the running clusters, with the last results of the health checker unless fresh is set
+func (s *Supervisor) sync(fresh bool) {
+	now := time.Now()
+	running := map[string]bool{}
+	for _, srv := range s.serverFactory.Servers() {
+		clusterID := srv.Cluster().Id
+		running[clusterID] = true
+
+		result := s.health.Get(srv)
+		if fresh {
+			result = s.health.Check(srv)
+		}
+		s.observe(clusterID, wedged(result), now)
+	}
+
+	for clusterID := range s.states {
+		if !running[clusterID] {
+			delete(s.states, clusterID)
+			unhealthyGauge.DeleteLabelValues(clusterID)
+		}
+	}
+}
+
+func (s *Supervisor) observe(clusterID string, unhealthy bool, now time.Time) {
+	st, ok := s.states[clusterID]
+	if !ok {
+		st = &state{healthySince: now}
+		s.states[clusterID] = st
+	}
+
+	if !unhealthy {
+		unhealthyGauge.WithLabelValues(clusterID).Set(0)
+		if !st.unhealthySince.IsZero() {
+			logrus.Infof("Apiserver of cluster %s is healthy again", clusterID)
+			st.unhealthySince = time.Time{}
+			st.healthySince = now
+		}
+		if st.backoff > 0 && now.Sub(st.healthySince) > maxBackoff {
+			st.backoff = 0
+		}
+		return
+	}
+
+	unhealthyGauge.WithLabelValues(clusterID).Set(1)
+	if st.unhealthySince.IsZero() {
+		logrus.Warnf("Apiserver of cluster %s is unhealthy", clusterID)
+		st.unhealthySince = now
+	}
+	if now.Sub(st.unhealthySince) < s.config.UnhealthyRestartTimeout || now.Before(st.nextRestart) {
+		return
+	}
+
+	if st.backoff == 0 {
+		st.backoff = minBackoff
+	} else if st.backoff *= 2; st.backoff > maxBackoff {
+		st.backoff = maxBackoff
+	}
+	st.nextRestart = now.Add(st.backoff)
+
+	logrus.Errorf("Apiserver of cluster %s has been unhealthy since %s, restarting it, next restart no earlier than in %s",
+		clusterID, st.unhealthySince.Format(time.RFC3339), st.backoff)
+	if err := s.serverFactory.Restart(clusterID, "unhealthy", s.config.DrainTimeout); err != nil {
+		logrus.Errorf("Failed to restart apiserver of cluster %s: %v", clusterID, err)
+		supervisorRestartCounter.WithLabelValues(clusterID, "error").Inc()
+		return
+	}
+	supervisorRestartCounter.WithLabelValues(clusterID, "success").Inc()
+	st.unhealthySince = now
+	s.event(clusterID, st.backoff)
+}
+
+// event tells the users of the cluster why their apiserver went away for a moment, the new apiserver may not
+// be able to store it yet
+func (s *Supervisor) event(clusterID string, backoff time.Duration) {
+	srv, ok := s.serverFactory.Server(clusterID)
+	if !ok {
+		return
+	}
+	now := metav1.Now()
+	_, err := srv.Clients().Client.CoreV1().Events(metav1.NamespaceDefault).Create(&v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "netes-apiserver-restart-",
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Namespace",
+			Name:      metav1.NamespaceDefault,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Reason:         "APIServerRestarted",
+		Message:        fmt.Sprintf("The apiserver was restarted by netes because it stayed unhealthy, the next restart is no earlier than in %s", backoff),
+		Source:         v1.EventSource{Component: "netes", Host: s.config.ReplicaID},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           v1.EventTypeWarning,
+	})
+	if err != nil {
+		logrus.Warnf("Failed to record restart event in cluster %s: %v", clusterID, err)
+	}
+}
+
+// wedged is whether the apiserver fails while its storage is fine, restarting doesn't help clusters that lost
+// their database
+func wedged(result health.Cluster) bool {
+	apiserverOK, storageOK := true, true
+	for _, check := range result.Checks {
+		switch check.Name {
+		case health.CheckAPIServer:
+			apiserverOK = check.OK
+		case health.CheckStorage:
+			storageOK = check.OK
+		}
+	}
+	return !apiserverOK && storageOK
+}
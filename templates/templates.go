@@ -0,0 +1,139 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/rancher/go-rancher/v3"
+	"github.com/rancher/k8s-sql/kv"
+	"github.com/rancher/netes/server/admission"
+	"github.com/rancher/netes/types"
+	"golang.org/x/net/context"
+)
+
+var extensions = []string{".yaml", ".yml", ".json"}
+
+// Template is a named set of defaults for new clusters so a fleet of clusters is configured alike.  Templates are
+// files of the template directory named like <name>.yaml, the settings given for a new cluster win over the ones
+// of its template.
+type Template struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Admission is saved as the admission plugin configuration of the cluster
+	Admission    *admission.PluginConfig `json:"admission,omitempty"`
+	FeatureGates []string                `json:"featureGates,omitempty"`
+	AuditPolicy  string                  `json:"auditPolicy,omitempty"`
+	// RBAC and StorageClasses are manifests applied when the cluster first starts, like its bootstrap manifests.
+	// They replace the files of the global manifest directory.
+	RBAC           string `json:"rbac,omitempty"`
+	StorageClasses string `json:"storageClasses,omitempty"`
+	// PodSecurityLevel is the minimum security posture of the pods of the tier, see admission.PodSecurityBaseline
+	PodSecurityLevel            string   `json:"podSecurityLevel,omitempty"`
+	PodSecurityExemptNamespaces []string `json:"podSecurityExemptNamespaces,omitempty"`
+}
+
+// List returns the templates of the directory, by name
+func List(config *types.GlobalConfig) ([]*Template, error) {
+	if config.ClusterTemplatesDir == "" {
+		return nil, nil
+	}
+
+	var files []string
+	for _, ext := range extensions {
+		matches, err := filepath.Glob(filepath.Join(config.ClusterTemplatesDir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	var result []*Template
+	for _, file := range files {
+		t, err := load(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// Get returns a template by name, nil if there is none
+func Get(config *types.GlobalConfig, name string) (*Template, error) {
+	if config.ClusterTemplatesDir == "" || name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, nil
+	}
+
+	for _, ext := range extensions {
+		t, err := load(filepath.Join(config.ClusterTemplatesDir, name+ext))
+		if err == nil {
+			return t, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func load(file string) (*Template, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{}
+	if err := yaml.Unmarshal(content, t); err != nil {
+		return nil, errors.Wrapf(err, "invalid cluster template %s", file)
+	}
+	t.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if err := admission.ValidatePodSecurityLevel(t.PodSecurityLevel); err != nil {
+		return nil, errors.Wrapf(err, "invalid cluster template %s", file)
+	}
+	if t.Admission != nil {
+		if err := t.Admission.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid cluster template %s", file)
+		}
+	}
+	return t, nil
+}
+
+// Apply fills in the settings of a new cluster that the template has defaults for
+func (t *Template) Apply(cluster *client.Cluster) {
+	if cluster.K8sServerConfig == nil {
+		cluster.K8sServerConfig = &client.K8sServerConfig{}
+	}
+	config := cluster.K8sServerConfig
+
+	config.FeatureGates = types.FirstNotLenZero(config.FeatureGates, t.FeatureGates)
+	config.AuditPolicy = types.FirstNotEmpty(config.AuditPolicy, t.AuditPolicy)
+	config.PodSecurityLevel = types.FirstNotEmpty(config.PodSecurityLevel, t.PodSecurityLevel)
+	config.PodSecurityExemptNamespaces = types.FirstNotLenZero(config.PodSecurityExemptNamespaces, t.PodSecurityExemptNamespaces)
+
+	if config.BootstrapManifests == "" {
+		var manifests []string
+		for _, m := range []string{t.RBAC, t.StorageClasses} {
+			if strings.TrimSpace(m) != "" {
+				manifests = append(manifests, m)
+			}
+		}
+		config.BootstrapManifests = strings.Join(manifests, "\n---\n")
+	}
+}
+
+// Configure saves the admission plugin configuration of the template for a created cluster, the server of the
+// cluster is restarted with it if it already started
+func (t *Template) Configure(ctx context.Context, kvClient kv.Client, clusterUUID string) error {
+	if t.Admission == nil {
+		return nil
+	}
+	return errors.Wrapf(admission.SavePluginConfig(ctx, kvClient, clusterUUID, t.Admission),
+		"failed to save admission configuration of template %s", t.Name)
+}
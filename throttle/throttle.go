@@ -0,0 +1,166 @@
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	maxRetryAfter = 60
+	// weight of the latest wait in the average used for Retry-After
+	waitAverageWeight = 0.2
+)
+
+var (
+	nonMutatingRequestVerbs = sets.NewString("get", "list", "watch")
+
+	waitHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "netes_request_queue_wait_seconds",
+		Help:    "Time requests waited for a free in-flight slot per cluster and kind, mutating or readonly",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"cluster", "kind"})
+	throttledCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "netes_requests_throttled_total",
+		Help: "Number of requests rejected with 429 per cluster and kind, mutating or readonly",
+	}, []string{"cluster", "kind"})
+)
+
+func init() {
+	prometheus.MustRegister(waitHistogram)
+	prometheus.MustRegister(throttledCounter)
+}
+
+type slots struct {
+	kind    string
+	limit   int
+	c       chan bool
+	avgLock sync.Mutex
+	avgWait float64
+}
+
+// Limiter limits the requests in flight of a cluster like the upstream max in-flight filter but queues
+// requests up to a timeout instead of rejecting them right away.  Responses carry the RateLimit-Limit and
+// RateLimit-Remaining headers, rejected requests a Retry-After of the recent queue wait so clients back off
+// for as long as the queue needs to drain rather than retrying every second.
+type Limiter struct {
+	clusterID   string
+	timeout     time.Duration
+	nonMutating *slots
+	mutating    *slots
+}
+
+func New(clusterID string, nonMutatingLimit, mutatingLimit int, timeout time.Duration) *Limiter {
+	return &Limiter{
+		clusterID:   clusterID,
+		timeout:     timeout,
+		nonMutating: newSlots("readonly", nonMutatingLimit),
+		mutating:    newSlots("mutating", mutatingLimit),
+	}
+}
+
+func newSlots(kind string, limit int) *slots {
+	if limit <= 0 {
+		return nil
+	}
+	return &slots{
+		kind:  kind,
+		limit: limit,
+		c:     make(chan bool, limit),
+	}
+}
+
+// Filter must run after the request info is resolved, long running requests are not limited
+func (l *Limiter) Filter(handler http.Handler, mapper apirequest.RequestContextMapper, longRunning apirequest.LongRunningRequestCheck) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			http.Error(rw, "no context found for request", http.StatusInternalServerError)
+			return
+		}
+		requestInfo, ok := apirequest.RequestInfoFrom(ctx)
+		if !ok {
+			http.Error(rw, "no RequestInfo found for request", http.StatusInternalServerError)
+			return
+		}
+
+		if longRunning != nil && longRunning(req, requestInfo) {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		s := l.nonMutating
+		if !nonMutatingRequestVerbs.Has(requestInfo.Verb) {
+			s = l.mutating
+		}
+		if s == nil {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		if !l.acquire(s, req) {
+			l.tooManyRequests(rw, s)
+			return
+		}
+		defer func() { <-s.c }()
+
+		rw.Header().Set("RateLimit-Limit", strconv.Itoa(s.limit))
+		rw.Header().Set("RateLimit-Remaining", strconv.Itoa(s.limit-len(s.c)))
+		handler.ServeHTTP(rw, req)
+	})
+}
+
+func (l *Limiter) acquire(s *slots, req *http.Request) bool {
+	select {
+	case s.c <- true:
+		return true
+	default:
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	acquired := false
+	select {
+	case s.c <- true:
+		acquired = true
+	case <-timer.C:
+	case <-req.Context().Done():
+	}
+
+	wait := time.Since(start)
+	waitHistogram.WithLabelValues(l.clusterID, s.kind).Observe(wait.Seconds())
+	s.avgLock.Lock()
+	s.avgWait = (1-waitAverageWeight)*s.avgWait + waitAverageWeight*wait.Seconds()
+	s.avgLock.Unlock()
+
+	return acquired
+}
+
+func (l *Limiter) tooManyRequests(rw http.ResponseWriter, s *slots) {
+	throttledCounter.WithLabelValues(l.clusterID, s.kind).Inc()
+
+	s.avgLock.Lock()
+	retryAfter := int(math.Ceil(s.avgWait))
+	s.avgLock.Unlock()
+	if retryAfter < 1 {
+		retryAfter = 1
+	} else if retryAfter > maxRetryAfter {
+		retryAfter = maxRetryAfter
+	}
+
+	rw.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	rw.Header().Set("RateLimit-Limit", strconv.Itoa(s.limit))
+	rw.Header().Set("RateLimit-Remaining", "0")
+	rw.Header().Set("RateLimit-Reset", strconv.Itoa(retryAfter))
+	http.Error(rw, fmt.Sprintf("Too many requests, please try again in %d seconds.", retryAfter), apierrors.StatusTooManyRequests)
+}
@@ -0,0 +1,206 @@
+package tokenrequest
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiserverserviceaccount "k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/api"
+)
+
+const (
+	protobufContentType = "application/vnd.kubernetes.protobuf"
+
+	defaultExpiration = time.Hour
+	minExpiration     = 10 * time.Minute
+)
+
+// Issuer serves the token subresource of service accounts, POST
+// /api/v1/namespaces/<namespace>/serviceaccounts/<name>/token, the way newer apiservers do.  Tokens expire, have
+// audiences and can be bound to a pod or secret.
+type Issuer struct {
+	issuer        string
+	maxExpiration time.Duration
+	key           *rsa.PrivateKey
+	client        kubernetes.Interface
+}
+
+func NewIssuer(issuer string, maxExpiration time.Duration, key *rsa.PrivateKey, client kubernetes.Interface) *Issuer {
+	return &Issuer{
+		issuer:        issuer,
+		maxExpiration: maxExpiration,
+		key:           key,
+		client:        client,
+	}
+}
+
+// Filter handles TokenRequests, they were authorized as create of serviceaccounts/token like upstream
+func (i *Issuer) Filter(handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx, ok := mapper.Get(req)
+		if !ok {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		info, ok := apirequest.RequestInfoFrom(ctx)
+		if !ok || !info.IsResourceRequest || info.APIGroup != "" || info.Resource != "serviceaccounts" ||
+			info.Subresource != "token" || info.Verb != "create" {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		if err := i.serve(rw, req, info); err != nil {
+			responsewriters.ErrorNegotiated(ctx, err, api.Codecs, api.Registry.GroupOrDie(api.GroupName).GroupVersion, rw, req)
+		}
+	})
+}
+
+func (i *Issuer) serve(rw http.ResponseWriter, req *http.Request, info *apirequest.RequestInfo) error {
+	protobuf := strings.HasPrefix(req.Header.Get("Content-Type"), protobufContentType)
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	tr := &TokenRequest{}
+	if protobuf {
+		err = decodeProtobuf(body, tr)
+	} else {
+		err = json.Unmarshal(body, tr)
+	}
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("Invalid TokenRequest: %v", err))
+	}
+
+	if err := i.issue(info.Namespace, info.Name, tr); err != nil {
+		return err
+	}
+
+	tr.APIVersion = GroupVersion
+	tr.Kind = Kind
+	if protobuf {
+		data, err := encodeProtobuf(tr)
+		if err != nil {
+			return err
+		}
+		rw.Header().Set("Content-Type", protobufContentType)
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write(data)
+		return nil
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(rw).Encode(tr)
+}
+
+func (i *Issuer) issue(namespace, name string, tr *TokenRequest) error {
+	expiration := defaultExpiration
+	if tr.Spec.ExpirationSeconds != nil {
+		expiration = time.Duration(*tr.Spec.ExpirationSeconds) * time.Second
+	}
+	if expiration < minExpiration {
+		return apierrors.NewBadRequest(fmt.Sprintf("expirationSeconds must be at least %d", int(minExpiration.Seconds())))
+	}
+	if i.maxExpiration > 0 && expiration > i.maxExpiration {
+		expiration = i.maxExpiration
+	}
+	if len(tr.Spec.Audiences) == 0 {
+		tr.Spec.Audiences = []string{i.issuer}
+	}
+
+	sa, err := i.client.CoreV1().ServiceAccounts(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if sa.DeletionTimestamp != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("service account %s is being deleted", name))
+	}
+
+	now := time.Now()
+	c := &claims{
+		Subject:   apiserverserviceaccount.MakeUsername(namespace, name),
+		Audience:  tr.Spec.Audiences,
+		Expiry:    now.Add(expiration).Unix(),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		Kubernetes: privateClaims{
+			Namespace: namespace,
+			ServiceAccount: ref{
+				Name: sa.Name,
+				UID:  sa.UID,
+			},
+		},
+	}
+
+	if bound := tr.Spec.BoundObjectRef; bound != nil {
+		if err := i.bind(namespace, sa.Name, bound, c); err != nil {
+			return err
+		}
+	}
+
+	token, err := issue(i.key, i.issuer, c)
+	if err != nil {
+		return err
+	}
+
+	seconds := int64(expiration.Seconds())
+	tr.Spec.ExpirationSeconds = &seconds
+	tr.Status = Status{
+		Token:               token,
+		ExpirationTimestamp: metav1.NewTime(time.Unix(c.Expiry, 0)),
+	}
+	return nil
+}
+
+// bind checks that the object exists, a pod must run as the service account
+func (i *Issuer) bind(namespace, serviceAccount string, bound *BoundObjectReference, c *claims) error {
+	var obj metav1.Object
+	switch bound.Kind {
+	case "Pod":
+		pod, err := i.client.CoreV1().Pods(namespace).Get(bound.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if pod.Spec.ServiceAccountName != serviceAccount {
+			return apierrors.NewBadRequest(fmt.Sprintf("pod %s doesn't run as service account %s", bound.Name, serviceAccount))
+		}
+		obj = pod
+	case "Secret":
+		secret, err := i.client.CoreV1().Secrets(namespace).Get(bound.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		obj = secret
+	default:
+		return apierrors.NewBadRequest(fmt.Sprintf("tokens can only be bound to a Pod or Secret, not %q", bound.Kind))
+	}
+
+	if bound.UID != "" && bound.UID != obj.GetUID() {
+		return apierrors.NewConflict(api.Resource(strings.ToLower(bound.Kind)+"s"), bound.Name,
+			fmt.Errorf("uid %s doesn't match %s", bound.UID, obj.GetUID()))
+	}
+	bound.UID = obj.GetUID()
+
+	r := &ref{
+		Name: bound.Name,
+		UID:  bound.UID,
+	}
+	if bound.Kind == "Pod" {
+		c.Kubernetes.Pod = r
+	} else {
+		c.Kubernetes.Secret = r
+	}
+	return nil
+}
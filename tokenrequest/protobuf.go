@@ -0,0 +1,166 @@
+package tokenrequest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Kubelets send TokenRequests as protobuf.  There is no generated code for them in this version, the
+// messages are small enough to encode by hand with the field numbers of authentication/v1/generated.proto.
+
+var protobufPrefix = []byte{0x6b, 0x38, 0x73, 0x00}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func decodeProtobuf(data []byte, tr *TokenRequest) error {
+	if !bytes.HasPrefix(data, protobufPrefix) {
+		return fmt.Errorf("protobuf TokenRequest without the k8s prefix")
+	}
+	unknown := &runtime.Unknown{}
+	if err := unknown.Unmarshal(data[len(protobufPrefix):]); err != nil {
+		return err
+	}
+
+	return fields(unknown.Raw, func(num int, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			return tr.ObjectMeta.Unmarshal(value)
+		case 2:
+			return decodeSpec(value, &tr.Spec)
+		}
+		return nil
+	})
+}
+
+func decodeSpec(data []byte, spec *Spec) error {
+	return fields(data, func(num int, value []byte, varint uint64) error {
+		switch num {
+		case 1:
+			spec.Audiences = append(spec.Audiences, string(value))
+		case 3:
+			spec.BoundObjectRef = &BoundObjectReference{}
+			return fields(value, func(num int, value []byte, _ uint64) error {
+				switch num {
+				case 1:
+					spec.BoundObjectRef.Kind = string(value)
+				case 2:
+					spec.BoundObjectRef.APIVersion = string(value)
+				case 3:
+					spec.BoundObjectRef.Name = string(value)
+				case 4:
+					spec.BoundObjectRef.UID = types.UID(value)
+				}
+				return nil
+			})
+		case 4:
+			seconds := int64(varint)
+			spec.ExpirationSeconds = &seconds
+		}
+		return nil
+	})
+}
+
+// fields calls f with the number and value of every length delimited or varint field of data
+func fields(data []byte, f func(num int, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("invalid protobuf field")
+		}
+		data = data[n:]
+
+		var (
+			value  []byte
+			varint uint64
+		)
+		switch key & 7 {
+		case wireVarint:
+			if varint, n = binary.Uvarint(data); n <= 0 {
+				return fmt.Errorf("invalid protobuf varint")
+			}
+			data = data[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return fmt.Errorf("invalid protobuf length")
+			}
+			value = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return fmt.Errorf("unexpected protobuf wire type %d", key&7)
+		}
+
+		if err := f(int(key>>3), value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeProtobuf(tr *TokenRequest) ([]byte, error) {
+	metadata, err := tr.ObjectMeta.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	expiration, err := tr.Status.ExpirationTimestamp.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &bytes.Buffer{}
+	for _, audience := range tr.Spec.Audiences {
+		writeBytes(spec, 1, []byte(audience))
+	}
+	if ref := tr.Spec.BoundObjectRef; ref != nil {
+		buf := &bytes.Buffer{}
+		writeBytes(buf, 1, []byte(ref.Kind))
+		writeBytes(buf, 2, []byte(ref.APIVersion))
+		writeBytes(buf, 3, []byte(ref.Name))
+		writeBytes(buf, 4, []byte(ref.UID))
+		writeBytes(spec, 3, buf.Bytes())
+	}
+	if tr.Spec.ExpirationSeconds != nil {
+		writeVarint(spec, 4<<3|wireVarint)
+		writeVarint(spec, uint64(*tr.Spec.ExpirationSeconds))
+	}
+
+	status := &bytes.Buffer{}
+	writeBytes(status, 1, []byte(tr.Status.Token))
+	writeBytes(status, 2, expiration)
+
+	raw := &bytes.Buffer{}
+	writeBytes(raw, 1, metadata)
+	writeBytes(raw, 2, spec.Bytes())
+	writeBytes(raw, 3, status.Bytes())
+
+	unknown := &runtime.Unknown{
+		TypeMeta: runtime.TypeMeta{
+			APIVersion: GroupVersion,
+			Kind:       Kind,
+		},
+		Raw: raw.Bytes(),
+	}
+	data, err := unknown.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, protobufPrefix...), data...), nil
+}
+
+func writeBytes(buf *bytes.Buffer, num int, value []byte) {
+	writeVarint(buf, uint64(num)<<3|wireBytes)
+	writeVarint(buf, uint64(len(value)))
+	buf.Write(value)
+}
+
+func writeVarint(buf *bytes.Buffer, x uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	buf.Write(b[:binary.PutUvarint(b, x)])
+}
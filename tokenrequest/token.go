@@ -0,0 +1,197 @@
+package tokenrequest
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	apiserverserviceaccount "k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	podNameExtra = "authentication.kubernetes.io/pod-name"
+	podUIDExtra  = "authentication.kubernetes.io/pod-uid"
+)
+
+var errUnexpectedSigningMethod = errors.New("unexpected signing method")
+
+// claims are the claims of upstream bound service account tokens
+type claims struct {
+	Issuer     string        `json:"iss"`
+	Subject    string        `json:"sub"`
+	Audience   []string      `json:"aud"`
+	Expiry     int64         `json:"exp"`
+	IssuedAt   int64         `json:"iat"`
+	NotBefore  int64         `json:"nbf"`
+	Kubernetes privateClaims `json:"kubernetes.io"`
+}
+
+type privateClaims struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount ref    `json:"serviceaccount"`
+	Pod            *ref   `json:"pod,omitempty"`
+	Secret         *ref   `json:"secret,omitempty"`
+}
+
+type ref struct {
+	Name string    `json:"name"`
+	UID  types.UID `json:"uid"`
+}
+
+// Valid is checked by the authenticator once it knows the token is one of its own
+func (c *claims) Valid() error {
+	return nil
+}
+
+func (c *claims) valid(now time.Time) error {
+	if now.Unix() >= c.Expiry {
+		return fmt.Errorf("token expired")
+	}
+	if now.Unix() < c.NotBefore {
+		return fmt.Errorf("token not valid yet")
+	}
+	return nil
+}
+
+func issue(key *rsa.PrivateKey, issuer string, c *claims) (string, error) {
+	c.Issuer = issuer
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, c).SignedString(key)
+}
+
+// Authenticator authenticates the tokens issued by TokenRequests for one of audiences.  The service account
+// and the object the token is bound to must still exist.
+type Authenticator struct {
+	issuer    string
+	audiences []string
+	keys      []interface{}
+	client    kubernetes.Interface
+}
+
+func NewAuthenticator(issuer string, keys []interface{}, client kubernetes.Interface) authenticator.Token {
+	return &Authenticator{
+		issuer:    issuer,
+		audiences: []string{issuer},
+		keys:      keys,
+		client:    client,
+	}
+}
+
+func (a *Authenticator) AuthenticateToken(token string) (user.Info, bool, error) {
+	c, err := a.parse(token)
+	if err != nil || c == nil {
+		return nil, false, err
+	}
+
+	if err := c.valid(time.Now()); err != nil {
+		return nil, false, err
+	}
+	if !intersects(c.Audience, a.audiences) {
+		return nil, false, fmt.Errorf("token audiences %v don't include %v", c.Audience, a.audiences)
+	}
+
+	namespace := c.Kubernetes.Namespace
+	sa, err := a.client.CoreV1().ServiceAccounts(namespace).Get(c.Kubernetes.ServiceAccount.Name, metav1.GetOptions{})
+	if err := checkObject("service account", c.Kubernetes.ServiceAccount, sa, err); err != nil {
+		return nil, false, err
+	}
+
+	info := &user.DefaultInfo{
+		Name:   apiserverserviceaccount.MakeUsername(namespace, sa.Name),
+		UID:    string(sa.UID),
+		Groups: apiserverserviceaccount.MakeGroupNames(namespace, sa.Name),
+	}
+
+	if c.Kubernetes.Pod != nil {
+		pod, err := a.client.CoreV1().Pods(namespace).Get(c.Kubernetes.Pod.Name, metav1.GetOptions{})
+		if err := checkObject("pod", *c.Kubernetes.Pod, pod, err); err != nil {
+			return nil, false, err
+		}
+		info.Extra = map[string][]string{
+			podNameExtra: {pod.Name},
+			podUIDExtra:  {string(pod.UID)},
+		}
+	}
+
+	if c.Kubernetes.Secret != nil {
+		secret, err := a.client.CoreV1().Secrets(namespace).Get(c.Kubernetes.Secret.Name, metav1.GetOptions{})
+		if err := checkObject("secret", *c.Kubernetes.Secret, secret, err); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return info, true, nil
+}
+
+// parse verifies the signature of token, it returns no claims for tokens of other issuers
+func (a *Authenticator) parse(token string) (*claims, error) {
+	parser := &jwt.Parser{
+		SkipClaimsValidation: true,
+	}
+
+	var validationError error
+	for _, key := range a.keys {
+		c := &claims{}
+		_, err := parser.ParseWithClaims(token, c, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, errUnexpectedSigningMethod
+			}
+			return key, nil
+		})
+		if err == nil {
+			if c.Issuer != a.issuer {
+				return nil, nil
+			}
+			return c, nil
+		}
+
+		if verr, ok := err.(*jwt.ValidationError); ok {
+			if verr.Errors&jwt.ValidationErrorMalformed != 0 {
+				// not a JWT
+				return nil, nil
+			}
+			if verr.Errors&jwt.ValidationErrorSignatureInvalid != 0 || verr.Inner == errUnexpectedSigningMethod {
+				// signed by another key, a previous one may still verify it
+				validationError = err
+				continue
+			}
+		}
+		return nil, err
+	}
+
+	return nil, validationError
+}
+
+// checkObject checks that the object a token was issued for, got with err, is still the same object
+func checkObject(kind string, expected ref, obj metav1.Object, err error) error {
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%s %s of the token no longer exists", kind, expected.Name)
+	} else if err != nil {
+		return err
+	}
+	if obj.GetUID() != expected.UID {
+		return fmt.Errorf("%s %s of the token was replaced", kind, expected.Name)
+	}
+	if obj.GetDeletionTimestamp() != nil {
+		return fmt.Errorf("%s %s of the token is being deleted", kind, expected.Name)
+	}
+	return nil
+}
+
+func intersects(left, right []string) bool {
+	for _, l := range left {
+		for _, r := range right {
+			if l == r {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package tokenrequest
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	GroupVersion = "authentication.k8s.io/v1"
+	Kind         = "TokenRequest"
+)
+
+// TokenRequest is authentication.k8s.io/v1 TokenRequest, which this apiserver version doesn't have
+type TokenRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Spec   `json:"spec"`
+	Status Status `json:"status,omitempty"`
+}
+
+type Spec struct {
+	Audiences         []string              `json:"audiences"`
+	ExpirationSeconds *int64                `json:"expirationSeconds,omitempty"`
+	BoundObjectRef    *BoundObjectReference `json:"boundObjectRef,omitempty"`
+}
+
+// BoundObjectReference is a pod or secret, the token stops working once it is deleted
+type BoundObjectReference struct {
+	Kind       string    `json:"kind,omitempty"`
+	APIVersion string    `json:"apiVersion,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	UID        types.UID `json:"uid,omitempty"`
+}
+
+type Status struct {
+	Token               string      `json:"token"`
+	ExpirationTimestamp metav1.Time `json:"expirationTimestamp"`
+}
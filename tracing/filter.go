@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"net/http"
+
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// Filter continues the trace of a request in the apiserver of a cluster, the storage operations of the request
+// become children of its span.  It must run after the request info is resolved.
+func Filter(clusterID string, handler http.Handler, mapper apirequest.RequestContextMapper) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx, ok := mapper.Get(req)
+		if !ok || FromContext(req.Context()) == nil {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		span := Start(req.Context(), "apiserver")
+		span.SetAttribute("netes.cluster", clusterID)
+		if requestInfo, ok := apirequest.RequestInfoFrom(ctx); ok {
+			span.SetAttribute("k8s.verb", requestInfo.Verb)
+			span.SetAttribute("k8s.resource", requestInfo.Resource)
+			span.SetAttribute("k8s.subresource", requestInfo.Subresource)
+			span.SetAttribute("k8s.namespace", requestInfo.Namespace)
+			span.SetAttribute("k8s.name", requestInfo.Name)
+		}
+		if user, ok := apirequest.UserFrom(ctx); ok {
+			span.SetAttribute("enduser.id", user.GetName())
+		}
+		defer span.End(nil)
+
+		mapper.Update(req, WithSpan(ctx, span))
+		handler.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,251 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	queueSize      = 4096
+	batchSize      = 512
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+)
+
+var droppedCounter = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "netes_tracing_dropped_spans_total",
+	Help: "Spans dropped because the collector couldn't keep up or failed",
+})
+
+func init() {
+	prometheus.MustRegister(droppedCounter)
+}
+
+// Tracer samples the traces of the requests to netes and exports their spans to an OpenTelemetry collector, as
+// OTLP over HTTP with JSON encoding.  A request with a traceparent header continues its trace and keeps its
+// sampling decision.
+type Tracer struct {
+	endpoint string
+	// math.Float64bits of the ratio, it changes when the config file is reloaded
+	sampleRatio uint64
+	client      *http.Client
+	spans       chan *Span
+}
+
+// New returns a tracer exporting to endpoint, like http://otel-collector:4318/v1/traces
+func New(endpoint string, sampleRatio float64) *Tracer {
+	return &Tracer{
+		endpoint:    endpoint,
+		sampleRatio: math.Float64bits(sampleRatio),
+		client:      &http.Client{Timeout: exportTimeout},
+		spans:       make(chan *Span, queueSize),
+	}
+}
+
+// SetSampleRatio changes the ratio of the requests without a trace that are sampled
+func (t *Tracer) SetSampleRatio(sampleRatio float64) {
+	if t != nil {
+		atomic.StoreUint64(&t.sampleRatio, math.Float64bits(sampleRatio))
+	}
+}
+
+func (t *Tracer) sample() bool {
+	return rand.Float64() < math.Float64frombits(atomic.LoadUint64(&t.sampleRatio))
+}
+
+// Start exports the ended spans in batches until ctx is done
+func (t *Tracer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(exportInterval)
+		defer ticker.Stop()
+
+		var batch []*Span
+		for {
+			select {
+			case <-ctx.Done():
+				for len(t.spans) > 0 {
+					batch = append(batch, <-t.spans)
+				}
+				t.post(batch)
+				return
+			case span := <-t.spans:
+				if batch = append(batch, span); len(batch) < batchSize {
+					continue
+				}
+			case <-ticker.C:
+			}
+			t.post(batch)
+			batch = nil
+		}
+	}()
+}
+
+// Root starts a trace for work outside of a request, like dialing through a tunnel, nil if the tracer is nil
+func (t *Tracer) Root(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	span := t.newSpan(name, kindClient, time.Now())
+	randomID(span.traceID[:])
+	span.sampled = t.sample()
+	return span
+}
+
+// Filter traces the requests to netes, the trace id is returned as X-Request-Id so a slow request can be looked
+// up.  Requests go on with the span in their context, the router, apiserver and storage add theirs to it.
+func (t *Tracer) Filter(handler http.Handler) http.Handler {
+	if t == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		span := t.newSpan("HTTP "+req.Method, kindServer, time.Now())
+		if traceID, parentID, sampled, ok := parseTraceparent(req.Header.Get(TraceparentHeader)); ok {
+			span.traceID, span.parentID, span.sampled = traceID, parentID, sampled
+		} else {
+			randomID(span.traceID[:])
+			span.sampled = t.sample()
+		}
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.target", req.URL.RequestURI())
+		span.SetAttribute("http.user_agent", req.UserAgent())
+		defer span.End(nil)
+
+		rw.Header().Set(RequestIDHeader, span.TraceID())
+		handler.ServeHTTP(rw, req.WithContext(WithSpan(req.Context(), span)))
+	})
+}
+
+func (t *Tracer) newSpan(name string, kind int, start time.Time) *Span {
+	span := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		start:      start,
+		attributes: map[string]string{},
+	}
+	randomID(span.spanID[:])
+	return span
+}
+
+func (t *Tracer) export(span *Span) {
+	select {
+	case t.spans <- span:
+	default:
+		droppedCounter.Inc()
+	}
+}
+
+func (t *Tracer) post(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	content, err := json.Marshal(encode(batch))
+	if err != nil {
+		logrus.Errorf("Failed to encode spans: %v", err)
+		droppedCounter.Add(float64(len(batch)))
+		return
+	}
+
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(content))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("collector returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		logrus.Errorf("Failed to export %d spans to %s: %v", len(batch), t.endpoint, err)
+		droppedCounter.Add(float64(len(batch)))
+	}
+}
+
+// the OTLP JSON encoding of spans, ids are hex and 64 bit integers strings
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            *otlpStatus     `json:"status,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+func encode(batch []*Span) *otlpRequest {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/rancher/netes"}}
+	for _, span := range batch {
+		span.Lock()
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.traceID[:]),
+			SpanID:            hex.EncodeToString(span.spanID[:]),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		}
+		if span.parentID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.parentID[:])
+		}
+		for key, value := range span.attributes {
+			s.Attributes = append(s.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+		}
+		if span.err != nil {
+			s.Status = &otlpStatus{Code: 2, Message: span.err.Error()}
+		}
+		span.Unlock()
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: "netes"}}},
+			},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	}
+}
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TraceparentHeader carries the trace of a request like W3C Trace Context, RequestIDHeader returns its trace id
+	TraceparentHeader = "traceparent"
+	RequestIDHeader   = "X-Request-Id"
+
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+)
+
+type spanKey struct{}
+
+// Span is an operation of a trace, spans of traces that are not sampled are only kept to propagate the trace.
+// The methods of a nil span do nothing, so callers don't need to check whether a request is traced.
+type Span struct {
+	sync.Mutex
+	tracer     *Tracer
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	sampled    bool
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+// WithSpan returns a context with the span, the operations started with it become its children
+func WithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span of a context, nil if it is not traced
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a child of the span of ctx, nil if ctx is not traced
+func Start(ctx context.Context, name string) *Span {
+	return StartAt(ctx, name, time.Now())
+}
+
+// StartAt starts a child of the span of ctx that started at start, for operations that are timed anyway
+func StartAt(ctx context.Context, name string, start time.Time) *Span {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	span := parent.tracer.newSpan(name, kindInternal, start)
+	span.traceID = parent.traceID
+	span.parentID = parent.spanID
+	span.sampled = parent.sampled
+	return span
+}
+
+// Inject sets the traceparent header of a request netes sends on, like to another replica, so the trace continues
+// there
+func Inject(req *http.Request) {
+	if span := FromContext(req.Context()); span != nil {
+		req.Header.Set(TraceparentHeader, span.traceparent())
+	}
+}
+
+// TraceID is the hex trace id, returned to clients as request id
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	s.attributes[key] = value
+	s.Unlock()
+}
+
+// End finishes the span, failed with err if it is not nil, and exports it if its trace is sampled
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	s.end = time.Now()
+	s.err = err
+	s.Unlock()
+	if s.sampled {
+		s.tracer.export(s)
+	}
+}
+
+func (s *Span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]), flags)
+}
+
+// parseTraceparent reads the trace id, parent span id and sampled flag of a traceparent header
+func parseTraceparent(value string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		// ids only need to be unique, not secret
+		now := time.Now().UnixNano()
+		for i := range id {
+			id[i] = byte(now >> uint(8*(i%8)))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Agent runs on a node and keeps a tunnel session to netes open, dialing the connections netes asks for
+type Agent struct {
+	URL       string
+	Node      string
+	Addresses []string
+	Header    http.Header
+	Dialer    func(network, address string) (net.Conn, error)
+}
+
+// Run connects until ctx is done, reconnecting with backoff when the session fails
+func (a *Agent) Run(ctx context.Context) {
+	dialer := a.Dialer
+	if dialer == nil {
+		d := &net.Dialer{Timeout: dialTimeout}
+		dialer = d.Dial
+	}
+
+	backoff := minBackoff
+	for {
+		start := time.Now()
+		err := a.connect(ctx, dialer)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) > maxBackoff {
+			backoff = minBackoff
+		}
+		logrus.Errorf("Tunnel to %s failed, reconnecting in %v: %v", a.URL, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (a *Agent) connect(ctx context.Context, dialer func(network, address string) (net.Conn, error)) error {
+	header := http.Header{}
+	for k, v := range a.Header {
+		header[k] = v
+	}
+	header.Set(NodeHeader, a.Node)
+	for _, address := range a.Addresses {
+		header.Add(AddressHeader, address)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(a.URL, header)
+	if err != nil {
+		return err
+	}
+
+	session := newSession(ws, dialer)
+	session.node = a.Node
+	logrus.Infof("Tunnel to %s connected", a.URL)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go session.keepAlive(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.close(ctx.Err())
+		case <-stop:
+		}
+	}()
+
+	return session.serve()
+}
@@ -0,0 +1,293 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// data of a connection is buffered up to this size, a connection whose reader falls further behind is closed
+	// instead of blocking all the others of the session
+	maxBuffer = 4 * 1024 * 1024
+	// data is written to the websocket in messages of at most this size
+	maxPayload = 32 * 1024
+)
+
+var errBufferFull = errors.New("tunnel connection buffer full")
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// conn is a connection multiplexed over a session
+type conn struct {
+	sync.Mutex
+	cond    *sync.Cond
+	session *session
+	id      uint64
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	dialErr   error
+
+	buf          []byte
+	err          error
+	closed       bool
+	readEOF      bool
+	readDeadline time.Time
+	readTimer    *time.Timer
+
+	writeClosed   bool
+	writeDeadline time.Time
+}
+
+func newConn(s *session, id uint64) *conn {
+	c := &conn{
+		session: s,
+		id:      id,
+		ready:   make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.Mutex)
+	return c
+}
+
+func (c *conn) setConnected(err error) {
+	c.readyOnce.Do(func() {
+		c.dialErr = err
+		close(c.ready)
+	})
+}
+
+func (c *conn) connectErr() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.dialErr != nil {
+		return c.dialErr
+	}
+	if c.err != nil && c.err != io.EOF {
+		return c.err
+	}
+	return nil
+}
+
+func (c *conn) deliver(payload []byte) {
+	c.Lock()
+	if c.closed || c.err != nil {
+		c.Unlock()
+		return
+	}
+	if len(c.buf)+len(payload) > maxBuffer {
+		c.Unlock()
+		c.closeWithError(errBufferFull)
+		return
+	}
+	c.buf = append(c.buf, payload...)
+	c.cond.Broadcast()
+	c.Unlock()
+}
+
+// remoteClose ends the connection after the other side closed it, buffered data can still be read
+func (c *conn) remoteClose(err error) {
+	c.session.remove(c.id)
+	c.setConnected(err)
+
+	c.Lock()
+	if err == nil {
+		err = io.EOF
+	}
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+	c.Unlock()
+}
+
+// remoteCloseWrite ends reading once the buffered data is read, writes still reach the other side
+func (c *conn) remoteCloseWrite() {
+	c.Lock()
+	c.readEOF = true
+	c.cond.Broadcast()
+	c.Unlock()
+}
+
+// CloseWrite half-closes the connection like TCP, the other side reads EOF but can still send
+func (c *conn) CloseWrite() error {
+	c.Lock()
+	if c.closed || c.err != nil || c.writeClosed {
+		c.Unlock()
+		return nil
+	}
+	c.writeClosed = true
+	c.Unlock()
+
+	return c.session.write(&message{connID: c.id, typ: closeWrite}, time.Time{})
+}
+
+// closeWithError closes the connection and tells the other side why
+func (c *conn) closeWithError(err error) error {
+	c.session.remove(c.id)
+	c.setConnected(err)
+
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return nil
+	}
+	c.closed = true
+	remoteClosed := c.err != nil
+	if c.err == nil {
+		c.err = err
+	}
+	c.buf = nil
+	c.cond.Broadcast()
+	c.Unlock()
+
+	if remoteClosed {
+		return nil
+	}
+	var payload []byte
+	if err != nil && err != io.EOF {
+		payload = []byte(err.Error())
+	}
+	return c.session.write(&message{connID: c.id, typ: closed, payload: payload}, time.Time{})
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	for len(c.buf) == 0 {
+		switch {
+		case c.closed:
+			return 0, errors.New("use of closed tunnel connection")
+		case c.err != nil:
+			return 0, c.err
+		case c.readEOF:
+			return 0, io.EOF
+		case !c.readDeadline.IsZero() && !time.Now().Before(c.readDeadline):
+			return 0, timeoutError{}
+		}
+		c.cond.Wait()
+	}
+
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	if len(c.buf) == 0 {
+		c.buf = nil
+	}
+	return n, nil
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		c.Lock()
+		closed, err, deadline := c.closed || c.writeClosed, c.err, c.writeDeadline
+		c.Unlock()
+		if closed {
+			return written, errors.New("use of closed tunnel connection")
+		}
+		if err != nil {
+			return written, err
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return written, timeoutError{}
+		}
+
+		n := len(b)
+		if n > maxPayload {
+			n = maxPayload
+		}
+		if err := c.session.write(&message{connID: c.id, typ: data, payload: b[:n]}, deadline); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (c *conn) Close() error {
+	return c.closeWithError(nil)
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.session.ws.LocalAddr()
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.session.ws.RemoteAddr()
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.readDeadline = t
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+		c.readTimer = nil
+	}
+	if !t.IsZero() {
+		c.readTimer = time.AfterFunc(time.Until(t), func() {
+			c.Lock()
+			c.cond.Broadcast()
+			c.Unlock()
+		})
+	}
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.Lock()
+	c.writeDeadline = t
+	c.Unlock()
+	return nil
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies between a connection of the tunnel and the connection dialed for it.  EOF of one direction is
+// passed on as a half-close, so the other can still finish, streams of exec and port-forward rely on it.  Both
+// are closed once both directions are done or either fails.
+func pipe(c *conn, target net.Conn) {
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(c, target)
+		if err == nil {
+			err = c.CloseWrite()
+		}
+		done <- err
+	}()
+	go func() {
+		_, err := io.Copy(target, c)
+		if err == nil {
+			if cw, ok := target.(closeWriter); ok {
+				err = cw.CloseWrite()
+			} else {
+				// can't be half-closed, end both directions
+				err = io.EOF
+			}
+		}
+		done <- err
+	}()
+
+	var err error
+	for i := 0; i < 2 && err == nil; i++ {
+		err = <-done
+	}
+	target.Close()
+	c.closeWithError(err)
+}
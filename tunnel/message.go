@@ -0,0 +1,49 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type messageType byte
+
+const (
+	// connect asks the agent to dial the address in the payload, like "tcp,10.42.0.5:10250"
+	connect messageType = iota + 1
+	// connected tells the netes side the dial succeeded
+	connected
+	data
+	// closed ends a connection, with the error as payload or empty for EOF
+	closed
+	// closeWrite is EOF for the reader of one side of a connection, the other side can still send
+	closeWrite
+)
+
+// message is a frame of one of the connections multiplexed over the websocket of a session.  It is encoded as a
+// binary websocket message of the varint connection id, the type and the payload.
+type message struct {
+	connID  uint64
+	typ     messageType
+	payload []byte
+}
+
+func (m *message) encode() []byte {
+	buf := make([]byte, binary.MaxVarintLen64+1+len(m.payload))
+	n := binary.PutUvarint(buf, m.connID)
+	buf[n] = byte(m.typ)
+	n++
+	n += copy(buf[n:], m.payload)
+	return buf[:n]
+}
+
+func decode(buf []byte) (*message, error) {
+	connID, n := binary.Uvarint(buf)
+	if n <= 0 || len(buf) <= n {
+		return nil, fmt.Errorf("invalid tunnel message")
+	}
+	return &message{
+		connID:  connID,
+		typ:     messageType(buf[n]),
+		payload: buf[n+1:],
+	}, nil
+}
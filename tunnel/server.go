@@ -0,0 +1,163 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+	"github.com/rancher/netes/tracing"
+)
+
+const (
+	// NodeHeader and AddressHeader identify the node of an agent and the addresses connections to it are for
+	NodeHeader    = "X-Netes-Node"
+	AddressHeader = "X-Netes-Address"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  maxPayload,
+	WriteBufferSize: maxPayload,
+}
+
+// Server keeps the tunnel sessions agents opened by cluster, so the apiserver of a cluster can reach kubelets
+// that can't be reached directly, like the ones behind NAT
+type Server struct {
+	sync.Mutex
+	sessions map[string][]*session
+	tracer   *tracing.Tracer
+}
+
+// NewServer returns a tunnel server, dials through the tunnels are traced with tracer if it is not nil.  Dials
+// don't get the context of the request they are for, so they start their own traces.
+func NewServer(tracer *tracing.Tracer) *Server {
+	return &Server{
+		sessions: map[string][]*session{},
+		tracer:   tracer,
+	}
+}
+
+// Serve upgrades the request of an agent of the cluster, that was already authenticated, to a tunnel session
+// and serves it until the agent disconnects
+func (s *Server) Serve(rw http.ResponseWriter, req *http.Request, clusterID string) {
+	node := req.Header.Get(NodeHeader)
+	if node == "" {
+		http.Error(rw, fmt.Sprintf("missing %s header", NodeHeader), http.StatusBadRequest)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		logrus.Errorf("Failed to upgrade tunnel of node %s of cluster %s: %v", node, clusterID, err)
+		return
+	}
+
+	session := newSession(ws, nil)
+	session.node = node
+	for _, address := range req.Header[AddressHeader] {
+		session.addresses = append(session.addresses, strings.Split(address, ",")...)
+	}
+
+	s.add(clusterID, session)
+	defer s.remove(clusterID, session)
+
+	logrus.Infof("Tunnel of node %s of cluster %s connected from %s", node, clusterID, req.RemoteAddr)
+	stop := make(chan struct{})
+	go session.keepAlive(stop)
+	err = session.serve()
+	close(stop)
+	logrus.Infof("Tunnel of node %s of cluster %s disconnected: %v", node, clusterID, err)
+}
+
+func (s *Server) add(clusterID string, added *session) {
+	s.Lock()
+	defer s.Unlock()
+
+	// a reconnecting agent replaces its previous session
+	var remaining []*session
+	for _, existing := range s.sessions[clusterID] {
+		if existing.node == added.node {
+			go existing.close(errSessionClosed)
+			continue
+		}
+		remaining = append(remaining, existing)
+	}
+	s.sessions[clusterID] = append(remaining, added)
+}
+
+func (s *Server) remove(clusterID string, removed *session) {
+	s.Lock()
+	defer s.Unlock()
+
+	var remaining []*session
+	for _, existing := range s.sessions[clusterID] {
+		if existing != removed {
+			remaining = append(remaining, existing)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(s.sessions, clusterID)
+	} else {
+		s.sessions[clusterID] = remaining
+	}
+}
+
+// Connected returns the nodes of the cluster that have a tunnel
+func (s *Server) Connected(clusterID string) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	var nodes []string
+	for _, session := range s.sessions[clusterID] {
+		nodes = append(nodes, session.node)
+	}
+	return nodes
+}
+
+// Dialer dials through the tunnel of the node an address belongs to, or of any node of the cluster, and falls
+// back to fallback when no agent of the cluster is connected
+func (s *Server) Dialer(clusterID string, fallback func(network, addr string) (net.Conn, error)) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		session := s.session(clusterID, addr)
+		if session == nil {
+			return fallback(network, addr)
+		}
+
+		span := s.tracer.Root("tunnel.dial")
+		span.SetAttribute("netes.cluster", clusterID)
+		span.SetAttribute("netes.node", session.node)
+		span.SetAttribute("net.peer.name", addr)
+		conn, err := session.dial(network, addr)
+		span.End(err)
+		return conn, err
+	}
+}
+
+func (s *Server) session(clusterID, addr string) *session {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	sessions := s.sessions[clusterID]
+	for _, session := range sessions {
+		if session.node == host {
+			return session
+		}
+		for _, address := range session.addresses {
+			if address == host {
+				return session
+			}
+		}
+	}
+	if len(sessions) > 0 {
+		return sessions[0]
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	pingInterval = 30 * time.Second
+	// the session is dead if nothing, not even a ping or pong, was read for this long
+	readTimeout  = 3 * pingInterval
+	writeTimeout = 30 * time.Second
+	dialTimeout  = 30 * time.Second
+)
+
+var errSessionClosed = errors.New("tunnel session closed")
+
+// session multiplexes connections over the websocket of an agent.  netes opens connections with dial, the agent
+// dials what netes asks for with its dialer.
+type session struct {
+	sync.Mutex
+	ws        *websocket.Conn
+	writeLock sync.Mutex
+	dialer    func(network, address string) (net.Conn, error)
+	conns     map[uint64]*conn
+	nextID    uint64
+	closed    bool
+
+	// the node of the agent and its addresses, to prefer it for connections to those
+	node      string
+	addresses []string
+}
+
+func newSession(ws *websocket.Conn, dialer func(network, address string) (net.Conn, error)) *session {
+	return &session{
+		ws:     ws,
+		dialer: dialer,
+		conns:  map[uint64]*conn{},
+	}
+}
+
+// serve reads the messages of the session until its websocket fails, then closes all its connections
+func (s *session) serve() error {
+	s.ws.SetReadDeadline(time.Now().Add(readTimeout))
+	s.ws.SetPongHandler(func(string) error {
+		return s.ws.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	s.ws.SetPingHandler(func(data string) error {
+		s.ws.SetReadDeadline(time.Now().Add(readTimeout))
+		return s.ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeTimeout))
+	})
+
+	for {
+		typ, buf, err := s.ws.ReadMessage()
+		if err != nil {
+			s.close(err)
+			return err
+		}
+		s.ws.SetReadDeadline(time.Now().Add(readTimeout))
+		if typ != websocket.BinaryMessage {
+			continue
+		}
+
+		m, err := decode(buf)
+		if err != nil {
+			s.close(err)
+			return err
+		}
+		s.handle(m)
+	}
+}
+
+// keepAlive pings the other side so idle sessions are not dropped by proxies and dead ones are noticed
+func (s *session) keepAlive(stop <-chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				logrus.Debugf("Failed to ping tunnel session of %s: %v", s.node, err)
+			}
+		}
+	}
+}
+
+func (s *session) handle(m *message) {
+	if m.typ == connect {
+		s.accept(m)
+		return
+	}
+
+	s.Lock()
+	c, ok := s.conns[m.connID]
+	s.Unlock()
+	if !ok {
+		if m.typ != closed {
+			s.write(&message{connID: m.connID, typ: closed, payload: []byte("unknown connection")}, time.Time{})
+		}
+		return
+	}
+
+	switch m.typ {
+	case connected:
+		c.setConnected(nil)
+	case data:
+		c.deliver(m.payload)
+	case closed:
+		var err error
+		if len(m.payload) > 0 {
+			err = errors.New(string(m.payload))
+		}
+		c.remoteClose(err)
+	case closeWrite:
+		c.remoteCloseWrite()
+	}
+}
+
+// accept dials for a connect message of netes and copies between the dialed connection and the tunnel
+func (s *session) accept(m *message) {
+	c := s.register(m.connID)
+	if c == nil {
+		return
+	}
+	if s.dialer == nil {
+		c.closeWithError(errors.New("connections can only be opened by netes"))
+		return
+	}
+
+	parts := strings.SplitN(string(m.payload), ",", 2)
+	if len(parts) != 2 {
+		c.closeWithError(fmt.Errorf("invalid connect %q", m.payload))
+		return
+	}
+
+	go func() {
+		target, err := s.dialer(parts[0], parts[1])
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+		if err := s.write(&message{connID: c.id, typ: connected}, time.Time{}); err != nil {
+			target.Close()
+			c.Close()
+			return
+		}
+		pipe(c, target)
+	}()
+}
+
+// dial opens a connection through the agent
+func (s *session) dial(network, address string) (net.Conn, error) {
+	c := s.register(atomic.AddUint64(&s.nextID, 1))
+	if c == nil {
+		return nil, errSessionClosed
+	}
+
+	if err := s.write(&message{connID: c.id, typ: connect, payload: []byte(network + "," + address)}, time.Time{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	select {
+	case <-c.ready:
+	case <-time.After(dialTimeout):
+		c.Close()
+		return nil, fmt.Errorf("timeout dialing %s through the tunnel of %s", address, s.node)
+	}
+
+	if err := c.connectErr(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *session) register(id uint64) *conn {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return nil
+	}
+	c := newConn(s, id)
+	s.conns[id] = c
+	return c
+}
+
+func (s *session) remove(id uint64) {
+	s.Lock()
+	delete(s.conns, id)
+	s.Unlock()
+}
+
+func (s *session) write(m *message, deadline time.Time) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	if deadline.IsZero() {
+		deadline = time.Now().Add(writeTimeout)
+	}
+	s.ws.SetWriteDeadline(deadline)
+	return s.ws.WriteMessage(websocket.BinaryMessage, m.encode())
+}
+
+func (s *session) close(err error) {
+	s.Lock()
+	conns := s.conns
+	s.conns = map[uint64]*conn{}
+	s.closed = true
+	s.Unlock()
+
+	for _, c := range conns {
+		c.remoteClose(errSessionClosed)
+	}
+	s.ws.Close()
+}
@@ -1,17 +1,260 @@
 package types
 
-import "github.com/rancher/netes/cluster"
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rancher/netes/authcache"
+	"github.com/rancher/netes/budget"
+	"github.com/rancher/netes/cluster"
+	"github.com/rancher/netes/configfile"
+	"github.com/rancher/netes/deprecation"
+	"github.com/rancher/netes/events"
+	"github.com/rancher/netes/rancher"
+	"github.com/rancher/netes/replication"
+	"github.com/rancher/netes/shard"
+	"github.com/rancher/netes/tracing"
+	"github.com/rancher/netes/tunnel"
+	"github.com/rancher/netes/usage"
+)
 
 type GlobalConfig struct {
-	Dialect    string
-	DSN        string
-	CattleURL  string
-	ListenAddr string
+	// The settings ConfigFile can change while netes runs are read and written with Reloading held: the log
+	// level, the tracing sample ratio, and the access log, limits and budgets of the servers started afterwards.
+	// The others take a restart.
+	Reloading  sync.RWMutex
+	ConfigFile *configfile.File
+	LogLevel   string
+
+	Dialect   string
+	DSN       string
+	ShardDSNs []string
+
+	CoalesceWindow    time.Duration
+	CoalesceResources []string
+
+	Audit       bool
+	MutationLog bool
+	// Entries of the mutation log older than this are deleted, standbys that fall further behind must resync
+	MutationLogRetention time.Duration
+
+	WatchPollInterval  time.Duration
+	WatchPollJitter    time.Duration
+	WatchPollIntervals map[string]time.Duration
+	// Identical JSON watches of a cluster share one watch of its apiserver, see fanin.Hub
+	WatchFanIn bool
+
+	CattleURL       string
+	CattleAccessKey string
+	CattleSecretKey string
+	ListenAddr      string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSCAFile       string
+	// Clusters are also served at <cluster name or id>.<ClusterDomain> for clients that can't handle a path in
+	// the server URL, with the certificate <cluster>.crt and <cluster>.key of ClusterCertDir if there is one
+	ClusterDomain  string
+	ClusterCertDir string
+	// Certificates of the cluster hosts without one in ClusterCertDir are obtained from the ACME directory, like
+	// https://acme-v02.api.letsencrypt.org/directory, if set.  It needs netes to terminate TLS on port 443.
+	ACMEDirectoryURL string
+	ACMEEmail        string
+
+	AdminListenAddr string
+	AdminToken      string
+	// The admin gRPC API for orchestrators managing clusters, empty disables it.  It takes the same token, without
+	// one it only listens on loopback addresses.
+	AdminGRPCListenAddr string
 
 	AdmissionControllers []string
 	ServiceNetCidr       string
 
-	Lookup *cluster.Lookup
+	// How the control plane dials webhooks, kubelets, aggregated APIs and services of clusters, like "tunnel",
+	// "rancher", "direct" or "http-connect" to a proxy at EgressAddress, see the proxy package.  Clusters can set
+	// their own in Rancher.
+	Egress        string
+	EgressAddress string
+
+	// The HTTP(S) proxy and extra CAs of the calls made on behalf of clusters to services outside of them, like
+	// their authentication, audit and image verification webhooks and OIDC issuers, see proxy.OutboundTransport.
+	// Clusters can set their own in Rancher.
+	OutboundProxy  string
+	OutboundCAFile string
+
+	// Zero keeps the upstream apiserver defaults
+	MaxRequestsInflight         int64
+	MaxMutatingRequestsInflight int64
+	MinRequestTimeout           int64
+	// How long requests over the in-flight limits wait for a slot before they are rejected, zero rejects
+	// them right away
+	RequestQueueTimeout time.Duration
+
+	// Zero disables the object count quotas
+	MaxObjectsPerNamespace int64
+	MaxObjectsPerCluster   int64
+
+	// Name of a registered image verifier and its configuration, empty disables image verification
+	ImageVerifier       string
+	ImageVerifierConfig string
+
+	// The pod security level enforced on the pods of clusters, privileged, baseline or restricted, except in the
+	// exempt namespaces.  Empty is privileged, clusters can set their own in Rancher or get one from their template.
+	PodSecurityLevel            string
+	PodSecurityExemptNamespaces []string
+
+	// Taints like key=value:NoSchedule of the hosts dedicated to kube-system pods and the node selector like
+	// key=value of those hosts
+	SystemTaints       []string
+	SystemNodeSelector []string
+
+	DrainTimeout time.Duration
+	DrainForce   bool
+
+	// How long in flight requests, watches and exec sessions get to complete when netes is stopped
+	ShutdownTimeout time.Duration
+
+	NamespaceDeleteWindow time.Duration
+
+	// Authorize the users Rancher authenticates by their roles in the projects of the cluster instead of letting
+	// them do anything
+	RancherAuthorization bool
+	// Keep the namespaces of clusters in their Rancher projects, creating namespaces of new projects and deleting
+	// the ones of removed projects, see the projects package
+	ProjectNamespaces bool
+
+	// Issuer of the service account tokens of TokenRequest, tokens are accepted with it as audience.  Zero
+	// ServiceAccountMaxTokenExpiration lets clients ask for any expiration.
+	ServiceAccountIssuer             string
+	ServiceAccountMaxTokenExpiration time.Duration
+
+	// Schedule the pods of every cluster in netes instead of a kube-scheduler deployed per cluster
+	EmbeddedScheduler bool
+
+	// Resources mirrored into Rancher as read-only generic objects, empty disables the export
+	ExportResources []string
+
+	// Audit policy of the clusters, events go to the log file, "-" for stdout, and to the webhook of the
+	// kubeconfig file.  Clusters with an audit policy or webhook kubeconfig set in Rancher use those instead, and
+	// an audit policy set through the admin API over both.
+	AuditPolicyFile        string
+	AuditLogPath           string
+	AuditWebhookConfigFile string
+
+	// JSON access log of the requests to the clusters, "-" for stdout, empty disables it.  Clusters log unless
+	// AccessLogByDefault is false, clusters can enable or disable it and set their sample ratio in Rancher.
+	AccessLogPath        string
+	AccessLogByDefault   bool
+	AccessLogSampleRatio float64
+
+	// With AnonymousAuth requests without credentials are served as system:anonymous, with InsecureLocalhost the
+	// ones from localhost as an admin like the insecure port of upstream, clusters can set either in Rancher.
+	// Anyone who gets through authentication can GET AlwaysAllowPaths, anonymous users nothing else.
+	AnonymousAuth     bool
+	InsecureLocalhost bool
+	AlwaysAllowPaths  []string
+
+	// Authenticators of the clusters in order, like rancher, client-cert, oidc, webhook and auth-proxy.  Clusters
+	// with a chain set in Rancher use it instead, with the client CA, OIDC issuer and webhook kubeconfig it needs.
+	AuthenticationChain []string
+
+	// Directory of the manifests applied to clusters when they first start and again when a server of the
+	// cluster starts with changed manifests, clusters with bootstrap manifests set in Rancher use those instead
+	BootstrapManifestsDir string
+
+	// Volumes of the default StorageClass of clusters are created through the openstorage volume API of
+	// OpenStorageDriver at OpenStorageEndpoint, the unix socket of the driver if empty, classes can pick another
+	// driver like nfs.  Clusters get it if OpenStorageByDefault is set, clusters can enable or disable it and set
+	// their endpoint in Rancher.
+	OpenStorageEndpoint  string
+	OpenStorageDriver    string
+	OpenStorageByDefault bool
+
+	// Directory of the templates new clusters can be created from, see the templates package
+	ClusterTemplatesDir string
+
+	// Replicate ReplicationTargets from the admin API of the primary netes at ReplicationSource
+	ReplicationSource      string
+	ReplicationSourceToken string
+	ReplicationTargets     []string
+
+	// Like --runtime-config, clusters can override the entries.  Feature gates are shared by all clusters of the
+	// process, clusters can't change them.
+	RuntimeConfig []string
+	FeatureGates  []string
+
+	// Budgets of the hosted apiservers sharing the process, new watches over MaxWatchesPerCluster are rejected and
+	// clusters with more than MaxGoroutinesPerCluster shed load until they are restarted
+	MaxWatchesPerCluster    int64
+	MaxGoroutinesPerCluster int64
+
+	// Servers without requests for IdleTimeout are stopped, servers start on the first request of their cluster
+	// rather than with netes.  Controllers only act on running servers.
+	IdleTimeout time.Duration
+
+	// Replicas sharing a database with ReplicaAddress set share the clusters, each serves the clusters it holds
+	// the lease of and forwards requests for the others
+	ReplicaID      string
+	ReplicaAddress string
+	LeaseDuration  time.Duration
+	// Replicas all serving every cluster elect the one running the controllers that must run only once
+	LeaderElection bool
+
+	// Proxies in front of netes, like load balancers and the other replicas, the X-Forwarded-For header of their
+	// requests gives the source checked against the allowed source ranges of clusters, X-Forwarded-Proto and
+	// X-Forwarded-Host the server URL of kubeconfigs
+	TrustedProxies []string
+
+	// Where cluster backups are stored, like file:///var/lib/netes/backups or s3://bucket/prefix?region=eu-west-1
+	BackupTarget string
+
+	// What is stored for clusters removed from Rancher is deleted this long after the removal, negative keeps it
+	ClusterGCDelay time.Duration
+
+	// The health, version and nodes of the running clusters are pushed to their Rancher cluster this often, zero
+	// disables it
+	HeartbeatInterval time.Duration
+
+	// The apiserver of a cluster failing its health check this long while its storage is fine is restarted, with
+	// backoff, zero disables it
+	UnhealthyRestartTimeout time.Duration
+
+	// Authentication and authorization results from Rancher are cached this long, failures for
+	// AuthNegativeCacheTTL.  Changes of API keys, projects and their members drop them earlier.
+	AuthCacheTTL         time.Duration
+	AuthNegativeCacheTTL time.Duration
+	// Successful authentications keep being used this long while Rancher is unreachable, zero fails the requests
+	// that aren't cached instead
+	AuthOfflineTTL time.Duration
+
+	// OTLP over HTTP endpoint spans are exported to, empty disables tracing.  Requests without a trace are sampled
+	// at TracingSampleRatio, from 0 to 1.
+	TracingEndpoint    string
+	TracingSampleRatio float64
+
+	// Sinks the control plane events are sent to, like cluster creations and apiserver restarts, see the events
+	// package
+	EventSinks []string
+
+	// RancherRetryMaxElapsed is how long the requests to Rancher failing because it is briefly unavailable are
+	// retried, before it is considered unreachable.  Zero doesn't retry.
+	RancherRetryMaxElapsed time.Duration
+
+	Lookup        *cluster.Lookup
+	RancherClient *rancher.Client
+	// RancherTransport is used for all requests to Rancher, tests use it to inject faults
+	RancherTransport http.RoundTripper
+	Usage            *usage.Tracker
+	Deprecations     *deprecation.Tracker
+	Replication      *replication.Replicator
+	// Tunnels of the node agents, kubelets are dialed through them when their cluster has one
+	Tunnels *tunnel.Server
+	Shards  *shard.Coordinator
+	Budgets *budget.Tracker
+	Tracer  *tracing.Tracer
+	Events  *events.Stream
+	// AuthCache drops cached authentication and authorization results on changes in Rancher
+	AuthCache *authcache.Invalidator
 }
 
 func FirstNotEmpty(left, right string) string {
@@ -21,6 +264,13 @@ func FirstNotEmpty(left, right string) string {
 	return right
 }
 
+func FirstNotZero(left, right int64) int64 {
+	if left != 0 {
+		return left
+	}
+	return right
+}
+
 func FirstNotLenZero(left, right []string) []string {
 	if len(left) > 0 {
 		return left
@@ -0,0 +1,134 @@
+package usage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher/k8s-sql/kv"
+	"golang.org/x/net/context"
+)
+
+const refreshInterval = 5 * time.Minute
+
+var (
+	rowsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_storage_rows",
+		Help: "Number of rows stored per cluster and resource",
+	}, []string{"cluster", "resource"})
+	bytesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "netes_storage_bytes",
+		Help: "Total size of the values stored per cluster and resource",
+	}, []string{"cluster", "resource"})
+)
+
+func init() {
+	prometheus.MustRegister(rowsGauge)
+	prometheus.MustRegister(bytesGauge)
+}
+
+type Resource struct {
+	Cluster  string    `json:"cluster"`
+	Resource string    `json:"resource"`
+	Prefix   string    `json:"prefix"`
+	Rows     int64     `json:"rows"`
+	Bytes    int64     `json:"bytes"`
+	Updated  time.Time `json:"updated,omitempty"`
+}
+
+// Tracker periodically computes the number of rows and bytes stored under every tracked resource prefix
+type Tracker struct {
+	sync.Mutex
+	client    kv.Client
+	resources map[string]*Resource
+}
+
+func New(client kv.Client) *Tracker {
+	return &Tracker{
+		client:    client,
+		resources: map[string]*Resource{},
+	}
+}
+
+func (t *Tracker) Track(cluster, resource, prefix string) {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.resources[prefix]; !ok {
+		t.resources[prefix] = &Resource{
+			Cluster:  cluster,
+			Resource: resource,
+			Prefix:   prefix,
+		}
+	}
+}
+
+func (t *Tracker) List() []Resource {
+	t.Lock()
+	defer t.Unlock()
+
+	var result []Resource
+	for _, r := range t.resources {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Prefix < result[j].Prefix
+	})
+	return result
+}
+
+// ListCluster returns the resources of a cluster
+func (t *Tracker) ListCluster(cluster string) []Resource {
+	var result []Resource
+	for _, r := range t.List() {
+		if r.Cluster == cluster {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func (t *Tracker) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(refreshInterval):
+				t.refresh(ctx)
+			}
+		}
+	}()
+}
+
+func (t *Tracker) refresh(ctx context.Context) {
+	for _, r := range t.List() {
+		stats, err := t.stats(ctx, r.Prefix)
+		if err != nil {
+			logrus.Errorf("Failed to compute storage usage of %s: %v", r.Prefix, err)
+			continue
+		}
+
+		rowsGauge.WithLabelValues(r.Cluster, r.Resource).Set(float64(stats.Count))
+		bytesGauge.WithLabelValues(r.Cluster, r.Resource).Set(float64(stats.Bytes))
+
+		t.Lock()
+		if resource, ok := t.resources[r.Prefix]; ok {
+			resource.Rows = stats.Count
+			resource.Bytes = stats.Bytes
+			resource.Updated = time.Now()
+		}
+		t.Unlock()
+	}
+}
+
+func (t *Tracker) stats(ctx context.Context, prefix string) (kv.Stats, error) {
+	if reader, ok := t.client.(kv.StatsReader); ok {
+		return reader.Stats(ctx, prefix)
+	}
+
+	kvs, err := t.client.List(ctx, prefix)
+	return kv.StatsOf(kvs), err
+}